@@ -22,7 +22,7 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/rexray/gocsi"
+	"github.com/dell/gocsi"
 	csiconfig "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/config"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/provider"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service"
@@ -18,6 +18,7 @@ package volume
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -70,6 +71,13 @@ type Manager interface {
 	// should not be nil.
 	AttachVolume(ctx context.Context, vm *cnsvsphere.VirtualMachine,
 		volumeID string, checkNVMeController bool) (string, string, error)
+	// BatchAttachVolumes attaches the given volumes to a virtual machine using a
+	// single CNS AttachVolume task. The per volume outcome is returned in the
+	// map keyed by volumeID. When the CNS task itself failed, the second return
+	// value (faultType) and third return value(error) need to be set, and should
+	// not be nil.
+	BatchAttachVolumes(ctx context.Context, vm *cnsvsphere.VirtualMachine,
+		volumeIDs []string, checkNVMeController bool) (map[string]*CnsAttachResult, string, error)
 	// DetachVolume detaches a volume from the virtual machine given the spec.
 	// When DetachVolume failed, the first return value (faultType) and second return value(error) need to be set, and
 	// should not be nil.
@@ -97,6 +105,12 @@ type Manager interface {
 	QueryVolume(ctx context.Context, queryFilter cnstypes.CnsQueryFilter) (*cnstypes.CnsQueryResult, error)
 	// RelocateVolume migrates volumes to their target datastore as specified in relocateSpecList.
 	RelocateVolume(ctx context.Context, relocateSpecList ...cnstypes.BaseCnsVolumeRelocateSpec) (*object.Task, error)
+	// UpdateVolumeStoragePolicy reconfigures the storage policy of a volume on
+	// the datastore it currently resides on.
+	// When UpdateVolumeStoragePolicy failed, the first return value (faultType) and second return value(error) need
+	// to be set, and should not be nil.
+	UpdateVolumeStoragePolicy(ctx context.Context, volumeID string, datastore vim25types.ManagedObjectReference,
+		storagePolicyID string) (string, error)
 	// ExpandVolume expands a volume to a new size.
 	// When ExpandVolume failed, the first return value (faultType) and second return value(error) need to be set, and
 	// should not be nil.
@@ -122,6 +136,16 @@ type Manager interface {
 type CnsVolumeInfo struct {
 	DatastoreURL string
 	VolumeID     cnstypes.CnsVolumeId
+	// TaskID is the moid of the CNS task which created the volume, if known.
+	TaskID string
+}
+
+// CnsAttachResult holds the outcome of attaching a single volume as part of
+// a batch attach operation.
+type CnsAttachResult struct {
+	DiskUUID  string
+	FaultType string
+	Err       error
 }
 
 type CnsSnapshotInfo struct {
@@ -146,6 +170,10 @@ var (
 	snapshotTaskMapLock sync.Mutex
 	// Alias for CreateVolumeOperationRequestDetails function declaration.
 	createRequestDetails = cnsvolumeoperationrequest.CreateVolumeOperationRequestDetails
+	// ErrOperationStoreUnavailable is returned by CreateVolume when the volume
+	// operation store cannot be reached and the manager is configured to fail
+	// instead of proceeding without recording the operation.
+	ErrOperationStoreUnavailable = errors.New("volume operation store is unavailable")
 )
 
 // createSnapshotTaskDetails has the same structure as createVolumeTaskDetails
@@ -159,10 +187,26 @@ type createVolumeTaskDetails struct {
 	expirationTime time.Time
 }
 
+// ManagerOptions holds the optional settings of the Manager instance.
+type ManagerOptions struct {
+	// FailOnOperationStoreUnavailable makes CreateVolume fail with
+	// ErrOperationStoreUnavailable instead of invoking CNS when the operation
+	// store cannot be reached.
+	FailOnOperationStoreUnavailable bool
+}
+
 // GetManager returns the Manager instance.
 func GetManager(ctx context.Context, vc *cnsvsphere.VirtualCenter,
 	operationStore cnsvolumeoperationrequest.VolumeOperationRequest,
 	idempotencyHandlingEnabled bool) Manager {
+	return GetManagerWithOptions(ctx, vc, operationStore, idempotencyHandlingEnabled, ManagerOptions{})
+}
+
+// GetManagerWithOptions returns the Manager instance, initializing it with
+// the given options if it does not exist yet.
+func GetManagerWithOptions(ctx context.Context, vc *cnsvsphere.VirtualCenter,
+	operationStore cnsvolumeoperationrequest.VolumeOperationRequest,
+	idempotencyHandlingEnabled bool, options ManagerOptions) Manager {
 	log := logger.GetLogger(ctx)
 	managerInstanceLock.Lock()
 	defer managerInstanceLock.Unlock()
@@ -172,9 +216,10 @@ func GetManager(ctx context.Context, vc *cnsvsphere.VirtualCenter,
 	}
 	log.Infof("Initializing new defaultManager...")
 	managerInstance = &defaultManager{
-		virtualCenter:              vc,
-		operationStore:             operationStore,
-		idempotencyHandlingEnabled: idempotencyHandlingEnabled,
+		virtualCenter:                   vc,
+		operationStore:                  operationStore,
+		idempotencyHandlingEnabled:      idempotencyHandlingEnabled,
+		failOnOperationStoreUnavailable: options.FailOnOperationStoreUnavailable,
 	}
 	return managerInstance
 }
@@ -184,6 +229,10 @@ type defaultManager struct {
 	virtualCenter              *cnsvsphere.VirtualCenter
 	operationStore             cnsvolumeoperationrequest.VolumeOperationRequest
 	idempotencyHandlingEnabled bool
+	// failOnOperationStoreUnavailable makes CreateVolume fail with
+	// ErrOperationStoreUnavailable instead of invoking CNS when the operation
+	// store cannot be reached.
+	failOnOperationStoreUnavailable bool
 }
 
 // ClearTaskInfoObjects is a go routine which runs in the background to clean
@@ -306,7 +355,23 @@ func (m *defaultManager) createVolumeWithImprovedIdempotency(ctx context.Context
 		// first attempt to create the volume.
 		volumeOperationDetails = createRequestDetails(volNameFromInputSpec, "", "", 0, metav1.Now(), "", "",
 			taskInvocationStatusInProgress, "")
+		if m.failOnOperationStoreUnavailable {
+			// Make sure the operation can be recorded before invoking CNS.
+			err = m.operationStore.StoreRequestDetails(ctx, volumeOperationDetails)
+			if err != nil {
+				err = fmt.Errorf("%w: failed to store CreateVolume details for volume %q. Error: %v",
+					ErrOperationStoreUnavailable, volNameFromInputSpec, err)
+				log.Error(err)
+				return nil, csifault.CSIInternalFault, err
+			}
+		}
 	default:
+		if m.failOnOperationStoreUnavailable {
+			err = fmt.Errorf("%w: failed to get CreateVolume details for volume %q. Error: %v",
+				ErrOperationStoreUnavailable, volNameFromInputSpec, err)
+			log.Error(err)
+			return nil, csifault.CSIInternalFault, err
+		}
 		return nil, csifault.CSIInternalFault, err
 	}
 	defer func() {
@@ -315,6 +380,11 @@ func (m *defaultManager) createVolumeWithImprovedIdempotency(ctx context.Context
 		// created on CNS.
 		if volumeOperationDetails != nil && volumeOperationDetails.OperationDetails != nil &&
 			volumeOperationDetails.OperationDetails.TaskStatus != taskInvocationStatusInProgress {
+			if volumeOperationDetails.OperationDetails.TaskStatus == taskInvocationStatusError &&
+				volumeOperationDetails.OperationDetails.FailureReason == "" {
+				volumeOperationDetails.OperationDetails.FailureReason =
+					cnsvolumeoperationrequest.FailureReasonCnsError
+			}
 			err := m.operationStore.StoreRequestDetails(ctx, volumeOperationDetails)
 			if err != nil {
 				log.Warnf("failed to store CreateVolume details with error: %v", err)
@@ -436,7 +506,7 @@ func (m *defaultManager) createVolumeWithImprovedIdempotency(ctx context.Context
 	}
 	// Extract the CnsVolumeInfo from the taskResult.
 	resp, faultType, err := getCnsVolumeInfoFromTaskResult(ctx, m.virtualCenter, volNameFromInputSpec,
-		volumeOperationRes.VolumeId, taskResult)
+		volumeOperationRes.VolumeId, taskResult, taskInfo.Task.Value)
 	if err != nil {
 		volumeOperationDetails = createRequestDetails(volNameFromInputSpec, "", "", 0,
 			volumeOperationDetails.OperationDetails.TaskInvocationTimestamp, task.Reference().Value,
@@ -542,7 +612,7 @@ func (m *defaultManager) createVolume(ctx context.Context, spec *cnstypes.CnsVol
 
 	// Reeturn CnsVolumeInfo from the taskResult.
 	return getCnsVolumeInfoFromTaskResult(ctx, m.virtualCenter, volNameFromInputSpec, volumeOperationRes.VolumeId,
-		taskResult)
+		taskResult, taskInfo.Task.Value)
 }
 
 // CreateVolume creates a new volume given its spec.
@@ -646,28 +716,8 @@ func (m *defaultManager) AttachVolume(ctx context.Context,
 					taskInfo.Task.Value, taskInfo.ActivationId)
 		}
 
-		volumeOperationRes := taskResult.GetCnsVolumeOperationResult()
-		if volumeOperationRes.Fault != nil {
-			faultType = ExtractFaultTypeFromVolumeResponseResult(ctx, volumeOperationRes)
-			_, isResourceInUseFault := volumeOperationRes.Fault.Fault.(*vim25types.ResourceInUse)
-			if isResourceInUseFault {
-				log.Infof("observed ResourceInUse fault while attaching volume: %q with vm: %q", volumeID, vm.String())
-				// Check if volume is already attached to the requested node.
-				diskUUID, err := IsDiskAttached(ctx, vm, volumeID, checkNVMeController)
-				if err != nil {
-					return "", faultType, err
-				}
-				if diskUUID != "" {
-					return diskUUID, "", nil
-				}
-			}
-			return "", faultType, logger.LogNewErrorf(log, "failed to attach cns volume: %q to node vm: %q. fault: %q. opId: %q",
-				volumeID, vm.String(), spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId)
-		}
-		diskUUID := interface{}(taskResult).(*cnstypes.CnsVolumeAttachResult).DiskUUID
-		log.Infof("AttachVolume: Volume attached successfully. volumeID: %q, opId: %q, vm: %q, diskUUID: %q",
-			volumeID, taskInfo.ActivationId, vm.String(), diskUUID)
-		return diskUUID, "", nil
+		result := getAttachResult(ctx, vm, volumeID, taskResult, taskInfo, checkNVMeController)
+		return result.DiskUUID, result.FaultType, result.Err
 	}
 	start := time.Now()
 	resp, faultType, err := internalAttachVolume()
@@ -683,6 +733,140 @@ func (m *defaultManager) AttachVolume(ctx context.Context,
 	return resp, faultType, err
 }
 
+// BatchAttachVolumes attaches the given volumes to a virtual machine using a
+// single CNS AttachVolume task.
+func (m *defaultManager) BatchAttachVolumes(ctx context.Context, vm *cnsvsphere.VirtualMachine,
+	volumeIDs []string, checkNVMeController bool) (map[string]*CnsAttachResult, string, error) {
+	internalBatchAttachVolumes := func() (map[string]*CnsAttachResult, string, error) {
+		log := logger.GetLogger(ctx)
+		var faultType string
+		err := validateManager(ctx, m)
+		if err != nil {
+			faultType = ExtractFaultTypeFromErr(ctx, err)
+			return nil, faultType, err
+		}
+		// Set up the VC connection.
+		err = m.virtualCenter.ConnectCns(ctx)
+		if err != nil {
+			log.Errorf("ConnectCns failed with err: %+v", err)
+			faultType = ExtractFaultTypeFromErr(ctx, err)
+			return nil, faultType, err
+		}
+		// Construct the CNS AttachSpec list.
+		var cnsAttachSpecList []cnstypes.CnsVolumeAttachDetachSpec
+		for _, volumeID := range volumeIDs {
+			cnsAttachSpecList = append(cnsAttachSpecList, cnstypes.CnsVolumeAttachDetachSpec{
+				VolumeId: cnstypes.CnsVolumeId{
+					Id: volumeID,
+				},
+				Vm: vm.Reference(),
+			})
+		}
+		// Call the CNS AttachVolume.
+		task, err := m.virtualCenter.CnsClient.AttachVolume(ctx, cnsAttachSpecList)
+		if err != nil {
+			log.Errorf("CNS AttachVolume failed from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
+			faultType = ExtractFaultTypeFromErr(ctx, err)
+			return nil, faultType, err
+		}
+		// Get the taskInfo.
+		taskInfo, err := cns.GetTaskInfo(ctx, task)
+		if err != nil || taskInfo == nil {
+			log.Errorf("failed to get taskInfo for AttachVolume task from vCenter %q with err: %v",
+				m.virtualCenter.Config.Host, err)
+			if err != nil {
+				faultType = ExtractFaultTypeFromErr(ctx, err)
+			} else {
+				faultType = csifault.CSITaskInfoEmptyFault
+				err = logger.LogNewErrorf(log, "taskInfo is empty for AttachVolume task on vm: %q", vm.String())
+			}
+			return nil, faultType, err
+		}
+		log.Infof("BatchAttachVolumes: volumeIDs: %v, vm: %q, opId: %q", volumeIDs, vm.String(),
+			taskInfo.ActivationId)
+		// Get the taskResults.
+		taskResults, err := cns.GetTaskResultArray(ctx, taskInfo)
+		if err != nil {
+			faultType = ExtractFaultTypeFromErr(ctx, err)
+			log.Errorf("unable to find AttachVolume results from vCenter %q with taskID %s. Error: %v",
+				m.virtualCenter.Config.Host, taskInfo.Task.Value, err)
+			return nil, faultType, err
+		}
+
+		results := make(map[string]*CnsAttachResult)
+		for _, taskResult := range taskResults {
+			if taskResult == nil {
+				continue
+			}
+			volumeID := taskResult.GetCnsVolumeOperationResult().VolumeId.Id
+			results[volumeID] = getAttachResult(ctx, vm, volumeID, taskResult, taskInfo, checkNVMeController)
+		}
+		// Every requested volume should have an outcome.
+		for _, volumeID := range volumeIDs {
+			if _, exists := results[volumeID]; !exists {
+				results[volumeID] = &CnsAttachResult{
+					FaultType: csifault.CSITaskResultEmptyFault,
+					Err: logger.LogNewErrorf(log, "taskResult is empty for volume: %q in AttachVolume task: %q, "+
+						"opId: %q", volumeID, taskInfo.Task.Value, taskInfo.ActivationId),
+				}
+			}
+		}
+		return results, "", nil
+	}
+	start := time.Now()
+	results, faultType, err := internalBatchAttachVolumes()
+	log := logger.GetLogger(ctx)
+	log.Debugf("internalBatchAttachVolumes: returns fault %q for volumes %v", faultType, volumeIDs)
+	if err != nil {
+		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsAttachVolumeOpType,
+			prometheus.PrometheusFailStatus).Observe(time.Since(start).Seconds())
+	} else {
+		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsAttachVolumeOpType,
+			prometheus.PrometheusPassStatus).Observe(time.Since(start).Seconds())
+	}
+	return results, faultType, err
+}
+
+// getAttachResult returns the outcome of attaching the given volume to the
+// virtual machine as per its result in the given CNS AttachVolume task.
+func getAttachResult(ctx context.Context, vm *cnsvsphere.VirtualMachine, volumeID string,
+	taskResult cnstypes.BaseCnsVolumeOperationResult, taskInfo *vim25types.TaskInfo,
+	checkNVMeController bool) *CnsAttachResult {
+	log := logger.GetLogger(ctx)
+	volumeOperationRes := taskResult.GetCnsVolumeOperationResult()
+	if volumeOperationRes.Fault != nil {
+		faultType := ExtractFaultTypeFromVolumeResponseResult(ctx, volumeOperationRes)
+		_, isResourceInUseFault := volumeOperationRes.Fault.Fault.(*vim25types.ResourceInUse)
+		if isResourceInUseFault {
+			log.Infof("observed ResourceInUse fault while attaching volume: %q with vm: %q", volumeID, vm.String())
+			// Check if volume is already attached to the requested node.
+			diskUUID, err := IsDiskAttached(ctx, vm, volumeID, checkNVMeController)
+			if err != nil {
+				return &CnsAttachResult{FaultType: faultType, Err: err}
+			}
+			if diskUUID != "" {
+				return &CnsAttachResult{DiskUUID: diskUUID}
+			}
+		}
+		return &CnsAttachResult{
+			FaultType: faultType,
+			Err: logger.LogNewErrorf(log, "failed to attach cns volume: %q to node vm: %q. fault: %q. opId: %q",
+				volumeID, vm.String(), spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId),
+		}
+	}
+	attachResult, ok := taskResult.(*cnstypes.CnsVolumeAttachResult)
+	if !ok {
+		return &CnsAttachResult{
+			FaultType: csifault.CSITaskResultEmptyFault,
+			Err: logger.LogNewErrorf(log, "unexpected result type %T for volume: %q in AttachVolume task: %q, "+
+				"opId: %q", taskResult, volumeID, taskInfo.Task.Value, taskInfo.ActivationId),
+		}
+	}
+	log.Infof("AttachVolume: Volume attached successfully. volumeID: %q, opId: %q, taskId: %q, vm: %q, "+
+		"diskUUID: %q", volumeID, taskInfo.ActivationId, taskInfo.Task.Value, vm.String(), attachResult.DiskUUID)
+	return &CnsAttachResult{DiskUUID: attachResult.DiskUUID}
+}
+
 // DetachVolume detaches a volume from the virtual machine given the spec.
 func (m *defaultManager) DetachVolume(ctx context.Context, vm *cnsvsphere.VirtualMachine, volumeID string) (string,
 	error) {
@@ -815,6 +999,12 @@ func (m *defaultManager) DeleteVolume(ctx context.Context, volumeID string, dele
 			log.Errorf("failed to validate manager with error: %v", err)
 			return faultType, err
 		}
+		// Skip connecting to vCenter if the operation store already records
+		// the volume as deleted, e.g. on retries of a successful DeleteVolume.
+		if m.idempotencyHandlingEnabled && m.isVolumeDeletedInOperationStore(ctx, volumeID) {
+			log.Infof("DeleteVolume: volumeID: %q is already deleted as per the operation store", volumeID)
+			return "", nil
+		}
 		// Set up the VC connection.
 		err = m.virtualCenter.ConnectCns(ctx)
 		if err != nil {
@@ -899,6 +1089,35 @@ func (m *defaultManager) deleteVolume(ctx context.Context, volumeID string, dele
 	return "", nil
 }
 
+// getDeleteVolumeInstanceName returns the name of the CnsVolumeOperationRequest
+// instance persisting the DeleteVolume details of the given volume.
+func getDeleteVolumeInstanceName(volumeID string) string {
+	instanceName := "delete-" + volumeID
+	if strings.Contains(instanceName, "file") {
+		instanceName = strings.ReplaceAll(instanceName, ":", "-")
+	}
+	return instanceName
+}
+
+// isVolumeDeletedInOperationStore returns true if the operation store records
+// a successful DeleteVolume for the given volume. Returns false if the store
+// has no record of it or could not be read.
+func (m *defaultManager) isVolumeDeletedInOperationStore(ctx context.Context, volumeID string) bool {
+	log := logger.GetLogger(ctx)
+	if m.operationStore == nil {
+		return false
+	}
+	volumeOperationDetails, err := m.operationStore.GetRequestDetails(ctx, getDeleteVolumeInstanceName(volumeID))
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Debugf("failed to get DeleteVolume operation details of volume %q. Error: %+v", volumeID, err)
+		}
+		return false
+	}
+	return volumeOperationDetails.OperationDetails != nil &&
+		volumeOperationDetails.OperationDetails.TaskStatus == taskInvocationStatusSuccess
+}
+
 // deleteVolumeWithImprovedIdempotency attempts to delete the volume on CNS.
 // CNS task information is persisted by leveraging the VolumeOperationRequest
 // interface.
@@ -909,7 +1128,7 @@ func (m *defaultManager) deleteVolumeWithImprovedIdempotency(ctx context.Context
 		// Reference to the DeleteVolume task on CNS.
 		task *object.Task
 		// Name of the CnsVolumeOperationRequest instance.
-		instanceName = "delete-" + volumeID
+		instanceName = getDeleteVolumeInstanceName(volumeID)
 		// Local instance of DeleteVolume details that needs to
 		// be persisted.
 		volumeOperationDetails *cnsvolumeoperationrequest.VolumeOperationRequestDetails
@@ -919,10 +1138,6 @@ func (m *defaultManager) deleteVolumeWithImprovedIdempotency(ctx context.Context
 		return csifault.CSIInternalFault, logger.LogNewError(log, "operation store cannot be nil")
 	}
 
-	if strings.Contains(instanceName, "file") {
-		instanceName = strings.ReplaceAll(instanceName, ":", "-")
-	}
-
 	// Determine if CNS needs to be invoked.
 	volumeOperationDetails, err := m.operationStore.GetRequestDetails(ctx, instanceName)
 	switch {
@@ -1564,6 +1779,88 @@ func (m *defaultManager) RelocateVolume(ctx context.Context,
 	return resp, err
 }
 
+// UpdateVolumeStoragePolicy reconfigures the storage policy of a volume by
+// relocating it to the datastore it currently resides on with the new policy.
+func (m *defaultManager) UpdateVolumeStoragePolicy(ctx context.Context, volumeID string,
+	datastore vim25types.ManagedObjectReference, storagePolicyID string) (string, error) {
+	internalUpdateVolumeStoragePolicy := func() (string, error) {
+		log := logger.GetLogger(ctx)
+		var faultType string
+		err := validateManager(ctx, m)
+		if err != nil {
+			log.Errorf("validateManager failed with err: %+v", err)
+			faultType = ExtractFaultTypeFromErr(ctx, err)
+			return faultType, err
+		}
+		// Set up the VC connection.
+		err = m.virtualCenter.ConnectCns(ctx)
+		if err != nil {
+			log.Errorf("ConnectCns failed with err: %+v", err)
+			faultType = ExtractFaultTypeFromErr(ctx, err)
+			return faultType, err
+		}
+		relocateSpec := cnstypes.NewCnsBlockVolumeRelocateSpec(volumeID, datastore,
+			&vim25types.VirtualMachineDefinedProfileSpec{ProfileId: storagePolicyID})
+		log.Infof("Calling CnsClient.RelocateVolume: VolumeID [%q] Datastore [%v] StoragePolicyID [%q]",
+			volumeID, datastore, storagePolicyID)
+		task, err := m.virtualCenter.CnsClient.RelocateVolume(ctx, relocateSpec)
+		if err != nil {
+			faultType = ExtractFaultTypeFromErr(ctx, err)
+			if cnsvsphere.IsNotFoundError(err) {
+				return faultType, logger.LogNewErrorf(log,
+					"volume %q not found. Cannot update storage policy of volume.", volumeID)
+			}
+			log.Errorf("CNS RelocateVolume failed from the vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
+			return faultType, err
+		}
+		// Get the taskInfo.
+		taskInfo, err := cns.GetTaskInfo(ctx, task)
+		if err != nil || taskInfo == nil {
+			log.Errorf("failed to get taskInfo for RelocateVolume task from vCenter %q with err: %v",
+				m.virtualCenter.Config.Host, err)
+			if err != nil {
+				faultType = ExtractFaultTypeFromErr(ctx, err)
+			} else {
+				faultType = csifault.CSITaskInfoEmptyFault
+			}
+			return faultType, err
+		}
+		// Get the task results for the given task.
+		taskResult, err := getTaskResultFromTaskInfo(ctx, taskInfo)
+		if taskResult == nil {
+			return csifault.CSITaskResultEmptyFault,
+				logger.LogNewErrorf(log, "taskResult is empty for RelocateVolume task: %q, opID: %q",
+					taskInfo.Task.Value, taskInfo.ActivationId)
+		}
+		if err != nil {
+			log.Errorf("failed to get task result for RelocateVolume task %s with error: %v",
+				task.Reference().Value, err)
+			faultType = ExtractFaultTypeFromErr(ctx, err)
+			return faultType, err
+		}
+		volumeOperationRes := taskResult.GetCnsVolumeOperationResult()
+		if volumeOperationRes.Fault != nil {
+			faultType = ExtractFaultTypeFromVolumeResponseResult(ctx, volumeOperationRes)
+			return faultType, logger.LogNewErrorf(log,
+				"failed to update storage policy of volume: %q, fault: %q, opID: %q",
+				volumeID, spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId)
+		}
+		log.Infof("UpdateVolumeStoragePolicy: Storage policy of volume %q updated to %q successfully. opId: %q",
+			volumeID, storagePolicyID, taskInfo.ActivationId)
+		return "", nil
+	}
+	start := time.Now()
+	faultType, err := internalUpdateVolumeStoragePolicy()
+	if err != nil {
+		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsUpdateVolumeStoragePolicyOpType,
+			prometheus.PrometheusFailStatus).Observe(time.Since(start).Seconds())
+	} else {
+		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsUpdateVolumeStoragePolicyOpType,
+			prometheus.PrometheusPassStatus).Observe(time.Since(start).Seconds())
+	}
+	return faultType, err
+}
+
 // ConfigureVolumeACLs configures net permissions for a given CnsVolumeACLConfigureSpec.
 func (m *defaultManager) ConfigureVolumeACLs(ctx context.Context, spec cnstypes.CnsVolumeACLConfigureSpec) error {
 	internalConfigureVolumeACLs := func() error {
@@ -0,0 +1,85 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/internalapis/cnsvolumeoperationrequest"
+)
+
+// unavailableOperationStore is a VolumeOperationRequest which cannot be reached.
+type unavailableOperationStore struct{}
+
+func (s *unavailableOperationStore) GetRequestDetails(ctx context.Context,
+	name string) (*cnsvolumeoperationrequest.VolumeOperationRequestDetails, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (s *unavailableOperationStore) StoreRequestDetails(ctx context.Context,
+	instance *cnsvolumeoperationrequest.VolumeOperationRequestDetails) error {
+	return errors.New("connection refused")
+}
+
+// TestGetManagerWithOptions verifies that CreateVolume fails with
+// ErrOperationStoreUnavailable only when the manager is configured to do so.
+func TestGetManagerWithOptions(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name                string
+		getManager          func() Manager
+		expectedUnavailable bool
+	}{
+		{
+			name: "GetManager",
+			getManager: func() Manager {
+				return GetManager(ctx, &cnsvsphere.VirtualCenter{}, &unavailableOperationStore{}, true)
+			},
+			expectedUnavailable: false,
+		},
+		{
+			name: "GetManagerWithOptions",
+			getManager: func() Manager {
+				return GetManagerWithOptions(ctx, &cnsvsphere.VirtualCenter{}, &unavailableOperationStore{}, true,
+					ManagerOptions{FailOnOperationStoreUnavailable: true})
+			},
+			expectedUnavailable: true,
+		},
+	}
+	for _, test := range tests {
+		managerInstanceLock.Lock()
+		managerInstance = nil
+		managerInstanceLock.Unlock()
+		m := test.getManager().(*defaultManager)
+		_, _, err := m.createVolumeWithImprovedIdempotency(ctx, &cnstypes.CnsVolumeCreateSpec{Name: "pvc-test"})
+		if err == nil {
+			t.Fatalf("%s: expected CreateVolume to fail", test.name)
+		}
+		if errors.Is(err, ErrOperationStoreUnavailable) != test.expectedUnavailable {
+			t.Errorf("%s: expected ErrOperationStoreUnavailable %t but got error: %+v", test.name,
+				test.expectedUnavailable, err)
+		}
+	}
+	managerInstanceLock.Lock()
+	managerInstance = nil
+	managerInstanceLock.Unlock()
+}
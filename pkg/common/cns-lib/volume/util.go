@@ -295,7 +295,8 @@ func validateCreateVolumeResponseFault(ctx context.Context, name string,
 // getCnsVolumeInfoFromTaskResult retrieves the datastoreURL and returns the
 // CnsVolumeInfo object.
 func getCnsVolumeInfoFromTaskResult(ctx context.Context, virtualCenter *cnsvsphere.VirtualCenter, volumeName string,
-	volumeID cnstypes.CnsVolumeId, taskResult cnstypes.BaseCnsVolumeOperationResult) (*CnsVolumeInfo, string, error) {
+	volumeID cnstypes.CnsVolumeId, taskResult cnstypes.BaseCnsVolumeOperationResult,
+	taskID string) (*CnsVolumeInfo, string, error) {
 	log := logger.GetLogger(ctx)
 	var datastoreURL string
 	volumeCreateResult := interface{}(taskResult).(*cnstypes.CnsVolumeCreateResult)
@@ -319,13 +320,14 @@ func getCnsVolumeInfoFromTaskResult(ctx context.Context, virtualCenter *cnsvsphe
 		}
 		datastoreURL = dsMo.Summary.Url
 	}
-	log.Infof("Volume created successfully. VolumeName: %q, volumeID: %q",
-		volumeName, volumeID.Id)
+	log.Infof("Volume created successfully. VolumeName: %q, volumeID: %q, taskId: %q",
+		volumeName, volumeID.Id, taskID)
 	log.Debugf("CreateVolume volumeId %q is placed on datastore %q",
 		volumeID, datastoreURL)
 	return &CnsVolumeInfo{
 		DatastoreURL: datastoreURL,
 		VolumeID:     volumeID,
+		TaskID:       taskID,
 	}, "", nil
 }
 
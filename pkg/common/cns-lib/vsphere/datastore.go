@@ -58,3 +58,44 @@ func (ds *Datastore) GetDatastoreURLAndType(ctx context.Context) (string, string
 	}
 	return dsMo.Summary.Url, dsMo.Summary.Type, nil
 }
+
+// FilterDatastoresAboveCapacityThreshold filters out datastores whose free
+// space is below reservedCapacityPercent of their capacity. Such datastores
+// are treated as full. If reservedCapacityPercent is not positive, or the
+// datastore summaries cannot be retrieved, the given list is returned as is.
+func FilterDatastoresAboveCapacityThreshold(ctx context.Context, datastoreInfoList []*DatastoreInfo,
+	reservedCapacityPercent int) []*DatastoreInfo {
+	log := logger.GetLogger(ctx)
+	if reservedCapacityPercent <= 0 || len(datastoreInfoList) == 0 {
+		return datastoreInfoList
+	}
+	var dsMorefs []types.ManagedObjectReference
+	for _, ds := range datastoreInfoList {
+		dsMorefs = append(dsMorefs, ds.Datastore.Reference())
+	}
+	var dsMoList []mo.Datastore
+	pc := property.DefaultCollector(datastoreInfoList[0].Client())
+	err := pc.Retrieve(ctx, dsMorefs, []string{"summary"}, &dsMoList)
+	if err != nil {
+		log.Warnf("Failed to retrieve summary of datastores %v. Skipping capacity threshold filtering. Err: %v",
+			dsMorefs, err)
+		return datastoreInfoList
+	}
+	fullDatastores := make(map[string]struct{})
+	for _, dsMo := range dsMoList {
+		capacity := dsMo.Summary.Capacity
+		if capacity > 0 && dsMo.Summary.FreeSpace*100 < capacity*int64(reservedCapacityPercent) {
+			log.Infof("Ignoring datastore %q as its free space %d is below the reserved %d%% of its capacity %d",
+				dsMo.Summary.Name, dsMo.Summary.FreeSpace, reservedCapacityPercent, capacity)
+			fullDatastores[dsMo.Reference().Value] = struct{}{}
+		}
+	}
+	var filteredList []*DatastoreInfo
+	for _, ds := range datastoreInfoList {
+		if _, isFull := fullDatastores[ds.Datastore.Reference().Value]; !isFull {
+			filteredList = append(filteredList, ds)
+		}
+	}
+	log.Debugf("Datastores below capacity threshold: %+v", filteredList)
+	return filteredList
+}
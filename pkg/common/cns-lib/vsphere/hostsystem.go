@@ -69,6 +69,22 @@ func (host *HostSystem) GetAllAccessibleDatastores(ctx context.Context) ([]*Data
 	return dsObjList, nil
 }
 
+// GetClusterComputeResourceMoId gets the moid of the cluster this host belongs
+// to. Returns an empty string if the host is not part of a cluster.
+func (host *HostSystem) GetClusterComputeResourceMoId(ctx context.Context) (string, error) {
+	log := logger.GetLogger(ctx)
+	var hostSystemMo mo.HostSystem
+	err := host.Properties(ctx, host.Reference(), []string{"parent"}, &hostSystemMo)
+	if err != nil {
+		log.Errorf("failed to retrieve parent of host %v with err: %v", host, err)
+		return "", err
+	}
+	if hostSystemMo.Parent == nil || hostSystemMo.Parent.Type != "ClusterComputeResource" {
+		return "", nil
+	}
+	return hostSystemMo.Parent.Value, nil
+}
+
 // GetHostVsanNodeUUID gets the vSAN NodeUuid for this host.
 func (host *HostSystem) GetHostVsanNodeUUID(ctx context.Context) (string, error) {
 	log := logger.GetLogger(ctx)
@@ -251,6 +251,27 @@ func (vc *VirtualCenter) Connect(ctx context.Context) error {
 	return err
 }
 
+// ValidateConnection verifies that the established connection with vCenter is
+// usable by issuing a lightweight query for the current user session. A
+// successful Connect doesn't guarantee that the session can serve requests.
+func (vc *VirtualCenter) ValidateConnection(ctx context.Context) error {
+	log := logger.GetLogger(ctx)
+	if vc.Client == nil {
+		return logger.LogNewError(log, "failed to validate connection as VC client is not set")
+	}
+	userSession, err := session.NewManager(vc.Client.Client).UserSession(ctx)
+	if err != nil {
+		return logger.LogNewErrorf(log, "failed to query user session on vCenter host %q. err: %v",
+			vc.Config.Host, err)
+	}
+	if userSession == nil {
+		return logger.LogNewErrorf(log, "user session on vCenter host %q is not authenticated", vc.Config.Host)
+	}
+	log.Debugf("Validated connection to vCenter host %q with user session for %q",
+		vc.Config.Host, userSession.UserName)
+	return nil
+}
+
 // connect creates a connection to the virtual center host.
 func (vc *VirtualCenter) connect(ctx context.Context, requestNewSession bool) error {
 	log := logger.GetLogger(ctx)
@@ -502,6 +523,35 @@ func (vc *VirtualCenter) GetDatastoresByCluster(ctx context.Context,
 	return dsList, nil
 }
 
+// GetDatastoreMorefsInStoragePod returns the datastore morefs which are members
+// of the given datastore cluster (StoragePod).
+func (vc *VirtualCenter) GetDatastoreMorefsInStoragePod(ctx context.Context,
+	storagePodMorefValue string) ([]types.ManagedObjectReference, error) {
+	log := logger.GetLogger(ctx)
+	if err := vc.Connect(ctx); err != nil {
+		log.Errorf("failed to connect to vCenter. err: %v", err)
+		return nil, err
+	}
+	storagePodMoref := types.ManagedObjectReference{
+		Type:  "StoragePod",
+		Value: storagePodMorefValue,
+	}
+	storagePodMo := mo.StoragePod{}
+	err := vc.Client.RetrieveOne(ctx, storagePodMoref, []string{"childEntity"}, &storagePodMo)
+	if err != nil {
+		log.Errorf("Failed to fetch datastores from datastore cluster given storagePodMorefValue %s with err: %v",
+			storagePodMorefValue, err)
+		return nil, err
+	}
+	var dsMorefs []types.ManagedObjectReference
+	for _, childMoref := range storagePodMo.ChildEntity {
+		if childMoref.Type == "Datastore" {
+			dsMorefs = append(dsMorefs, childMoref)
+		}
+	}
+	return dsMorefs, nil
+}
+
 // GetVirtualCenterInstance returns the vcenter object singleton.
 // It is thread safe. Takes in a boolean paramater reloadConfig.
 // If reinitialize is true, the vcenter object is instantiated again and the
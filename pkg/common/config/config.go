@@ -28,6 +28,7 @@ import (
 
 	"gopkg.in/gcfg.v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 
 	cnstypes "github.com/vmware/govmomi/cns/types"
 	vsanfstypes "github.com/vmware/govmomi/vsan/vsanfs/types"
@@ -90,6 +91,30 @@ const (
 	// DefaultListVolumeThreshold specifies the default maximum number of differences in volumes between CNS
 	// and kubernetes
 	DefaultListVolumeThreshold = 50
+	// DefaultVCConnectTimeoutInSec is the default time limit for each attempt to
+	// connect to vCenter when the controller starts up.
+	DefaultVCConnectTimeoutInSec = 60
+	// DefaultVCConnectMaxAttempts is the default number of attempts made to
+	// connect to vCenter when the controller starts up.
+	DefaultVCConnectMaxAttempts = 3
+	// DefaultFileVolumeSizeInGB is the default size in GiB of file volumes
+	// created without a requested capacity.
+	DefaultFileVolumeSizeInGB = 10
+	// DefaultPrometheusMetricsPort is the default port on which the controller
+	// exposes Prometheus metrics.
+	DefaultPrometheusMetricsPort = 2112
+	// DefaultReloadConfigRetryInitialIntervalInSec is the default time to wait
+	// before retrying a failed reload of the configuration.
+	DefaultReloadConfigRetryInitialIntervalInSec = 5
+	// DefaultReloadConfigRetryMultiplier is the default factor by which the
+	// wait between retries of a failed reload of the configuration grows.
+	DefaultReloadConfigRetryMultiplier = 2
+	// DefaultReloadConfigRetryMaxIntervalInSec is the default maximum time to
+	// wait between retries of a failed reload of the configuration.
+	DefaultReloadConfigRetryMaxIntervalInSec = 60
+	// DefaultHostMoidCacheTTLInSec is the default time for which the host-moid
+	// of a node fetched from the K8sCloudOperator service is cached.
+	DefaultHostMoidCacheTTLInSec = 60
 )
 
 // Errors
@@ -391,6 +416,45 @@ func validateConfig(ctx context.Context, cfg *Config) error {
 	if cfg.Snapshot.GlobalMaxSnapshotsPerBlockVolume == 0 {
 		cfg.Snapshot.GlobalMaxSnapshotsPerBlockVolume = DefaultGlobalMaxSnapshotsPerBlockVolume
 	}
+	if cfg.Global.VCConnectTimeoutInSec < 0 {
+		return logger.LogNewErrorf(log, "invalid value %d for vc-connect-timeout-insec. "+
+			"Value should not be negative", cfg.Global.VCConnectTimeoutInSec)
+	}
+	if cfg.Global.VCConnectTimeoutInSec == 0 {
+		cfg.Global.VCConnectTimeoutInSec = DefaultVCConnectTimeoutInSec
+	}
+	if cfg.Global.VCConnectMaxAttempts < 0 {
+		return logger.LogNewErrorf(log, "invalid value %d for vc-connect-max-attempts. "+
+			"Value should not be negative", cfg.Global.VCConnectMaxAttempts)
+	}
+	if cfg.Global.VCConnectMaxAttempts == 0 {
+		cfg.Global.VCConnectMaxAttempts = DefaultVCConnectMaxAttempts
+	}
+	if cfg.Global.DefaultFileVolumeSizeInGB < 0 {
+		return logger.LogNewErrorf(log, "invalid value %d for default-file-volume-size-ingb. "+
+			"Value should not be negative", cfg.Global.DefaultFileVolumeSizeInGB)
+	}
+	if cfg.Global.DefaultFileVolumeSizeInGB == 0 {
+		cfg.Global.DefaultFileVolumeSizeInGB = DefaultFileVolumeSizeInGB
+	}
+	if cfg.Global.TopologyComputationTimeoutInSec < 0 {
+		return logger.LogNewErrorf(log, "invalid value %d for topology-computation-timeout-insec. "+
+			"Value should not be negative", cfg.Global.TopologyComputationTimeoutInSec)
+	}
+	if err := validateReloadConfigRetry(ctx, cfg); err != nil {
+		return err
+	}
+	if cfg.Global.HostMoidCacheTTLInSec < 0 {
+		return logger.LogNewErrorf(log, "invalid value %d for host-moid-cache-ttl-insec. "+
+			"Value should not be negative", cfg.Global.HostMoidCacheTTLInSec)
+	}
+	if cfg.Global.HostMoidCacheTTLInSec == 0 {
+		cfg.Global.HostMoidCacheTTLInSec = DefaultHostMoidCacheTTLInSec
+	}
+	if cfg.Global.DatastoreReservedCapacityPercent < 0 || cfg.Global.DatastoreReservedCapacityPercent >= 100 {
+		return logger.LogNewErrorf(log, "invalid value %d for datastore-reserved-capacity-percent. "+
+			"Value should be between 0 and 99", cfg.Global.DatastoreReservedCapacityPercent)
+	}
 
 	// Labels section validation - the customer can either provide topology
 	// domain info using zone,region parameters or by using the topologyCategories
@@ -409,6 +473,14 @@ func validateConfig(ctx context.Context, cfg *Config) error {
 		}
 	}
 
+	// Validate the node selector in Labels section.
+	if strings.TrimSpace(cfg.Labels.TopologyNodeSelector) != "" {
+		if _, err := labels.Parse(cfg.Labels.TopologyNodeSelector); err != nil {
+			return logger.LogNewErrorf(log, "invalid topology-node-selector %q specified. Error: %v",
+				cfg.Labels.TopologyNodeSelector, err)
+		}
+	}
+
 	// Validate topology labels specified in TopologyCategory section.
 	betaDomain := strings.Split(corev1.LabelFailureDomainBetaZone, "/")[0]
 	gaDomain := strings.Split(corev1.LabelTopologyZone, "/")[0]
@@ -489,6 +561,23 @@ func GetDefaultNetPermission() *NetPermissionConfig {
 	}
 }
 
+// GetSupervisorCAFilePaths returns the list of CA file paths to be watched for
+// rotation in the Supervisor cluster. SupervisorCAFilePath is returned when
+// supervisor-ca-file-paths is not configured.
+func GetSupervisorCAFilePaths(cfg *Config) []string {
+	var caFilePaths []string
+	for _, caFilePath := range strings.Split(cfg.Global.SupervisorCAFilePaths, ",") {
+		caFilePath = strings.TrimSpace(caFilePath)
+		if caFilePath != "" {
+			caFilePaths = append(caFilePaths, caFilePath)
+		}
+	}
+	if len(caFilePaths) == 0 {
+		caFilePaths = []string{SupervisorCAFilePath}
+	}
+	return caFilePaths
+}
+
 // FromEnvToGC initializes the provided configuration object with values
 // obtained from environment variables. If an environment variable is set
 // for a property that's already initialized, the environment variable's value
@@ -574,6 +663,39 @@ func validateGCConfig(ctx context.Context, cfg *Config) error {
 		log.Error(ErrMissingTanzuKubernetesClusterUID)
 		return ErrMissingTanzuKubernetesClusterUID
 	}
+	return validateReloadConfigRetry(ctx, cfg)
+}
+
+// validateReloadConfigRetry validates the backoff between retries of a failed
+// reload of the configuration and sets the defaults for unset values.
+func validateReloadConfigRetry(ctx context.Context, cfg *Config) error {
+	log := logger.GetLogger(ctx)
+	if cfg.Global.ReloadConfigRetryInitialIntervalInSec < 0 {
+		return logger.LogNewErrorf(log, "invalid value %d for reload-config-retry-initial-interval-insec. "+
+			"Value should not be negative", cfg.Global.ReloadConfigRetryInitialIntervalInSec)
+	}
+	if cfg.Global.ReloadConfigRetryInitialIntervalInSec == 0 {
+		cfg.Global.ReloadConfigRetryInitialIntervalInSec = DefaultReloadConfigRetryInitialIntervalInSec
+	}
+	if cfg.Global.ReloadConfigRetryMultiplier < 0 {
+		return logger.LogNewErrorf(log, "invalid value %d for reload-config-retry-multiplier. "+
+			"Value should not be negative", cfg.Global.ReloadConfigRetryMultiplier)
+	}
+	if cfg.Global.ReloadConfigRetryMultiplier == 0 {
+		cfg.Global.ReloadConfigRetryMultiplier = DefaultReloadConfigRetryMultiplier
+	}
+	if cfg.Global.ReloadConfigRetryMaxIntervalInSec < 0 {
+		return logger.LogNewErrorf(log, "invalid value %d for reload-config-retry-max-interval-insec. "+
+			"Value should not be negative", cfg.Global.ReloadConfigRetryMaxIntervalInSec)
+	}
+	if cfg.Global.ReloadConfigRetryMaxIntervalInSec == 0 {
+		cfg.Global.ReloadConfigRetryMaxIntervalInSec = DefaultReloadConfigRetryMaxIntervalInSec
+	}
+	if cfg.Global.ReloadConfigRetryMaxIntervalInSec < cfg.Global.ReloadConfigRetryInitialIntervalInSec {
+		return logger.LogNewErrorf(log, "invalid value %d for reload-config-retry-max-interval-insec. "+
+			"Value should not be less than reload-config-retry-initial-interval-insec %d",
+			cfg.Global.ReloadConfigRetryMaxIntervalInSec, cfg.Global.ReloadConfigRetryInitialIntervalInSec)
+	}
 	return nil
 }
 
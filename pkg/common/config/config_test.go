@@ -189,6 +189,18 @@ func TestSnapshotConfigWhenMaxSpecifiedAsEnv(t *testing.T) {
 	}
 }
 
+func TestGetSupervisorCAFilePaths(t *testing.T) {
+	cfg := &Config{}
+	if paths := GetSupervisorCAFilePaths(cfg); !reflect.DeepEqual(paths, []string{SupervisorCAFilePath}) {
+		t.Errorf("Expected default CA file path %q, got %v", SupervisorCAFilePath, paths)
+	}
+	cfg.Global.SupervisorCAFilePaths = "/etc/ca/a.pem, /etc/ca/b.pem,"
+	expected := []string{"/etc/ca/a.pem", "/etc/ca/b.pem"}
+	if paths := GetSupervisorCAFilePaths(cfg); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected CA file paths %v, got %v", expected, paths)
+	}
+}
+
 func isConfigEqual(actual *Config, expected *Config) bool {
 	// TODO: Compare Global struct
 	// Compare VC Config
@@ -201,3 +213,25 @@ func isConfigEqual(actual *Config, expected *Config) bool {
 	}
 	return true
 }
+
+func TestValidateReloadConfigRetry(t *testing.T) {
+	cfg := &Config{}
+	cfg.GC.Endpoint = "1.1.1.1"
+	cfg.GC.TanzuKubernetesClusterUID = "tkc-uid"
+	err := validateGCConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error during config validation - %+v", err)
+	}
+	if cfg.Global.ReloadConfigRetryInitialIntervalInSec != DefaultReloadConfigRetryInitialIntervalInSec ||
+		cfg.Global.ReloadConfigRetryMultiplier != DefaultReloadConfigRetryMultiplier ||
+		cfg.Global.ReloadConfigRetryMaxIntervalInSec != DefaultReloadConfigRetryMaxIntervalInSec {
+		t.Errorf("Default reload config retry backoff incorrect - %+v", cfg.Global)
+	}
+
+	cfg = &Config{VirtualCenter: idealVCConfig}
+	cfg.Global.ReloadConfigRetryInitialIntervalInSec = 120
+	err = validateConfig(ctx, cfg)
+	if err == nil {
+		t.Errorf("Expected error due to initial interval greater than the default max interval")
+	}
+}
@@ -41,6 +41,11 @@ type Config struct {
 		// InsecureFlag is enabled. Optional; if not configured, the system's CA
 		// certificates will be used.
 		CAFile string `gcfg:"ca-file"`
+		// SupervisorCAFilePaths is a comma separated list of CA file paths which
+		// are watched for rotation in the Supervisor cluster. A rotation of any of
+		// these files re-establishes the connection with vCenter. Optional; if not
+		// configured, SupervisorCAFilePath will be watched.
+		SupervisorCAFilePaths string `gcfg:"supervisor-ca-file-paths"`
 		// Thumbprint specifies the certificate thumbprint to use
 		// This has no effect if InsecureFlag is enabled.
 		Thumbprint string `gcfg:"thumbprint"`
@@ -63,12 +68,71 @@ type Config struct {
 		// CnsVolumeOperationRequestCleanupIntervalInMin specifies the interval after which
 		// stale CnsVolumeOperationRequest instances will be cleaned up.
 		CnsVolumeOperationRequestCleanupIntervalInMin int `gcfg:"cnsvolumeoperationrequest-cleanup-intervalinmin"`
+		// FailCreateVolumeOnOperationStoreUnavailable, when set to true, makes CreateVolume fail
+		// with codes.Unavailable if the CnsVolumeOperationRequest store cannot be reached,
+		// instead of proceeding without recording the operation.
+		FailCreateVolumeOnOperationStoreUnavailable bool `gcfg:"fail-createvolume-on-operationstore-unavailable"`
+		// BatchAttachVolumes, when set to true, makes the WCP controller coalesce the
+		// ControllerPublishVolume requests for a PodVM which arrive while an attach to the
+		// same PodVM is in progress into a single CNS attach task.
+		BatchAttachVolumes bool `gcfg:"batch-attach-volumes"`
+		// FailCreateVolumeOnZonesWithoutTKGsHA, when set to true, makes CreateVolume fail
+		// with codes.FailedPrecondition if zones are requested while the tkgs-ha feature
+		// state switch is disabled, instead of ignoring the zones with a warning.
+		FailCreateVolumeOnZonesWithoutTKGsHA bool `gcfg:"fail-createvolume-on-zones-without-tkgs-ha"`
 
 		// QueryLimit specifies the number of volumes that can be fetched by CNS QueryAll API at a time
 		QueryLimit int `gcfg:"query-limit"`
 		// ListVolumeThreshold specifies the maximum number of differences in volume that can exist between CNS
 		// and kubernetes
 		ListVolumeThreshold int `gcfg:"list-volume-threshold"`
+		// DatastoreReservedCapacityPercent specifies the percentage of a datastore's capacity which
+		// is kept free. Datastores with less free space are not used to place new volumes.
+		// If not set, datastores are not filtered based on their free space.
+		DatastoreReservedCapacityPercent int `gcfg:"datastore-reserved-capacity-percent"`
+		// VCConnectTimeoutInSec specifies a time limit in seconds for each attempt
+		// to connect to vCenter when the controller starts up.
+		// If not set, default will be 60 seconds.
+		VCConnectTimeoutInSec int `gcfg:"vc-connect-timeout-insec"`
+		// VCConnectMaxAttempts specifies the number of attempts made to connect to
+		// vCenter when the controller starts up before giving up.
+		// If not set, default will be 3 attempts.
+		VCConnectMaxAttempts int `gcfg:"vc-connect-max-attempts"`
+		// DisableFileVolume when set to true makes the controller reject all file
+		// volume requests, irrespective of the file volume feature states.
+		DisableFileVolume bool `gcfg:"disable-file-volume"`
+		// DefaultFileVolumeSizeInGB specifies the size in GiB of file volumes
+		// created without a requested capacity.
+		// If not set, default will be 10 GiB, same as for block volumes.
+		DefaultFileVolumeSizeInGB int `gcfg:"default-file-volume-size-ingb"`
+		// PrometheusMetricsPort specifies the port on which the controller exposes
+		// Prometheus metrics. Environment variable CSI_METRICS_PORT takes
+		// precedence over this value.
+		// If not set, default will be 2112.
+		PrometheusMetricsPort int `gcfg:"prometheus-metrics-port"`
+		// TopologyComputationTimeoutInSec specifies a time limit in seconds for
+		// computing the shared datastores and the accessible topology of a block
+		// volume in CreateVolume. When exceeded, CreateVolume fails with a
+		// retryable DeadlineExceeded error.
+		// If not set, topology computation is not time limited.
+		TopologyComputationTimeoutInSec int `gcfg:"topology-computation-timeout-insec"`
+		// ReloadConfigRetryInitialIntervalInSec specifies the time in seconds to
+		// wait before retrying a failed reload of the configuration, e.g. when VC
+		// is briefly unreachable during a credential or CA rotation.
+		// If not set, default will be 5 seconds.
+		ReloadConfigRetryInitialIntervalInSec int `gcfg:"reload-config-retry-initial-interval-insec"`
+		// ReloadConfigRetryMultiplier specifies the factor by which the wait
+		// between retries of a failed reload of the configuration grows.
+		// If not set, default will be 2.
+		ReloadConfigRetryMultiplier int `gcfg:"reload-config-retry-multiplier"`
+		// ReloadConfigRetryMaxIntervalInSec specifies the maximum time in seconds
+		// to wait between retries of a failed reload of the configuration.
+		// If not set, default will be 60 seconds.
+		ReloadConfigRetryMaxIntervalInSec int `gcfg:"reload-config-retry-max-interval-insec"`
+		// HostMoidCacheTTLInSec specifies the time in seconds for which the
+		// host-moid of a node fetched from the K8sCloudOperator service is cached.
+		// If not set, default will be 60 seconds.
+		HostMoidCacheTTLInSec int `gcfg:"host-moid-cache-ttl-insec"`
 	}
 
 	// Multiple sets of Net Permissions applied to all file shares
@@ -96,6 +160,15 @@ type Config struct {
 		// create in the inventory using the UI.
 		// Maximum number of categories allowed is 5.
 		TopologyCategories string `gcfg:"topology-categories"`
+		// TopologyNodeSelector is a Kubernetes label selector, e.g.
+		// "topology.csi.vmware.com/participate=true", restricting the nodes
+		// considered for topology aware volume placement. All nodes
+		// participate when it is not set.
+		TopologyNodeSelector string `gcfg:"topology-node-selector"`
+		// DrainingTopologyValues is a comma separated string of topology values,
+		// i.e. tags or zones, being retired. New volumes are not placed in them
+		// while existing volumes are left untouched.
+		DrainingTopologyValues string `gcfg:"draining-topology-values"`
 	}
 
 	TopologyCategory map[string]*TopologyCategoryInfo
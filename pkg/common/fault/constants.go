@@ -22,9 +22,19 @@ const (
 	// CSIVmUuidNotFoundFault is the fault type when Pod VMs do not have the vmware-system-vm-uuid annotation.
 	CSIVmUuidNotFoundFault = "csi.fault.nonstorage.VmUuidNotFound"
 
+	// CSIVmNotFoundFault is the fault type when the Pod VM to attach a volume to is not found in vCenter.
+	CSIVmNotFoundFault = "csi.fault.nonstorage.VmNotFound"
+
+	// CSIVmPoweredOffFault is the fault type when the Pod VM to attach a volume to is powered off.
+	CSIVmPoweredOffFault = "csi.fault.nonstorage.VmPoweredOff"
+
 	// CSITaskResultEmptyFault is the fault type when taskResult is empty.
 	CSITaskResultEmptyFault = "csi.fault.TaskResultEmpty"
 
+	// CSITopologyServiceNotInitializedFault is the fault type when a volume is requested in
+	// zones but the topology service could not be initialized.
+	CSITopologyServiceNotInitializedFault = "csi.fault.nonstorage.TopologyServiceNotInitialized"
+
 	// CSIInternalFault is the fault type returned when CSI internal error occurs.
 	CSIInternalFault = "csi.fault.Internal"
 	// CSINotFoundFault is the fault type returned when object required is not found.
@@ -33,4 +43,12 @@ const (
 	CSIInvalidArgumentFault = "csi.fault.InvalidArgument"
 	// CSIUnimplementedFault is the fault type returned when the function is unimplemented.
 	CSIUnimplementedFault = "csi.fault.Unimplemented"
+	// CSIResourceExhaustedFault is the fault type returned when no datastore has enough capacity left.
+	CSIResourceExhaustedFault = "csi.fault.ResourceExhausted"
+	// CSIFailedPreconditionFault is the fault type returned when the system is not in a state required
+	// for the operation.
+	CSIFailedPreconditionFault = "csi.fault.FailedPrecondition"
+	// CSIAlreadyExistsFault is the fault type returned when a volume with the requested name already exists
+	// and is not compatible with the request.
+	CSIAlreadyExistsFault = "csi.fault.AlreadyExists"
 )
@@ -32,6 +32,14 @@ const (
 	// PrometheusUnknownNamespace is used when namespace isn't set by sidecars for a volume operation.
 	PrometheusUnknownNamespace = "unknown"
 
+	// PrometheusUnknownZone is used when the zone of a volume could not be found.
+	PrometheusUnknownZone = "unknown"
+
+	// PrometheusAvailabilityZoneInformer represents the AvailabilityZone informer.
+	PrometheusAvailabilityZoneInformer = "availabilityzone"
+	// PrometheusCSINodeTopologyInformer represents the CSINodeTopology informer.
+	PrometheusCSINodeTopologyInformer = "csinodetopology"
+
 	// CSI operation types
 
 	// PrometheusCreateVolumeOpType represents the CreateVolume operation.
@@ -50,6 +58,8 @@ const (
 	PrometheusDeleteSnapshotOpType = "delete-snapshot"
 	// PrometheusListSnapshotsOpType represents the ListSnapshots operation.
 	PrometheusListSnapshotsOpType = "list-snapshot"
+	// PrometheusModifyVolumeStoragePolicyOpType represents the ModifyVolumeStoragePolicy operation.
+	PrometheusModifyVolumeStoragePolicyOpType = "modify-volume-storage-policy"
 
 	// CNS operation types
 
@@ -73,6 +83,8 @@ const (
 	PrometheusCnsQueryVolumeInfoOpType = "query-volume-info"
 	// PrometheusCnsRelocateVolumeOpType represents the RelocateVolume operation.
 	PrometheusCnsRelocateVolumeOpType = "relocate-volume"
+	// PrometheusCnsUpdateVolumeStoragePolicyOpType represents the UpdateVolumeStoragePolicy operation.
+	PrometheusCnsUpdateVolumeStoragePolicyOpType = "update-volume-storage-policy"
 	// PrometheusCnsConfigureVolumeACLOpType represents the ConfigureVolumeAcl operation.
 	PrometheusCnsConfigureVolumeACLOpType = "configure-volume-acl"
 	// PrometheusQuerySnapshotsOpType represents QuerySnapshots operation.
@@ -86,6 +98,15 @@ const (
 	// PrometheusInaccessibleVolumes represents inaccessible volumes.
 	PrometheusInaccessibleVolumes = "inaccessible-volumes"
 
+	// Reload configuration triggers
+
+	// PrometheusReloadConfigTriggerConfigChange represents a configuration reload
+	// triggered by a change in the vSphere config secret.
+	PrometheusReloadConfigTriggerConfigChange = "config-change"
+	// PrometheusReloadConfigTriggerCARotation represents a configuration reload
+	// triggered by a rotation of the vCenter CA file.
+	PrometheusReloadConfigTriggerCARotation = "ca-rotation"
+
 	// PrometheusPassStatus represents a successful API run.
 	PrometheusPassStatus = "pass"
 	// PrometheusFailStatus represents an unsuccessful API run.
@@ -135,6 +156,22 @@ var (
 		// Possible status - "pass", "fail"
 		[]string{"optype", "status"})
 
+	// CsiCnsUtilOpsHistVec is a histogram vector metric to observe the time taken
+	// by the CNS util calls made by CSI operations. Together with
+	// CsiControlOpsHistVec, it attributes the latency of a CSI operation to CNS
+	// versus the driver logic.
+	CsiCnsUtilOpsHistVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "vsphere_csi_cns_util_ops_histogram",
+		Help: "Histogram vector for CNS util calls made by CSI volume operations.",
+		// Using the same buckets as CsiControlOpsHistVec so that both the
+		// metrics can be compared.
+		Buckets: []float64{1, 2, 3, 4, 5, 7, 10, 12, 15, 18, 20, 25, 30, 60, 120, 180, 300},
+	},
+		// Possible voltype - "unknown", "block", "file"
+		// Possible optype - "create-volume", "delete-volume", "attach-volume", "detach-volume", "expand-volume", etc
+		// Possible status - "pass", "fail"
+		[]string{"voltype", "optype", "status"})
+
 	// VolumeHealthGaugeVec is a gauge metric to observe the number of accessible and inaccessible volumes.
 	VolumeHealthGaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "vsphere_volume_health_gauge",
@@ -154,4 +191,82 @@ var (
 	},
 		// Possible status - "pass", "fail"
 		[]string{"status"})
+
+	// ReloadConfigOpsCounterVec is a counter vector metric to observe the outcome of
+	// reload configuration attempts.
+	ReloadConfigOpsCounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vsphere_csi_reload_config_ops_total",
+		Help: "Total number of CSI reload configuration attempts.",
+	},
+		// Possible trigger - "config-change", "ca-rotation"
+		// Possible status - "pass", "fail"
+		[]string{"trigger", "status"})
+
+	// ReloadConfigLastSuccessGaugeVec is a gauge vector metric to observe the unix
+	// timestamp of the last successful reload configuration.
+	ReloadConfigLastSuccessGaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vsphere_csi_reload_config_last_success_timestamp_seconds",
+		Help: "Unix timestamp of the last successful CSI reload configuration.",
+	},
+		// Possible trigger - "config-change", "ca-rotation"
+		[]string{"trigger"})
+
+	// AttachDetachRetryCounterVec is a counter vector metric to observe retries of
+	// attach and detach operations, i.e. attempts made for a volume and node after
+	// a previous attempt for the same volume and node has failed.
+	AttachDetachRetryCounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vsphere_csi_attach_detach_retries_total",
+		Help: "Total number of CSI attach and detach retry attempts.",
+	},
+		// Possible optype - "attach-volume", "detach-volume"
+		// Possible status - "pass", "fail"
+		[]string{"optype", "status"})
+
+	// VolumeDeleteZoneCounterVec is a counter vector metric to observe the zones
+	// of volumes deleted by the CSI driver.
+	VolumeDeleteZoneCounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vsphere_csi_delete_volume_zone_ops_total",
+		Help: "Total number of CSI delete volume operations per volume zone.",
+	},
+		// Possible zone - zone name, "unknown"
+		// Possible status - "pass", "fail"
+		[]string{"zone", "status"})
+
+	// VolumeCreateSizeHistVec is a histogram vector metric to observe the size in
+	// GiB of volumes successfully created by the CSI driver.
+	VolumeCreateSizeHistVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "vsphere_csi_create_volume_size_gib_histogram",
+		Help: "Histogram vector for the size in GiB of volumes created by CSI.",
+		// Buckets grow exponentially as volume sizes span several orders of
+		// magnitude.
+		Buckets: []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1024, 2048, 4096, 8192, 16384, 65536},
+	},
+		// Possible voltype - "unknown", "block", "file"
+		[]string{"voltype"})
+
+	// TopologyInformerLastSyncGaugeVec is a gauge vector metric to observe the unix
+	// timestamp at which a topology informer was last known to be in sync with
+	// the API server.
+	TopologyInformerLastSyncGaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vsphere_csi_topology_informer_last_sync_timestamp_seconds",
+		Help: "Unix timestamp at which the topology informer was last in sync with the API server.",
+	},
+		// Possible informer - "availabilityzone", "csinodetopology"
+		[]string{"informer"})
+
+	// TopologyConflictingNodeLabelsCounterVec is a counter vector metric to observe
+	// nodes found under more than one value of the same topology key.
+	TopologyConflictingNodeLabelsCounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vsphere_csi_topology_conflicting_node_labels_total",
+		Help: "Total number of times a node was found under multiple values of the same topology key.",
+	},
+		// Possible key - topology key, e.g. "topology.csi.vmware.com/k8s-zone"
+		[]string{"key"})
+
+	// TopologyDuplicateCSINodeTopologyCounter is a counter metric to observe
+	// multiple CSINodeTopology instances found for the same node.
+	TopologyDuplicateCSINodeTopologyCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "vsphere_csi_topology_duplicate_csinodetopology_total",
+		Help: "Total number of times multiple CSINodeTopology instances were found for the same node.",
+	})
 )
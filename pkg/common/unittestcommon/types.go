@@ -29,6 +29,8 @@ import (
 // FakeK8SOrchestrator is used to mock common K8S Orchestrator instance to store FSS values
 type FakeK8SOrchestrator struct {
 	featureStates map[string]string
+	// volumeIDToNodeNames holds the names of the nodes each volume is attached to
+	volumeIDToNodeNames map[string][]string
 }
 
 // volumeMigration holds mocked migrated volume information
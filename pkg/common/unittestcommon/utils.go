@@ -51,6 +51,7 @@ func GetFakeContainerOrchestratorInterface(orchestratorType int) (commonco.COCom
 				"block-volume-snapshot": "true",
 				"tkgs-ha":               "true",
 				"list-volumes":          "true",
+				"capacity-tracking":     "true",
 			},
 		}
 		return fakeCO, nil
@@ -73,6 +74,11 @@ func (c *FakeK8SOrchestrator) IsFSSEnabled(ctx context.Context, featureName stri
 	return false
 }
 
+// SetFSS sets the state of the given feature in the fake CO.
+func (c *FakeK8SOrchestrator) SetFSS(featureName string, enabled bool) {
+	c.featureStates[featureName] = strconv.FormatBool(enabled)
+}
+
 // IsFakeAttachAllowed checks if the passed volume can be fake attached and mark it as fake attached.
 func (c *FakeK8SOrchestrator) IsFakeAttachAllowed(
 	ctx context.Context,
@@ -108,6 +114,13 @@ func (nodeTopology *mockNodeVolumeTopology) GetNodeTopologyLabels(ctx context.Co
 	return nil, logger.LogNewError(log, "GetNodeTopologyLabels is not yet implemented.")
 }
 
+// RefreshAllNodeTopologyLabels re-computes the topology labels of all the nodes.
+func (nodeTopology *mockNodeVolumeTopology) RefreshAllNodeTopologyLabels(ctx context.Context) (
+	map[string]map[string]string, error) {
+	log := logger.GetLogger(ctx)
+	return nil, logger.LogNewError(log, "RefreshAllNodeTopologyLabels is not yet implemented.")
+}
+
 // GetSharedDatastoresInTopology retrieves shared datastores of nodes which satisfy a given topology requirement.
 func (cntrlTopology *mockControllerVolumeTopology) GetSharedDatastoresInTopology(ctx context.Context,
 	reqParams interface{}) ([]*cnsvsphere.DatastoreInfo, error) {
@@ -122,6 +135,27 @@ func (cntrlTopology *mockControllerVolumeTopology) GetTopologyInfoFromNodes(ctx
 	return nil, logger.LogNewError(log, "GetTopologyInfoFromNodes is not yet implemented.")
 }
 
+// GetZonesForCluster returns the zones the given cluster belongs to.
+func (cntrlTopology *mockControllerVolumeTopology) GetZonesForCluster(ctx context.Context,
+	clusterMoref string) []string {
+	return nil
+}
+
+// HasSynced returns true as the mocked topology service has no informers.
+func (cntrlTopology *mockControllerVolumeTopology) HasSynced() bool {
+	return true
+}
+
+// WaitForSync returns true as the mocked topology service has no informers.
+func (cntrlTopology *mockControllerVolumeTopology) WaitForSync(ctx context.Context) bool {
+	return true
+}
+
+// SetDrainingTopologyValues is a no-op for the mocked topology service.
+func (cntrlTopology *mockControllerVolumeTopology) SetDrainingTopologyValues(ctx context.Context,
+	values []string) {
+}
+
 // InitTopologyServiceInController returns a singleton implementation of the
 // commoncotypes.ControllerTopologyService interface for the FakeK8SOrchestrator.
 func (c *FakeK8SOrchestrator) InitTopologyServiceInController(ctx context.Context) (
@@ -130,6 +164,10 @@ func (c *FakeK8SOrchestrator) InitTopologyServiceInController(ctx context.Contex
 	return &mockControllerVolumeTopology{}, nil
 }
 
+// ResetTopologyServiceInController is a no-op for the FakeK8SOrchestrator.
+func (c *FakeK8SOrchestrator) ResetTopologyServiceInController(ctx context.Context) {
+}
+
 // InitTopologyServiceInNode returns a singleton implementation of the
 //commoncotypes.NodeTopologyService interface for the FakeK8SOrchestrator.
 func (c *FakeK8SOrchestrator) InitTopologyServiceInNode(ctx context.Context) (
@@ -215,5 +253,24 @@ func (f *fakeVolumeOperationRequestInterface) StoreRequestDetails(
 // GetNodesForVolumes returns nodeNames to which the given volumeIDs are attached
 func (c *FakeK8SOrchestrator) GetNodesForVolumes(ctx context.Context, volumeID []string) map[string][]string {
 	nodeNames := make(map[string][]string)
+	for _, id := range volumeID {
+		if names, ok := c.volumeIDToNodeNames[id]; ok {
+			nodeNames[id] = names
+		}
+	}
 	return nodeNames
 }
+
+// SetNodesForVolume sets the names of the nodes the given volume is attached
+// to in the fake CO.
+func (c *FakeK8SOrchestrator) SetNodesForVolume(volumeID string, nodeNames []string) {
+	if c.volumeIDToNodeNames == nil {
+		c.volumeIDToNodeNames = make(map[string][]string)
+	}
+	c.volumeIDToNodeNames[volumeID] = nodeNames
+}
+
+// GetZonesForVolume returns the zones in which the given volume is accessible
+func (c *FakeK8SOrchestrator) GetZonesForVolume(ctx context.Context, volumeID string) []string {
+	return nil
+}
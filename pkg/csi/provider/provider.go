@@ -17,7 +17,7 @@ limitations under the License.
 package provider
 
 import (
-	"github.com/rexray/gocsi"
+	"github.com/dell/gocsi"
 
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service"
 )
@@ -50,6 +50,11 @@ type AuthorizationService interface {
 
 	// ResetvCenterInstance sets new vCenter instance for AuthorizationService
 	ResetvCenterInstance(ctx context.Context, vCenter *cnsvsphere.VirtualCenter)
+
+	// RefreshFsEnabledClusterToDsMap recomputes the map of vSAN clusters with
+	// file services enabled to their datastores without waiting for the next
+	// periodic refresh.
+	RefreshFsEnabledClusterToDsMap(ctx context.Context)
 }
 
 // AuthManager maintains an internal map to track the datastores that need to be
@@ -128,6 +133,14 @@ func (authManager *AuthManager) ResetvCenterInstance(ctx context.Context, vCente
 	authManager.vcenter = vCenter
 }
 
+// RefreshFsEnabledClusterToDsMap recomputes the fsEnabledClusterToDsMap
+// immediately.
+func (authManager *AuthManager) RefreshFsEnabledClusterToDsMap(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	log.Info("Refreshing fsEnabledClusterToDsMap in the AuthManager")
+	authManager.refreshFSEnabledClustersToDsMap()
+}
+
 // refreshDatastoreMapForBlockVolumes scans all datastores in vCenter to check
 // privileges, and compute the datastoreMapForBlockVolumes.
 func (authManager *AuthManager) refreshDatastoreMapForBlockVolumes() {
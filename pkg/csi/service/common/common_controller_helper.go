@@ -21,15 +21,23 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	cnstypes "github.com/vmware/govmomi/cns/types"
 	vim25types "github.com/vmware/govmomi/vim25/types"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/volume"
 	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/vsphere"
+	csifault "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/fault"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/utils"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/logger"
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/internalapis/cnsvolumeoperationrequest"
 )
 
 // ValidateCreateVolumeRequest is the helper function to validate
@@ -294,3 +302,391 @@ func CheckPVtoBackingDiskObjectIdSupport(ctx context.Context, vc *cnsvsphere.Vir
 	log.Infof("vCenter API version: %s supports CNS PV to BackingDiskObjectId mapping.", currentVcVersion)
 	return true
 }
+
+// GetExpandVolumeErrorCode classifies the fault type returned by
+// ExpandVolumeUtil into a gRPC code. Transient faults are mapped to Aborted or
+// Unavailable so that external-resizer retries them, while terminal faults are
+// mapped to InvalidArgument or Internal.
+func GetExpandVolumeErrorCode(faultType string) codes.Code {
+	switch faultType {
+	case "vim.fault.TaskInProgress", "vim.fault.ConcurrentAccess", "vim.fault.ResourceInUse":
+		return codes.Aborted
+	case "vim.fault.HostCommunication", "vim.fault.HostNotConnected", "vim.fault.Timedout",
+		"vim.fault.NotAuthenticated":
+		return codes.Unavailable
+	case "vim.fault.InvalidArgument", csifault.CSIInvalidArgumentFault:
+		return codes.InvalidArgument
+	default:
+		return codes.Internal
+	}
+}
+
+// SetRetryAfterTrailer attaches a "retry-after" hint, in seconds, to the gRPC
+// trailer metadata if the given error has a retryable code, so that sidecars
+// honoring it back off by the driver suggested interval.
+func SetRetryAfterTrailer(ctx context.Context, err error) {
+	log := logger.GetLogger(ctx)
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted, codes.ResourceExhausted:
+		trailer := metadata.Pairs(RetryAfterMetadataKey, strconv.Itoa(DefaultRetryAfterIntervalInSec))
+		if trailerErr := grpc.SetTrailer(ctx, trailer); trailerErr != nil {
+			log.Debugf("failed to set %q trailer. Error: %+v", RetryAfterMetadataKey, trailerErr)
+		}
+	}
+}
+
+// ValidateCreateSnapshotRequest is the helper function to validate
+// CreateSnapshotRequest for all block controllers.
+// Function returns error if validation fails otherwise returns nil.
+func ValidateCreateSnapshotRequest(ctx context.Context, req *csi.CreateSnapshotRequest) error {
+	log := logger.GetLogger(ctx)
+	if len(req.GetSourceVolumeId()) == 0 {
+		return logger.LogNewErrorCode(log, codes.InvalidArgument,
+			"CreateSnapshot Source Volume ID must be provided")
+	}
+	if len(req.Name) == 0 {
+		return logger.LogNewErrorCode(log, codes.InvalidArgument,
+			"Snapshot name must be provided")
+	}
+	return nil
+}
+
+// ValidateDeleteSnapshotRequest is the helper function to validate
+// DeleteSnapshotRequest for all block controllers.
+// Function returns error if validation fails otherwise returns nil.
+func ValidateDeleteSnapshotRequest(ctx context.Context, req *csi.DeleteSnapshotRequest) error {
+	log := logger.GetLogger(ctx)
+	if len(req.GetSnapshotId()) == 0 {
+		return logger.LogNewErrorCode(log, codes.InvalidArgument,
+			"DeleteSnapshot Snapshot ID must be provided")
+	}
+	return nil
+}
+
+// ValidateListSnapshotRequest is the helper function to validate
+// ListSnapshotRequest for all block controllers.
+// Function returns error if validation fails otherwise returns nil.
+func ValidateListSnapshotRequest(ctx context.Context, req *csi.ListSnapshotsRequest) error {
+	log := logger.GetLogger(ctx)
+	if req.MaxEntries < 0 {
+		return logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"ListSnapshots MaxEntries: %d cannot be negative", req.MaxEntries)
+	}
+	// Validate the starting token by verifying that it can be converted to an int.
+	if req.StartingToken != "" {
+		if _, err := strconv.Atoi(req.StartingToken); err != nil {
+			return logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"ListSnapshots StartingToken: %s cannot be parsed", req.StartingToken)
+		}
+	}
+	// Validate snapshot-id conforms to vSphere CSI driver format if specified.
+	if req.SnapshotId != "" && !strings.Contains(req.SnapshotId, VSphereCSISnapshotIdDelimiter) {
+		return logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"ListSnapshots SnapshotId: %s is incorrectly formatted for vSphere CSI driver", req.SnapshotId)
+	}
+	return nil
+}
+
+// checkCnsSnapshotSupported returns an Unimplemented error if the vCenter of
+// the given manager does not support CNS snapshots.
+func checkCnsSnapshotSupported(ctx context.Context, manager *Manager) error {
+	log := logger.GetLogger(ctx)
+	isCnsSnapshotSupported, err := manager.VcenterManager.IsCnsSnapshotSupported(ctx, manager.VcenterConfig.Host)
+	if err != nil {
+		return logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to check if cns snapshot is supported on VC due to error: %v", err)
+	}
+	if !isCnsSnapshotSupported {
+		return logger.LogNewErrorCode(log, codes.Unimplemented,
+			"VC version does not support snapshot operations")
+	}
+	return nil
+}
+
+// ListSnapshots is the helper function to serve ListSnapshotsRequest for all
+// block controllers. The snapshots can be filtered by source volume or
+// snapshot ID and are paginated using the starting token and max entries of
+// the request.
+func ListSnapshots(ctx context.Context, manager *Manager, req *csi.ListSnapshotsRequest) (
+	*csi.ListSnapshotsResponse, error) {
+	start := time.Now()
+	log := logger.GetLogger(ctx)
+	volumeType := prometheus.PrometheusBlockVolumeType
+	namespace := prometheus.PrometheusUnknownNamespace
+	if err := checkCnsSnapshotSupported(ctx, manager); err != nil {
+		return nil, err
+	}
+
+	listSnapshotsInternal := func() (*csi.ListSnapshotsResponse, error) {
+		log.Infof("ListSnapshots: called with args %+v", *req)
+		err := ValidateListSnapshotRequest(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		maxEntries := QuerySnapshotLimit
+		if req.MaxEntries != 0 {
+			maxEntries = int64(req.MaxEntries)
+		}
+		cnsOpStart := time.Now()
+		snapshots, nextToken, err := ListSnapshotsUtil(ctx, manager.VolumeManager, req.SourceVolumeId,
+			req.SnapshotId, req.StartingToken, maxEntries)
+		ObserveCnsUtilOpLatency(prometheus.PrometheusBlockVolumeType, prometheus.PrometheusListSnapshotsOpType,
+			cnsOpStart, err)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal, "failed to retrieve the snapshots, err: %+v", err)
+		}
+		var entries []*csi.ListSnapshotsResponse_Entry
+		for _, snapshot := range snapshots {
+			entries = append(entries, &csi.ListSnapshotsResponse_Entry{
+				Snapshot: snapshot,
+			})
+		}
+		log.Infof("ListSnapshots served %d results, token for next set: %s", len(entries), nextToken)
+		return &csi.ListSnapshotsResponse{
+			Entries:   entries,
+			NextToken: nextToken,
+		}, nil
+	}
+	resp, err := listSnapshotsInternal()
+	if err != nil {
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusListSnapshotsOpType,
+			prometheus.PrometheusFailStatus, namespace, "NotComputed").Observe(time.Since(start).Seconds())
+	} else {
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusListSnapshotsOpType,
+			prometheus.PrometheusPassStatus, namespace, "").Observe(time.Since(start).Seconds())
+	}
+	return resp, err
+}
+
+// getMaxSnapshotsPerBlockVolume returns the maximum number of snapshots of a
+// block volume on the datastore with the given URL. The granular maximum of
+// vSAN and VVOL datastores overrides the global maximum if it is set.
+func getMaxSnapshotsPerBlockVolume(ctx context.Context, manager *Manager, datastoreURL string) int {
+	log := logger.GetLogger(ctx)
+	snapshotConfig := manager.CnsConfig.Snapshot
+	maxSnapshotsPerBlockVolume := snapshotConfig.GlobalMaxSnapshotsPerBlockVolume
+	log.Infof("The limit of the maximum number of snapshots per block volume is "+
+		"set to the global maximum (%v) by default.", maxSnapshotsPerBlockVolume)
+	var isGranularMaxEnabled bool
+	if strings.Contains(datastoreURL, strings.ToLower(string(vim25types.HostFileSystemVolumeFileSystemTypeVsan))) {
+		if snapshotConfig.GranularMaxSnapshotsPerBlockVolumeInVSAN > 0 {
+			maxSnapshotsPerBlockVolume = snapshotConfig.GranularMaxSnapshotsPerBlockVolumeInVSAN
+			isGranularMaxEnabled = true
+		}
+	} else if strings.Contains(datastoreURL, strings.ToLower(string(vim25types.HostFileSystemVolumeFileSystemTypeVVOL))) {
+		if snapshotConfig.GranularMaxSnapshotsPerBlockVolumeInVVOL > 0 {
+			maxSnapshotsPerBlockVolume = snapshotConfig.GranularMaxSnapshotsPerBlockVolumeInVVOL
+			isGranularMaxEnabled = true
+		}
+	}
+	if isGranularMaxEnabled {
+		log.Infof("The limit of the maximum number of snapshots per block volume on datastore %q is "+
+			"overridden by the granular maximum (%v).", datastoreURL, maxSnapshotsPerBlockVolume)
+	}
+	return maxSnapshotsPerBlockVolume
+}
+
+// CreateSnapshot is the helper function to serve CreateSnapshotRequest for
+// all block controllers. It creates a CNS snapshot of the source block volume
+// unless the number of its snapshots reaches the configured maximum.
+func CreateSnapshot(ctx context.Context, manager *Manager, req *csi.CreateSnapshotRequest) (
+	*csi.CreateSnapshotResponse, error) {
+	log := logger.GetLogger(ctx)
+	log.Infof("CreateSnapshot: called with args %+v", *req)
+	if err := checkCnsSnapshotSupported(ctx, manager); err != nil {
+		return nil, err
+	}
+	volumeType := prometheus.PrometheusUnknownVolumeType
+	namespace := prometheus.PrometheusUnknownNamespace
+	createSnapshotInternal := func() (*csi.CreateSnapshotResponse, error) {
+		if err := ValidateCreateSnapshotRequest(ctx, req); err != nil {
+			return nil, err
+		}
+		volumeID := req.GetSourceVolumeId()
+
+		// Check if the source volume is migrated vSphere volume.
+		if strings.Contains(volumeID, ".vmdk") {
+			return nil, logger.LogNewErrorCodef(log, codes.Unimplemented,
+				"cannot snapshot migrated vSphere volume. :%q", volumeID)
+		}
+		volumeType = prometheus.PrometheusBlockVolumeType
+		// Query capacity in MB and datastore url for block volume snapshot.
+		volumeIds := []cnstypes.CnsVolumeId{{Id: volumeID}}
+		cnsVolumeDetailsMap, err := utils.QueryVolumeDetailsUtil(ctx, manager.VolumeManager, volumeIds)
+		if err != nil {
+			return nil, err
+		}
+		volumeDetails, ok := cnsVolumeDetailsMap[volumeID]
+		if !ok {
+			return nil, logger.LogNewErrorCodef(log, codes.NotFound,
+				"source volume %q not found", volumeID)
+		}
+		if volumeDetails.VolumeType != BlockVolumeType {
+			return nil, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
+				"queried volume doesn't have the expected volume type. Expected VolumeType: %v. "+
+					"Queried VolumeType: %v", volumeType, volumeDetails.VolumeType)
+		}
+
+		// Check if snapshots number of this volume reaches the limit.
+		maxSnapshotsPerBlockVolume := getMaxSnapshotsPerBlockVolume(ctx, manager, volumeDetails.DatastoreUrl)
+		snapshotList, _, err := QueryVolumeSnapshotsByVolumeID(ctx, manager.VolumeManager, volumeID,
+			"", QuerySnapshotLimit)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to query snapshots of volume %s for the limit check. Error: %v", volumeID, err)
+		}
+		if len(snapshotList) >= maxSnapshotsPerBlockVolume {
+			return nil, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
+				"the number of snapshots on the source volume %s reaches the configured maximum (%v)",
+				volumeID, maxSnapshotsPerBlockVolume)
+		}
+
+		// The returned snapshotID is a combination of CNS VolumeID and CNS
+		// SnapshotID concatenated by the "+" sign. That is, a string of
+		// "<UUID>+<UUID>". All other CNS snapshot APIs still require both
+		// VolumeID and SnapshotID as the input, while the corresponding snapshot
+		// APIs in upstream CSI require SnapshotID only.
+		cnsOpStart := time.Now()
+		snapshotID, snapshotCreateTimePtr, err := CreateSnapshotUtil(ctx, manager, volumeID, req.Name)
+		ObserveCnsUtilOpLatency(prometheus.PrometheusBlockVolumeType, prometheus.PrometheusCreateSnapshotOpType,
+			cnsOpStart, err)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to create snapshot on volume %q: %v", volumeID, err)
+		}
+		snapshotCreateTimeInProto := timestamppb.New(*snapshotCreateTimePtr)
+		createSnapshotResponse := &csi.CreateSnapshotResponse{
+			Snapshot: &csi.Snapshot{
+				SizeBytes:      volumeDetails.SizeInMB * MbInBytes,
+				SnapshotId:     snapshotID,
+				SourceVolumeId: volumeID,
+				CreationTime:   snapshotCreateTimeInProto,
+				ReadyToUse:     true,
+			},
+		}
+		log.Infof("CreateSnapshot succeeded for snapshot %s "+
+			"on volume %s size %d Time proto %+v Timestamp %+v Response: %+v",
+			snapshotID, volumeID, volumeDetails.SizeInMB*MbInBytes, snapshotCreateTimeInProto,
+			*snapshotCreateTimePtr, createSnapshotResponse)
+		return createSnapshotResponse, nil
+	}
+
+	start := time.Now()
+	resp, err := createSnapshotInternal()
+	if err != nil {
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusCreateSnapshotOpType,
+			prometheus.PrometheusFailStatus, namespace, "NotComputed").Observe(time.Since(start).Seconds())
+	} else {
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusCreateSnapshotOpType,
+			prometheus.PrometheusPassStatus, namespace, "").Observe(time.Since(start).Seconds())
+	}
+	return resp, err
+}
+
+// DeleteSnapshot is the helper function to serve DeleteSnapshotRequest for
+// all block controllers. Deleting a snapshot which does not exist succeeds.
+func DeleteSnapshot(ctx context.Context, manager *Manager, req *csi.DeleteSnapshotRequest) (
+	*csi.DeleteSnapshotResponse, error) {
+	log := logger.GetLogger(ctx)
+	log.Infof("DeleteSnapshot: called with args %+v", *req)
+	if err := checkCnsSnapshotSupported(ctx, manager); err != nil {
+		return nil, err
+	}
+	deleteSnapshotInternal := func() (*csi.DeleteSnapshotResponse, error) {
+		if err := ValidateDeleteSnapshotRequest(ctx, req); err != nil {
+			return nil, err
+		}
+		csiSnapshotID := req.GetSnapshotId()
+		volumeID, cnsSnapshotID, err := ParseCSISnapshotID(csiSnapshotID)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"failed to parse snapshot ID %q. Error: %v", csiSnapshotID, err)
+		}
+		// Skip the deletion if the snapshot or its source volume no longer exists.
+		snapshots, _, err := QueryVolumeSnapshotsByVolumeID(ctx, manager.VolumeManager, volumeID,
+			"", QuerySnapshotLimit)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to query snapshots of volume %q. Error: %v", volumeID, err)
+		}
+		found := false
+		for _, snapshot := range snapshots {
+			if snapshot.SnapshotId == csiSnapshotID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.Infof("DeleteSnapshot: snapshot %q of volume %q not found, thus returning success",
+				cnsSnapshotID, volumeID)
+			return &csi.DeleteSnapshotResponse{}, nil
+		}
+		cnsOpStart := time.Now()
+		err = DeleteSnapshotUtil(ctx, manager, csiSnapshotID)
+		ObserveCnsUtilOpLatency(prometheus.PrometheusBlockVolumeType, prometheus.PrometheusDeleteSnapshotOpType,
+			cnsOpStart, err)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to delete snapshot %q. Error: %+v", csiSnapshotID, err)
+		}
+		log.Infof("DeleteSnapshot: successfully deleted snapshot %q", csiSnapshotID)
+		return &csi.DeleteSnapshotResponse{}, nil
+	}
+
+	volumeType := prometheus.PrometheusBlockVolumeType
+	namespace := prometheus.PrometheusUnknownNamespace
+	start := time.Now()
+	resp, err := deleteSnapshotInternal()
+	if err != nil {
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusDeleteSnapshotOpType,
+			prometheus.PrometheusFailStatus, namespace, "NotComputed").Observe(time.Since(start).Seconds())
+	} else {
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusDeleteSnapshotOpType,
+			prometheus.PrometheusPassStatus, namespace, "").Observe(time.Since(start).Seconds())
+	}
+	return resp, err
+}
+
+// CheckExistingVolumeCapacity returns an AlreadyExists error if a volume with
+// the given name was already created by a previous CreateVolume call with a
+// capacity that is not compatible with the given capacity range. The volume
+// created earlier is looked up in the given operation store, which is nil if
+// idempotency handling is disabled, and its capacity is queried from CNS.
+func CheckExistingVolumeCapacity(ctx context.Context, manager *Manager,
+	operationStore cnsvolumeoperationrequest.VolumeOperationRequest, volumeName string,
+	capacityRange *csi.CapacityRange) error {
+	log := logger.GetLogger(ctx)
+	if operationStore == nil || capacityRange == nil {
+		return nil
+	}
+	volumeOperationDetails, err := operationStore.GetRequestDetails(ctx, volumeName)
+	if err != nil || volumeOperationDetails.OperationDetails == nil || volumeOperationDetails.VolumeID == "" ||
+		volumeOperationDetails.OperationDetails.TaskStatus != cnsvolumeoperationrequest.TaskInvocationStatusSuccess {
+		return nil
+	}
+	volumeID := volumeOperationDetails.VolumeID
+	queryFilter := cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeID}},
+	}
+	querySelection := cnstypes.CnsQuerySelection{
+		Names: []string{string(cnstypes.QuerySelectionNameTypeBackingObjectDetails)},
+	}
+	queryResult, err := manager.VolumeManager.QueryAllVolume(ctx, queryFilter, querySelection)
+	if err != nil {
+		log.Warnf("failed to query the capacity of volume %q created for %q. Error: %+v", volumeID, volumeName, err)
+		return nil
+	}
+	if len(queryResult.Volumes) == 0 || queryResult.Volumes[0].BackingObjectDetails == nil {
+		return nil
+	}
+	existingCapacityMB := queryResult.Volumes[0].BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+	requiredMB := int64(RoundUpSize(capacityRange.GetRequiredBytes(), MbInBytes))
+	limitBytes := capacityRange.GetLimitBytes()
+	if existingCapacityMB < requiredMB || (limitBytes != 0 && existingCapacityMB*MbInBytes > limitBytes) {
+		return logger.LogNewErrorCodef(log, codes.AlreadyExists,
+			"volume %q already exists with volumeID %q and capacity %d Mb, which is not compatible with the "+
+				"requested capacity range (required: %d bytes, limit: %d bytes)", volumeName, volumeID,
+			existingCapacityMB, capacityRange.GetRequiredBytes(), limitBytes)
+	}
+	return nil
+}
@@ -21,6 +21,9 @@ import (
 	"testing"
 
 	vim25types "github.com/vmware/govmomi/vim25/types"
+	"google.golang.org/grpc/codes"
+
+	csifault "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/fault"
 )
 
 // TestUseVslmAPIsFuncForVC67Update3l tests UseVslmAPIs method for VC version 6.7 Update 3l
@@ -174,3 +177,20 @@ func TestUseVslmAPIsFuncForVC70u1(t *testing.T) {
 		t.Fatal("Received error from UseVslmAPIs method")
 	}
 }
+
+// TestGetExpandVolumeErrorCode tests classification of expand volume faults.
+func TestGetExpandVolumeErrorCode(t *testing.T) {
+	tests := map[string]codes.Code{
+		"vim.fault.TaskInProgress":       codes.Aborted,
+		"vim.fault.HostCommunication":    codes.Unavailable,
+		"vim.fault.InvalidArgument":      codes.InvalidArgument,
+		csifault.CSIInvalidArgumentFault: codes.InvalidArgument,
+		csifault.CSIInternalFault:        codes.Internal,
+		"":                               codes.Internal,
+	}
+	for faultType, expected := range tests {
+		if code := GetExpandVolumeErrorCode(faultType); code != expected {
+			t.Errorf("expected code %v for fault type %q, got %v", expected, faultType, code)
+		}
+	}
+}
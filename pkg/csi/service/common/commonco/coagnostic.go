@@ -48,11 +48,17 @@ type COCommonInterface interface {
 	// InitTopologyServiceInController initializes the necessary resources
 	// required for topology related functionality in the controller.
 	InitTopologyServiceInController(ctx context.Context) (types.ControllerTopologyService, error)
+	// ResetTopologyServiceInController stops the resources of the topology
+	// service in the controller so that it is initialized afresh on the next
+	// call to InitTopologyServiceInController.
+	ResetTopologyServiceInController(ctx context.Context)
 	// InitTopologyServiceInNode initializes the necessary resources
 	// required for topology related functionality in the nodes.
 	InitTopologyServiceInNode(ctx context.Context) (types.NodeTopologyService, error)
 	// GetNodesForVolumes returns a map of volumeID to list of node names
 	GetNodesForVolumes(ctx context.Context, volumeIds []string) map[string][]string
+	// GetZonesForVolume returns the zones in which the given volume is accessible
+	GetZonesForVolume(ctx context.Context, volumeID string) []string
 }
 
 // GetContainerOrchestratorInterface returns orchestrator object for a given
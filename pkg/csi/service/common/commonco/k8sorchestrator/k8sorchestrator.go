@@ -33,9 +33,11 @@ import (
 	apiMeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/informers"
 	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -134,6 +136,35 @@ func (m *volumeIDToNodesMap) get(volumeID string) []string {
 	return m.items[volumeID]
 }
 
+// volumeIDToZonesMap maps a volumeID to the zones in its PV node affinity.
+// The methods to add, remove and get entries from the map in a threadsafe
+// manner are defined.
+type volumeIDToZonesMap struct {
+	*sync.RWMutex
+	items map[string][]string
+}
+
+// Adds an entry to volumeIDToZonesMap in a thread safe manner.
+func (m *volumeIDToZonesMap) add(volumeID string, zones []string) {
+	m.Lock()
+	defer m.Unlock()
+	m.items[volumeID] = zones
+}
+
+// Removes a volumeID from the volumeIDToZonesMap in a thread safe manner.
+func (m *volumeIDToZonesMap) remove(volumeID string) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.items, volumeID)
+}
+
+// Returns the list of zones for the given volumeID in a thread safe manner.
+func (m *volumeIDToZonesMap) get(volumeID string) []string {
+	m.RLock()
+	defer m.RUnlock()
+	return m.items[volumeID]
+}
+
 // K8sOrchestrator defines set of properties specific to K8s.
 type K8sOrchestrator struct {
 	supervisorFSS      FSSConfigMapInfo
@@ -142,6 +173,8 @@ type K8sOrchestrator struct {
 	clusterFlavor      cnstypes.CnsClusterFlavor
 	volumeIDToPvcMap   *volumeIDToPvcMap
 	volumeIDToNodesMap *volumeIDToNodesMap
+	volumeIDToZonesMap *volumeIDToZonesMap
+	pvLister           corelisters.PersistentVolumeLister
 	k8sClient          clientset.Interface
 }
 
@@ -206,10 +239,20 @@ func Newk8sOrchestrator(ctx context.Context, controllerClusterFlavor cnstypes.Cn
 				initVolumeHandleToPvcMap(ctx)
 			}
 
-			if k8sOrchestratorInstance.IsFSSEnabled(ctx, common.ListVolumes) {
+			// The volume id to node names map is used by ListVolumes and, in
+			// Vanilla, by ControllerGetVolume to report the nodes volumes are
+			// published to.
+			if k8sOrchestratorInstance.IsFSSEnabled(ctx, common.ListVolumes) ||
+				(controllerClusterFlavor == cnstypes.CnsClusterFlavorVanilla &&
+					k8sOrchestratorInstance.IsFSSEnabled(ctx, common.VolumeHealth)) {
 				initVolumeIDToNodesMap(ctx)
 			}
 
+			if controllerClusterFlavor == cnstypes.CnsClusterFlavorWorkload &&
+				k8sOrchestratorInstance.IsFSSEnabled(ctx, common.TKGsHA) {
+				initVolumeIDToZonesMap(ctx)
+			}
+
 			k8sOrchestratorInstance.informerManager.Listen()
 			atomic.StoreUint32(&k8sOrchestratorInstanceInitialized, 1)
 			log.Info("k8sOrchestratorInstance initialized")
@@ -982,7 +1025,8 @@ func (c *K8sOrchestrator) ClearFakeAttached(ctx context.Context, volumeID string
 
 // initVolumeIDToNodesMap performs all the operations required to initialize
 // the volume id to node names map. It also watches for volume attachment add,
-// update & delete operations, and updates the map accordingly.
+// update & delete operations, and updates the map accordingly. The map is
+// keyed by PV name, which is resolved from the volume ID using the PV lister.
 func initVolumeIDToNodesMap(ctx context.Context) {
 	log := logger.GetLogger(ctx)
 	log.Debugf("Initializing volumeID to node name map")
@@ -990,6 +1034,7 @@ func initVolumeIDToNodesMap(ctx context.Context) {
 		RWMutex: &sync.RWMutex{},
 		items:   make(map[string][]string),
 	}
+	k8sOrchestratorInstance.pvLister = k8sOrchestratorInstance.informerManager.GetPVLister()
 
 	// Set up kubernetes resource listener to listen events on volume attachments
 	k8sOrchestratorInstance.informerManager.AddVolumeAttachmentListener(
@@ -1069,9 +1114,111 @@ func volumeAttachmentDeleted(obj interface{}) {
 // GetNodesForVolumes returns a map containing the volumeID to node names map for the given
 // list of volumeIDs
 func (c *K8sOrchestrator) GetNodesForVolumes(ctx context.Context, volumeIDs []string) map[string][]string {
+	log := logger.GetLogger(ctx)
 	volumeIDToNodeNames := make(map[string][]string)
+	if c.volumeIDToNodesMap == nil {
+		return volumeIDToNodeNames
+	}
+	// VolumeAttachments refer to the PV of the volume. Resolve the PV names of
+	// the given volumes.
+	pvs, err := c.pvLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list PVs. Error: %+v", err)
+		return volumeIDToNodeNames
+	}
+	volumeIDToPVName := make(map[string]string)
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csitypes.Name {
+			volumeIDToPVName[pv.Spec.CSI.VolumeHandle] = pv.Name
+		}
+	}
 	for _, volumeID := range volumeIDs {
-		volumeIDToNodeNames[volumeID] = c.volumeIDToNodesMap.get(volumeID)
+		if pvName, exists := volumeIDToPVName[volumeID]; exists {
+			volumeIDToNodeNames[volumeID] = c.volumeIDToNodesMap.get(pvName)
+		}
 	}
 	return volumeIDToNodeNames
 }
+
+// initVolumeIDToZonesMap performs all the operations required to initialize
+// the volume id to zones map. It also watches for PV add, update & delete
+// operations, and updates the map accordingly.
+func initVolumeIDToZonesMap(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	log.Debugf("Initializing volume ID to zones map")
+	k8sOrchestratorInstance.volumeIDToZonesMap = &volumeIDToZonesMap{
+		RWMutex: &sync.RWMutex{},
+		items:   make(map[string][]string),
+	}
+
+	k8sOrchestratorInstance.informerManager.AddPVListener(
+		func(obj interface{}) { // Add.
+			pvZonesUpdated(obj)
+		},
+		func(oldObj interface{}, newObj interface{}) { // Update.
+			pvZonesUpdated(newObj)
+		},
+		func(obj interface{}) { // Delete.
+			pvZonesDeleted(obj)
+		})
+}
+
+// getZonesFromPV returns the zones listed in the node affinity of the given PV.
+func getZonesFromPV(pv *v1.PersistentVolume) []string {
+	var zones []string
+	if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil {
+		return zones
+	}
+	for _, term := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+		for _, expr := range term.MatchExpressions {
+			if expr.Key == v1.LabelTopologyZone {
+				zones = append(zones, expr.Values...)
+			}
+		}
+	}
+	return zones
+}
+
+// pvZonesUpdated adds or updates the entry for a PV in the volumeIDToZonesMap.
+func pvZonesUpdated(obj interface{}) {
+	_, log := logger.GetNewContextWithLogger()
+	pv, ok := obj.(*v1.PersistentVolume)
+	if pv == nil || !ok {
+		log.Warnf("pvZonesUpdated: unrecognized object %+v", obj)
+		return
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != csitypes.Name {
+		return
+	}
+	zones := getZonesFromPV(pv)
+	if len(zones) == 0 {
+		k8sOrchestratorInstance.volumeIDToZonesMap.remove(pv.Spec.CSI.VolumeHandle)
+		return
+	}
+	k8sOrchestratorInstance.volumeIDToZonesMap.add(pv.Spec.CSI.VolumeHandle, zones)
+	log.Debugf("pvZonesUpdated: Added '%s -> %v' pair to volumeIDToZonesMap", pv.Spec.CSI.VolumeHandle, zones)
+}
+
+// pvZonesDeleted deletes an entry from volumeIDToZonesMap when a PV gets deleted.
+func pvZonesDeleted(obj interface{}) {
+	_, log := logger.GetNewContextWithLogger()
+	pv, ok := obj.(*v1.PersistentVolume)
+	if pv == nil || !ok {
+		log.Warnf("pvZonesDeleted: unrecognized object %+v", obj)
+		return
+	}
+	if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csitypes.Name {
+		k8sOrchestratorInstance.volumeIDToZonesMap.remove(pv.Spec.CSI.VolumeHandle)
+		log.Debugf("pvZonesDeleted: Deleted key %s from volumeIDToZonesMap", pv.Spec.CSI.VolumeHandle)
+	}
+}
+
+// GetZonesForVolume returns the zones in which the given volume is accessible,
+// as recorded in the node affinity of its PV. An empty list is returned if
+// the zones are unknown.
+func (c *K8sOrchestrator) GetZonesForVolume(ctx context.Context, volumeID string) []string {
+	if c.volumeIDToZonesMap == nil {
+		return nil
+	}
+	return c.volumeIDToZonesMap.get(volumeID)
+}
@@ -24,8 +24,13 @@ import (
 	"testing"
 
 	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 
 	cnsconfig "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/config"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/types"
 )
 
 var (
@@ -241,19 +246,37 @@ func TestGetNodesForVolumes(t *testing.T) {
 		RWMutex: &sync.RWMutex{},
 		items:   make(map[string][]string),
 	}
+	pvIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
 	for i := 1; i <= 5; i += 1 {
-		volumeIDToNodesMap.items["volume-"+strconv.Itoa(i)] = []string{"node" + strconv.Itoa(i), "node" + strconv.Itoa(i+5)}
+		// VolumeAttachments refer to the PV of the volume, so the map is keyed
+		// by PV name.
+		volumeIDToNodesMap.items["pv-"+strconv.Itoa(i)] = []string{"node-" + strconv.Itoa(i), "node-" + strconv.Itoa(i+5)}
+		err := pvIndexer.Add(&v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-" + strconv.Itoa(i)},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{
+						Driver:       csitypes.Name,
+						VolumeHandle: "volume-" + strconv.Itoa(i),
+					},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
 	k8sOrchestrator := K8sOrchestrator{
 		volumeIDToNodesMap: volumeIDToNodesMap,
+		pvLister:           corelisters.NewPersistentVolumeLister(pvIndexer),
 	}
 
-	volumeIDs := []string{"volume-1", "volume-3"}
+	volumeIDs := []string{"volume-1", "volume-3", "volume-unknown"}
 	nodeNames := k8sOrchestrator.GetNodesForVolumes(ctx, volumeIDs)
 	expectedNodeNames := make(map[string][]string)
-	expectedNodeNames["volume1"] = []string{"node-1", "node-6"}
-	expectedNodeNames["volume3"] = []string{"node-3", "node-8"}
-	if reflect.DeepEqual(nodeNames, expectedNodeNames) {
+	expectedNodeNames["volume-1"] = []string{"node-1", "node-6"}
+	expectedNodeNames["volume-3"] = []string{"node-3", "node-8"}
+	if !reflect.DeepEqual(nodeNames, expectedNodeNames) {
 		t.Errorf("Expected node names %v but got %v", expectedNodeNames, nodeNames)
 	}
 }
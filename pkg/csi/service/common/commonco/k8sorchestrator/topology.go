@@ -18,11 +18,14 @@ package k8sorchestrator
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"math/rand"
+	"net/http"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -31,16 +34,19 @@ import (
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	cnstypes "github.com/vmware/govmomi/cns/types"
 	"google.golang.org/grpc/codes"
+	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	apiMeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
 	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -48,6 +54,7 @@ import (
 
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/node"
 	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/prometheus"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common"
 	commoncotypes "sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common/commonco/types"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/logger"
@@ -81,23 +88,164 @@ var (
 	// the topology service client will watch on the CSINodeTopology instance to check
 	// if the Status has been updated successfully.
 	maxTimeoutInMin = 2
-	// domainNodeMap maintains a cache of topology tags to the node names under that tag.
-	// Example - {region1: {Node1: struct{}{}, Node2: struct{}{}},
-	//            zone1: {Node1: struct{}{}},
-	//            zone2: {Node2: struct{}{}}}
-	// The nodes under each tag are maintained as a map of string with nil values to improve
+	// maxAllowedTimeoutInMin is the highest value to which the maximum duration
+	// for watching on a CSINodeTopology instance can be raised.
+	maxAllowedTimeoutInMin = 10
+	// defaultCSINodeTopologyWatchMaxRetries is the default number of times the
+	// watch on a CSINodeTopology instance is re-established when it is closed
+	// before the timeout.
+	defaultCSINodeTopologyWatchMaxRetries = 3
+	// csiNodeTopologyWatchRetryInterval is the interval to wait before
+	// re-establishing the watch on a CSINodeTopology instance.
+	csiNodeTopologyWatchRetryInterval = 2 * time.Second
+	// topologyMatchModeSubset matches a node whose topology labels are a
+	// superset of the keys in the requested topology segment.
+	topologyMatchModeSubset = "subset"
+	// topologyMatchModeExact matches a node only if its topology labels have
+	// exactly the keys in the requested topology segment.
+	topologyMatchModeExact = "exact"
+	// requisiteTopologyModeUnion uses the datastores shared by the nodes of any
+	// of the requisite topology segments.
+	requisiteTopologyModeUnion = "union"
+	// requisiteTopologyModeIntersection uses only the datastores shared by the
+	// nodes of every requisite topology segment.
+	requisiteTopologyModeIntersection = "intersection"
+	// csiNodeTopologyDuplicateResolutionNewest resolves duplicate CSINodeTopology
+	// instances of a node in favour of the most recently created one.
+	csiNodeTopologyDuplicateResolutionNewest = "newest"
+	// csiNodeTopologyDuplicateResolutionOldest resolves duplicate CSINodeTopology
+	// instances of a node in favour of the earliest created one.
+	csiNodeTopologyDuplicateResolutionOldest = "oldest"
+	// csiNodeTopologyDuplicateResolution is the resolution used when multiple
+	// CSINodeTopology instances exist for the same node UUID, e.g. after a node
+	// is renamed. Only the winning instance is used for topology.
+	csiNodeTopologyDuplicateResolution = csiNodeTopologyDuplicateResolutionNewest
+	// domainNodeMap maintains a cache of topology labels to the node names under that label.
+	// The labels are keyed by the topology key and the tag value, see getDomainNodeMapKey.
+	// Example - {topology.csi.vmware.com/k8s-region:region1: {Node1: struct{}{}, Node2: struct{}{}},
+	//            topology.csi.vmware.com/k8s-zone:zone1: {Node1: struct{}{}},
+	//            topology.csi.vmware.com/k8s-zone:zone2: {Node2: struct{}{}}}
+	// The nodes under each label are maintained as a map of string with nil values to improve
 	// retrieval and deletion performance.
-	// CAUTION: This technique requires that tag values should not be repeated across
-	// categories i.e using `us-east` as a region and as a zone is not allowed.
+	// Keying by the topology key as well allows tag values to be repeated across
+	// categories i.e using `us-east` as a region and as a zone.
 	domainNodeMap = make(map[string]map[string]struct{})
 	// domainNodeMapInstanceLock guards the domainNodeMap instance from concurrent writes.
 	domainNodeMapInstanceLock = &sync.RWMutex{}
+	// domainNodeMapRebuildLock keeps the CSINodeTopology event handlers from
+	// updating the domainNodeMap while it is rebuilt from the informer store,
+	// so that the updates made between listing the store and applying the
+	// rebuilt map are not lost. The events received meanwhile are handled once
+	// the rebuild is done.
+	domainNodeMapRebuildLock = &sync.RWMutex{}
+	// loadedCSINodeTopologyVersions holds the resource version of every
+	// CSINodeTopology instance listed by the initial load of the domainNodeMap,
+	// keyed by instance name, so that the replayed add events of the instances
+	// already loaded are skipped.
+	loadedCSINodeTopologyVersions = make(map[string]string)
 	// azClusterMap maintains a cache of AZ instance name to the clusterMoref in that zone.
 	azClusterMap = make(map[string]string)
 	// azClusterMapInstanceLock guards the azClusterMap instance from concurrent writes.
 	azClusterMapInstanceLock = &sync.RWMutex{}
+	// defaultNodeVMCacheTTLInMin is the default duration for which a nodeVM resolved
+	// by the controller topology service is cached before it is looked up again.
+	defaultNodeVMCacheTTLInMin = 5
+	// topologyNodeSelector restricts the nodes which participate in topology
+	// aware volume placement. All nodes participate when it is nil.
+	topologyNodeSelector labels.Selector
+	// topologyNodeLister is used to look up the labels of a node when
+	// topologyNodeSelector is set.
+	topologyNodeLister corelisters.NodeLister
+	// drainingTopologyValues is the set of topology values, i.e. tags or zones,
+	// which are being drained and must not be used for new volume placements.
+	drainingTopologyValues = make(map[string]struct{})
+	// drainingTopologyValuesInstanceLock guards the drainingTopologyValues instance from concurrent writes.
+	drainingTopologyValuesInstanceLock = &sync.RWMutex{}
+	// registerDrainingTopologyHandlerOnce ensures the draining topology debug
+	// endpoint is registered only once.
+	registerDrainingTopologyHandlerOnce sync.Once
+	// registerRequisiteTopologyHandlerOnce ensures the requisite topology
+	// validation debug endpoint is registered only once.
+	registerRequisiteTopologyHandlerOnce sync.Once
+	// registerTopologySnapshotHandlerOnce ensures the topology snapshot debug
+	// endpoint is registered only once.
+	registerTopologySnapshotHandlerOnce sync.Once
+	// registerTopologyNodeListenerOnce ensures the node listener of the
+	// topology service is registered only once, as the listeners of the node
+	// informer cannot be removed when the topology service is reset.
+	registerTopologyNodeListenerOnce sync.Once
+	// topologyLabelValueCaseFold indicates whether topology label values are
+	// compared case insensitively.
+	topologyLabelValueCaseFold bool
+	// defaultDomainNodeMapRelistIntervalInMin is the default interval after which
+	// the domainNodeMap is rebuilt from the CSINodeTopology informer store.
+	defaultDomainNodeMapRelistIntervalInMin = 30
+	// defaultDomainNodeMapLoadParallelism is the default number of workers used
+	// to populate the domainNodeMap when the topology service starts.
+	defaultDomainNodeMapLoadParallelism = 8
+	// maxDomainNodeMapLoadParallelism is the maximum number of workers used to
+	// populate the domainNodeMap, irrespective of the configured parallelism.
+	maxDomainNodeMapLoadParallelism = 64
+	// defaultMaxTopologySegments is the default maximum number of distinct
+	// topology segments of a topology requirement which are processed.
+	defaultMaxTopologySegments = 128
+	// defaultTopologyInformerResyncPeriodInMin is the default period after which
+	// the topology informers redeliver all the instances in their store to the
+	// event handlers.
+	defaultTopologyInformerResyncPeriodInMin = 10
+	// defaultTopologyInformerSyncTimeoutInSec is the default duration for which
+	// the topology service waits for its informers to sync when it starts.
+	defaultTopologyInformerSyncTimeoutInSec = 60
+	// topologyInformerSyncCheckInterval is the interval at which the topology
+	// informers are checked to be in sync with the API server.
+	topologyInformerSyncCheckInterval = 1 * time.Minute
+	// defaultSharedDatastoresCacheTTLInSec is the default duration for which
+	// the shared datastores of a topology segment are cached.
+	defaultSharedDatastoresCacheTTLInSec = 60
+	// sharedDatastoresCache maintains a cache of canonicalized topology segments
+	// to the shared datastores of the nodes in that segment.
+	sharedDatastoresCache = make(map[string]*sharedDatastoresCacheEntry)
+	// sharedDatastoresCacheInstanceLock guards the sharedDatastoresCache instance from concurrent writes.
+	sharedDatastoresCacheInstanceLock = &sync.RWMutex{}
+	// getSharedDatastoresForVMs fetches the shared datastores of the given
+	// nodeVMs. It is a variable so that it can be overridden in unit tests.
+	getSharedDatastoresForVMs = cnsvsphere.GetSharedDatastoresForVMs
 )
 
+// topologyInformerSyncStatus tracks whether a topology informer is in sync
+// with the API server, i.e. whether its watch is healthy.
+type topologyInformerSyncStatus struct {
+	// name is the name of the informer used in logs and metrics.
+	name string
+	// informer is the informer being tracked.
+	informer cache.SharedIndexInformer
+	// lock guards the fields below from concurrent writes.
+	lock sync.Mutex
+	// watchFailed is set when the watch of the informer failed and is reset
+	// once the informer has relisted the instances from the API server.
+	watchFailed bool
+	// failedResourceVersion is the last resource version synced by the informer
+	// before its watch failed.
+	failedResourceVersion string
+}
+
+// nodeVMCacheEntry is a cached nodeVM lookup in the nodeVMCache.
+type nodeVMCacheEntry struct {
+	// nodeVM is the resolved nodeVM.
+	nodeVM *cnsvsphere.VirtualMachine
+	// expiresAt is the time after which the entry is considered stale.
+	expiresAt time.Time
+}
+
+// sharedDatastoresCacheEntry is a cached shared datastores lookup in the
+// sharedDatastoresCache.
+type sharedDatastoresCacheEntry struct {
+	// datastores are the shared datastores of the nodes in the topology segment.
+	datastores []*cnsvsphere.DatastoreInfo
+	// expiresAt is the time after which the entry is considered stale.
+	expiresAt time.Time
+}
+
 // nodeVolumeTopology implements the commoncotypes.NodeTopologyService interface. It stores
 // the necessary kubernetes configurations and clients required to implement the methods in the interface.
 type nodeVolumeTopology struct {
@@ -124,6 +272,8 @@ type controllerVolumeTopology struct {
 	k8sConfig *restclient.Config
 	// csiNodeTopologyInformer is an informer instance on the CSINodeTopology custom resource.
 	csiNodeTopologyInformer cache.SharedIndexInformer
+	// csiNodeTopologyK8sClient helps operate on CSINodeTopology custom resource.
+	csiNodeTopologyK8sClient client.Client
 	// nodeMgr is an instance of the node interface which exposes functionality related to nodeVMs.
 	nodeMgr node.Manager
 	// clusterFlavor is the cluster flavor.
@@ -131,6 +281,44 @@ type controllerVolumeTopology struct {
 	// isCSINodeIdFeatureEnabled indicates whether the
 	// use-csinode-id feature is enabled or not.
 	isCSINodeIdFeatureEnabled bool
+	// nodeVMCacheTTL is the duration for which resolved nodeVMs are cached.
+	nodeVMCacheTTL time.Duration
+	// nodeVMCache maintains a cache of node UUIDs to the nodeVMs resolved for
+	// them. Entries are resolved again on a lookup miss.
+	nodeVMCache map[string]*nodeVMCacheEntry
+	// nodeVMCacheLock guards the nodeVMCache from concurrent access.
+	nodeVMCacheLock sync.Mutex
+	// failOnEmptyTopologySegment indicates whether a topology segment with no
+	// matching nodes fails the datastore lookup instead of being skipped.
+	failOnEmptyTopologySegment bool
+	// includeNodesWithoutTopologyLabels indicates whether nodes without any
+	// topology labels are considered for topology aware placement.
+	includeNodesWithoutTopologyLabels bool
+	// topologyMatchMode is the mode used to match the topology labels of a
+	// node against a topology segment, either subset or exact.
+	topologyMatchMode string
+	// requisiteTopologyMode is the mode used to combine the shared datastores
+	// of the requisite topology segments, either union or intersection.
+	requisiteTopologyMode string
+	// maxTopologySegments is the maximum number of distinct preferred or
+	// requisite topology segments processed for a topology requirement. In the
+	// intersection mode, a requisite topology with more segments is rejected.
+	maxTopologySegments int
+	// isStrictPreferredTopologyEnabled indicates whether the fallback to
+	// requisite topology is disabled when preferred topology yields no
+	// shared datastores.
+	isStrictPreferredTopologyEnabled bool
+	// sharedDatastoresCacheTTL is the duration for which the shared datastores
+	// of a topology segment are cached. Caching is disabled when it is 0.
+	sharedDatastoresCacheTTL time.Duration
+	// domainNodeMapLoaded is closed once the initial load of the domainNodeMap
+	// is done. It is nil if no initial load is run.
+	domainNodeMapLoaded chan struct{}
+	// stopInformers stops the CSINodeTopology informer and the goroutines
+	// started along with it.
+	stopInformers context.CancelFunc
+	// informerDone is closed once the CSINodeTopology informer has stopped.
+	informerDone <-chan struct{}
 }
 
 // wcpControllerVolumeTopology implements the commoncotypes.ControllerTopologyService
@@ -141,10 +329,18 @@ type wcpControllerVolumeTopology struct {
 	k8sConfig *restclient.Config
 	// azInformer is an informer instance on the AvailabilityZone custom resource.
 	azInformer cache.SharedIndexInformer
+	// stopInformers stops the AvailabilityZone informer and the goroutines
+	// started along with it.
+	stopInformers context.CancelFunc
+	// informerDone is closed once the AvailabilityZone informer has stopped.
+	informerDone <-chan struct{}
 }
 
 // InitTopologyServiceInController returns a singleton implementation of the
-// commoncotypes.ControllerTopologyService interface.
+// commoncotypes.ControllerTopologyService interface. The informers of the
+// topology service run until the given context is done or the service is reset
+// using ResetTopologyServiceInController, so callers pass the long-lived
+// context of the controller rather than the context of a request.
 func (c *K8sOrchestrator) InitTopologyServiceInController(ctx context.Context) (
 	commoncotypes.ControllerTopologyService, error) {
 	log := logger.GetLogger(ctx)
@@ -168,26 +364,109 @@ func (c *K8sOrchestrator) InitTopologyServiceInController(ctx context.Context) (
 				// Node manager should already have been initialized in controller init.
 				nodeManager := node.GetManager(ctx)
 
-				// Create and start an informer on CSINodeTopology instances.
-				crInformer, err := startTopologyCRInformer(ctx, config)
+				// Set up topology label value normalization before the informer
+				// starts populating the domainNodeMap.
+				topologyLabelValueCaseFold = getTopologyLabelValueCaseFold(ctx)
+				csiNodeTopologyDuplicateResolution = getCSINodeTopologyDuplicateResolution(ctx)
+
+				// Restrict the nodes participating in topology to the ones matching
+				// the node selector in the config, if any.
+				cfg, err := common.GetConfig(ctx)
+				if err != nil {
+					log.Errorf("failed to read config. Error: %+v", err)
+					return nil, err
+				}
+				k8sClient, err := k8s.NewClient(ctx)
 				if err != nil {
+					log.Errorf("failed to create kubernetes client. Error: %+v", err)
+					return nil, err
+				}
+				informerManager := k8s.NewInformer(k8sClient)
+				if strings.TrimSpace(cfg.Labels.TopologyNodeSelector) != "" {
+					topologyNodeSelector, err = labels.Parse(cfg.Labels.TopologyNodeSelector)
+					if err != nil {
+						log.Errorf("failed to parse topology node selector %q. Error: %+v",
+							cfg.Labels.TopologyNodeSelector, err)
+						return nil, err
+					}
+					topologyNodeLister = informerManager.GetNodeLister()
+					log.Infof("Only nodes matching selector %q will participate in topology",
+						topologyNodeSelector.String())
+				}
+
+				// Create and start an informer on CSINodeTopology instances. The
+				// informer is stopped when the topology service is reset.
+				informerCtx, stopInformers := context.WithCancel(ctx)
+				crInformer, crInformerDone, err := startTopologyCRInformer(informerCtx, config,
+					informerCtx.Done())
+				if err != nil {
+					stopInformers()
 					log.Errorf("failed to create an informer for CSINodeTopology instances. Error: %+v", err)
 					return nil, err
 				}
 
+				// Create client to API server.
+				crClient, err := k8s.NewClientForGroup(ctx, config, csinodetopologyv1alpha1.GroupName)
+				if err != nil {
+					stopInformers()
+					log.Errorf("failed to create K8s client for CSINodeTopology resource with error: %v", err)
+					return nil, err
+				}
+
 				clusterFlavor, err := cnsconfig.GetClusterFlavor(ctx)
 				if err != nil {
+					stopInformers()
 					log.Errorf("failed to get cluster flavor. Error: %+v", err)
 					return nil, err
 				}
 
 				controllerVolumeTopologyInstance = &controllerVolumeTopology{
-					k8sConfig:                 config,
-					nodeMgr:                   nodeManager,
-					csiNodeTopologyInformer:   *crInformer,
-					clusterFlavor:             clusterFlavor,
-					isCSINodeIdFeatureEnabled: c.IsFSSEnabled(ctx, common.UseCSINodeId),
+					k8sConfig:                         config,
+					nodeMgr:                           nodeManager,
+					csiNodeTopologyInformer:           *crInformer,
+					csiNodeTopologyK8sClient:          crClient,
+					clusterFlavor:                     clusterFlavor,
+					isCSINodeIdFeatureEnabled:         c.IsFSSEnabled(ctx, common.UseCSINodeId),
+					nodeVMCacheTTL:                    time.Duration(getNodeVMCacheTTLInMin(ctx)) * time.Minute,
+					isStrictPreferredTopologyEnabled:  c.IsFSSEnabled(ctx, common.StrictPreferredTopology),
+					failOnEmptyTopologySegment:        getFailOnEmptyTopologySegment(ctx),
+					includeNodesWithoutTopologyLabels: getIncludeNodesWithoutTopologyLabels(ctx),
+					topologyMatchMode:                 getTopologyMatchMode(ctx),
+					requisiteTopologyMode:             getRequisiteTopologyMode(ctx),
+					maxTopologySegments:               getMaxTopologySegments(ctx),
+					sharedDatastoresCacheTTL: time.Duration(getSharedDatastoresCacheTTLInSec(ctx)) *
+						time.Second,
+					domainNodeMapLoaded: make(chan struct{}),
+					stopInformers:       stopInformers,
+					informerDone:        crInformerDone,
 				}
+				// Populate the domainNodeMap in bulk once the informer has synced
+				// instead of waiting for the add events of all the instances to be
+				// replayed one at a time.
+				go controllerVolumeTopologyInstance.loadDomainNodeMap(informerCtx, informerCtx.Done(),
+					getDomainNodeMapLoadParallelism(ctx))
+				// Periodically rebuild the domainNodeMap so that any drift caused by
+				// missed informer events self-corrects.
+				go controllerVolumeTopologyInstance.reconcileDomainNodeMap(informerCtx,
+					time.Duration(getDomainNodeMapRelistIntervalInMin(ctx))*time.Minute)
+				// Re-evaluate the participation of a node in topology when it is
+				// added or its labels change, and clean up the CSINodeTopology
+				// instance of a node as soon as the node is deleted instead of
+				// waiting for garbage collection.
+				registerTopologyNodeListenerOnce.Do(func() {
+					informerManager.AddNodeListener(topologyNodeAdded, topologyNodeUpdated, topologyNodeDeleted)
+					informerManager.Listen()
+				})
+				// Invalidate the nodeVMs cached for the CSINodeTopology instances
+				// which are deleted or whose node UUID changes.
+				controllerVolumeTopologyInstance.csiNodeTopologyInformer.AddEventHandler(
+					cache.ResourceEventHandlerFuncs{
+						UpdateFunc: controllerVolumeTopologyInstance.csiNodeTopologyUpdated,
+						DeleteFunc: controllerVolumeTopologyInstance.csiNodeTopologyDeleted,
+					})
+				registerDrainingTopologyHandler(ctx)
+				registerRequisiteTopologyHandler(ctx)
+				registerTopologySnapshotHandler(ctx)
 				log.Info("Topology service initiated successfully")
 			}
 		} else {
@@ -208,9 +487,13 @@ func (c *K8sOrchestrator) InitTopologyServiceInController(ctx context.Context) (
 					log.Errorf("failed to get kubeconfig with error: %v", err)
 					return nil, err
 				}
-				// Create and start an informer on AvailabilityZone instances.
-				azInformer, err := startAvailabilityZoneInformer(ctx, config)
+				// Create and start an informer on AvailabilityZone instances. The
+				// informer is stopped when the topology service is reset.
+				informerCtx, stopInformers := context.WithCancel(ctx)
+				azInformer, azInformerDone, err := startAvailabilityZoneInformer(informerCtx, config,
+					informerCtx.Done())
 				if err != nil {
+					stopInformers()
 					if err == common.ErrAvailabilityZoneCRNotRegistered {
 						log.Infof("Skip initializing the topology service as the AvailabilityZone " +
 							"CR is not registered.")
@@ -220,9 +503,17 @@ func (c *K8sOrchestrator) InitTopologyServiceInController(ctx context.Context) (
 					return nil, err
 				}
 				wcpControllerVolumeTopologyInstance = &wcpControllerVolumeTopology{
-					k8sConfig:  config,
-					azInformer: *azInformer,
+					k8sConfig:     config,
+					azInformer:    *azInformer,
+					stopInformers: stopInformers,
+					informerDone:  azInformerDone,
 				}
+				// Periodically rebuild the azClusterMap so that any drift caused by
+				// missed informer events self-corrects.
+				go wcpControllerVolumeTopologyInstance.reconcileAZClusterMap(informerCtx,
+					time.Duration(getTopologyInformerResyncPeriodInMin(ctx))*time.Minute)
+				registerDrainingTopologyHandler(ctx)
+				registerTopologySnapshotHandler(ctx)
 			}
 		} else {
 			controllerVolumeTopologyInstanceLock.RUnlock()
@@ -233,14 +524,38 @@ func (c *K8sOrchestrator) InitTopologyServiceInController(ctx context.Context) (
 		"cluster flavor: %q", c.clusterFlavor)
 }
 
+// ResetTopologyServiceInController stops the informers of the controller
+// topology service and waits for them to exit. The singleton is cleared so that
+// the next call to InitTopologyServiceInController creates it afresh instead of
+// running duplicate informers.
+func (c *K8sOrchestrator) ResetTopologyServiceInController(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	controllerVolumeTopologyInstanceLock.Lock()
+	defer controllerVolumeTopologyInstanceLock.Unlock()
+	if controllerVolumeTopologyInstance != nil {
+		controllerVolumeTopologyInstance.stopInformers()
+		<-controllerVolumeTopologyInstance.informerDone
+		controllerVolumeTopologyInstance = nil
+		log.Infof("Stopped %s informer of the topology service", csinodetopology.CRDSingular)
+	}
+	if wcpControllerVolumeTopologyInstance != nil {
+		wcpControllerVolumeTopologyInstance.stopInformers()
+		<-wcpControllerVolumeTopologyInstance.informerDone
+		wcpControllerVolumeTopologyInstance = nil
+		log.Info("Stopped AvailabilityZone informer of the topology service")
+	}
+}
+
 // startAvailabilityZoneInformer listens on changes to AvailabilityZone instances and updates the azClusterMap cache.
-func startAvailabilityZoneInformer(ctx context.Context, cfg *restclient.Config) (*cache.SharedIndexInformer, error) {
+// The informer runs until stopCh is closed, after which the returned channel is closed.
+func startAvailabilityZoneInformer(ctx context.Context, cfg *restclient.Config,
+	stopCh <-chan struct{}) (*cache.SharedIndexInformer, <-chan struct{}, error) {
 	log := logger.GetLogger(ctx)
 	// Check if AZ CR is registered in the environment.
 	// Create a new AvailabilityZone client.
 	azClient, err := dynamic.NewForConfig(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create AvailabilityZone client using config. Err: %+v", err)
+		return nil, nil, fmt.Errorf("failed to create AvailabilityZone client using config. Err: %+v", err)
 	}
 	// Get AvailabilityZone list
 	azResource := schema.GroupVersionResource{
@@ -250,33 +565,137 @@ func startAvailabilityZoneInformer(ctx context.Context, cfg *restclient.Config)
 	// supervisor cluster.
 	if apiMeta.IsNoMatchError(err) {
 		log.Info("AvailabilityZone CR is not registered on the cluster")
-		return nil, common.ErrAvailabilityZoneCRNotRegistered
+		return nil, nil, common.ErrAvailabilityZoneCRNotRegistered
 	}
 	// At this point, we are sure the AZ CR is registered. Create an informer for AvailabilityZone instances.
-	dynInformer, err := k8s.GetDynamicInformer(ctx, "topology.tanzu.vmware.com",
-		"v1alpha1", "availabilityzones", metav1.NamespaceAll, cfg, true)
+	dynInformer, err := k8s.NewDynamicInformer(ctx, "topology.tanzu.vmware.com",
+		"v1alpha1", "availabilityzones", metav1.NamespaceAll, cfg)
 	if err != nil {
 		log.Errorf("failed to create dynamic informer for AvailabilityZone CR. Error: %+v",
 			err)
-		return nil, err
+		return nil, nil, err
 	}
 	availabilityZoneInformer := dynInformer.Informer()
-	availabilityZoneInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+	// Watch failures, e.g. on API server restarts, are handled by relisting the
+	// AvailabilityZone instances. The periodic resync redelivers all instances to
+	// the update handler so that the azClusterMap is refreshed from the store.
+	syncStatus := newTopologyInformerSyncStatus(ctx, prometheus.PrometheusAvailabilityZoneInformer,
+		availabilityZoneInformer)
+	availabilityZoneInformer.AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			azCRAdded(obj)
 		},
-		UpdateFunc: nil,
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			azCRAdded(newObj)
+		},
 		DeleteFunc: func(obj interface{}) {
 			azCRDeleted(obj)
 		},
-	})
+	}, time.Duration(getTopologyInformerResyncPeriodInMin(ctx))*time.Minute)
 
 	// Start informer.
+	informerDone := runTopologyInformer(ctx, "AvailabilityZone", availabilityZoneInformer, syncStatus, stopCh)
+	return &availabilityZoneInformer, informerDone, nil
+}
+
+// runTopologyInformer starts the given informer and the monitor of its sync
+// status, both of which run until stopCh is closed. The returned channel is
+// closed once the informer has stopped.
+func runTopologyInformer(ctx context.Context, crName string, informer cache.SharedIndexInformer,
+	syncStatus *topologyInformerSyncStatus, stopCh <-chan struct{}) <-chan struct{} {
+	log := logger.GetLogger(ctx)
+	informerDone := make(chan struct{})
 	go func() {
-		log.Info("Informer to watch on AvailabilityZone CR starting..")
-		availabilityZoneInformer.Run(make(chan struct{}))
+		defer close(informerDone)
+		log.Infof("Informer to watch on %s CR starting..", crName)
+		informer.Run(stopCh)
+		log.Infof("Informer to watch on %s CR stopped", crName)
 	}()
-	return &availabilityZoneInformer, nil
+	go syncStatus.monitor(ctx, topologyInformerSyncCheckInterval, stopCh)
+	return informerDone
+}
+
+// waitForTopologyInformerSync waits up to timeout for hasSynced of the informer
+// on the given CR to return true and returns whether it did. The topology
+// service is usable even if the informer has not synced by then, but topology
+// lookups fail with common.ErrTopologyNotSynced until it does.
+func waitForTopologyInformerSync(ctx context.Context, crName string, hasSynced cache.InformerSynced,
+	timeout time.Duration) bool {
+	log := logger.GetLogger(ctx)
+	syncCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), hasSynced) {
+		log.Warnf("Informer to watch on %s CR has not synced within %v. Topology lookups will fail "+
+			"until it syncs", crName, timeout)
+		return false
+	}
+	log.Infof("Informer to watch on %s CR synced", crName)
+	return true
+}
+
+// newTopologyInformerSyncStatus returns a topologyInformerSyncStatus for the
+// given informer and sets up its watch error handler. This must be called
+// before the informer is started.
+func newTopologyInformerSyncStatus(ctx context.Context, name string,
+	informer cache.SharedIndexInformer) *topologyInformerSyncStatus {
+	log := logger.GetLogger(ctx)
+	syncStatus := &topologyInformerSyncStatus{
+		name:     name,
+		informer: informer,
+	}
+	err := informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		syncStatus.lock.Lock()
+		if !syncStatus.watchFailed {
+			syncStatus.watchFailed = true
+			syncStatus.failedResourceVersion = informer.LastSyncResourceVersion()
+		}
+		syncStatus.lock.Unlock()
+		log.Warnf("Watch on %s instances failed. The informer will relist the instances. Error: %+v",
+			name, err)
+		cache.DefaultWatchErrorHandler(r, err)
+	})
+	if err != nil {
+		log.Warnf("failed to set watch error handler on %s informer. Error: %+v", name, err)
+	}
+	return syncStatus
+}
+
+// monitor periodically records the time at which the informer was last known
+// to be in sync with the API server, until stopCh is closed.
+func (syncStatus *topologyInformerSyncStatus) monitor(ctx context.Context, interval time.Duration,
+	stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		syncStatus.recordSync(ctx)
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordSync updates the last sync time of the informer if it has synced and
+// its watch did not fail since the informer last relisted the instances.
+func (syncStatus *topologyInformerSyncStatus) recordSync(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	if !syncStatus.informer.HasSynced() {
+		return
+	}
+	resourceVersion := syncStatus.informer.LastSyncResourceVersion()
+	syncStatus.lock.Lock()
+	defer syncStatus.lock.Unlock()
+	if syncStatus.watchFailed {
+		if resourceVersion == syncStatus.failedResourceVersion {
+			log.Debugf("%s informer has not yet recovered from a watch failure", syncStatus.name)
+			return
+		}
+		log.Infof("%s informer recovered from a watch failure at resource version %q",
+			syncStatus.name, resourceVersion)
+		syncStatus.watchFailed = false
+	}
+	prometheus.TopologyInformerLastSyncGaugeVec.WithLabelValues(syncStatus.name).Set(float64(time.Now().Unix()))
 }
 
 // azCRAdded handles adding AZ name and clusterMoref to the cache.
@@ -319,6 +738,10 @@ func addToAZClusterMap(ctx context.Context, azName, clusterMoref string) {
 	log := logger.GetLogger(ctx)
 	azClusterMapInstanceLock.Lock()
 	defer azClusterMapInstanceLock.Unlock()
+	if existingMoref, exists := azClusterMap[azName]; exists && existingMoref == clusterMoref {
+		// Nothing to do, e.g. when the instance is redelivered on informer resync.
+		return
+	}
 	azClusterMap[azName] = clusterMoref
 	log.Infof("Added %q cluster to %q zone in azClusterMap", clusterMoref, azName)
 }
@@ -332,43 +755,107 @@ func removeFromAZClusterMap(ctx context.Context, azName string) {
 	log.Infof("Removed %q zone from azClusterMap", azName)
 }
 
+// reconcileAZClusterMap periodically rebuilds the azClusterMap from the
+// AvailabilityZone informer store until ctx is done.
+func (volTopology *wcpControllerVolumeTopology) reconcileAZClusterMap(ctx context.Context,
+	relistInterval time.Duration) {
+	log := logger.GetLogger(ctx)
+	ticker := time.NewTicker(relistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			log.Debug("Rebuilding azClusterMap from AvailabilityZone informer store")
+			volTopology.relistAZClusterMap(ctx)
+		}
+	}
+}
+
+// relistAZClusterMap builds a new azClusterMap from the AvailabilityZone
+// instances in the informer store and swaps it with the existing one.
+func (volTopology *wcpControllerVolumeTopology) relistAZClusterMap(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	newAZClusterMap := make(map[string]string)
+	for _, val := range volTopology.azInformer.GetStore().List() {
+		azObj, ok := val.(*unstructured.Unstructured)
+		if !ok {
+			log.Errorf("relistAZClusterMap: failed to cast object %+v to AvailabilityZone", val)
+			continue
+		}
+		azName := azObj.GetName()
+		clusterComputeResourceMoId, found, err := unstructured.NestedString(azObj.Object,
+			"spec", "clusterComputeResourceMoId")
+		if !found || err != nil {
+			log.Errorf("relistAZClusterMap: failed to get `clusterComputeResourceMoId` from AvailabilityZone "+
+				"instance: %q, Error: %+v", azName, err)
+			continue
+		}
+		newAZClusterMap[azName] = clusterComputeResourceMoId
+	}
+	azClusterMapInstanceLock.Lock()
+	defer azClusterMapInstanceLock.Unlock()
+	if !reflect.DeepEqual(azClusterMap, newAZClusterMap) {
+		log.Infof("azClusterMap drifted from AvailabilityZone informer store. Old: %+v, New: %+v",
+			azClusterMap, newAZClusterMap)
+	}
+	azClusterMap = newAZClusterMap
+}
+
 // startTopologyCRInformer creates and starts an informer for CSINodeTopology custom resource.
-func startTopologyCRInformer(ctx context.Context, cfg *restclient.Config) (*cache.SharedIndexInformer, error) {
+// The informer runs until stopCh is closed, after which the returned channel is closed.
+func startTopologyCRInformer(ctx context.Context, cfg *restclient.Config,
+	stopCh <-chan struct{}) (*cache.SharedIndexInformer, <-chan struct{}, error) {
 	log := logger.GetLogger(ctx)
 	// Create an informer for CSINodeTopology instances.
-	dynInformer, err := k8s.GetDynamicInformer(ctx, csinodetopologyv1alpha1.GroupName,
-		csinodetopologyv1alpha1.Version, csinodetopology.CRDPlural, metav1.NamespaceAll, cfg, true)
+	dynInformer, err := k8s.NewDynamicInformer(ctx, csinodetopologyv1alpha1.GroupName,
+		csinodetopologyv1alpha1.Version, csinodetopology.CRDPlural, metav1.NamespaceAll, cfg)
 	if err != nil {
 		log.Errorf("failed to create dynamic informer for %s CR. Error: %+v", csinodetopology.CRDSingular,
 			err)
-		return nil, err
+		return nil, nil, err
 	}
 	csiNodeTopologyInformer := dynInformer.Informer()
-	csiNodeTopologyInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+	// Watch failures, e.g. on API server restarts, are handled by relisting the
+	// CSINodeTopology instances so that the domainNodeMap does not go stale.
+	syncStatus := newTopologyInformerSyncStatus(ctx, prometheus.PrometheusCSINodeTopologyInformer,
+		csiNodeTopologyInformer)
+	csiNodeTopologyInformer.AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
 		// Typically when the CSINodeTopology instance is created, the
 		// topology labels are not populated till the reconcile loop runs.
 		// However, this Add function will take care of cases where the node
 		// daemonset is restarted on driver upgrades and the CSINodeTopology
 		// instances already exist.
 		AddFunc: func(obj interface{}) {
+			domainNodeMapRebuildLock.RLock()
+			defer domainNodeMapRebuildLock.RUnlock()
+			if isLoadedCSINodeTopology(obj) {
+				return
+			}
 			topoCRAdded(obj)
+			resolveDuplicateCSINodeTopologies(csiNodeTopologyInformer.GetStore(), obj, false)
 		},
 		// Update handler.
 		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			domainNodeMapRebuildLock.RLock()
+			defer domainNodeMapRebuildLock.RUnlock()
 			topoCRUpdated(oldObj, newObj)
+			resolveDuplicateCSINodeTopologies(csiNodeTopologyInformer.GetStore(), newObj, false)
 		},
 		// Delete handler.
 		DeleteFunc: func(obj interface{}) {
+			domainNodeMapRebuildLock.RLock()
+			defer domainNodeMapRebuildLock.RUnlock()
 			topoCRDeleted(obj)
+			resolveDuplicateCSINodeTopologies(csiNodeTopologyInformer.GetStore(), obj, true)
 		},
-	})
+	}, time.Duration(getTopologyInformerResyncPeriodInMin(ctx))*time.Minute)
 
 	// Start informer.
-	go func() {
-		log.Infof("Informer to watch on %s CR starting..", csinodetopology.CRDSingular)
-		csiNodeTopologyInformer.Run(make(chan struct{}))
-	}()
-	return &csiNodeTopologyInformer, nil
+	informerDone := runTopologyInformer(ctx, csinodetopology.CRDSingular, csiNodeTopologyInformer, syncStatus,
+		stopCh)
+	return &csiNodeTopologyInformer, informerDone, nil
 }
 
 // topoCRAdded checks if the CSINodeTopology instance Status is set to Success
@@ -383,6 +870,7 @@ func topoCRAdded(obj interface{}) {
 			csinodetopology.CRDSingular, err)
 		return
 	}
+	invalidateSharedDatastoresCache(ctx)
 	// Check if Status is set to Success.
 	if nodeTopoObj.Status.Status != csinodetopologyv1alpha1.CSINodeTopologySuccess {
 		log.Infof("topoCRAdded: CSINodeTopology instance %q not yet ready. Status: %q",
@@ -415,6 +903,7 @@ func topoCRUpdated(oldObj interface{}, newObj interface{}) {
 			csinodetopology.CRDSingular, err)
 		return
 	}
+	invalidateSharedDatastoresCache(ctx)
 	oldTopoLabelsMap := make(map[string]string)
 	for _, label := range oldNodeTopoObj.Status.TopologyLabels {
 		oldTopoLabelsMap[label.Key] = label.Value
@@ -455,6 +944,7 @@ func topoCRDeleted(obj interface{}) {
 			csinodetopology.CRDSingular, err)
 		return
 	}
+	invalidateSharedDatastoresCache(ctx)
 	// Delete node name from domainNodeMap if the status of the CR was set to Success.
 	if nodeTopoObj.Status.Status == csinodetopologyv1alpha1.CSINodeTopologySuccess {
 		removeNodeFromDomainNodeMap(ctx, nodeTopoObj)
@@ -464,32 +954,1011 @@ func topoCRDeleted(obj interface{}) {
 	}
 }
 
+// resolveDuplicateCSINodeTopologies detects multiple CSINodeTopology instances
+// for the node UUID of the given instance and keeps only the winning instance
+// as per csiNodeTopologyDuplicateResolution in the domainNodeMap. When the
+// given instance was deleted, the remaining instance of the node is restored
+// in case it was superseded by the deleted one.
+func resolveDuplicateCSINodeTopologies(store cache.Store, obj interface{}, deleted bool) {
+	ctx, log := logger.GetNewContextWithLogger()
+	var nodeTopoObj csinodetopologyv1alpha1.CSINodeTopology
+	unstructuredObj, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredObj.Object, &nodeTopoObj)
+	if err != nil || nodeTopoObj.Spec.NodeUUID == "" {
+		return
+	}
+	instances := getCSINodeTopologiesForNodeUUID(ctx, store, nodeTopoObj.Spec.NodeUUID)
+	if len(instances) == 0 || (len(instances) == 1 && !deleted) {
+		return
+	}
+	winner := getWinningCSINodeTopology(instances)
+	if len(instances) > 1 {
+		var names []string
+		for _, instance := range instances {
+			names = append(names, instance.Name)
+		}
+		log.Warnf("Found %d %s instances %v for node UUID %q. Using %q as per the %q resolution. "+
+			"Delete the stale instances.", len(instances), csinodetopology.CRDSingular, names,
+			nodeTopoObj.Spec.NodeUUID, winner.Name, csiNodeTopologyDuplicateResolution)
+		prometheus.TopologyDuplicateCSINodeTopologyCounter.Inc()
+	}
+	for _, instance := range instances {
+		if instance.Name != winner.Name && instance.Status.Status == csinodetopologyv1alpha1.CSINodeTopologySuccess {
+			removeNodeFromDomainNodeMap(ctx, instance)
+		}
+	}
+	if winner.Status.Status == csinodetopologyv1alpha1.CSINodeTopologySuccess {
+		addNodeToDomainNodeMap(ctx, winner)
+	}
+}
+
+// getCSINodeTopologiesForNodeUUID returns the CSINodeTopology instances in the
+// given store which belong to the node with the given UUID.
+func getCSINodeTopologiesForNodeUUID(ctx context.Context, store cache.Store,
+	nodeUUID string) []csinodetopologyv1alpha1.CSINodeTopology {
+	log := logger.GetLogger(ctx)
+	var instances []csinodetopologyv1alpha1.CSINodeTopology
+	for _, val := range store.List() {
+		var nodeTopoObj csinodetopologyv1alpha1.CSINodeTopology
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(val.(*unstructured.Unstructured).Object,
+			&nodeTopoObj)
+		if err != nil {
+			log.Errorf("failed to cast object %+v to %s. Error: %+v", val, csinodetopology.CRDSingular, err)
+			continue
+		}
+		if nodeTopoObj.Spec.NodeUUID == nodeUUID {
+			instances = append(instances, nodeTopoObj)
+		}
+	}
+	return instances
+}
+
+// getWinningCSINodeTopology returns the instance to be used for a node among
+// the given instances of the node as per csiNodeTopologyDuplicateResolution.
+// Ties in creation timestamp are broken by the instance name so that the
+// result does not depend on the order of the instances.
+func getWinningCSINodeTopology(
+	instances []csinodetopologyv1alpha1.CSINodeTopology) csinodetopologyv1alpha1.CSINodeTopology {
+	winner := instances[0]
+	for _, instance := range instances[1:] {
+		winnerTime, instanceTime := winner.CreationTimestamp.Time, instance.CreationTimestamp.Time
+		isNewer := instanceTime.After(winnerTime) ||
+			(instanceTime.Equal(winnerTime) && instance.Name > winner.Name)
+		if isNewer == (csiNodeTopologyDuplicateResolution != csiNodeTopologyDuplicateResolutionOldest) {
+			winner = instance
+		}
+	}
+	return winner
+}
+
+// getSupersededCSINodeTopologies returns the names of the given instances
+// which are superseded by another instance for the same node UUID.
+func getSupersededCSINodeTopologies(
+	instances []csinodetopologyv1alpha1.CSINodeTopology) map[string]struct{} {
+	nodeUUIDInstances := make(map[string][]csinodetopologyv1alpha1.CSINodeTopology)
+	for _, instance := range instances {
+		if instance.Spec.NodeUUID == "" {
+			continue
+		}
+		nodeUUIDInstances[instance.Spec.NodeUUID] = append(nodeUUIDInstances[instance.Spec.NodeUUID], instance)
+	}
+	superseded := make(map[string]struct{})
+	for _, duplicates := range nodeUUIDInstances {
+		if len(duplicates) < 2 {
+			continue
+		}
+		winner := getWinningCSINodeTopology(duplicates)
+		for _, instance := range duplicates {
+			if instance.Name != winner.Name {
+				superseded[instance.Name] = struct{}{}
+			}
+		}
+	}
+	return superseded
+}
+
+// getDomainNodeMapKey returns the key of the given topology label in the
+// domainNodeMap, which is a composite of the topology key and the normalized
+// tag value, e.g. "topology.csi.vmware.com/k8s-zone:us-east".
+func getDomainNodeMapKey(key, value string) string {
+	return key + ":" + normalizeTopologyLabelValue(value)
+}
+
 // Adds the CR instance name in the domainNodeMap wherever appropriate.
 func addNodeToDomainNodeMap(ctx context.Context, nodeTopoObj csinodetopologyv1alpha1.CSINodeTopology) {
 	log := logger.GetLogger(ctx)
+	if !isNodeParticipatingInTopology(ctx, nodeTopoObj.Name) {
+		log.Infof("Node %q does not match the topology node selector. Skipping it in domainNodeMap",
+			nodeTopoObj.Name)
+		return
+	}
+	warnOnConflictingTopologyLabels(ctx, nodeTopoObj)
 	domainNodeMapInstanceLock.Lock()
 	defer domainNodeMapInstanceLock.Unlock()
 	for _, label := range nodeTopoObj.Status.TopologyLabels {
-		if _, exists := domainNodeMap[label.Value]; !exists {
-			domainNodeMap[label.Value] = map[string]struct{}{nodeTopoObj.Name: {}}
+		value := normalizeTopologyLabelValue(label.Value)
+		if value != label.Value {
+			log.Debugf("Normalized topology label value %q of %q to %q", label.Value, nodeTopoObj.Name, value)
+		}
+		domainKey := getDomainNodeMapKey(label.Key, label.Value)
+		if _, exists := domainNodeMap[domainKey]; !exists {
+			domainNodeMap[domainKey] = map[string]struct{}{nodeTopoObj.Name: {}}
 		} else {
-			domainNodeMap[label.Value][nodeTopoObj.Name] = struct{}{}
+			domainNodeMap[domainKey][nodeTopoObj.Name] = struct{}{}
 		}
 	}
 	log.Infof("Added %q value to domainNodeMap", nodeTopoObj.Name)
 }
 
+// getConflictingTopologyLabels returns the topology keys under which the given
+// CSINodeTopology instance has more than one distinct value, along with those
+// values.
+func getConflictingTopologyLabels(nodeTopoObj csinodetopologyv1alpha1.CSINodeTopology) map[string][]string {
+	keyValues := make(map[string][]string)
+	for _, label := range nodeTopoObj.Status.TopologyLabels {
+		value := normalizeTopologyLabelValue(label.Value)
+		duplicate := false
+		for _, existingValue := range keyValues[label.Key] {
+			if existingValue == value {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			keyValues[label.Key] = append(keyValues[label.Key], value)
+		}
+	}
+	conflicts := make(map[string][]string)
+	for key, values := range keyValues {
+		if len(values) > 1 {
+			conflicts[key] = values
+		}
+	}
+	return conflicts
+}
+
+// warnOnConflictingTopologyLabels logs a warning and increments a metric for
+// each topology key under which the node has more than one value. Such a node
+// matches conflicting topology segments, which is usually caused by a
+// mis-tagged node VM.
+func warnOnConflictingTopologyLabels(ctx context.Context, nodeTopoObj csinodetopologyv1alpha1.CSINodeTopology) {
+	log := logger.GetLogger(ctx)
+	for key, values := range getConflictingTopologyLabels(nodeTopoObj) {
+		log.Warnf("Node %q has multiple values %v for topology key %q. The node will match conflicting "+
+			"topology segments. Verify the tags on the node VM.", nodeTopoObj.Name, values, key)
+		prometheus.TopologyConflictingNodeLabelsCounterVec.WithLabelValues(key).Inc()
+	}
+}
+
 // Removes the CR instance name from the domainNodeMap.
 func removeNodeFromDomainNodeMap(ctx context.Context, nodeTopoObj csinodetopologyv1alpha1.CSINodeTopology) {
 	log := logger.GetLogger(ctx)
 	domainNodeMapInstanceLock.Lock()
 	defer domainNodeMapInstanceLock.Unlock()
 	for _, label := range nodeTopoObj.Status.TopologyLabels {
-		delete(domainNodeMap[label.Value], nodeTopoObj.Name)
+		delete(domainNodeMap[getDomainNodeMapKey(label.Key, label.Value)], nodeTopoObj.Name)
 	}
 	log.Infof("Removed %q value from domainNodeMap", nodeTopoObj.Name)
 }
 
+// isNodeParticipatingInTopology returns true if the given node matches the
+// topology node selector or if no selector is configured.
+func isNodeParticipatingInTopology(ctx context.Context, nodeName string) bool {
+	log := logger.GetLogger(ctx)
+	if topologyNodeSelector == nil || topologyNodeLister == nil {
+		return true
+	}
+	node, err := topologyNodeLister.Get(nodeName)
+	if err != nil {
+		log.Debugf("failed to get node %q from the node lister. Error: %v", nodeName, err)
+		return false
+	}
+	return topologyNodeSelector.Matches(labels.Set(node.Labels))
+}
+
+// topologyNodeAdded, topologyNodeUpdated and topologyNodeDeleted dispatch the
+// events of the node informer to the current controllerVolumeTopologyInstance,
+// if any.
+func topologyNodeAdded(obj interface{}) {
+	if volTopology := getControllerVolumeTopologyInstance(); volTopology != nil {
+		volTopology.nodeAdded(obj)
+	}
+}
+
+func topologyNodeUpdated(oldObj interface{}, newObj interface{}) {
+	if volTopology := getControllerVolumeTopologyInstance(); volTopology != nil {
+		volTopology.nodeUpdated(oldObj, newObj)
+	}
+}
+
+func topologyNodeDeleted(obj interface{}) {
+	if volTopology := getControllerVolumeTopologyInstance(); volTopology != nil {
+		volTopology.nodeDeleted(obj)
+	}
+}
+
+// getControllerVolumeTopologyInstance returns the controllerVolumeTopologyInstance.
+func getControllerVolumeTopologyInstance() *controllerVolumeTopology {
+	controllerVolumeTopologyInstanceLock.RLock()
+	defer controllerVolumeTopologyInstanceLock.RUnlock()
+	return controllerVolumeTopologyInstance
+}
+
+// nodeAdded adds the node to the domainNodeMap if it matches the topology
+// node selector. This handles the CSINodeTopology instance being processed
+// before the node is known to the node informer.
+func (volTopology *controllerVolumeTopology) nodeAdded(obj interface{}) {
+	ctx, log := logger.GetNewContextWithLogger()
+	node, ok := obj.(*v1.Node)
+	if node == nil || !ok {
+		log.Warnf("nodeAdded: unrecognized object %+v", obj)
+		return
+	}
+	if topologyNodeSelector == nil {
+		return
+	}
+	volTopology.refreshNodeInDomainNodeMap(ctx, node.Name)
+}
+
+// nodeUpdated adds or removes the node from the domainNodeMap when a change
+// in its labels changes whether it matches the topology node selector.
+func (volTopology *controllerVolumeTopology) nodeUpdated(oldObj interface{}, newObj interface{}) {
+	ctx, log := logger.GetNewContextWithLogger()
+	oldNode, ok := oldObj.(*v1.Node)
+	if oldNode == nil || !ok {
+		log.Warnf("nodeUpdated: unrecognized old object %+v", oldObj)
+		return
+	}
+	newNode, ok := newObj.(*v1.Node)
+	if newNode == nil || !ok {
+		log.Warnf("nodeUpdated: unrecognized new object %+v", newObj)
+		return
+	}
+	if topologyNodeSelector == nil ||
+		topologyNodeSelector.Matches(labels.Set(oldNode.Labels)) ==
+			topologyNodeSelector.Matches(labels.Set(newNode.Labels)) {
+		return
+	}
+	volTopology.refreshNodeInDomainNodeMap(ctx, newNode.Name)
+}
+
+// refreshNodeInDomainNodeMap adds the node to the domainNodeMap if it
+// participates in topology and removes it otherwise.
+func (volTopology *controllerVolumeTopology) refreshNodeInDomainNodeMap(ctx context.Context, nodeName string) {
+	log := logger.GetLogger(ctx)
+	val, exists, err := volTopology.csiNodeTopologyInformer.GetStore().GetByKey(nodeName)
+	if err != nil || !exists {
+		log.Debugf("no %s instance found for node %q in the informer store. Error: %v",
+			csinodetopology.CRDSingular, nodeName, err)
+		return
+	}
+	var nodeTopoObj csinodetopologyv1alpha1.CSINodeTopology
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(val.(*unstructured.Unstructured).Object,
+		&nodeTopoObj)
+	if err != nil {
+		log.Errorf("failed to cast object %+v to %s type. Error: %+v", val, csinodetopology.CRDSingular, err)
+		return
+	}
+	if nodeTopoObj.Status.Status != csinodetopologyv1alpha1.CSINodeTopologySuccess {
+		return
+	}
+	invalidateSharedDatastoresCache(ctx)
+	if isNodeParticipatingInTopology(ctx, nodeName) {
+		addNodeToDomainNodeMap(ctx, nodeTopoObj)
+	} else {
+		removeNodeFromDomainNodeMap(ctx, nodeTopoObj)
+	}
+}
+
+// nodeDeleted removes the deleted node from the domainNodeMap and the
+// nodeVMCache, and deletes its CSINodeTopology instance without waiting for
+// garbage collection to act on the owner reference.
+func (volTopology *controllerVolumeTopology) nodeDeleted(obj interface{}) {
+	ctx, log := logger.GetNewContextWithLogger()
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	node, ok := obj.(*v1.Node)
+	if node == nil || !ok {
+		log.Warnf("nodeDeleted: unrecognized object %+v", obj)
+		return
+	}
+	invalidateSharedDatastoresCache(ctx)
+	val, exists, err := volTopology.csiNodeTopologyInformer.GetStore().GetByKey(node.Name)
+	if err != nil || !exists {
+		log.Debugf("nodeDeleted: no %s instance found for node %q in the informer store. Error: %v",
+			csinodetopology.CRDSingular, node.Name, err)
+		return
+	}
+	var nodeTopoObj csinodetopologyv1alpha1.CSINodeTopology
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(val.(*unstructured.Unstructured).Object,
+		&nodeTopoObj)
+	if err != nil {
+		log.Errorf("nodeDeleted: failed to cast object %+v to %s type. Error: %+v", val,
+			csinodetopology.CRDSingular, err)
+		return
+	}
+	volTopology.removeFromNodeVMCache(ctx, nodeTopoObj.Spec.NodeUUID)
+	if nodeTopoObj.Status.Status == csinodetopologyv1alpha1.CSINodeTopologySuccess {
+		removeNodeFromDomainNodeMap(ctx, nodeTopoObj)
+	}
+	err = volTopology.csiNodeTopologyK8sClient.Delete(ctx, &csinodetopologyv1alpha1.CSINodeTopology{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: node.Name,
+		},
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Errorf("nodeDeleted: failed to delete %s instance %q. Error: %+v", csinodetopology.CRDSingular,
+			node.Name, err)
+		return
+	}
+	log.Infof("nodeDeleted: deleted %s instance %q of the deleted node", csinodetopology.CRDSingular, node.Name)
+}
+
+// reconcileDomainNodeMap rebuilds the domainNodeMap from the CSINodeTopology
+// informer store after every relistInterval until ctx is done.
+func (volTopology *controllerVolumeTopology) reconcileDomainNodeMap(ctx context.Context,
+	relistInterval time.Duration) {
+	log := logger.GetLogger(ctx)
+	ticker := time.NewTicker(relistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			log.Debugf("Rebuilding domainNodeMap from %s informer store", csinodetopology.CRDSingular)
+			volTopology.relistDomainNodeMap(ctx)
+		}
+	}
+}
+
+// relistDomainNodeMap builds a new domainNodeMap from the CSINodeTopology
+// instances in the informer store and swaps it with the existing one. The
+// event handlers are blocked meanwhile, so no update is lost by the swap.
+func (volTopology *controllerVolumeTopology) relistDomainNodeMap(ctx context.Context) {
+	domainNodeMapRebuildLock.Lock()
+	defer domainNodeMapRebuildLock.Unlock()
+	newDomainNodeMap := volTopology.buildDomainNodeMap(ctx, 1)
+	swapDomainNodeMap(ctx, newDomainNodeMap)
+}
+
+// loadDomainNodeMap waits for the CSINodeTopology informer to sync and then
+// populates the domainNodeMap from its store using the given number of
+// workers. The map is built without holding domainNodeMapInstanceLock so that
+// a cold start does not serialize on the lock for every instance. The event
+// handlers are blocked until the load is merged, after which the replayed add
+// events of the loaded instances are skipped. The topology service does not
+// report that it has synced until the load is done.
+func (volTopology *controllerVolumeTopology) loadDomainNodeMap(ctx context.Context, stopCh <-chan struct{},
+	parallelism int) {
+	log := logger.GetLogger(ctx)
+	defer close(volTopology.domainNodeMapLoaded)
+	if !cache.WaitForCacheSync(stopCh, volTopology.csiNodeTopologyInformer.HasSynced) {
+		log.Warnf("%s informer stopped before syncing. Skipping the initial load of domainNodeMap",
+			csinodetopology.CRDSingular)
+		return
+	}
+	start := time.Now()
+	domainNodeMapRebuildLock.Lock()
+	defer domainNodeMapRebuildLock.Unlock()
+	objs := volTopology.csiNodeTopologyInformer.GetStore().List()
+	newDomainNodeMap := buildDomainNodeMapFromObjects(ctx, objs, parallelism)
+	mergeDomainNodeMap(ctx, newDomainNodeMap)
+	for _, obj := range objs {
+		if unstructuredObj, ok := obj.(*unstructured.Unstructured); ok {
+			loadedCSINodeTopologyVersions[unstructuredObj.GetName()] = unstructuredObj.GetResourceVersion()
+		}
+	}
+	log.Infof("Loaded domainNodeMap from %s informer store with %d worker(s) in %v",
+		csinodetopology.CRDSingular, parallelism, time.Since(start))
+}
+
+// isLoadedCSINodeTopology returns true if the given CSINodeTopology instance
+// was already populated in the domainNodeMap by the initial load. The caller
+// must hold domainNodeMapRebuildLock.
+func isLoadedCSINodeTopology(obj interface{}) bool {
+	unstructuredObj, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	resourceVersion, exists := loadedCSINodeTopologyVersions[unstructuredObj.GetName()]
+	return exists && resourceVersion == unstructuredObj.GetResourceVersion()
+}
+
+// buildDomainNodeMap builds a new domainNodeMap from the CSINodeTopology
+// instances in the informer store. The instances are split among the given
+// number of workers.
+func (volTopology *controllerVolumeTopology) buildDomainNodeMap(ctx context.Context,
+	parallelism int) map[string]map[string]struct{} {
+	return buildDomainNodeMapFromObjects(ctx, volTopology.csiNodeTopologyInformer.GetStore().List(),
+		parallelism)
+}
+
+// buildDomainNodeMapFromObjects builds a new domainNodeMap from the given
+// CSINodeTopology instances, which are split among the given number of
+// workers.
+func buildDomainNodeMapFromObjects(ctx context.Context, objs []interface{},
+	parallelism int) map[string]map[string]struct{} {
+	log := logger.GetLogger(ctx)
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	if parallelism > len(objs) {
+		parallelism = len(objs)
+	}
+	converted := make([]*csinodetopologyv1alpha1.CSINodeTopology, len(objs))
+	runInParallel(len(objs), parallelism, func(i int) {
+		var nodeTopoObj csinodetopologyv1alpha1.CSINodeTopology
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(objs[i].(*unstructured.Unstructured).Object,
+			&nodeTopoObj)
+		if err != nil {
+			log.Errorf("buildDomainNodeMap: failed to cast object %+v to %s. Error: %+v", objs[i],
+				csinodetopology.CRDSingular, err)
+			return
+		}
+		converted[i] = &nodeTopoObj
+	})
+	var instances []csinodetopologyv1alpha1.CSINodeTopology
+	for _, nodeTopoObj := range converted {
+		if nodeTopoObj != nil {
+			instances = append(instances, *nodeTopoObj)
+		}
+	}
+	// Skip the instances superseded by a duplicate instance for the same node.
+	superseded := getSupersededCSINodeTopologies(instances)
+	participating := make([]bool, len(instances))
+	runInParallel(len(instances), parallelism, func(i int) {
+		nodeTopoObj := instances[i]
+		if _, exists := superseded[nodeTopoObj.Name]; exists {
+			log.Debugf("buildDomainNodeMap: skipping superseded %s instance %q", csinodetopology.CRDSingular,
+				nodeTopoObj.Name)
+			return
+		}
+		participating[i] = nodeTopoObj.Status.Status == csinodetopologyv1alpha1.CSINodeTopologySuccess &&
+			isNodeParticipatingInTopology(ctx, nodeTopoObj.Name)
+	})
+	newDomainNodeMap := make(map[string]map[string]struct{})
+	for i, nodeTopoObj := range instances {
+		if !participating[i] {
+			continue
+		}
+		for _, label := range nodeTopoObj.Status.TopologyLabels {
+			domainKey := getDomainNodeMapKey(label.Key, label.Value)
+			if _, exists := newDomainNodeMap[domainKey]; !exists {
+				newDomainNodeMap[domainKey] = make(map[string]struct{})
+			}
+			newDomainNodeMap[domainKey][nodeTopoObj.Name] = struct{}{}
+		}
+	}
+	return newDomainNodeMap
+}
+
+// runInParallel calls fn for every index in [0, count) using the given number
+// of workers and waits for all of them to finish. No more than count workers
+// are started.
+func runInParallel(count, workers int, fn func(i int)) {
+	if workers > count {
+		workers = count
+	}
+	if workers <= 1 {
+		for i := 0; i < count; i++ {
+			fn(i)
+		}
+		return
+	}
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+}
+
+// swapDomainNodeMap replaces the domainNodeMap with the given one.
+func swapDomainNodeMap(ctx context.Context, newDomainNodeMap map[string]map[string]struct{}) {
+	log := logger.GetLogger(ctx)
+	domainNodeMapInstanceLock.Lock()
+	defer domainNodeMapInstanceLock.Unlock()
+	if !reflect.DeepEqual(domainNodeMap, newDomainNodeMap) {
+		log.Infof("domainNodeMap drifted from %s informer store. Old: %+v, New: %+v",
+			csinodetopology.CRDSingular, domainNodeMap, newDomainNodeMap)
+		invalidateSharedDatastoresCache(ctx)
+	}
+	domainNodeMap = newDomainNodeMap
+}
+
+// mergeDomainNodeMap adds the nodes of the given domainNodeMap to the
+// domainNodeMap, keeping the nodes added by the event handlers.
+func mergeDomainNodeMap(ctx context.Context, newDomainNodeMap map[string]map[string]struct{}) {
+	domainNodeMapInstanceLock.Lock()
+	defer domainNodeMapInstanceLock.Unlock()
+	for domainKey, nodes := range newDomainNodeMap {
+		if _, exists := domainNodeMap[domainKey]; !exists {
+			domainNodeMap[domainKey] = make(map[string]struct{}, len(nodes))
+		}
+		for nodeName := range nodes {
+			domainNodeMap[domainKey][nodeName] = struct{}{}
+		}
+	}
+	invalidateSharedDatastoresCache(ctx)
+}
+
+// getFromNodeVMCache returns the cached nodeVM for the given node UUID if the
+// entry has not expired.
+func (volTopology *controllerVolumeTopology) getFromNodeVMCache(nodeUUID string) (
+	*cnsvsphere.VirtualMachine, bool) {
+	volTopology.nodeVMCacheLock.Lock()
+	defer volTopology.nodeVMCacheLock.Unlock()
+	entry, exists := volTopology.nodeVMCache[nodeUUID]
+	if !exists || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.nodeVM, true
+}
+
+// Adds the nodeVM resolved for the given node UUID to the nodeVMCache.
+func (volTopology *controllerVolumeTopology) addToNodeVMCache(ctx context.Context, nodeUUID string,
+	nodeVM *cnsvsphere.VirtualMachine) {
+	log := logger.GetLogger(ctx)
+	volTopology.nodeVMCacheLock.Lock()
+	defer volTopology.nodeVMCacheLock.Unlock()
+	if volTopology.nodeVMCache == nil {
+		volTopology.nodeVMCache = make(map[string]*nodeVMCacheEntry)
+	}
+	volTopology.nodeVMCache[nodeUUID] = &nodeVMCacheEntry{
+		nodeVM:    nodeVM,
+		expiresAt: time.Now().Add(volTopology.nodeVMCacheTTL),
+	}
+	log.Debugf("Added nodeVM for node UUID %q to nodeVMCache", nodeUUID)
+}
+
+// Removes the given node UUID from the nodeVMCache.
+func (volTopology *controllerVolumeTopology) removeFromNodeVMCache(ctx context.Context, nodeUUID string) {
+	log := logger.GetLogger(ctx)
+	volTopology.nodeVMCacheLock.Lock()
+	defer volTopology.nodeVMCacheLock.Unlock()
+	if _, exists := volTopology.nodeVMCache[nodeUUID]; exists {
+		delete(volTopology.nodeVMCache, nodeUUID)
+		log.Infof("Removed node UUID %q from nodeVMCache", nodeUUID)
+	}
+}
+
+// csiNodeTopologyUpdated removes the nodeVM cached for the old node UUID of an
+// updated CSINodeTopology instance. The node UUID changes when the node VM is
+// recreated, e.g. during a node rebuild.
+func (volTopology *controllerVolumeTopology) csiNodeTopologyUpdated(oldObj interface{}, newObj interface{}) {
+	ctx, log := logger.GetNewContextWithLogger()
+	var oldNodeTopoObj, newNodeTopoObj csinodetopologyv1alpha1.CSINodeTopology
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(oldObj.(*unstructured.Unstructured).Object,
+		&oldNodeTopoObj)
+	if err != nil {
+		log.Errorf("csiNodeTopologyUpdated: failed to cast old object %+v to %s. Error: %+v", oldObj,
+			csinodetopology.CRDSingular, err)
+		return
+	}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(newObj.(*unstructured.Unstructured).Object,
+		&newNodeTopoObj)
+	if err != nil {
+		log.Errorf("csiNodeTopologyUpdated: failed to cast new object %+v to %s. Error: %+v", newObj,
+			csinodetopology.CRDSingular, err)
+		return
+	}
+	if oldNodeTopoObj.Spec.NodeUUID != newNodeTopoObj.Spec.NodeUUID {
+		log.Infof("csiNodeTopologyUpdated: node UUID of %q instance %q changed from %q to %q",
+			csinodetopology.CRDSingular, newNodeTopoObj.Name, oldNodeTopoObj.Spec.NodeUUID,
+			newNodeTopoObj.Spec.NodeUUID)
+		volTopology.removeFromNodeVMCache(ctx, oldNodeTopoObj.Spec.NodeUUID)
+	}
+}
+
+// csiNodeTopologyDeleted removes the nodeVM cached for the node UUID of a
+// deleted CSINodeTopology instance.
+func (volTopology *controllerVolumeTopology) csiNodeTopologyDeleted(obj interface{}) {
+	ctx, log := logger.GetNewContextWithLogger()
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	unstructuredObj, ok := obj.(*unstructured.Unstructured)
+	if unstructuredObj == nil || !ok {
+		log.Warnf("csiNodeTopologyDeleted: unrecognized object %+v", obj)
+		return
+	}
+	var nodeTopoObj csinodetopologyv1alpha1.CSINodeTopology
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredObj.Object, &nodeTopoObj)
+	if err != nil {
+		log.Errorf("csiNodeTopologyDeleted: failed to cast object %+v to %s type. Error: %+v", obj,
+			csinodetopology.CRDSingular, err)
+		return
+	}
+	volTopology.removeFromNodeVMCache(ctx, nodeTopoObj.Spec.NodeUUID)
+}
+
+// getSharedDatastoresCacheKey returns the canonical form of the given topology
+// segments, which is independent of the order of the keys and of the case of
+// the values when topology label values are compared case insensitively.
+func getSharedDatastoresCacheKey(segments map[string]string) string {
+	pairs := make([]string, 0, len(segments))
+	for key, value := range segments {
+		pairs = append(pairs, key+"="+normalizeTopologyLabelValue(value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// getFromSharedDatastoresCache returns the cached shared datastores for the
+// given cache key if the entry has not expired.
+func getFromSharedDatastoresCache(key string) ([]*cnsvsphere.DatastoreInfo, bool) {
+	sharedDatastoresCacheInstanceLock.RLock()
+	defer sharedDatastoresCacheInstanceLock.RUnlock()
+	entry, exists := sharedDatastoresCache[key]
+	if !exists || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.datastores, true
+}
+
+// Adds the shared datastores resolved for the given cache key to the sharedDatastoresCache.
+func addToSharedDatastoresCache(ctx context.Context, key string, datastores []*cnsvsphere.DatastoreInfo,
+	ttl time.Duration) {
+	log := logger.GetLogger(ctx)
+	sharedDatastoresCacheInstanceLock.Lock()
+	defer sharedDatastoresCacheInstanceLock.Unlock()
+	sharedDatastoresCache[key] = &sharedDatastoresCacheEntry{
+		datastores: datastores,
+		expiresAt:  time.Now().Add(ttl),
+	}
+	log.Debugf("Added shared datastores for topology segment %q to sharedDatastoresCache", key)
+}
+
+// invalidateSharedDatastoresCache removes all the entries from the
+// sharedDatastoresCache as the nodes in a topology segment may have changed.
+func invalidateSharedDatastoresCache(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	sharedDatastoresCacheInstanceLock.Lock()
+	defer sharedDatastoresCacheInstanceLock.Unlock()
+	if len(sharedDatastoresCache) != 0 {
+		sharedDatastoresCache = make(map[string]*sharedDatastoresCacheEntry)
+		log.Debugf("Invalidated sharedDatastoresCache")
+	}
+}
+
+// isTopologyValueDraining returns true if the given topology value is being
+// drained. Values are compared after normalizing them like the topology label
+// values used for placement.
+func isTopologyValueDraining(value string) bool {
+	drainingTopologyValuesInstanceLock.RLock()
+	defer drainingTopologyValuesInstanceLock.RUnlock()
+	value = normalizeTopologyLabelValue(value)
+	for drainingValue := range drainingTopologyValues {
+		if normalizeTopologyLabelValue(drainingValue) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isTopologySegmentDraining returns true if any value in the given topology
+// segment is being drained.
+func isTopologySegmentDraining(segments map[string]string) bool {
+	for _, value := range segments {
+		if isTopologyValueDraining(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// setDrainingTopologyValues replaces the topology values being drained.
+// Draining values are excluded from new volume placements while existing
+// volumes are left untouched.
+func setDrainingTopologyValues(ctx context.Context, values []string) {
+	log := logger.GetLogger(ctx)
+	drainingTopologyValuesInstanceLock.Lock()
+	defer drainingTopologyValuesInstanceLock.Unlock()
+	drainingTopologyValues = make(map[string]struct{})
+	for _, value := range values {
+		drainingTopologyValues[strings.TrimSpace(value)] = struct{}{}
+	}
+	log.Infof("Set draining topology values to %v", values)
+}
+
+// addDrainingTopologyValue marks the given topology value as being drained.
+func addDrainingTopologyValue(ctx context.Context, value string) {
+	log := logger.GetLogger(ctx)
+	drainingTopologyValuesInstanceLock.Lock()
+	defer drainingTopologyValuesInstanceLock.Unlock()
+	drainingTopologyValues[strings.TrimSpace(value)] = struct{}{}
+	log.Infof("Marked topology value %q as draining", value)
+}
+
+// removeDrainingTopologyValue stops draining the given topology value. Values
+// are compared after normalizing them, see isTopologyValueDraining.
+func removeDrainingTopologyValue(ctx context.Context, value string) {
+	log := logger.GetLogger(ctx)
+	drainingTopologyValuesInstanceLock.Lock()
+	defer drainingTopologyValuesInstanceLock.Unlock()
+	value = normalizeTopologyLabelValue(value)
+	for drainingValue := range drainingTopologyValues {
+		if normalizeTopologyLabelValue(drainingValue) == value {
+			delete(drainingTopologyValues, drainingValue)
+		}
+	}
+	log.Infof("Stopped draining topology value %q", value)
+}
+
+// getDrainingTopologyValues returns the sorted list of topology values being drained.
+func getDrainingTopologyValues() []string {
+	drainingTopologyValuesInstanceLock.RLock()
+	defer drainingTopologyValuesInstanceLock.RUnlock()
+	values := make([]string, 0, len(drainingTopologyValues))
+	for value := range drainingTopologyValues {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// registerDrainingTopologyHandler registers the debug endpoint used to manage
+// the draining topology values on the debug server of the controller.
+func registerDrainingTopologyHandler(ctx context.Context) {
+	registerDrainingTopologyHandlerOnce.Do(func() {
+		common.RegisterDebugHandler(ctx, "/debug/draining-topology", drainingTopologyHandler)
+	})
+}
+
+// drainingTopologyHandler serves the /debug/draining-topology endpoint. GET
+// returns the topology values being drained. POST marks the topology value in
+// the "value" query parameter as draining and DELETE stops draining it. POST
+// and DELETE require the bearer token set in CSI_DEBUG_SERVER_TOKEN. The
+// values are replaced by the draining-topology-values entry of the config
+// whenever it is reloaded.
+func drainingTopologyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, log := logger.GetNewContextWithLogger()
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
+		if !common.IsAuthorizedDebugRequest(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		value := strings.TrimSpace(r.URL.Query().Get("value"))
+		if value == "" {
+			http.Error(w, "the value query parameter is required", http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost {
+			addDrainingTopologyValue(ctx, value)
+		} else {
+			removeDrainingTopologyValue(ctx, value)
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(getDrainingTopologyValues()); err != nil {
+		log.Errorf("failed to encode draining topology values. Error: %+v", err)
+	}
+}
+
+// getRequisiteTopologiesWithoutNodes returns the requisite topology segments
+// in the given topology requirement which do not match any node as per the
+// domainNodeMap.
+func getRequisiteTopologiesWithoutNodes(ctx context.Context,
+	topologyRequirement *csi.TopologyRequirement) []map[string]string {
+	log := logger.GetLogger(ctx)
+	domainNodeMapInstanceLock.RLock()
+	defer domainNodeMapInstanceLock.RUnlock()
+	unsatisfiedTopologies := make([]map[string]string, 0)
+	for _, topology := range topologyRequirement.GetRequisite() {
+		segments := topology.GetSegments()
+		var domainKeys []string
+		for key, tag := range segments {
+			domainKeys = append(domainKeys, getDomainNodeMapKey(key, tag))
+		}
+		if len(domainKeys) == 0 {
+			continue
+		}
+		// Look for a node which is present in every label of the segment.
+		isSatisfied := false
+		for nodeName := range domainNodeMap[domainKeys[0]] {
+			isPresent := true
+			for _, otherKey := range domainKeys[1:] {
+				if _, exists := domainNodeMap[otherKey][nodeName]; !exists {
+					isPresent = false
+					break
+				}
+			}
+			if isPresent {
+				isSatisfied = true
+				break
+			}
+		}
+		if !isSatisfied {
+			log.Infof("No node found in requisite topology segment %+v", segments)
+			unsatisfiedTopologies = append(unsatisfiedTopologies, segments)
+		}
+	}
+	return unsatisfiedTopologies
+}
+
+// registerRequisiteTopologyHandler registers the debug endpoint used to
+// validate requisite topologies on the debug server of the controller.
+func registerRequisiteTopologyHandler(ctx context.Context) {
+	registerRequisiteTopologyHandlerOnce.Do(func() {
+		common.RegisterDebugHandler(ctx, "/debug/requisite-topology", requisiteTopologyHandler)
+	})
+}
+
+// requisiteTopologyHandler serves the /debug/requisite-topology endpoint. POST
+// takes a JSON encoded csi.TopologyRequirement and returns the requisite
+// topology segments which do not match any node.
+func requisiteTopologyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, log := logger.GetNewContextWithLogger()
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var topologyRequirement csi.TopologyRequirement
+	if err := json.NewDecoder(r.Body).Decode(&topologyRequirement); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode topology requirement. Error: %v", err),
+			http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(getRequisiteTopologiesWithoutNodes(ctx,
+		&topologyRequirement)); err != nil {
+		log.Errorf("failed to encode requisite topologies without nodes. Error: %+v", err)
+	}
+}
+
+// topologySnapshot is a point in time copy of the topology caches of the
+// controller used for offline diagnosis.
+type topologySnapshot struct {
+	// Time is the time at which the snapshot was taken.
+	Time time.Time `json:"time"`
+	// DomainNodeMap maps each topology label to the names of the nodes having it.
+	DomainNodeMap map[string][]string `json:"domainNodeMap"`
+	// AZClusterMap maps each AvailabilityZone to the cluster moref in it.
+	AZClusterMap map[string]string `json:"azClusterMap"`
+	// CSINodeTopologies maps each CSINodeTopology instance to its status.
+	CSINodeTopologies map[string]csinodetopologyv1alpha1.CSINodeTopologyStatus `json:"csiNodeTopologies"`
+}
+
+// getTopologySnapshot returns a snapshot of the domainNodeMap, the
+// azClusterMap and the status of the CSINodeTopology instances in the given
+// store, if any. The caches are read while holding both of their locks so that
+// the snapshot is consistent.
+func getTopologySnapshot(ctx context.Context, csiNodeTopologyStore cache.Store) topologySnapshot {
+	log := logger.GetLogger(ctx)
+	snapshot := topologySnapshot{
+		DomainNodeMap:     make(map[string][]string),
+		AZClusterMap:      make(map[string]string),
+		CSINodeTopologies: make(map[string]csinodetopologyv1alpha1.CSINodeTopologyStatus),
+	}
+	domainNodeMapInstanceLock.RLock()
+	defer domainNodeMapInstanceLock.RUnlock()
+	azClusterMapInstanceLock.RLock()
+	defer azClusterMapInstanceLock.RUnlock()
+	snapshot.Time = time.Now()
+	for domainKey, nodes := range domainNodeMap {
+		nodeNames := make([]string, 0, len(nodes))
+		for nodeName := range nodes {
+			nodeNames = append(nodeNames, nodeName)
+		}
+		sort.Strings(nodeNames)
+		snapshot.DomainNodeMap[domainKey] = nodeNames
+	}
+	for azName, clusterMoref := range azClusterMap {
+		snapshot.AZClusterMap[azName] = clusterMoref
+	}
+	if csiNodeTopologyStore != nil {
+		for _, val := range csiNodeTopologyStore.List() {
+			var nodeTopoObj csinodetopologyv1alpha1.CSINodeTopology
+			err := runtime.DefaultUnstructuredConverter.FromUnstructured(val.(*unstructured.Unstructured).Object,
+				&nodeTopoObj)
+			if err != nil {
+				log.Warnf("failed to convert unstructured object %+v to CSINodeTopology instance. Error: %+v",
+					val, err)
+				continue
+			}
+			snapshot.CSINodeTopologies[nodeTopoObj.Name] = nodeTopoObj.Status
+		}
+	}
+	return snapshot
+}
+
+// writeTopologySnapshot writes a JSON encoded snapshot of the topology caches
+// to a new file in the given directory and returns the path of the file.
+func writeTopologySnapshot(ctx context.Context, csiNodeTopologyStore cache.Store, dir string) (string, error) {
+	log := logger.GetLogger(ctx)
+	snapshot := getTopologySnapshot(ctx, csiNodeTopologyStore)
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return "", logger.LogNewErrorf(log, "failed to encode topology snapshot. Error: %+v", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("topology-snapshot-%s.json",
+		snapshot.Time.UTC().Format("20060102T150405.000000000Z")))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", logger.LogNewErrorf(log, "failed to create topology snapshot file %q. Error: %+v", path, err)
+	}
+	defer file.Close()
+	if _, err = file.Write(data); err != nil {
+		return "", logger.LogNewErrorf(log, "failed to write topology snapshot file %q. Error: %+v", path, err)
+	}
+	log.Infof("Wrote topology snapshot to %q", path)
+	return path, nil
+}
+
+// registerTopologySnapshotHandler registers the debug endpoint used to export
+// the topology caches on the debug server of the controller.
+func registerTopologySnapshotHandler(ctx context.Context) {
+	registerTopologySnapshotHandlerOnce.Do(func() {
+		common.RegisterDebugHandler(ctx, "/debug/topology-snapshot", topologySnapshotHandler)
+	})
+}
+
+// topologySnapshotHandler serves the /debug/topology-snapshot endpoint. GET
+// returns a JSON encoded snapshot of the topology caches. POST writes the
+// snapshot to a new file in the directory set in the TOPOLOGY_SNAPSHOT_DIR
+// env variable and returns the path of the file. POST requires the bearer
+// token set in CSI_DEBUG_SERVER_TOKEN.
+func topologySnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, log := logger.GetNewContextWithLogger()
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var csiNodeTopologyStore cache.Store
+	controllerVolumeTopologyInstanceLock.RLock()
+	if controllerVolumeTopologyInstance != nil {
+		csiNodeTopologyStore = controllerVolumeTopologyInstance.csiNodeTopologyInformer.GetStore()
+	}
+	controllerVolumeTopologyInstanceLock.RUnlock()
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(getTopologySnapshot(ctx, csiNodeTopologyStore)); err != nil {
+			log.Errorf("failed to encode topology snapshot. Error: %+v", err)
+		}
+		return
+	}
+	if !common.IsAuthorizedDebugRequest(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	dir := getTopologySnapshotDir(ctx)
+	if dir == "" {
+		http.Error(w, "writing topology snapshots is disabled as TOPOLOGY_SNAPSHOT_DIR is not set",
+			http.StatusForbidden)
+		return
+	}
+	path, err := writeTopologySnapshot(ctx, csiNodeTopologyStore, dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(map[string]string{"path": path}); err != nil {
+		log.Errorf("failed to encode topology snapshot path. Error: %+v", err)
+	}
+}
+
 // InitTopologyServiceInNode returns a singleton implementation of the commoncotypes.NodeTopologyService interface.
 func (c *K8sOrchestrator) InitTopologyServiceInNode(ctx context.Context) (
 	commoncotypes.NodeTopologyService, error) {
@@ -609,20 +2078,137 @@ func (volTopology *nodeVolumeTopology) GetNodeTopologyLabels(ctx context.Context
 	} else {
 		err = createCSINodeTopologyInstance(ctx, volTopology, nodeInfo)
 		if err != nil {
-			return nil, logger.LogNewErrorCodef(log, codes.Internal, err.Error())
+			return nil, logger.LogNewErrorCodef(log, codes.Internal, err.Error())
+		}
+	}
+
+	// Watch the CSINodeTopology instance until its status is updated or the
+	// timeout expires.
+	deadline := time.Now().Add(time.Duration(getCSINodeTopologyWatchTimeoutInMin(ctx)) * time.Minute)
+	return volTopology.waitForCSINodeTopologyLabels(ctx, nodeInfo.NodeName, deadline)
+}
+
+// waitForCSINodeTopologyLabels watches the CSINodeTopology instance with the
+// given name until its status is updated or the deadline expires. The watch
+// is re-established if it is closed early, e.g. due to an API server
+// disruption, at most maxRetries times.
+func (volTopology *nodeVolumeTopology) waitForCSINodeTopologyLabels(ctx context.Context, nodeName string,
+	deadline time.Time) (map[string]string, error) {
+	log := logger.GetLogger(ctx)
+	var err error
+	maxRetries := getCSINodeTopologyWatchMaxRetries(ctx)
+	for retries := 0; ; retries++ {
+		if retries > 0 {
+			if retries > maxRetries {
+				return nil, logger.LogNewErrorCodef(log, codes.Internal,
+					"giving up watching on CSINodeTopology instance with name %q after %d retries. "+
+						"Last error: %+v", nodeName, maxRetries, err)
+			}
+			log.Infof("Re-establishing the watch on CSINodeTopology instance %q. Retry %d of %d.",
+				nodeName, retries, maxRetries)
+			time.Sleep(csiNodeTopologyWatchRetryInterval)
+		}
+		timeoutSeconds := int64(time.Until(deadline).Seconds())
+		if timeoutSeconds <= 0 {
+			break
+		}
+		var accessibleTopology map[string]string
+		var done bool
+		accessibleTopology, done, err = volTopology.watchCSINodeTopologyStatus(ctx, nodeName,
+			timeoutSeconds)
+		if done {
+			return accessibleTopology, err
+		}
+		if err == nil && !time.Now().Before(deadline) {
+			break
+		}
+		if err == nil {
+			err = fmt.Errorf("watch closed before the timeout")
+		}
+		log.Warnf("Watch on CSINodeTopology instance %q ended early. Error: %+v", nodeName, err)
+	}
+	// Timed out waiting for topology labels to be updated.
+	return nil, logger.LogNewErrorCodef(log, codes.Internal,
+		"timed out while waiting for topology labels to be updated in %q CSINodeTopology instance.",
+		nodeName)
+}
+
+// RefreshAllNodeTopologyLabels requests the re-computation of the topology
+// labels of all the nodes in the cluster. The status of every CSINodeTopology
+// instance is reset and its refresh annotation is updated, which triggers a
+// new reconciliation of the instance. It returns the refreshed topology labels
+// keyed by node name. If the refresh fails for some of the nodes, the labels of
+// the remaining nodes are returned along with an error listing the failures.
+func (volTopology *nodeVolumeTopology) RefreshAllNodeTopologyLabels(ctx context.Context) (
+	map[string]map[string]string, error) {
+	log := logger.GetLogger(ctx)
+	csiNodeTopologyList := &csinodetopologyv1alpha1.CSINodeTopologyList{}
+	err := volTopology.csiNodeTopologyK8sClient.List(ctx, csiNodeTopologyList)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to list CSINodeTopology instances. Error: %+v", err)
+	}
+
+	var failures []string
+	var refreshedNodes []string
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}},"status":null}`,
+		csinodetopologyv1alpha1.RefreshTopologyLabelsAnnotation, time.Now().UTC().Format(time.RFC3339Nano)))
+	for _, csiNodeTopology := range csiNodeTopologyList.Items {
+		nodeName := csiNodeTopology.Name
+		err = volTopology.csiNodeTopologyK8sClient.Patch(ctx,
+			&csinodetopologyv1alpha1.CSINodeTopology{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: nodeName,
+				},
+			},
+			client.RawPatch(types.MergePatchType, patch))
+		if err != nil {
+			log.Errorf("failed to request a refresh of topology labels for CSINodeTopology instance %q. "+
+				"Error: %+v", nodeName, err)
+			failures = append(failures, fmt.Sprintf("%s: %v", nodeName, err))
+			continue
+		}
+		refreshedNodes = append(refreshedNodes, nodeName)
+	}
+
+	// All the instances are reconciled concurrently, therefore wait for them
+	// within a single timeout.
+	nodeTopologyLabels := make(map[string]map[string]string)
+	deadline := time.Now().Add(time.Duration(getCSINodeTopologyWatchTimeoutInMin(ctx)) * time.Minute)
+	for _, nodeName := range refreshedNodes {
+		topologyLabels, err := volTopology.waitForCSINodeTopologyLabels(ctx, nodeName, deadline)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", nodeName, err))
+			continue
 		}
+		nodeTopologyLabels[nodeName] = topologyLabels
+	}
+	if len(failures) > 0 {
+		return nodeTopologyLabels, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to refresh topology labels for %d out of %d node(s): %s", len(failures),
+			len(csiNodeTopologyList.Items), strings.Join(failures, "; "))
 	}
+	log.Infof("Successfully refreshed topology labels for %d node(s)", len(nodeTopologyLabels))
+	return nodeTopologyLabels, nil
+}
 
+// watchCSINodeTopologyStatus watches the CSINodeTopology instance with the
+// given name for at most timeoutSeconds. done is set to true once the status
+// of the instance is updated, in which case either its topology labels or an
+// error describing the failure are returned. An error with done set to false
+// means the watch could not be established.
+func (volTopology *nodeVolumeTopology) watchCSINodeTopologyStatus(ctx context.Context, nodeName string,
+	timeoutSeconds int64) (map[string]string, bool, error) {
+	log := logger.GetLogger(ctx)
 	// Create a watcher for CSINodeTopology CRs.
-	timeoutSeconds := int64((time.Duration(getCSINodeTopologyWatchTimeoutInMin(ctx)) * time.Minute).Seconds())
 	watchCSINodeTopology, err := volTopology.csiNodeTopologyWatcher.Watch(metav1.ListOptions{
-		FieldSelector:  fields.OneTermEqualSelector("metadata.name", nodeInfo.NodeName).String(),
+		FieldSelector:  fields.OneTermEqualSelector("metadata.name", nodeName).String(),
 		TimeoutSeconds: &timeoutSeconds,
 		Watch:          true,
 	})
 	if err != nil {
-		return nil, logger.LogNewErrorCodef(log, codes.Internal,
-			"failed to watch on CSINodeTopology instance with name %q. Error: %+v", nodeInfo.NodeName, err)
+		return nil, false, fmt.Errorf("failed to watch on CSINodeTopology instance with name %q. Error: %+v",
+			nodeName, err)
 	}
 	defer watchCSINodeTopology.Stop()
 
@@ -633,7 +2219,7 @@ func (volTopology *nodeVolumeTopology) GetNodeTopologyLabels(ctx context.Context
 			log.Warnf("Received unidentified object - %+v", event.Object)
 			continue
 		}
-		if csiNodeTopologyInstance.Name != nodeInfo.NodeName {
+		if csiNodeTopologyInstance.Name != nodeName {
 			continue
 		}
 		switch csiNodeTopologyInstance.Status.Status {
@@ -643,18 +2229,15 @@ func (volTopology *nodeVolumeTopology) GetNodeTopologyLabels(ctx context.Context
 			for _, label := range csiNodeTopologyInstance.Status.TopologyLabels {
 				accessibleTopology[label.Key] = label.Value
 			}
-			return accessibleTopology, nil
+			return accessibleTopology, true, nil
 		case csinodetopologyv1alpha1.CSINodeTopologyError:
 			// There was an error collecting topology information from nodes.
-			return nil, logger.LogNewErrorCodef(log, codes.Internal,
-				"failed to retrieve topology information for Node: %q. Error: %q", nodeInfo.NodeName,
+			return nil, true, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to retrieve topology information for Node: %q. Error: %q", nodeName,
 				csiNodeTopologyInstance.Status.ErrorMessage)
 		}
 	}
-	// Timed out waiting for topology labels to be updated.
-	return nil, logger.LogNewErrorCodef(log, codes.Internal,
-		"timed out while waiting for topology labels to be updated in %q CSINodeTopology instance.",
-		nodeInfo.NodeName)
+	return nil, false, nil
 }
 
 // Create new CSINodeTopology instance if it doesn't exist
@@ -718,20 +2301,22 @@ func createCSINodeTopologyInstance(ctx context.Context,
 // getCSINodeTopologyWatchTimeoutInMin returns the timeout for watching
 // on CSINodeTopology instances for any updates.
 // If environment variable NODEGETINFO_WATCH_TIMEOUT_MINUTES is set and
-// has a valid value between [1, 2], return the interval value read
+// has a valid value between 1 and the maximum returned by
+// getCSINodeTopologyWatchMaxTimeoutInMin, return the interval value read
 // from environment variable. Otherwise, use the default timeout of 1 min.
 func getCSINodeTopologyWatchTimeoutInMin(ctx context.Context) int {
 	log := logger.GetLogger(ctx)
 	watcherTimeoutInMin := defaultTimeoutInMin
 	if v := os.Getenv("NODEGETINFO_WATCH_TIMEOUT_MINUTES"); v != "" {
+		watcherMaxTimeoutInMin := getCSINodeTopologyWatchMaxTimeoutInMin(ctx)
 		if value, err := strconv.Atoi(v); err == nil {
 			switch {
 			case value <= 0:
 				log.Warnf("Timeout set in env variable NODEGETINFO_WATCH_TIMEOUT_MINUTES %q is equal or "+
 					"less than 0, will use the default timeout of %d minute(s)", v, watcherTimeoutInMin)
-			case value > maxTimeoutInMin:
+			case value > watcherMaxTimeoutInMin:
 				log.Warnf("Timeout set in env variable NODEGETINFO_WATCH_TIMEOUT_MINUTES %q is greater than "+
-					"%d, will use the default timeout of %d minute(s)", v, maxTimeoutInMin,
+					"%d, will use the default timeout of %d minute(s)", v, watcherMaxTimeoutInMin,
 					watcherTimeoutInMin)
 			default:
 				watcherTimeoutInMin = value
@@ -745,6 +2330,392 @@ func getCSINodeTopologyWatchTimeoutInMin(ctx context.Context) int {
 	return watcherTimeoutInMin
 }
 
+// getCSINodeTopologyWatchMaxTimeoutInMin returns the maximum timeout allowed
+// for watching on CSINodeTopology instances for any updates.
+// If environment variable NODEGETINFO_WATCH_MAX_TIMEOUT_MINUTES is set and
+// has a valid value between [1, 10], return the value read from environment
+// variable. Otherwise, use the default maximum of 2 mins.
+func getCSINodeTopologyWatchMaxTimeoutInMin(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	watcherMaxTimeoutInMin := maxTimeoutInMin
+	if v := os.Getenv("NODEGETINFO_WATCH_MAX_TIMEOUT_MINUTES"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil {
+			switch {
+			case value <= 0:
+				log.Warnf("Maximum timeout set in env variable NODEGETINFO_WATCH_MAX_TIMEOUT_MINUTES %q is "+
+					"equal or less than 0, will use the default maximum of %d minute(s)", v, watcherMaxTimeoutInMin)
+			case value > maxAllowedTimeoutInMin:
+				log.Warnf("Maximum timeout set in env variable NODEGETINFO_WATCH_MAX_TIMEOUT_MINUTES %q is "+
+					"greater than %d, will use the default maximum of %d minute(s)", v, maxAllowedTimeoutInMin,
+					watcherMaxTimeoutInMin)
+			default:
+				watcherMaxTimeoutInMin = value
+			}
+		} else {
+			log.Warnf("Maximum timeout set in env variable NODEGETINFO_WATCH_MAX_TIMEOUT_MINUTES %q is invalid, "+
+				"using the default maximum of %d minute(s)", v, watcherMaxTimeoutInMin)
+		}
+	}
+	return watcherMaxTimeoutInMin
+}
+
+// getCSINodeTopologyWatchMaxRetries returns the number of times the watch on
+// a CSINodeTopology instance is re-established when it is closed early.
+// If environment variable NODEGETINFO_WATCH_MAX_RETRIES is set and has a valid
+// value greater than or equal to 0, return the value read from environment
+// variable. Otherwise, use the default of 3 retries.
+func getCSINodeTopologyWatchMaxRetries(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	maxRetries := defaultCSINodeTopologyWatchMaxRetries
+	if v := os.Getenv("NODEGETINFO_WATCH_MAX_RETRIES"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value >= 0 {
+			maxRetries = value
+			log.Infof("Max retries for the CSINodeTopology watch is set to %d", maxRetries)
+		} else {
+			log.Warnf("Max retries set in env variable NODEGETINFO_WATCH_MAX_RETRIES %q is invalid, "+
+				"using the default of %d", v, maxRetries)
+		}
+	}
+	return maxRetries
+}
+
+// getNodeVMCacheTTLInMin returns the duration for which nodeVMs resolved by the
+// controller topology service are cached.
+// If environment variable NODE_VM_CACHE_TTL_MINUTES is set and has a valid
+// value greater than 0, return the value read from environment variable.
+// Otherwise, use the default TTL of 5 minutes.
+func getNodeVMCacheTTLInMin(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	nodeVMCacheTTLInMin := defaultNodeVMCacheTTLInMin
+	if v := os.Getenv("NODE_VM_CACHE_TTL_MINUTES"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil {
+			if value <= 0 {
+				log.Warnf("TTL set in env variable NODE_VM_CACHE_TTL_MINUTES %q is equal or less than 0, "+
+					"will use the default TTL of %d minute(s)", v, nodeVMCacheTTLInMin)
+			} else {
+				nodeVMCacheTTLInMin = value
+				log.Infof("NodeVM cache TTL is set to %d minute(s)", nodeVMCacheTTLInMin)
+			}
+		} else {
+			log.Warnf("TTL set in env variable NODE_VM_CACHE_TTL_MINUTES %q is invalid, "+
+				"using the default TTL of %d minute(s)", v, nodeVMCacheTTLInMin)
+		}
+	}
+	return nodeVMCacheTTLInMin
+}
+
+// getSharedDatastoresCacheTTLInSec returns the duration for which the shared
+// datastores of a topology segment are cached.
+// If environment variable SHARED_DATASTORES_CACHE_TTL_SECONDS is set and has a
+// valid value greater than or equal to 0, return the value read from
+// environment variable. A value of 0 disables the cache.
+// Otherwise, use the default TTL of 60 seconds.
+func getSharedDatastoresCacheTTLInSec(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	sharedDatastoresCacheTTLInSec := defaultSharedDatastoresCacheTTLInSec
+	if v := os.Getenv("SHARED_DATASTORES_CACHE_TTL_SECONDS"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil {
+			if value < 0 {
+				log.Warnf("TTL set in env variable SHARED_DATASTORES_CACHE_TTL_SECONDS %q is less than 0, "+
+					"will use the default TTL of %d second(s)", v, sharedDatastoresCacheTTLInSec)
+			} else {
+				sharedDatastoresCacheTTLInSec = value
+				log.Infof("Shared datastores cache TTL is set to %d second(s)", sharedDatastoresCacheTTLInSec)
+			}
+		} else {
+			log.Warnf("TTL set in env variable SHARED_DATASTORES_CACHE_TTL_SECONDS %q is invalid, "+
+				"using the default TTL of %d second(s)", v, sharedDatastoresCacheTTLInSec)
+		}
+	}
+	return sharedDatastoresCacheTTLInSec
+}
+
+// getDomainNodeMapRelistIntervalInMin returns the interval after which the
+// domainNodeMap is rebuilt from the CSINodeTopology informer store.
+// If environment variable DOMAIN_NODE_MAP_RELIST_INTERVAL_MINUTES is set and
+// has a valid value greater than 0, return the value read from environment
+// variable. Otherwise, use the default interval of 30 minutes.
+func getDomainNodeMapRelistIntervalInMin(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	relistIntervalInMin := defaultDomainNodeMapRelistIntervalInMin
+	if v := os.Getenv("DOMAIN_NODE_MAP_RELIST_INTERVAL_MINUTES"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil {
+			if value <= 0 {
+				log.Warnf("Interval set in env variable DOMAIN_NODE_MAP_RELIST_INTERVAL_MINUTES %q is equal or "+
+					"less than 0, will use the default interval of %d minute(s)", v, relistIntervalInMin)
+			} else {
+				relistIntervalInMin = value
+				log.Infof("domainNodeMap relist interval is set to %d minute(s)", relistIntervalInMin)
+			}
+		} else {
+			log.Warnf("Interval set in env variable DOMAIN_NODE_MAP_RELIST_INTERVAL_MINUTES %q is invalid, "+
+				"using the default interval of %d minute(s)", v, relistIntervalInMin)
+		}
+	}
+	return relistIntervalInMin
+}
+
+// getDomainNodeMapLoadParallelism returns the number of workers used to
+// populate the domainNodeMap from the CSINodeTopology informer store when the
+// topology service starts.
+// If environment variable DOMAIN_NODE_MAP_LOAD_PARALLELISM is set and has a
+// valid value greater than 0, return the value read from environment variable
+// capped at 64 workers. Otherwise, use the default of 8 workers.
+func getDomainNodeMapLoadParallelism(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	parallelism := defaultDomainNodeMapLoadParallelism
+	if v := os.Getenv("DOMAIN_NODE_MAP_LOAD_PARALLELISM"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil {
+			if value <= 0 {
+				log.Warnf("Parallelism set in env variable DOMAIN_NODE_MAP_LOAD_PARALLELISM %q is equal or "+
+					"less than 0, will use the default parallelism of %d", v, parallelism)
+			} else if value > maxDomainNodeMapLoadParallelism {
+				parallelism = maxDomainNodeMapLoadParallelism
+				log.Warnf("Parallelism set in env variable DOMAIN_NODE_MAP_LOAD_PARALLELISM %q is greater "+
+					"than the maximum, will use the maximum parallelism of %d", v, parallelism)
+			} else {
+				parallelism = value
+				log.Infof("domainNodeMap load parallelism is set to %d", parallelism)
+			}
+		} else {
+			log.Warnf("Parallelism set in env variable DOMAIN_NODE_MAP_LOAD_PARALLELISM %q is invalid, "+
+				"using the default parallelism of %d", v, parallelism)
+		}
+	}
+	return parallelism
+}
+
+// getTopologyInformerResyncPeriodInMin returns the period after which the
+// topology informers redeliver all the instances in their store to the event
+// handlers.
+// If environment variable TOPOLOGY_INFORMER_RESYNC_PERIOD_MINUTES is set and
+// has a valid value greater than 0, return the value read from environment
+// variable. Otherwise, use the default period of 10 minutes.
+func getTopologyInformerResyncPeriodInMin(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	resyncPeriodInMin := defaultTopologyInformerResyncPeriodInMin
+	if v := os.Getenv("TOPOLOGY_INFORMER_RESYNC_PERIOD_MINUTES"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil {
+			if value <= 0 {
+				log.Warnf("Period set in env variable TOPOLOGY_INFORMER_RESYNC_PERIOD_MINUTES %q is equal or "+
+					"less than 0, will use the default period of %d minute(s)", v, resyncPeriodInMin)
+			} else {
+				resyncPeriodInMin = value
+				log.Infof("Topology informer resync period is set to %d minute(s)", resyncPeriodInMin)
+			}
+		} else {
+			log.Warnf("Period set in env variable TOPOLOGY_INFORMER_RESYNC_PERIOD_MINUTES %q is invalid, "+
+				"using the default period of %d minute(s)", v, resyncPeriodInMin)
+		}
+	}
+	return resyncPeriodInMin
+}
+
+// getTopologyInformerSyncTimeoutInSec returns the duration for which the
+// topology service waits for its informers to sync when it starts.
+// If environment variable TOPOLOGY_INFORMER_SYNC_TIMEOUT_SECONDS is set and
+// has a valid value greater than 0, return the value read from environment
+// variable. Otherwise, use the default timeout of 60 seconds.
+func getTopologyInformerSyncTimeoutInSec(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	syncTimeoutInSec := defaultTopologyInformerSyncTimeoutInSec
+	if v := os.Getenv("TOPOLOGY_INFORMER_SYNC_TIMEOUT_SECONDS"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil {
+			if value <= 0 {
+				log.Warnf("Timeout set in env variable TOPOLOGY_INFORMER_SYNC_TIMEOUT_SECONDS %q is equal or "+
+					"less than 0, will use the default timeout of %d second(s)", v, syncTimeoutInSec)
+			} else {
+				syncTimeoutInSec = value
+				log.Infof("Topology informer sync timeout is set to %d second(s)", syncTimeoutInSec)
+			}
+		} else {
+			log.Warnf("Timeout set in env variable TOPOLOGY_INFORMER_SYNC_TIMEOUT_SECONDS %q is invalid, "+
+				"using the default timeout of %d second(s)", v, syncTimeoutInSec)
+		}
+	}
+	return syncTimeoutInSec
+}
+
+// getTopologyLabelValueCaseFold returns whether topology label values should
+// be compared case insensitively.
+// If environment variable TOPOLOGY_LABEL_VALUE_CASE_INSENSITIVE is set to a
+// valid boolean, return the value read from environment variable. Otherwise,
+// topology label values are compared case sensitively.
+func getTopologyLabelValueCaseFold(ctx context.Context) bool {
+	log := logger.GetLogger(ctx)
+	caseFold := false
+	if v := os.Getenv("TOPOLOGY_LABEL_VALUE_CASE_INSENSITIVE"); v != "" {
+		if value, err := strconv.ParseBool(v); err == nil {
+			caseFold = value
+			log.Infof("Case insensitive comparison of topology label values is set to %t", caseFold)
+		} else {
+			log.Warnf("Value set in env variable TOPOLOGY_LABEL_VALUE_CASE_INSENSITIVE %q is invalid, "+
+				"topology label values will be compared case sensitively", v)
+		}
+	}
+	return caseFold
+}
+
+// getFailOnEmptyTopologySegment returns whether a topology segment with no
+// matching nodes should fail the datastore lookup.
+// If environment variable FAIL_ON_EMPTY_TOPOLOGY_SEGMENT is set to a valid
+// boolean, return the value read from environment variable. Otherwise, such
+// segments are skipped.
+func getFailOnEmptyTopologySegment(ctx context.Context) bool {
+	log := logger.GetLogger(ctx)
+	failOnEmptySegment := false
+	if v := os.Getenv("FAIL_ON_EMPTY_TOPOLOGY_SEGMENT"); v != "" {
+		if value, err := strconv.ParseBool(v); err == nil {
+			failOnEmptySegment = value
+			log.Infof("Failing on topology segments with no matching nodes is set to %t", failOnEmptySegment)
+		} else {
+			log.Warnf("Value set in env variable FAIL_ON_EMPTY_TOPOLOGY_SEGMENT %q is invalid, "+
+				"topology segments with no matching nodes will be skipped", v)
+		}
+	}
+	return failOnEmptySegment
+}
+
+// getIncludeNodesWithoutTopologyLabels returns whether nodes without any
+// topology labels are considered for topology aware placement.
+// If environment variable INCLUDE_NODES_WITHOUT_TOPOLOGY_LABELS is set to a
+// valid boolean, return the value read from environment variable. Otherwise,
+// such nodes are excluded.
+func getIncludeNodesWithoutTopologyLabels(ctx context.Context) bool {
+	log := logger.GetLogger(ctx)
+	includeNodes := false
+	if v := os.Getenv("INCLUDE_NODES_WITHOUT_TOPOLOGY_LABELS"); v != "" {
+		if value, err := strconv.ParseBool(v); err == nil {
+			includeNodes = value
+			log.Infof("Including nodes without topology labels is set to %t", includeNodes)
+		} else {
+			log.Warnf("Value set in env variable INCLUDE_NODES_WITHOUT_TOPOLOGY_LABELS %q is invalid, "+
+				"nodes without topology labels will be excluded", v)
+		}
+	}
+	return includeNodes
+}
+
+// getTopologySnapshotDir returns the directory to which topology snapshots
+// are written.
+// If environment variable TOPOLOGY_SNAPSHOT_DIR is set to an absolute path,
+// return the value read from environment variable. Otherwise, return an empty
+// string which means that topology snapshots are not written to files.
+func getTopologySnapshotDir(ctx context.Context) string {
+	log := logger.GetLogger(ctx)
+	v := os.Getenv("TOPOLOGY_SNAPSHOT_DIR")
+	if v == "" {
+		return ""
+	}
+	if !filepath.IsAbs(v) {
+		log.Warnf("Directory set in env variable TOPOLOGY_SNAPSHOT_DIR %q is not an absolute path, "+
+			"topology snapshots will not be written to files", v)
+		return ""
+	}
+	return filepath.Clean(v)
+}
+
+// getTopologyMatchMode returns the mode used to match the topology labels of
+// a node against a topology segment.
+// If environment variable TOPOLOGY_MATCH_MODE is set to "subset" or "exact",
+// return the value read from environment variable. Otherwise, use the default
+// subset mode where a node with additional topology keys still matches.
+func getTopologyMatchMode(ctx context.Context) string {
+	log := logger.GetLogger(ctx)
+	matchMode := topologyMatchModeSubset
+	if v := os.Getenv("TOPOLOGY_MATCH_MODE"); v != "" {
+		switch strings.ToLower(v) {
+		case topologyMatchModeSubset, topologyMatchModeExact:
+			matchMode = strings.ToLower(v)
+			log.Infof("Topology match mode is set to %q", matchMode)
+		default:
+			log.Warnf("Value set in env variable TOPOLOGY_MATCH_MODE %q is invalid, "+
+				"using the default %q mode", v, matchMode)
+		}
+	}
+	return matchMode
+}
+
+// getRequisiteTopologyMode returns the mode used to combine the shared
+// datastores of the requisite topology segments.
+// If environment variable REQUISITE_TOPOLOGY_MODE is set to "union" or
+// "intersection", return the value read from environment variable. Otherwise,
+// use the default union mode where a datastore shared by the nodes of any of
+// the segments is used.
+func getRequisiteTopologyMode(ctx context.Context) string {
+	log := logger.GetLogger(ctx)
+	requisiteMode := requisiteTopologyModeUnion
+	if v := os.Getenv("REQUISITE_TOPOLOGY_MODE"); v != "" {
+		switch strings.ToLower(v) {
+		case requisiteTopologyModeUnion, requisiteTopologyModeIntersection:
+			requisiteMode = strings.ToLower(v)
+			log.Infof("Requisite topology mode is set to %q", requisiteMode)
+		default:
+			log.Warnf("Value set in env variable REQUISITE_TOPOLOGY_MODE %q is invalid, "+
+				"using the default %q mode", v, requisiteMode)
+		}
+	}
+	return requisiteMode
+}
+
+// getMaxTopologySegments returns the maximum number of distinct topology
+// segments of a preferred or requisite topology requirement which are used to
+// look up shared datastores.
+// If environment variable MAX_TOPOLOGY_SEGMENTS is set and has a valid value
+// greater than 0, return the value read from environment variable. Otherwise,
+// use the default of 128 segments.
+func getMaxTopologySegments(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	maxSegments := defaultMaxTopologySegments
+	if v := os.Getenv("MAX_TOPOLOGY_SEGMENTS"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil {
+			if value <= 0 {
+				log.Warnf("Maximum set in env variable MAX_TOPOLOGY_SEGMENTS %q is equal or "+
+					"less than 0, will use the default maximum of %d", v, maxSegments)
+			} else {
+				maxSegments = value
+				log.Infof("Maximum number of topology segments is set to %d", maxSegments)
+			}
+		} else {
+			log.Warnf("Maximum set in env variable MAX_TOPOLOGY_SEGMENTS %q is invalid, "+
+				"using the default maximum of %d", v, maxSegments)
+		}
+	}
+	return maxSegments
+}
+
+// getCSINodeTopologyDuplicateResolution returns the resolution used when
+// multiple CSINodeTopology instances exist for the same node.
+// If environment variable CSINODETOPOLOGY_DUPLICATE_RESOLUTION is set to
+// "newest" or "oldest", return the value read from environment variable.
+// Otherwise, use the default resolution in favour of the newest instance.
+func getCSINodeTopologyDuplicateResolution(ctx context.Context) string {
+	log := logger.GetLogger(ctx)
+	resolution := csiNodeTopologyDuplicateResolutionNewest
+	if v := os.Getenv("CSINODETOPOLOGY_DUPLICATE_RESOLUTION"); v != "" {
+		switch strings.ToLower(v) {
+		case csiNodeTopologyDuplicateResolutionNewest, csiNodeTopologyDuplicateResolutionOldest:
+			resolution = strings.ToLower(v)
+			log.Infof("Duplicate CSINodeTopology resolution is set to %q", resolution)
+		default:
+			log.Warnf("Value set in env variable CSINODETOPOLOGY_DUPLICATE_RESOLUTION %q is invalid, "+
+				"using the default %q resolution", v, resolution)
+		}
+	}
+	return resolution
+}
+
+// normalizeTopologyLabelValue trims surrounding whitespace from the given
+// topology label value and folds its case if configured, so that values from
+// StorageClass allowedTopologies and node labels are compared consistently.
+func normalizeTopologyLabelValue(value string) string {
+	value = strings.TrimSpace(value)
+	if topologyLabelValueCaseFold {
+		value = strings.ToLower(value)
+	}
+	return value
+}
+
 // GetSharedDatastoresInTopology returns shared accessible datastores for the specified topologyRequirement.
 // Argument TopologyRequirement needs to be passed in following form:
 // topologyRequirement [requisite:<segments:<key:"failure-domain.beta.kubernetes.io/region" value:"k8s-region-us" >
@@ -760,6 +2731,10 @@ func (volTopology *controllerVolumeTopology) GetSharedDatastoresInTopology(ctx c
 	log := logger.GetLogger(ctx)
 	params := reqParams.(commoncotypes.VanillaTopologyFetchDSParams)
 	log.Debugf("Get shared datastores with topologyRequirement: %+v", params.TopologyRequirement)
+	if !volTopology.HasSynced() {
+		log.Errorf("%s informer has not synced", csinodetopology.CRDSingular)
+		return nil, fmt.Errorf("%s informer: %w", csinodetopology.CRDSingular, common.ErrTopologyNotSynced)
+	}
 	var (
 		err              error
 		sharedDatastores []*cnsvsphere.DatastoreInfo
@@ -769,28 +2744,89 @@ func (volTopology *controllerVolumeTopology) GetSharedDatastoresInTopology(ctx c
 	if params.TopologyRequirement.GetPreferred() != nil {
 		log.Debugf("Using preferred topology")
 		sharedDatastores, err = volTopology.getSharedDatastoresInTopology(ctx,
-			params.TopologyRequirement.GetPreferred())
+			dedupTopologySegments(ctx, params.TopologyRequirement.GetPreferred(), volTopology.maxTopologySegments))
 		if err != nil {
 			log.Errorf("Error finding shared datastores using preferred topology: %+v",
 				params.TopologyRequirement.GetPreferred())
 			return nil, err
 		}
+		setTopologyPath(params.TopologyPath, common.TopologyPathPreferred)
+	}
+	// If strict preferred placement is enabled, do not fall back to the requisite
+	// topology requirement.
+	if len(sharedDatastores) == 0 && params.TopologyRequirement.GetPreferred() != nil &&
+		volTopology.isStrictPreferredTopologyEnabled {
+		return nil, logger.LogNewErrorf(log, "no shared datastores found for preferred topology: %+v "+
+			"and fallback to requisite topology is disabled", params.TopologyRequirement.GetPreferred())
 	}
 	// If there are no shared datastores for the preferred topology requirement, fetch shared
 	// datastores for the requisite topology requirement instead.
 	if len(sharedDatastores) == 0 && params.TopologyRequirement.GetRequisite() != nil {
 		log.Debugf("Using requisite topology")
-		sharedDatastores, err = volTopology.getSharedDatastoresInTopology(ctx,
-			params.TopologyRequirement.GetRequisite())
+		if volTopology.requisiteTopologyMode == requisiteTopologyModeIntersection {
+			// The volume has to be accessible from every requisite topology
+			// segment, so the segments cannot be truncated.
+			requisite := dedupTopologySegments(ctx, params.TopologyRequirement.GetRequisite(), 0)
+			if volTopology.maxTopologySegments > 0 && len(requisite) > volTopology.maxTopologySegments {
+				log.Errorf("Requisite topology has %d distinct topology segments, more than the maximum of %d",
+					len(requisite), volTopology.maxTopologySegments)
+				return nil, fmt.Errorf("requisite topology has %d distinct topology segments, more than the "+
+					"maximum of %d: %w", len(requisite), volTopology.maxTopologySegments,
+					common.ErrTooManyTopologySegments)
+			}
+			sharedDatastores, err = volTopology.getSharedDatastoresInAllTopologies(ctx, requisite)
+		} else {
+			requisite := dedupTopologySegments(ctx, params.TopologyRequirement.GetRequisite(),
+				volTopology.maxTopologySegments)
+			sharedDatastores, err = volTopology.getSharedDatastoresInTopology(ctx, requisite)
+		}
 		if err != nil {
 			log.Errorf("Error finding shared datastores using requisite topology: %+v",
 				params.TopologyRequirement.GetRequisite())
 			return nil, err
 		}
+		setTopologyPath(params.TopologyPath, common.TopologyPathRequisiteFallback)
 	}
 	return sharedDatastores, nil
 }
 
+// dedupTopologySegments returns the given topology segments without the ones
+// identical to an earlier segment, keeping at most maxSegments of them in their
+// original order. A maxSegments of 0 or less keeps all the distinct segments.
+func dedupTopologySegments(ctx context.Context, topologyArr []*csi.Topology,
+	maxSegments int) []*csi.Topology {
+	log := logger.GetLogger(ctx)
+	seen := make(map[string]struct{}, len(topologyArr))
+	var dedupedTopologies []*csi.Topology
+	for _, topology := range topologyArr {
+		key := getSharedDatastoresCacheKey(topology.GetSegments())
+		if _, exists := seen[key]; exists {
+			continue
+		}
+		seen[key] = struct{}{}
+		dedupedTopologies = append(dedupedTopologies, topology)
+	}
+	if len(dedupedTopologies) < len(topologyArr) {
+		log.Debugf("Removed %d duplicate topology segments from the topology requirement",
+			len(topologyArr)-len(dedupedTopologies))
+	}
+	if maxSegments > 0 && len(dedupedTopologies) > maxSegments {
+		log.Warnf("Topology requirement has %d distinct topology segments, only the first %d are used",
+			len(dedupedTopologies), maxSegments)
+		log.Debugf("Topology segments ignored: %+v", dedupedTopologies[maxSegments:])
+		dedupedTopologies = dedupedTopologies[:maxSegments]
+	}
+	return dedupedTopologies
+}
+
+// setTopologyPath sets the topology path to the given value if the caller
+// asked for it.
+func setTopologyPath(topologyPath *string, value string) {
+	if topologyPath != nil {
+		*topologyPath = value
+	}
+}
+
 // getSharedDatastoresInTopology returns a list of shared accessible datastores
 // for requested topology.
 func (volTopology *controllerVolumeTopology) getSharedDatastoresInTopology(ctx context.Context,
@@ -798,6 +2834,9 @@ func (volTopology *controllerVolumeTopology) getSharedDatastoresInTopology(ctx c
 	log := logger.GetLogger(ctx)
 
 	var sharedDatastores []*cnsvsphere.DatastoreInfo
+	// nodeCountByURL tracks the number of matching node VMs which can access
+	// each of the shared datastores.
+	nodeCountByURL := make(map[string]int)
 	// A topology requirement is an array of topology segments.
 	for _, topology := range topologyArr {
 		segments := topology.GetSegments()
@@ -809,27 +2848,120 @@ func (volTopology *controllerVolumeTopology) getSharedDatastoresInTopology(ctx c
 			return nil, err
 		}
 		if len(matchingNodeVMs) == 0 {
+			// Segments being drained are expected to have no matching nodes.
+			if volTopology.failOnEmptyTopologySegment && !isTopologySegmentDraining(segments) {
+				log.Errorf("No nodes in the cluster matched the topology requirement provided: %+v", segments)
+				return nil, fmt.Errorf("no nodes in the cluster matched the topology requirement provided: "+
+					"%+v: %w", segments, common.ErrNoMatchingNodes)
+			}
 			log.Warnf("No nodes in the cluster matched the topology requirement provided: %+v",
 				segments)
 			continue
 		}
 
+		// Use the cached shared datastores of the topology segment, if any.
+		cacheKey := getSharedDatastoresCacheKey(segments)
+		if volTopology.sharedDatastoresCacheTTL > 0 {
+			if cachedDatastores, found := getFromSharedDatastoresCache(cacheKey); found {
+				log.Debugf("Using cached shared datastores for topology segment %+v", segments)
+				sharedDatastores = addSharedDatastores(sharedDatastores, cachedDatastores, nodeCountByURL,
+					len(matchingNodeVMs))
+				continue
+			}
+		}
 		// Fetch shared datastores for the matching nodeVMs.
 		log.Infof("Obtained list of nodeVMs %+v", matchingNodeVMs)
-		sharedDatastoresInTopology, err := cnsvsphere.GetSharedDatastoresForVMs(ctx, matchingNodeVMs)
+		sharedDatastoresInTopology, err := getSharedDatastoresForVMs(ctx, matchingNodeVMs)
 		if err != nil {
 			log.Errorf("Failed to get shared datastores for nodes: %+v in topology segment %+v. Error: %+v",
 				matchingNodeVMs, segments, err)
 			return nil, err
 		}
+		if volTopology.sharedDatastoresCacheTTL > 0 {
+			addToSharedDatastoresCache(ctx, cacheKey, sharedDatastoresInTopology,
+				volTopology.sharedDatastoresCacheTTL)
+		}
 
 		// Update sharedDatastores with the list of datastores received.
-		sharedDatastores = append(sharedDatastores, sharedDatastoresInTopology...)
+		sharedDatastores = addSharedDatastores(sharedDatastores, sharedDatastoresInTopology, nodeCountByURL,
+			len(matchingNodeVMs))
 	}
+	// Prefer the datastores accessible to the largest number of matching nodes.
+	sortDatastoresByNodeCount(sharedDatastores, nodeCountByURL)
 	log.Infof("Obtained shared datastores: %+v", sharedDatastores)
 	return sharedDatastores, nil
 }
 
+// getSharedDatastoresInAllTopologies returns the datastores which are shared
+// by the nodes of every given topology segment. Segments being drained are
+// ignored. The datastores are ordered as per the first of the segments.
+func (volTopology *controllerVolumeTopology) getSharedDatastoresInAllTopologies(ctx context.Context,
+	topologyArr []*csi.Topology) ([]*cnsvsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	var sharedDatastores []*cnsvsphere.DatastoreInfo
+	first := true
+	for _, topology := range topologyArr {
+		if isTopologySegmentDraining(topology.GetSegments()) {
+			log.Infof("Ignoring topology segment %+v being drained", topology.GetSegments())
+			continue
+		}
+		datastores, err := volTopology.getSharedDatastoresInTopology(ctx, []*csi.Topology{topology})
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			sharedDatastores = datastores
+			first = false
+		} else {
+			datastoreURLs := make(map[string]struct{})
+			for _, datastore := range datastores {
+				datastoreURLs[datastore.Info.Url] = struct{}{}
+			}
+			var commonDatastores []*cnsvsphere.DatastoreInfo
+			for _, datastore := range sharedDatastores {
+				if _, exists := datastoreURLs[datastore.Info.Url]; exists {
+					commonDatastores = append(commonDatastores, datastore)
+				}
+			}
+			sharedDatastores = commonDatastores
+		}
+		if len(sharedDatastores) == 0 {
+			log.Infof("No datastores are shared across all the topology segments up to %+v",
+				topology.GetSegments())
+			return nil, nil
+		}
+	}
+	log.Infof("Obtained datastores shared across all the topology segments: %+v", sharedDatastores)
+	return sharedDatastores, nil
+}
+
+// addSharedDatastores appends the given datastores which are not yet present
+// in sharedDatastores, and adds nodeCount to the number of matching node VMs
+// which can access each of the given datastores.
+func addSharedDatastores(sharedDatastores []*cnsvsphere.DatastoreInfo, datastores []*cnsvsphere.DatastoreInfo,
+	nodeCountByURL map[string]int, nodeCount int) []*cnsvsphere.DatastoreInfo {
+	for _, datastore := range datastores {
+		if _, exists := nodeCountByURL[datastore.Info.Url]; !exists {
+			sharedDatastores = append(sharedDatastores, datastore)
+		}
+		nodeCountByURL[datastore.Info.Url] += nodeCount
+	}
+	return sharedDatastores
+}
+
+// sortDatastoresByNodeCount sorts the given datastores by the number of
+// matching node VMs which can access them in descending order, breaking ties
+// by the datastore URL.
+func sortDatastoresByNodeCount(datastores []*cnsvsphere.DatastoreInfo, nodeCountByURL map[string]int) {
+	sort.Slice(datastores, func(i, j int) bool {
+		iCount, jCount := nodeCountByURL[datastores[i].Info.Url], nodeCountByURL[datastores[j].Info.Url]
+		if iCount != jCount {
+			return iCount > jCount
+		}
+		return datastores[i].Info.Url < datastores[j].Info.Url
+	})
+}
+
 // getNodesMatchingTopologySegment takes in topology segments as parameter and returns list
 // of node VMs which belong to all the segments.
 func (volTopology *controllerVolumeTopology) getNodesMatchingTopologySegment(ctx context.Context,
@@ -837,6 +2969,11 @@ func (volTopology *controllerVolumeTopology) getNodesMatchingTopologySegment(ctx
 	log := logger.GetLogger(ctx)
 
 	var matchingNodeVMs []*cnsvsphere.VirtualMachine
+	// Skip the segment if any of its values is being drained.
+	if isTopologySegmentDraining(segments) {
+		log.Infof("Topology segment %+v is being drained. Skipping it for new volume placement.", segments)
+		return matchingNodeVMs, nil
+	}
 	// Fetch node topology information from informer cache.
 	nodeTopologyStore := volTopology.csiNodeTopologyInformer.GetStore()
 	for _, val := range nodeTopologyStore.List() {
@@ -855,34 +2992,57 @@ func (volTopology *controllerVolumeTopology) getNodesMatchingTopologySegment(ctx
 				nodeTopologyInstance.Name, nodeTopologyInstance.Status.Status)
 			return nil, err
 		}
+		// Skip the nodes which do not match the topology node selector.
+		if !isNodeParticipatingInTopology(ctx, nodeTopologyInstance.Name) {
+			log.Debugf("Node %q does not match the topology node selector. Skipping it.",
+				nodeTopologyInstance.Name)
+			continue
+		}
 		// Convert array of labels to map.
 		topoLabels := make(map[string]string)
 		for _, topoLabel := range nodeTopologyInstance.Status.TopologyLabels {
 			topoLabels[topoLabel.Key] = topoLabel.Value
 		}
+		// A node without topology labels only ever matches an empty segment.
+		if volTopology.isNodeExcludedForMissingTopologyLabels(ctx, nodeTopologyInstance.Name, topoLabels) {
+			continue
+		}
 		// Check for a match of labels in every segment.
 		isMatch := true
 		for key, value := range segments {
-			if topoLabels[key] != value {
+			if normalizeTopologyLabelValue(topoLabels[key]) != normalizeTopologyLabelValue(value) {
 				log.Debugf("Node %q with topology %+v did not match the topology requirement - %q: %q ",
 					nodeTopologyInstance.Name, topoLabels, key, value)
 				isMatch = false
 				break
 			}
 		}
+		// In exact match mode, the node must not have any topology keys besides
+		// the ones in the segment.
+		if isMatch && volTopology.topologyMatchMode == topologyMatchModeExact && len(topoLabels) != len(segments) {
+			log.Debugf("Node %q with topology %+v has topology keys other than the ones in segment %+v",
+				nodeTopologyInstance.Name, topoLabels, segments)
+			isMatch = false
+		}
 		if isMatch {
-			var nodeVM *cnsvsphere.VirtualMachine
-			if volTopology.isCSINodeIdFeatureEnabled &&
-				volTopology.clusterFlavor == cnstypes.CnsClusterFlavorVanilla {
-				nodeVM, err = volTopology.nodeMgr.GetNode(ctx,
-					nodeTopologyInstance.Spec.NodeUUID, nil)
-			} else {
-				nodeVM, err = volTopology.nodeMgr.GetNodeByName(ctx,
-					nodeTopologyInstance.Spec.NodeID)
-			}
-			if err != nil {
-				log.Errorf("failed to retrieve NodeVM %q. Error - %+v", nodeTopologyInstance.Spec.NodeID, err)
-				return nil, err
+			nodeUUID := nodeTopologyInstance.Spec.NodeUUID
+			nodeVM, found := volTopology.getFromNodeVMCache(nodeUUID)
+			if !found {
+				if volTopology.isCSINodeIdFeatureEnabled &&
+					volTopology.clusterFlavor == cnstypes.CnsClusterFlavorVanilla {
+					nodeVM, err = volTopology.nodeMgr.GetNode(ctx,
+						nodeTopologyInstance.Spec.NodeUUID, nil)
+				} else {
+					nodeVM, err = volTopology.nodeMgr.GetNodeByName(ctx,
+						nodeTopologyInstance.Spec.NodeID)
+				}
+				if err != nil {
+					log.Errorf("failed to retrieve NodeVM %q. Error - %+v", nodeTopologyInstance.Spec.NodeID, err)
+					return nil, err
+				}
+				if nodeUUID != "" {
+					volTopology.addToNodeVMCache(ctx, nodeUUID, nodeVM)
+				}
 			}
 			matchingNodeVMs = append(matchingNodeVMs, nodeVM)
 		}
@@ -890,6 +3050,19 @@ func (volTopology *controllerVolumeTopology) getNodesMatchingTopologySegment(ctx
 	return matchingNodeVMs, nil
 }
 
+// isNodeExcludedForMissingTopologyLabels returns true if the node with the
+// given topology labels has none of them and such nodes are excluded from
+// topology aware placement.
+func (volTopology *controllerVolumeTopology) isNodeExcludedForMissingTopologyLabels(ctx context.Context,
+	nodeName string, topoLabels map[string]string) bool {
+	log := logger.GetLogger(ctx)
+	if len(topoLabels) > 0 || volTopology.includeNodesWithoutTopologyLabels {
+		return false
+	}
+	log.Debugf("Node %q has no topology labels. Excluding it from topology aware placement.", nodeName)
+	return true
+}
+
 // GetTopologyInfoFromNodes retrieves the topology information of the given
 // list of node names using the information from CSINodeTopology instances.
 func (volTopology *controllerVolumeTopology) GetTopologyInfoFromNodes(ctx context.Context, reqParams interface{}) (
@@ -916,6 +3089,19 @@ func (volTopology *controllerVolumeTopology) GetTopologyInfoFromNodes(ctx contex
 			return nil, logger.LogNewErrorf(log, "failed to convert unstructured object %+v to "+
 				"CSINodeTopology instance. Error: %+v", item, err)
 		}
+		// Use the winning instance if duplicate instances exist for the node.
+		if nodeTopologyInstance.Spec.NodeUUID != "" {
+			duplicates := getCSINodeTopologiesForNodeUUID(ctx, nodeTopologyStore,
+				nodeTopologyInstance.Spec.NodeUUID)
+			if len(duplicates) > 1 {
+				winner := getWinningCSINodeTopology(duplicates)
+				if winner.Name != nodeTopologyInstance.Name {
+					log.Infof("CSINodeTopology instance %q is superseded by %q for node UUID %q",
+						nodeTopologyInstance.Name, winner.Name, nodeTopologyInstance.Spec.NodeUUID)
+					nodeTopologyInstance = winner
+				}
+			}
+		}
 		// Check the status of CSINodeTopology instance.
 		if nodeTopologyInstance.Status.Status != csinodetopologyv1alpha1.CSINodeTopologySuccess {
 			return nil, logger.LogNewErrorf(log, "CSINodeTopology instance with name: %q and Status: %q not "+
@@ -927,10 +3113,12 @@ func (volTopology *controllerVolumeTopology) GetTopologyInfoFromNodes(ctx contex
 		for _, topoLabel := range nodeTopologyInstance.Status.TopologyLabels {
 			topoLabels[topoLabel.Key] = topoLabel.Value
 		}
-		// Check if topology labels received are empty.
+		// Nodes without topology labels do not belong to any topology domain and
+		// hence never add to the node affinity, whether or not they are included
+		// in topology aware placement.
 		if len(topoLabels) == 0 {
-			log.Infof("Node %q does not belong to any topology domain. Skipping it for node " +
-				"affinity calculation")
+			log.Infof("Node %q does not belong to any topology domain. Skipping it for node "+
+				"affinity calculation", nodeName)
 			continue
 		}
 
@@ -962,6 +3150,44 @@ func (volTopology *controllerVolumeTopology) GetTopologyInfoFromNodes(ctx contex
 	return accessibleTopology, nil
 }
 
+// GetZonesForCluster is not applicable to vanilla clusters as zones are not
+// backed by AvailabilityZone instances. Returns nil.
+func (volTopology *controllerVolumeTopology) GetZonesForCluster(ctx context.Context,
+	clusterMoref string) []string {
+	return nil
+}
+
+// HasSynced returns true if the CSINodeTopology informer has completed its
+// initial sync and the domainNodeMap has been loaded from it.
+func (volTopology *controllerVolumeTopology) HasSynced() bool {
+	if !volTopology.csiNodeTopologyInformer.HasSynced() {
+		return false
+	}
+	if volTopology.domainNodeMapLoaded == nil {
+		return true
+	}
+	select {
+	case <-volTopology.domainNodeMapLoaded:
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitForSync waits for the CSINodeTopology informer to complete its initial
+// sync and the domainNodeMap to be loaded from it, and returns whether they
+// did within the sync timeout.
+func (volTopology *controllerVolumeTopology) WaitForSync(ctx context.Context) bool {
+	return waitForTopologyInformerSync(ctx, csinodetopology.CRDSingular, volTopology.HasSynced,
+		time.Duration(getTopologyInformerSyncTimeoutInSec(ctx))*time.Second)
+}
+
+// SetDrainingTopologyValues replaces the topology values, i.e. tags or zones,
+// excluded from new volume placements.
+func (volTopology *controllerVolumeTopology) SetDrainingTopologyValues(ctx context.Context, values []string) {
+	setDrainingTopologyValues(ctx, values)
+}
+
 func verifyAllNodesInTopologyAccessibleToDatastore(ctx context.Context, nodeNames []string,
 	datastoreURL string, topologySegments []map[string]string) ([]map[string]string, error) {
 	log := logger.GetLogger(ctx)
@@ -972,22 +3198,24 @@ func verifyAllNodesInTopologyAccessibleToDatastore(ctx context.Context, nodeName
 		accessibleNodeNamesMap[name] = struct{}{}
 	}
 	// Check if for each topology segment, all the nodes in that segment have access to the chosen datastore.
+	domainNodeMapInstanceLock.RLock()
+	defer domainNodeMapInstanceLock.RUnlock()
 	var accessibleTopology []map[string]string
 	for _, segments := range topologySegments {
-		// Create slice of all tag values in the given segments.
-		var tagValues []string
-		for _, tag := range segments {
-			tagValues = append(tagValues, tag)
+		// Create slice of all the domainNodeMap keys of the labels in the given segments.
+		var domainKeys []string
+		for key, tag := range segments {
+			domainKeys = append(domainKeys, getDomainNodeMapKey(key, tag))
 		}
-		if len(tagValues) == 0 {
+		if len(domainKeys) == 0 {
 			continue
 		}
-		// Find the intersection of node names for all the tagValues using the domainNodeMap cached values.
+		// Find the intersection of node names for all the domainKeys using the domainNodeMap cached values.
 		var nodesInSegment []string
-		for nodeName := range domainNodeMap[tagValues[0]] {
+		for nodeName := range domainNodeMap[domainKeys[0]] {
 			isPresent := true
-			for _, otherTag := range tagValues[1:] {
-				if _, exists := domainNodeMap[otherTag][nodeName]; !exists {
+			for _, otherKey := range domainKeys[1:] {
+				if _, exists := domainNodeMap[otherKey][nodeName]; !exists {
 					isPresent = false
 					break
 				}
@@ -1023,22 +3251,34 @@ func (volTopology *wcpControllerVolumeTopology) GetSharedDatastoresInTopology(ct
 	log := logger.GetLogger(ctx)
 	params := reqParams.(commoncotypes.WCPTopologyFetchDSParams)
 	log.Debugf("Get shared datastores with topologyRequirement: %+v", params.TopologyRequirement)
+	if !volTopology.HasSynced() {
+		log.Error("AvailabilityZone informer has not synced")
+		return nil, fmt.Errorf("AvailabilityZone informer: %w", common.ErrTopologyNotSynced)
+	}
 	var sharedDatastores []*cnsvsphere.DatastoreInfo
 	if params.TopologyRequirement.GetPreferred() == nil {
 		return sharedDatastores, nil
 	}
 
-	// Fetch shared datastores for each segment in the preferred topology requirement.
+	// Fetch shared datastores for the segments in the preferred topology requirement
+	// in their order of preference. The datastores of the first segment which can host
+	// the volume are returned. If no segment can host the volume, the datastores of all
+	// segments are returned and the volume placement fails on them.
 	log.Debugf("Using preferred topology")
 	for _, topology := range params.TopologyRequirement.GetPreferred() {
 		segments := topology.GetSegments()
 
 		// For each topology segments, fetch cluster morefs satisfying the condition.
 		log.Debugf("Getting list of cluster morefs for topology segments %+v", segments)
-		clusterMorefs, err := volTopology.getClustersMatchingTopologySegment(ctx, segments)
+		clusterMorefs, unresolvedZones, err := volTopology.getClustersPartiallyMatchingTopologySegment(ctx,
+			segments)
 		if err != nil {
-			return nil, logger.LogNewErrorf(log,
-				"failed to fetch clusters matching topology requirement. Error: %v", err)
+			log.Errorf("failed to fetch clusters matching topology requirement. Error: %v", err)
+			return nil, fmt.Errorf("failed to fetch clusters matching topology requirement: %w", err)
+		}
+		if len(unresolvedZones) > 0 {
+			log.Warnf("Ignoring zones %v of topology segment %+v which could not be resolved to a cluster",
+				unresolvedZones, segments)
 		}
 		if len(clusterMorefs) == 0 {
 			log.Warnf("No clusters matched the topology requirement provided: %+v",
@@ -1047,6 +3287,7 @@ func (volTopology *wcpControllerVolumeTopology) GetSharedDatastoresInTopology(ct
 		}
 
 		// Call GetCandidateDatastores for each cluster moref. Ignore the vsanDirectDatastores for now.
+		var segmentDatastores []*cnsvsphere.DatastoreInfo
 		for _, clusterMoref := range clusterMorefs {
 			accessibleDs, _, err := cnsvsphere.GetCandidateDatastoresInCluster(ctx, params.Vc, clusterMoref)
 			if err != nil {
@@ -1054,28 +3295,66 @@ func (volTopology *wcpControllerVolumeTopology) GetSharedDatastoresInTopology(ct
 					"failed to find candidate datastores to place volume in cluster %q. Error: %v",
 					clusterMoref, err)
 			}
-			sharedDatastores = append(sharedDatastores, accessibleDs...)
+			segmentDatastores = append(segmentDatastores, accessibleDs...)
+		}
+		if canHostVolume(segmentDatastores, params.VolumeSizeMB) {
+			log.Infof("Selected topology segment %+v in the order of preference %+v", segments,
+				params.TopologyRequirement.GetPreferred())
+			return segmentDatastores, nil
 		}
+		log.Infof("None of the datastores of topology segment %+v can host a volume of %d Mb. "+
+			"Falling back to the next preferred topology segment", segments, params.VolumeSizeMB)
+		sharedDatastores = append(sharedDatastores, segmentDatastores...)
 	}
 	return sharedDatastores, nil
 }
 
-// getClustersMatchingTopologySegment fetches clusters matching the topology requirement provided by checking
-// the azClusterMap cache.
-func (volTopology *wcpControllerVolumeTopology) getClustersMatchingTopologySegment(ctx context.Context,
-	segments map[string]string) ([]string, error) {
+// canHostVolume checks whether any of the given datastores has enough free
+// space for a volume of the given size.
+func canHostVolume(datastores []*cnsvsphere.DatastoreInfo, volumeSizeMB int64) bool {
+	for _, ds := range datastores {
+		if ds.Info != nil && ds.Info.FreeSpace >= volumeSizeMB*common.MbInBytes {
+			return true
+		}
+	}
+	return false
+}
+
+// getClustersPartiallyMatchingTopologySegment fetches clusters matching the
+// topology requirement provided by checking the azClusterMap cache. Zones
+// missing from the azClusterMap are skipped and returned separately. An error
+// is returned only if none of the zones could be resolved to a cluster.
+func (volTopology *wcpControllerVolumeTopology) getClustersPartiallyMatchingTopologySegment(ctx context.Context,
+	segments map[string]string) ([]string, []string, error) {
 	log := logger.GetLogger(ctx)
-	var matchingClusterMorefs []string
+	var (
+		matchingClusterMorefs []string
+		unresolvedZones       []string
+	)
+	azClusterMapInstanceLock.RLock()
 	for _, zone := range segments {
+		if isTopologyValueDraining(zone) {
+			log.Infof("Zone %q is being drained. Skipping it for new volume placement.", zone)
+			continue
+		}
 		clusterMoref, exists := azClusterMap[zone]
 		if !exists || clusterMoref == "" {
-			return nil, logger.LogNewErrorf(log, "could not find the cluster MoID for zone %q in "+
-				"AvailabilityZone resources", zone)
+			log.Warnf("Could not find the cluster MoID for zone %q in AvailabilityZone resources", zone)
+			unresolvedZones = append(unresolvedZones, zone)
+			continue
 		}
 		matchingClusterMorefs = append(matchingClusterMorefs, clusterMoref)
 	}
+	azClusterMapInstanceLock.RUnlock()
+	sort.Strings(unresolvedZones)
+	if len(matchingClusterMorefs) == 0 && len(unresolvedZones) > 0 {
+		log.Errorf("Could not find the cluster MoID for any of the zones %v in AvailabilityZone resources",
+			unresolvedZones)
+		return nil, unresolvedZones, fmt.Errorf("could not find the cluster MoID for any of the zones %v "+
+			"in AvailabilityZone resources: %w", unresolvedZones, common.ErrZoneNotMapped)
+	}
 	log.Infof("Clusters matching topology requirement %+v are %+v", segments, matchingClusterMorefs)
-	return matchingClusterMorefs, nil
+	return matchingClusterMorefs, unresolvedZones, nil
 }
 
 // GetTopologyInfoFromNodes retrieves the topology information of the selected datastore
@@ -1087,54 +3366,79 @@ func (volTopology *wcpControllerVolumeTopology) GetTopologyInfoFromNodes(ctx con
 	var topologySegments []map[string]string
 
 	switch strings.ToLower(params.StorageTopologyType) {
-	case "zonal":
-		// If the topology requirement received has just one zone, use the same zone as node affinity terms on PV.
+	case common.TopologyTypeZonal:
+		// If the topology requirement received has just one zone, use the same zone as node affinity terms on PV
+		// after verifying that the selected datastore is accessible from that zone.
 		if len(params.TopologyRequirement.GetPreferred()) == 1 {
-			topologySegments = append(topologySegments, params.TopologyRequirement.GetPreferred()[0].GetSegments())
+			segments := params.TopologyRequirement.GetPreferred()[0].GetSegments()
+			for _, value := range segments {
+				found, err := isDatastoreInZone(ctx, params.Vc, value, params.DatastoreURL)
+				if err != nil {
+					log.Errorf("Failed to verify the zone %q of datastore %q. Error: %+v",
+						value, params.DatastoreURL, err)
+					return nil, err
+				}
+				if !found {
+					return nil, logger.LogNewErrorf(log, "selected datastore %q does not belong to the "+
+						"cluster of zone %q", params.DatastoreURL, value)
+				}
+			}
+			topologySegments = append(topologySegments, segments)
+			setTopologyPath(params.TopologyPath, common.TopologyPathZonalSingle)
 		} else {
 			// If multiple zones are provided as input in the topology requirement, find the zone
 			// to which the selected datastore is associated with. If this search results in multiple zones,
-			// randomly choose one as node affinity.
-			var selectedSegments []map[string]string
+			// choose the first one in the order of preference as node affinity.
+			// Zones missing from the AvailabilityZone resources are skipped.
+			var (
+				selectedSegments []map[string]string
+				unresolvedZones  []string
+				numZones         int
+			)
 			for _, topology := range params.TopologyRequirement.GetPreferred() {
 				for label, value := range topology.GetSegments() {
-					clusterMoref, exists := azClusterMap[value]
-					if !exists || clusterMoref == "" {
-						return nil, logger.LogNewErrorf(log, "could not find the cluster MoID for zone %q in "+
-							"AvailabilityZone resources", value)
-					}
-					datastores, err := params.Vc.GetDatastoresByCluster(ctx, clusterMoref)
+					numZones++
+					found, err := isDatastoreInZone(ctx, params.Vc, value, params.DatastoreURL)
 					if err != nil {
-						return nil, logger.LogNewErrorf(log,
-							"Failed to fetch datastores associated with cluster %q", clusterMoref)
-					}
-					for _, ds := range datastores {
-						if ds.Info.Url == params.DatastoreURL {
-							selectedSegments = append(selectedSegments, map[string]string{label: value})
-							break
+						if errors.Is(err, common.ErrZoneNotMapped) {
+							log.Warnf("Skipping zone %q while finding the topology of the volume "+
+								"provisioned on datastore %q. Error: %+v", value, params.DatastoreURL, err)
+							unresolvedZones = append(unresolvedZones, value)
+							continue
 						}
+						return nil, err
+					}
+					if found {
+						selectedSegments = append(selectedSegments, map[string]string{label: value})
 					}
 				}
 			}
 
 			numSelectedSegments := len(selectedSegments)
 			switch {
+			case numSelectedSegments == 0 && numZones > 0 && len(unresolvedZones) == numZones:
+				sort.Strings(unresolvedZones)
+				log.Errorf("Could not find the cluster MoID for any of the zones %v in AvailabilityZone resources",
+					unresolvedZones)
+				return nil, fmt.Errorf("could not find the cluster MoID for any of the zones %v "+
+					"in AvailabilityZone resources: %w", unresolvedZones, common.ErrZoneNotMapped)
 			case numSelectedSegments == 0:
 				return nil, logger.LogNewErrorf(log,
 					"could not find the topology of the volume provisioned on datastore %q", params.DatastoreURL)
 			case numSelectedSegments > 1:
 				// This situation will arise when datastore belongs to multiple zones but the
-				// storageTopologyType is `zonal`. In such cases, we will choose a random zone among
-				// the retrieved zones and use it as node affinity for the PV.
-				rand.Seed(time.Now().Unix())
-				topologySegments = append(topologySegments, selectedSegments[rand.Intn(len(selectedSegments))])
+				// storageTopologyType is `zonal`. In such cases, we will choose the most preferred zone
+				// among the retrieved zones and use it as node affinity for the PV.
+				topologySegments = append(topologySegments, selectedSegments[0])
 				log.Infof("Selected topology %+v from possible selections %+v", topologySegments,
 					selectedSegments)
+				setTopologyPath(params.TopologyPath, common.TopologyPathZonalPreferred)
 			default:
 				topologySegments = selectedSegments
+				setTopologyPath(params.TopologyPath, common.TopologyPathZonalSingle)
 			}
 		}
-	case "crosszonal":
+	case common.TopologyTypeCrossZonal:
 		// TODO: TKGS-HA : Implement the node affinity logic for crossZonal
 		return nil, logger.LogNewErrorf(log,
 			"Node Affinity logic for crossZonal storageTopologyType not implemented yet.")
@@ -1145,3 +3449,65 @@ func (volTopology *wcpControllerVolumeTopology) GetTopologyInfoFromNodes(ctx con
 	log.Infof("Topology of the provisioned volume detected as %+v", topologySegments)
 	return topologySegments, nil
 }
+
+// isDatastoreInZone checks whether the datastore with the given URL belongs to
+// the cluster of the given zone as per the AvailabilityZone instances.
+func isDatastoreInZone(ctx context.Context, vc *cnsvsphere.VirtualCenter, zone, datastoreURL string) (
+	bool, error) {
+	log := logger.GetLogger(ctx)
+	azClusterMapInstanceLock.RLock()
+	clusterMoref, exists := azClusterMap[zone]
+	azClusterMapInstanceLock.RUnlock()
+	if !exists || clusterMoref == "" {
+		// Callers decide whether a zone missing from the AvailabilityZone
+		// resources is fatal, so the error is not logged here.
+		return false, fmt.Errorf("could not find the cluster MoID for zone %q in AvailabilityZone "+
+			"resources: %w", zone, common.ErrZoneNotMapped)
+	}
+	datastores, err := vc.GetDatastoresByCluster(ctx, clusterMoref)
+	if err != nil {
+		return false, logger.LogNewErrorf(log,
+			"Failed to fetch datastores associated with cluster %q", clusterMoref)
+	}
+	for _, ds := range datastores {
+		if ds.Info.Url == datastoreURL {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetZonesForCluster returns the zones the given cluster belongs to as per the
+// AvailabilityZone instances.
+func (volTopology *wcpControllerVolumeTopology) GetZonesForCluster(ctx context.Context,
+	clusterMoref string) []string {
+	azClusterMapInstanceLock.RLock()
+	defer azClusterMapInstanceLock.RUnlock()
+	var zones []string
+	for zone, moref := range azClusterMap {
+		if moref == clusterMoref {
+			zones = append(zones, zone)
+		}
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// HasSynced returns true if the AvailabilityZone informer has completed its
+// initial sync.
+func (volTopology *wcpControllerVolumeTopology) HasSynced() bool {
+	return volTopology.azInformer.HasSynced()
+}
+
+// WaitForSync waits for the AvailabilityZone informer to complete its initial
+// sync and returns whether it did within the sync timeout.
+func (volTopology *wcpControllerVolumeTopology) WaitForSync(ctx context.Context) bool {
+	return waitForTopologyInformerSync(ctx, "AvailabilityZone", volTopology.HasSynced,
+		time.Duration(getTopologyInformerSyncTimeoutInSec(ctx))*time.Second)
+}
+
+// SetDrainingTopologyValues replaces the topology values, i.e. tags or zones,
+// excluded from new volume placements.
+func (volTopology *wcpControllerVolumeTopology) SetDrainingTopologyValues(ctx context.Context, values []string) {
+	setDrainingTopologyValues(ctx, values)
+}
@@ -0,0 +1,1569 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sorchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/vmware/govmomi"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/session"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/node"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common"
+	commoncotypes "sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common/commonco/types"
+	csinodetopologyv1alpha1 "sigs.k8s.io/vsphere-csi-driver/v2/pkg/internalapis/csinodetopology/v1alpha1"
+)
+
+// newFakeCSINodeTopologyInformer returns an informer, which is never started
+// but reports that it has synced, whose store is populated with the given
+// CSINodeTopology instances.
+func newFakeCSINodeTopologyInformer(t testing.TB,
+	instances ...csinodetopologyv1alpha1.CSINodeTopology) cache.SharedIndexInformer {
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &unstructured.Unstructured{}, 0,
+		cache.Indexers{})
+	for i := range instances {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&instances[i])
+		if err != nil {
+			t.Fatalf("failed to convert %+v to unstructured. Error: %+v", instances[i], err)
+		}
+		if err = informer.GetStore().Add(&unstructured.Unstructured{Object: obj}); err != nil {
+			t.Fatalf("failed to add %+v to informer store. Error: %+v", instances[i], err)
+		}
+	}
+	return &syncedInformer{informer}
+}
+
+// syncedInformer is a SharedIndexInformer which reports that it has completed
+// its initial sync without being started.
+type syncedInformer struct {
+	cache.SharedIndexInformer
+}
+
+func (informer *syncedInformer) HasSynced() bool {
+	return true
+}
+
+// newCSINodeTopology returns a CSINodeTopology instance with the given name,
+// status and topology labels. The node UUID of the instance is "uuid-<name>".
+func newCSINodeTopology(name string, status csinodetopologyv1alpha1.CRDStatus,
+	labels map[string]string) csinodetopologyv1alpha1.CSINodeTopology {
+	instance := csinodetopologyv1alpha1.CSINodeTopology{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       csinodetopologyv1alpha1.CSINodeTopologySpec{NodeID: name, NodeUUID: "uuid-" + name},
+		Status:     csinodetopologyv1alpha1.CSINodeTopologyStatus{Status: status},
+	}
+	for key, value := range labels {
+		instance.Status.TopologyLabels = append(instance.Status.TopologyLabels,
+			csinodetopologyv1alpha1.TopologyLabel{Key: key, Value: value})
+	}
+	return instance
+}
+
+// cacheNodeVMs adds the given nodeVMs, keyed by their node name, to the
+// nodeVMCache of volTopology for the node UUIDs set by newCSINodeTopology, so
+// that the nodes can be matched without a node manager.
+func cacheNodeVMs(volTopology *controllerVolumeTopology, nodeVMs map[string]*cnsvsphere.VirtualMachine) {
+	volTopology.nodeVMCacheLock.Lock()
+	defer volTopology.nodeVMCacheLock.Unlock()
+	if volTopology.nodeVMCache == nil {
+		volTopology.nodeVMCache = make(map[string]*nodeVMCacheEntry)
+	}
+	for nodeName, nodeVM := range nodeVMs {
+		volTopology.nodeVMCache["uuid-"+nodeName] = &nodeVMCacheEntry{
+			nodeVM:    nodeVM,
+			expiresAt: time.Now().Add(time.Hour),
+		}
+	}
+}
+
+// saveDomainNodeMap restores the global domainNodeMap once the test completes,
+// so that tests overwriting it do not affect each other.
+func saveDomainNodeMap(t *testing.T) {
+	domainNodeMapInstanceLock.RLock()
+	saved := domainNodeMap
+	domainNodeMapInstanceLock.RUnlock()
+	t.Cleanup(func() {
+		domainNodeMapInstanceLock.Lock()
+		domainNodeMap = saved
+		domainNodeMapInstanceLock.Unlock()
+	})
+}
+
+// saveAZClusterMap restores the global azClusterMap once the test completes,
+// so that tests overwriting it do not affect each other.
+func saveAZClusterMap(t *testing.T) {
+	azClusterMapInstanceLock.RLock()
+	saved := azClusterMap
+	azClusterMapInstanceLock.RUnlock()
+	t.Cleanup(func() {
+		azClusterMapInstanceLock.Lock()
+		azClusterMap = saved
+		azClusterMapInstanceLock.Unlock()
+	})
+}
+
+// TestRelistDomainNodeMap verifies that relistDomainNodeMap replaces a drifted
+// domainNodeMap with the contents of the informer store.
+func TestRelistDomainNodeMap(t *testing.T) {
+	saveDomainNodeMap(t)
+	volTopology := &controllerVolumeTopology{
+		csiNodeTopologyInformer: newFakeCSINodeTopologyInformer(t,
+			newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+				map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}),
+			newCSINodeTopology("node2", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+				map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-b"}),
+			newCSINodeTopology("node3", csinodetopologyv1alpha1.CSINodeTopologyError, nil)),
+	}
+	domainNodeMapInstanceLock.Lock()
+	domainNodeMap = map[string]map[string]struct{}{
+		"topology.csi.vmware.com/k8s-zone:zone-a": {"node1": {}, "stale-node": {}},
+	}
+	domainNodeMapInstanceLock.Unlock()
+
+	volTopology.relistDomainNodeMap(ctx)
+
+	expected := map[string]map[string]struct{}{
+		"topology.csi.vmware.com/k8s-zone:zone-a": {"node1": {}},
+		"topology.csi.vmware.com/k8s-zone:zone-b": {"node2": {}},
+	}
+	domainNodeMapInstanceLock.RLock()
+	defer domainNodeMapInstanceLock.RUnlock()
+	if !reflect.DeepEqual(domainNodeMap, expected) {
+		t.Errorf("expected domainNodeMap %+v but got %+v", expected, domainNodeMap)
+	}
+}
+
+// TestLoadDomainNodeMap verifies that the initial load merges the informer
+// store into the domainNodeMap without dropping the nodes added by the event
+// handlers, that the replayed add events of the loaded instances are skipped
+// and that the topology service reports it has synced only after the load.
+func TestLoadDomainNodeMap(t *testing.T) {
+	saveDomainNodeMap(t)
+	savedVersions := loadedCSINodeTopologyVersions
+	t.Cleanup(func() { loadedCSINodeTopologyVersions = savedVersions })
+	loadedCSINodeTopologyVersions = make(map[string]string)
+	node1 := newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+		map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"})
+	node1.ResourceVersion = "1"
+	volTopology := &controllerVolumeTopology{
+		csiNodeTopologyInformer: newFakeCSINodeTopologyInformer(t, node1),
+		domainNodeMapLoaded:     make(chan struct{}),
+	}
+	domainNodeMapInstanceLock.Lock()
+	domainNodeMap = map[string]map[string]struct{}{
+		"topology.csi.vmware.com/k8s-zone:zone-a": {"node2": {}},
+	}
+	domainNodeMapInstanceLock.Unlock()
+	if volTopology.HasSynced() {
+		t.Fatal("expected the topology service to not be synced before the domainNodeMap is loaded")
+	}
+
+	volTopology.loadDomainNodeMap(ctx, wait.NeverStop, 2)
+
+	if !volTopology.HasSynced() {
+		t.Fatal("expected the topology service to be synced once the domainNodeMap is loaded")
+	}
+	expected := map[string]map[string]struct{}{
+		"topology.csi.vmware.com/k8s-zone:zone-a": {"node1": {}, "node2": {}},
+	}
+	domainNodeMapInstanceLock.RLock()
+	actual := domainNodeMap
+	domainNodeMapInstanceLock.RUnlock()
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected domainNodeMap %+v but got %+v", expected, actual)
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&node1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isLoadedCSINodeTopology(&unstructured.Unstructured{Object: obj}) {
+		t.Errorf("expected the add event of the loaded instance %q to be skipped", node1.Name)
+	}
+	node1.ResourceVersion = "2"
+	obj, err = runtime.DefaultUnstructuredConverter.ToUnstructured(&node1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isLoadedCSINodeTopology(&unstructured.Unstructured{Object: obj}) {
+		t.Errorf("expected the add event of a newer version of instance %q to be handled", node1.Name)
+	}
+}
+
+// TestBuildDomainNodeMapInParallel verifies that building the domainNodeMap
+// with multiple workers yields the same result as building it with one.
+func TestBuildDomainNodeMapInParallel(t *testing.T) {
+	var instances []csinodetopologyv1alpha1.CSINodeTopology
+	for i := 0; i < 100; i++ {
+		status := csinodetopologyv1alpha1.CSINodeTopologySuccess
+		if i%10 == 0 {
+			status = csinodetopologyv1alpha1.CSINodeTopologyError
+		}
+		instances = append(instances, newCSINodeTopology(fmt.Sprintf("node%d", i), status,
+			map[string]string{"topology.csi.vmware.com/k8s-zone": fmt.Sprintf("zone-%d", i%3)}))
+	}
+	volTopology := &controllerVolumeTopology{
+		csiNodeTopologyInformer: newFakeCSINodeTopologyInformer(t, instances...),
+	}
+
+	expected := volTopology.buildDomainNodeMap(ctx, 1)
+	if len(expected["topology.csi.vmware.com/k8s-zone:zone-0"]) == 0 {
+		t.Fatalf("expected nodes in zone-0 but got %+v", expected)
+	}
+	for _, parallelism := range []int{0, 4, 200} {
+		actual := volTopology.buildDomainNodeMap(ctx, parallelism)
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("parallelism %d: expected domainNodeMap %+v but got %+v", parallelism, expected, actual)
+		}
+	}
+}
+
+// TestGetDomainNodeMapLoadParallelism verifies that the configured parallelism
+// is capped at the maximum and that the default is used for invalid values.
+func TestGetDomainNodeMapLoadParallelism(t *testing.T) {
+	tests := []struct {
+		parallelism         string
+		expectedParallelism int
+	}{
+		{parallelism: "", expectedParallelism: defaultDomainNodeMapLoadParallelism},
+		{parallelism: "16", expectedParallelism: 16},
+		{parallelism: "64", expectedParallelism: maxDomainNodeMapLoadParallelism},
+		{parallelism: "10000", expectedParallelism: maxDomainNodeMapLoadParallelism},
+		{parallelism: "0", expectedParallelism: defaultDomainNodeMapLoadParallelism},
+		{parallelism: "invalid", expectedParallelism: defaultDomainNodeMapLoadParallelism},
+	}
+	for _, test := range tests {
+		t.Run(test.parallelism, func(t *testing.T) {
+			t.Setenv("DOMAIN_NODE_MAP_LOAD_PARALLELISM", test.parallelism)
+			if parallelism := getDomainNodeMapLoadParallelism(ctx); parallelism != test.expectedParallelism {
+				t.Errorf("parallelism %q: expected %d but got %d", test.parallelism, test.expectedParallelism,
+					parallelism)
+			}
+		})
+	}
+}
+
+// TestRunInParallelBoundsWorkers verifies that runInParallel calls fn for
+// every index without running more than the given number of workers at once.
+func TestRunInParallelBoundsWorkers(t *testing.T) {
+	const count, workers = 1000, 4
+	var running, maxRunning, calls int32
+	runInParallel(count, workers, func(i int) {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			observed := atomic.LoadInt32(&maxRunning)
+			if current <= observed || atomic.CompareAndSwapInt32(&maxRunning, observed, current) {
+				break
+			}
+		}
+		atomic.AddInt32(&calls, 1)
+		atomic.AddInt32(&running, -1)
+	})
+	if calls != count {
+		t.Errorf("expected fn to be called %d times but got %d", count, calls)
+	}
+	if maxRunning > workers {
+		t.Errorf("expected at most %d concurrent workers but got %d", workers, maxRunning)
+	}
+}
+
+// TestRelistAZClusterMap verifies that relistAZClusterMap replaces a drifted
+// azClusterMap with the contents of the informer store.
+func TestRelistAZClusterMap(t *testing.T) {
+	saveAZClusterMap(t)
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &unstructured.Unstructured{}, 0,
+		cache.Indexers{})
+	for zone, cluster := range map[string]string{"zone-a": "domain-c1", "zone-b": "domain-c2"} {
+		az := &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": zone},
+			"spec":     map[string]interface{}{"clusterComputeResourceMoId": cluster},
+		}}
+		if err := informer.GetStore().Add(az); err != nil {
+			t.Fatalf("failed to add %+v to informer store. Error: %+v", az, err)
+		}
+	}
+	volTopology := &wcpControllerVolumeTopology{azInformer: informer}
+	azClusterMapInstanceLock.Lock()
+	azClusterMap = map[string]string{"zone-a": "domain-c1", "stale-zone": "domain-c3"}
+	azClusterMapInstanceLock.Unlock()
+
+	volTopology.relistAZClusterMap(ctx)
+
+	expected := map[string]string{"zone-a": "domain-c1", "zone-b": "domain-c2"}
+	azClusterMapInstanceLock.RLock()
+	defer azClusterMapInstanceLock.RUnlock()
+	if !reflect.DeepEqual(azClusterMap, expected) {
+		t.Errorf("expected azClusterMap %+v but got %+v", expected, azClusterMap)
+	}
+}
+
+// TestGetTopologyInfoFromNodesUnknownSingleZone verifies that the affinity to
+// a single requested zone is not returned when the zone cannot be verified to
+// contain the selected datastore.
+func TestGetTopologyInfoFromNodesUnknownSingleZone(t *testing.T) {
+	saveAZClusterMap(t)
+	azClusterMapInstanceLock.Lock()
+	azClusterMap = map[string]string{"zone-a": "domain-c1"}
+	azClusterMapInstanceLock.Unlock()
+
+	volTopology := &wcpControllerVolumeTopology{}
+	topologySegments, err := volTopology.GetTopologyInfoFromNodes(ctx,
+		commoncotypes.WCPRetrieveTopologyInfoParams{
+			DatastoreURL:        "ds:///vmfs/volumes/datastore1/",
+			StorageTopologyType: common.TopologyTypeZonal,
+			TopologyRequirement: &csi.TopologyRequirement{
+				Preferred: []*csi.Topology{{Segments: map[string]string{v1.LabelTopologyZone: "zone-b"}}},
+			},
+		})
+	if err == nil {
+		t.Errorf("expected an error for zone-b but got topology %+v", topologySegments)
+	}
+}
+
+// TestGetTopologyInfoFromNodesSkipsUnknownZones verifies that zones missing
+// from the azClusterMap are skipped when multiple zones are requested, and that
+// ErrZoneNotMapped is returned only if none of the zones is resolved.
+func TestGetTopologyInfoFromNodesSkipsUnknownZones(t *testing.T) {
+	simulator.Test(func(simCtx context.Context, client *vim25.Client) {
+		cluster := simulator.Map.Any("ClusterComputeResource").(*simulator.ClusterComputeResource)
+		vc := &cnsvsphere.VirtualCenter{
+			Client: &govmomi.Client{Client: client, SessionManager: session.NewManager(client)},
+		}
+		var host mo.HostSystem
+		if err := vc.Client.RetrieveOne(simCtx, cluster.Host[0], []string{"datastore"}, &host); err != nil {
+			t.Fatalf("failed to retrieve host. Error: %+v", err)
+		}
+		var datastore mo.Datastore
+		if err := vc.Client.RetrieveOne(simCtx, host.Datastore[0], []string{"info"}, &datastore); err != nil {
+			t.Fatalf("failed to retrieve datastore. Error: %+v", err)
+		}
+		saveAZClusterMap(t)
+		azClusterMapInstanceLock.Lock()
+		azClusterMap = map[string]string{"zone-a": cluster.Self.Value}
+		azClusterMapInstanceLock.Unlock()
+		volTopology := &wcpControllerVolumeTopology{}
+		getTopology := func(zones ...string) ([]map[string]string, error) {
+			var preferred []*csi.Topology
+			for _, zone := range zones {
+				preferred = append(preferred, &csi.Topology{Segments: map[string]string{v1.LabelTopologyZone: zone}})
+			}
+			return volTopology.GetTopologyInfoFromNodes(simCtx, commoncotypes.WCPRetrieveTopologyInfoParams{
+				DatastoreURL:        datastore.Info.GetDatastoreInfo().Url,
+				StorageTopologyType: common.TopologyTypeZonal,
+				TopologyRequirement: &csi.TopologyRequirement{Preferred: preferred},
+				Vc:                  vc,
+			})
+		}
+
+		topologySegments, err := getTopology("zone-b", "zone-a", "zone-c")
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		expected := []map[string]string{{v1.LabelTopologyZone: "zone-a"}}
+		if !reflect.DeepEqual(topologySegments, expected) {
+			t.Errorf("expected topology %+v but got %+v", expected, topologySegments)
+		}
+
+		topologySegments, err = getTopology("zone-b", "zone-c")
+		if !errors.Is(err, common.ErrZoneNotMapped) {
+			t.Errorf("expected ErrZoneNotMapped when no zone is resolved but got topology %+v and error %v",
+				topologySegments, err)
+		}
+	})
+}
+
+// TestGetClustersPartiallyMatchingTopologySegment verifies that zones missing
+// from the azClusterMap are skipped as long as at least one zone is resolved.
+func TestGetClustersPartiallyMatchingTopologySegment(t *testing.T) {
+	saveAZClusterMap(t)
+	azClusterMapInstanceLock.Lock()
+	azClusterMap = map[string]string{"zone-a": "domain-c1", "zone-b": "domain-c2"}
+	azClusterMapInstanceLock.Unlock()
+	volTopology := &wcpControllerVolumeTopology{}
+
+	clusterMorefs, unresolvedZones, err := volTopology.getClustersPartiallyMatchingTopologySegment(ctx,
+		map[string]string{v1.LabelTopologyZone: "zone-a", "example.com/zone": "zone-c"})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if !reflect.DeepEqual(clusterMorefs, []string{"domain-c1"}) {
+		t.Errorf("expected cluster morefs [domain-c1] but got %+v", clusterMorefs)
+	}
+	if !reflect.DeepEqual(unresolvedZones, []string{"zone-c"}) {
+		t.Errorf("expected unresolved zones [zone-c] but got %+v", unresolvedZones)
+	}
+
+	clusterMorefs, unresolvedZones, err = volTopology.getClustersPartiallyMatchingTopologySegment(ctx,
+		map[string]string{v1.LabelTopologyZone: "zone-c", "example.com/zone": "zone-d"})
+	if !errors.Is(err, common.ErrZoneNotMapped) {
+		t.Errorf("expected ErrZoneNotMapped when no zone is resolved but got cluster morefs %+v and error %v",
+			clusterMorefs, err)
+	}
+	if !reflect.DeepEqual(unresolvedZones, []string{"zone-c", "zone-d"}) {
+		t.Errorf("expected unresolved zones [zone-c zone-d] but got %+v", unresolvedZones)
+	}
+}
+
+// TestCanHostVolume verifies that a preferred topology segment is selected
+// only if one of its datastores has enough free space for the volume.
+func TestCanHostVolume(t *testing.T) {
+	datastores := []*cnsvsphere.DatastoreInfo{
+		{Info: &vimtypes.DatastoreInfo{Url: "ds:///vmfs/volumes/ds1/", FreeSpace: 1 * common.GbInBytes}},
+		{Info: &vimtypes.DatastoreInfo{Url: "ds:///vmfs/volumes/ds2/", FreeSpace: 4 * common.GbInBytes}},
+	}
+	if !canHostVolume(datastores, 4*1024) {
+		t.Errorf("expected datastores %+v to host a volume of 4 Gb", datastores)
+	}
+	if canHostVolume(datastores, 5*1024) {
+		t.Errorf("expected datastores %+v to not host a volume of 5 Gb", datastores)
+	}
+	if canHostVolume(nil, 0) {
+		t.Errorf("expected a topology segment without datastores to not host a volume")
+	}
+}
+
+// TestGetSharedDatastoresInTopologyNoMatchingNodes verifies that a topology
+// segment without matching nodes fails with ErrNoMatchingNodes when
+// configured to.
+func TestGetSharedDatastoresInTopologyNoMatchingNodes(t *testing.T) {
+	volTopology := &controllerVolumeTopology{
+		csiNodeTopologyInformer: newFakeCSINodeTopologyInformer(t,
+			newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+				map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"})),
+		failOnEmptyTopologySegment: true,
+	}
+	_, err := volTopology.getSharedDatastoresInTopology(ctx,
+		[]*csi.Topology{{Segments: map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-b"}}})
+	if !errors.Is(err, common.ErrNoMatchingNodes) {
+		t.Errorf("expected ErrNoMatchingNodes but got %v", err)
+	}
+}
+
+// TestGetSharedDatastoresInTopologyNotSynced verifies that topology lookups
+// fail with ErrTopologyNotSynced until the informers have synced.
+func TestGetSharedDatastoresInTopologyNotSynced(t *testing.T) {
+	saveAZClusterMap(t)
+	topologyRequirement := &csi.TopologyRequirement{
+		Preferred: []*csi.Topology{{Segments: map[string]string{v1.LabelTopologyZone: "zone-a"}}},
+	}
+	volTopology := &controllerVolumeTopology{
+		csiNodeTopologyInformer: cache.NewSharedIndexInformer(&cache.ListWatch{}, &unstructured.Unstructured{}, 0,
+			cache.Indexers{}),
+	}
+	_, err := volTopology.GetSharedDatastoresInTopology(ctx, commoncotypes.VanillaTopologyFetchDSParams{
+		TopologyRequirement: topologyRequirement,
+	})
+	if !errors.Is(err, common.ErrTopologyNotSynced) {
+		t.Errorf("expected ErrTopologyNotSynced for an unsynced CSINodeTopology informer but got %v", err)
+	}
+
+	azClusterMapInstanceLock.Lock()
+	azClusterMap = map[string]string{"zone-a": "domain-c1"}
+	azClusterMapInstanceLock.Unlock()
+	wcpTopology := &wcpControllerVolumeTopology{
+		azInformer: cache.NewSharedIndexInformer(&cache.ListWatch{}, &unstructured.Unstructured{}, 0,
+			cache.Indexers{}),
+	}
+	_, err = wcpTopology.GetSharedDatastoresInTopology(ctx, commoncotypes.WCPTopologyFetchDSParams{
+		TopologyRequirement: topologyRequirement,
+	})
+	if !errors.Is(err, common.ErrTopologyNotSynced) {
+		t.Errorf("expected ErrTopologyNotSynced for an unsynced AvailabilityZone informer but got %v", err)
+	}
+	if waitForTopologyInformerSync(ctx, "AvailabilityZone", wcpTopology.HasSynced, 100*time.Millisecond) {
+		t.Errorf("expected the unstarted AvailabilityZone informer to not sync")
+	}
+}
+
+// TestGetNodesMatchingDrainingTopologySegment verifies that no nodes are
+// returned for a topology segment whose value is being drained.
+func TestGetNodesMatchingDrainingTopologySegment(t *testing.T) {
+	volTopology := &controllerVolumeTopology{
+		csiNodeTopologyInformer: newFakeCSINodeTopologyInformer(t,
+			newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+				map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"})),
+	}
+	setDrainingTopologyValues(ctx, []string{" zone-a "})
+	defer setDrainingTopologyValues(ctx, nil)
+
+	nodeVMs, err := volTopology.getNodesMatchingTopologySegment(ctx,
+		map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if len(nodeVMs) != 0 {
+		t.Errorf("expected no nodes for draining zone but got %+v", nodeVMs)
+	}
+	if values := getDrainingTopologyValues(); !reflect.DeepEqual(values, []string{"zone-a"}) {
+		t.Errorf("expected draining values [zone-a] but got %+v", values)
+	}
+	// Draining values are compared like the topology label values used for
+	// placement.
+	savedCaseFold := topologyLabelValueCaseFold
+	defer func() {
+		topologyLabelValueCaseFold = savedCaseFold
+	}()
+	topologyLabelValueCaseFold = true
+	if !isTopologyValueDraining("Zone-A") {
+		t.Errorf("expected zone Zone-A to be draining when label values are case folded")
+	}
+}
+
+// TestDrainingTopologyHandler verifies that the draining topology values can
+// be listed, and changed only by authorized requests.
+func TestDrainingTopologyHandler(t *testing.T) {
+	defer setDrainingTopologyValues(ctx, nil)
+	setDrainingTopologyValues(ctx, []string{"zone-a"})
+	serve := func(method, target, token string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		drainingTopologyHandler(recorder, request)
+		return recorder
+	}
+	getValues := func() []string {
+		recorder := serve(http.MethodGet, "/debug/draining-topology", "")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected status %d but got %d", http.StatusOK, recorder.Code)
+		}
+		var values []string
+		if err := json.NewDecoder(recorder.Body).Decode(&values); err != nil {
+			t.Fatalf("failed to decode draining topology values. Error: %+v", err)
+		}
+		return values
+	}
+	if values := getValues(); !reflect.DeepEqual(values, []string{"zone-a"}) {
+		t.Errorf("expected draining values [zone-a] but got %+v", values)
+	}
+
+	// Changes are refused unless the debug server token is set and provided.
+	if code := serve(http.MethodPost, "/debug/draining-topology?value=zone-b", "secret").Code; code !=
+		http.StatusUnauthorized {
+		t.Errorf("expected status %d without a debug server token but got %d", http.StatusUnauthorized, code)
+	}
+	t.Setenv(common.EnvDebugServerToken, "secret")
+	if code := serve(http.MethodPost, "/debug/draining-topology?value=zone-b", "wrong").Code; code !=
+		http.StatusUnauthorized {
+		t.Errorf("expected status %d for a wrong token but got %d", http.StatusUnauthorized, code)
+	}
+	if code := serve(http.MethodPost, "/debug/draining-topology", "secret").Code; code != http.StatusBadRequest {
+		t.Errorf("expected status %d without a value but got %d", http.StatusBadRequest, code)
+	}
+	if code := serve(http.MethodPost, "/debug/draining-topology?value=zone-b", "secret").Code; code !=
+		http.StatusOK {
+		t.Errorf("expected status %d when draining zone-b but got %d", http.StatusOK, code)
+	}
+	if values := getValues(); !reflect.DeepEqual(values, []string{"zone-a", "zone-b"}) {
+		t.Errorf("expected draining values [zone-a zone-b] but got %+v", values)
+	}
+	if code := serve(http.MethodDelete, "/debug/draining-topology?value=zone-a", "secret").Code; code !=
+		http.StatusOK {
+		t.Errorf("expected status %d when no longer draining zone-a but got %d", http.StatusOK, code)
+	}
+	if values := getValues(); !reflect.DeepEqual(values, []string{"zone-b"}) {
+		t.Errorf("expected draining values [zone-b] but got %+v", values)
+	}
+	if code := serve(http.MethodPut, "/debug/draining-topology", "secret").Code; code !=
+		http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for PUT but got %d", http.StatusMethodNotAllowed, code)
+	}
+}
+
+// TestRelistDomainNodeMapNormalizesLabelValues verifies that topology label
+// values are trimmed and, when configured, case folded in the domainNodeMap.
+func TestRelistDomainNodeMapNormalizesLabelValues(t *testing.T) {
+	saveDomainNodeMap(t)
+	volTopology := &controllerVolumeTopology{
+		csiNodeTopologyInformer: newFakeCSINodeTopologyInformer(t,
+			newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+				map[string]string{"topology.csi.vmware.com/k8s-zone": " Zone-A "})),
+	}
+	topologyLabelValueCaseFold = true
+	defer func() { topologyLabelValueCaseFold = false }()
+
+	volTopology.relistDomainNodeMap(ctx)
+
+	expected := map[string]map[string]struct{}{
+		"topology.csi.vmware.com/k8s-zone:zone-a": {"node1": {}},
+	}
+	domainNodeMapInstanceLock.RLock()
+	defer domainNodeMapInstanceLock.RUnlock()
+	if !reflect.DeepEqual(domainNodeMap, expected) {
+		t.Errorf("expected domainNodeMap %+v but got %+v", expected, domainNodeMap)
+	}
+}
+
+// TestGetNodesMatchingTopologySegmentNormalizesLabelValues verifies that
+// whitespace and casing differences between the requested topology segment
+// and the node labels are handled as per the case folding configuration.
+func TestGetNodesMatchingTopologySegmentNormalizesLabelValues(t *testing.T) {
+	volTopology := &controllerVolumeTopology{
+		csiNodeTopologyInformer: newFakeCSINodeTopologyInformer(t,
+			newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+				map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a "})),
+	}
+	cacheNodeVMs(volTopology, map[string]*cnsvsphere.VirtualMachine{"node1": {}})
+
+	tests := []struct {
+		name          string
+		caseFold      bool
+		segmentValue  string
+		expectedNodes int
+	}{
+		{name: "whitespace mismatch", caseFold: false, segmentValue: " zone-a", expectedNodes: 1},
+		{name: "case mismatch without case folding", caseFold: false, segmentValue: "Zone-A", expectedNodes: 0},
+		{name: "case mismatch with case folding", caseFold: true, segmentValue: "Zone-A", expectedNodes: 1},
+	}
+	for _, test := range tests {
+		topologyLabelValueCaseFold = test.caseFold
+		nodeVMs, err := volTopology.getNodesMatchingTopologySegment(ctx,
+			map[string]string{"topology.csi.vmware.com/k8s-zone": test.segmentValue})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %+v", test.name, err)
+		}
+		if len(nodeVMs) != test.expectedNodes {
+			t.Errorf("%s: expected %d matching nodes but got %d", test.name, test.expectedNodes, len(nodeVMs))
+		}
+	}
+	topologyLabelValueCaseFold = false
+}
+
+// TestGetRequisiteTopologiesWithoutNodes verifies that only the requisite
+// topology segments which do not match any node are returned.
+func TestGetRequisiteTopologiesWithoutNodes(t *testing.T) {
+	saveDomainNodeMap(t)
+	domainNodeMapInstanceLock.Lock()
+	domainNodeMap = map[string]map[string]struct{}{
+		"region:region-1": {"node1": {}, "node2": {}},
+		"zone:zone-a":     {"node1": {}},
+		"zone:zone-b":     {"node2": {}},
+	}
+	domainNodeMapInstanceLock.Unlock()
+
+	topologyRequirement := &csi.TopologyRequirement{
+		Requisite: []*csi.Topology{
+			{Segments: map[string]string{"region": "region-1", "zone": "zone-a"}},
+			{Segments: map[string]string{"zone": "zone-b"}},
+			{Segments: map[string]string{"zone": "zone-c"}},
+			{Segments: map[string]string{"region": "region-2", "zone": "zone-a"}},
+		},
+	}
+	expected := []map[string]string{
+		{"zone": "zone-c"},
+		{"region": "region-2", "zone": "zone-a"},
+	}
+	unsatisfied := getRequisiteTopologiesWithoutNodes(ctx, topologyRequirement)
+	if !reflect.DeepEqual(unsatisfied, expected) {
+		t.Errorf("expected unsatisfied topologies %+v but got %+v", expected, unsatisfied)
+	}
+}
+
+// TestDomainNodeMapWithValueRepeatedAcrossCategories verifies that a tag
+// value used in more than one topology category is tracked per category.
+func TestDomainNodeMapWithValueRepeatedAcrossCategories(t *testing.T) {
+	saveDomainNodeMap(t)
+	node1 := newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+		map[string]string{"region": "us-east", "zone": "us-west"})
+	node2 := newCSINodeTopology("node2", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+		map[string]string{"region": "us-west", "zone": "us-east"})
+	domainNodeMapInstanceLock.Lock()
+	domainNodeMap = make(map[string]map[string]struct{})
+	domainNodeMapInstanceLock.Unlock()
+	addNodeToDomainNodeMap(ctx, node1)
+	addNodeToDomainNodeMap(ctx, node2)
+
+	topologyRequirement := &csi.TopologyRequirement{
+		Requisite: []*csi.Topology{
+			{Segments: map[string]string{"region": "us-east", "zone": "us-west"}},
+			{Segments: map[string]string{"region": "us-east", "zone": "us-east"}},
+		},
+	}
+	expected := []map[string]string{
+		{"region": "us-east", "zone": "us-east"},
+	}
+	unsatisfied := getRequisiteTopologiesWithoutNodes(ctx, topologyRequirement)
+	if !reflect.DeepEqual(unsatisfied, expected) {
+		t.Errorf("expected unsatisfied topologies %+v but got %+v", expected, unsatisfied)
+	}
+
+	removeNodeFromDomainNodeMap(ctx, node2)
+	expectedDomainNodeMap := map[string]map[string]struct{}{
+		"region:us-east": {"node1": {}},
+		"region:us-west": {},
+		"zone:us-west":   {"node1": {}},
+		"zone:us-east":   {},
+	}
+	domainNodeMapInstanceLock.RLock()
+	defer domainNodeMapInstanceLock.RUnlock()
+	if !reflect.DeepEqual(domainNodeMap, expectedDomainNodeMap) {
+		t.Errorf("expected domainNodeMap %+v but got %+v", expectedDomainNodeMap, domainNodeMap)
+	}
+}
+
+// TestGetNodesMatchingTopologySegmentExactMatchMode verifies that a node with
+// topology keys besides the ones in the segment matches only in subset mode.
+func TestGetNodesMatchingTopologySegmentExactMatchMode(t *testing.T) {
+	segments := map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}
+
+	tests := []struct {
+		matchMode     string
+		expectedNodes int
+	}{
+		{matchMode: topologyMatchModeSubset, expectedNodes: 1},
+		{matchMode: topologyMatchModeExact, expectedNodes: 0},
+	}
+	for _, test := range tests {
+		volTopology := &controllerVolumeTopology{
+			csiNodeTopologyInformer: newFakeCSINodeTopologyInformer(t,
+				newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+					map[string]string{
+						"topology.csi.vmware.com/k8s-zone":   "zone-a",
+						"topology.csi.vmware.com/k8s-region": "region-1",
+					})),
+			topologyMatchMode: test.matchMode,
+		}
+		cacheNodeVMs(volTopology, map[string]*cnsvsphere.VirtualMachine{"node1": {}})
+		nodeVMs, err := volTopology.getNodesMatchingTopologySegment(ctx, segments)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %+v", test.matchMode, err)
+		}
+		if len(nodeVMs) != test.expectedNodes {
+			t.Errorf("%s: expected %d matching nodes but got %d", test.matchMode, test.expectedNodes, len(nodeVMs))
+		}
+	}
+}
+
+// TestGetNodesMatchingTopologySegmentWithoutTopologyLabels verifies that a
+// node without topology labels matches an empty segment only when such nodes
+// are included, and never matches a non-empty segment.
+func TestGetNodesMatchingTopologySegmentWithoutTopologyLabels(t *testing.T) {
+
+	tests := []struct {
+		includeNodes  bool
+		segments      map[string]string
+		expectedNodes int
+	}{
+		{includeNodes: false, segments: map[string]string{}, expectedNodes: 0},
+		{includeNodes: true, segments: map[string]string{}, expectedNodes: 1},
+		{includeNodes: false, segments: map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}},
+		{includeNodes: true, segments: map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}},
+	}
+	for _, test := range tests {
+		volTopology := &controllerVolumeTopology{
+			csiNodeTopologyInformer: newFakeCSINodeTopologyInformer(t,
+				newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologySuccess, nil)),
+			includeNodesWithoutTopologyLabels: test.includeNodes,
+		}
+		cacheNodeVMs(volTopology, map[string]*cnsvsphere.VirtualMachine{"node1": {}})
+		nodeVMs, err := volTopology.getNodesMatchingTopologySegment(ctx, test.segments)
+		if err != nil {
+			t.Fatalf("include %t, segments %+v: unexpected error: %+v", test.includeNodes, test.segments, err)
+		}
+		if len(nodeVMs) != test.expectedNodes {
+			t.Errorf("include %t, segments %+v: expected %d matching nodes but got %d",
+				test.includeNodes, test.segments, test.expectedNodes, len(nodeVMs))
+		}
+	}
+}
+
+// fakeNodeManager is a node.Manager which resolves every node UUID to a nodeVM
+// and counts the lookups made.
+type fakeNodeManager struct {
+	node.Manager
+	getNodeCalls int32
+}
+
+func (m *fakeNodeManager) GetNode(ctx context.Context, nodeUUID string,
+	dc *cnsvsphere.Datacenter) (*cnsvsphere.VirtualMachine, error) {
+	atomic.AddInt32(&m.getNodeCalls, 1)
+	return &cnsvsphere.VirtualMachine{UUID: nodeUUID}, nil
+}
+
+// newNodeVMLookupTestTopology returns a vanilla controllerVolumeTopology with
+// the given number of nodes in zone-a, whose nodeVMs are resolved by the
+// returned fakeNodeManager.
+func newNodeVMLookupTestTopology(t testing.TB, nodeCount int,
+	cacheTTL time.Duration) (*controllerVolumeTopology, *fakeNodeManager) {
+	var instances []csinodetopologyv1alpha1.CSINodeTopology
+	for i := 0; i < nodeCount; i++ {
+		instances = append(instances, newCSINodeTopology(fmt.Sprintf("node%d", i),
+			csinodetopologyv1alpha1.CSINodeTopologySuccess,
+			map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}))
+	}
+	nodeMgr := &fakeNodeManager{}
+	volTopology := &controllerVolumeTopology{
+		csiNodeTopologyInformer:   newFakeCSINodeTopologyInformer(t, instances...),
+		nodeMgr:                   nodeMgr,
+		clusterFlavor:             cnstypes.CnsClusterFlavorVanilla,
+		isCSINodeIdFeatureEnabled: true,
+		nodeVMCacheTTL:            cacheTTL,
+	}
+	return volTopology, nodeMgr
+}
+
+// TestGetNodesMatchingTopologySegmentCachesNodeVMs verifies that nodeVMs are
+// looked up once and again only after their CSINodeTopology instance is
+// deleted or its node UUID changes.
+func TestGetNodesMatchingTopologySegmentCachesNodeVMs(t *testing.T) {
+	volTopology, nodeMgr := newNodeVMLookupTestTopology(t, 3, time.Minute)
+	segments := map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}
+
+	for i := 0; i < 2; i++ {
+		nodeVMs, err := volTopology.getNodesMatchingTopologySegment(ctx, segments)
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if len(nodeVMs) != 3 {
+			t.Fatalf("expected 3 matching nodes but got %d", len(nodeVMs))
+		}
+	}
+	if calls := atomic.LoadInt32(&nodeMgr.getNodeCalls); calls != 3 {
+		t.Errorf("expected 3 GetNode calls but got %d", calls)
+	}
+
+	deleted := newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologyError, nil)
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&deleted)
+	if err != nil {
+		t.Fatalf("failed to convert %+v to unstructured. Error: %+v", deleted, err)
+	}
+	volTopology.csiNodeTopologyDeleted(&unstructured.Unstructured{Object: obj})
+	if _, err = volTopology.getNodesMatchingTopologySegment(ctx, segments); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if calls := atomic.LoadInt32(&nodeMgr.getNodeCalls); calls != 4 {
+		t.Errorf("expected 4 GetNode calls after node1 was deleted but got %d", calls)
+	}
+
+	oldInstance := newCSINodeTopology("node2", csinodetopologyv1alpha1.CSINodeTopologySuccess, nil)
+	newInstance := newCSINodeTopology("node2", csinodetopologyv1alpha1.CSINodeTopologySuccess, nil)
+	newInstance.Spec.NodeUUID = "uuid-node2-rebuilt"
+	oldObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&oldInstance)
+	if err != nil {
+		t.Fatalf("failed to convert %+v to unstructured. Error: %+v", oldInstance, err)
+	}
+	newObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&newInstance)
+	if err != nil {
+		t.Fatalf("failed to convert %+v to unstructured. Error: %+v", newInstance, err)
+	}
+	volTopology.csiNodeTopologyUpdated(&unstructured.Unstructured{Object: oldObj},
+		&unstructured.Unstructured{Object: newObj})
+	if _, err = volTopology.getNodesMatchingTopologySegment(ctx, segments); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if calls := atomic.LoadInt32(&nodeMgr.getNodeCalls); calls != 5 {
+		t.Errorf("expected 5 GetNode calls after the node UUID of node2 changed but got %d", calls)
+	}
+}
+
+func benchmarkGetNodesMatchingTopologySegment(b *testing.B, cacheTTL time.Duration) {
+	volTopology, nodeMgr := newNodeVMLookupTestTopology(b, 200, cacheTTL)
+	segments := map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := volTopology.getNodesMatchingTopologySegment(ctx, segments); err != nil {
+			b.Fatalf("unexpected error: %+v", err)
+		}
+	}
+	b.ReportMetric(float64(atomic.LoadInt32(&nodeMgr.getNodeCalls))/float64(b.N), "GetNode-calls/op")
+}
+
+func BenchmarkGetNodesMatchingTopologySegmentCached(b *testing.B) {
+	benchmarkGetNodesMatchingTopologySegment(b, time.Hour)
+}
+
+func BenchmarkGetNodesMatchingTopologySegmentUncached(b *testing.B) {
+	benchmarkGetNodesMatchingTopologySegment(b, 0)
+}
+
+// TestRelistDomainNodeMapWithTopologyNodeSelector verifies that nodes not
+// matching the topology node selector are skipped in the domainNodeMap.
+func TestRelistDomainNodeMapWithTopologyNodeSelector(t *testing.T) {
+	saveDomainNodeMap(t)
+	nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for name, nodeLabels := range map[string]map[string]string{
+		"node1": {"topology.csi.vmware.com/participate": "true"},
+		"node2": {},
+	} {
+		if err := nodeIndexer.Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: nodeLabels}}); err != nil {
+			t.Fatalf("failed to add node %q to indexer. Error: %+v", name, err)
+		}
+	}
+	selector, err := labels.Parse("topology.csi.vmware.com/participate=true")
+	if err != nil {
+		t.Fatalf("failed to parse selector. Error: %+v", err)
+	}
+	topologyNodeSelector, topologyNodeLister = selector, corelisters.NewNodeLister(nodeIndexer)
+	defer func() {
+		topologyNodeSelector, topologyNodeLister = nil, nil
+	}()
+	volTopology := &controllerVolumeTopology{
+		csiNodeTopologyInformer: newFakeCSINodeTopologyInformer(t,
+			newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+				map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}),
+			newCSINodeTopology("node2", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+				map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"})),
+	}
+
+	volTopology.relistDomainNodeMap(ctx)
+
+	expected := map[string]map[string]struct{}{
+		"topology.csi.vmware.com/k8s-zone:zone-a": {"node1": {}},
+	}
+	domainNodeMapInstanceLock.RLock()
+	defer domainNodeMapInstanceLock.RUnlock()
+	if !reflect.DeepEqual(domainNodeMap, expected) {
+		t.Errorf("expected domainNodeMap %+v but got %+v", expected, domainNodeMap)
+	}
+}
+
+// TestRelistDomainNodeMapWithDuplicateCSINodeTopologies verifies that only
+// the winning instance among the instances for the same node UUID is used.
+func TestRelistDomainNodeMapWithDuplicateCSINodeTopologies(t *testing.T) {
+	saveDomainNodeMap(t)
+	oldInstance := newCSINodeTopology("old-node1", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+		map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"})
+	newInstance := newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+		map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-b"})
+	oldInstance.Spec.NodeUUID, newInstance.Spec.NodeUUID = "uuid-1", "uuid-1"
+	oldInstance.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	newInstance.CreationTimestamp = metav1.NewTime(time.Now())
+	volTopology := &controllerVolumeTopology{
+		csiNodeTopologyInformer: newFakeCSINodeTopologyInformer(t, oldInstance, newInstance),
+	}
+	defer func() { csiNodeTopologyDuplicateResolution = csiNodeTopologyDuplicateResolutionNewest }()
+
+	tests := []struct {
+		resolution string
+		expected   map[string]map[string]struct{}
+	}{
+		{
+			resolution: csiNodeTopologyDuplicateResolutionNewest,
+			expected: map[string]map[string]struct{}{
+				"topology.csi.vmware.com/k8s-zone:zone-b": {"node1": {}},
+			},
+		},
+		{
+			resolution: csiNodeTopologyDuplicateResolutionOldest,
+			expected: map[string]map[string]struct{}{
+				"topology.csi.vmware.com/k8s-zone:zone-a": {"old-node1": {}},
+			},
+		},
+	}
+	for _, test := range tests {
+		csiNodeTopologyDuplicateResolution = test.resolution
+		volTopology.relistDomainNodeMap(ctx)
+		domainNodeMapInstanceLock.RLock()
+		if !reflect.DeepEqual(domainNodeMap, test.expected) {
+			t.Errorf("%s: expected domainNodeMap %+v but got %+v", test.resolution, test.expected, domainNodeMap)
+		}
+		domainNodeMapInstanceLock.RUnlock()
+	}
+}
+
+// newSharedDatastoresTestTopology returns a controllerVolumeTopology with a
+// single node in zone-a, and stubs getSharedDatastoresForVMs to count the
+// number of times it is invoked. The returned function restores the stub.
+func newSharedDatastoresTestTopology(t testing.TB, cacheTTL time.Duration) (*controllerVolumeTopology,
+	*int, func()) {
+	informer := newFakeCSINodeTopologyInformer(t,
+		newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+			map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}))
+	calls := 0
+	getSharedDatastoresForVMs = func(ctx context.Context,
+		nodeVMs []*cnsvsphere.VirtualMachine) ([]*cnsvsphere.DatastoreInfo, error) {
+		calls++
+		return []*cnsvsphere.DatastoreInfo{{Info: &vimtypes.DatastoreInfo{Url: "ds:///vmfs/volumes/ds1/"}}}, nil
+	}
+	invalidateSharedDatastoresCache(ctx)
+	volTopology := &controllerVolumeTopology{
+		csiNodeTopologyInformer:  informer,
+		sharedDatastoresCacheTTL: cacheTTL,
+	}
+	cacheNodeVMs(volTopology, map[string]*cnsvsphere.VirtualMachine{"node1": {}})
+	return volTopology, &calls, func() {
+		getSharedDatastoresForVMs = cnsvsphere.GetSharedDatastoresForVMs
+		invalidateSharedDatastoresCache(ctx)
+	}
+}
+
+// TestGetSharedDatastoresInTopologyUsesCache verifies that a second lookup of
+// the same topology segment within the TTL is served from the cache, and that
+// the cache is invalidated by CSINodeTopology events.
+func TestGetSharedDatastoresInTopologyUsesCache(t *testing.T) {
+	volTopology, calls, cleanup := newSharedDatastoresTestTopology(t, time.Minute)
+	defer cleanup()
+	topology := []*csi.Topology{{Segments: map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}}}
+
+	for i := 0; i < 2; i++ {
+		datastores, err := volTopology.getSharedDatastoresInTopology(ctx, topology)
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if len(datastores) != 1 {
+			t.Errorf("expected 1 shared datastore but got %d", len(datastores))
+		}
+	}
+	if *calls != 1 {
+		t.Errorf("expected GetSharedDatastoresForVMs to be called once but it was called %d times", *calls)
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&csinodetopologyv1alpha1.CSINodeTopology{
+		ObjectMeta: metav1.ObjectMeta{Name: "node2"}})
+	if err != nil {
+		t.Fatalf("failed to convert CSINodeTopology to unstructured. Error: %+v", err)
+	}
+	topoCRAdded(&unstructured.Unstructured{Object: obj})
+	if _, err = volTopology.getSharedDatastoresInTopology(ctx, topology); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if *calls != 2 {
+		t.Errorf("expected GetSharedDatastoresForVMs to be called again after a CSINodeTopology event "+
+			"but it was called %d times", *calls)
+	}
+}
+
+// TestGetSharedDatastoresInTopologyOrdersByNodeCount verifies that the shared
+// datastores are ordered by the number of matching nodes which can access them,
+// and that the intersection mode keeps only the datastores shared by all zones.
+func TestGetSharedDatastoresInTopologyOrdersByNodeCount(t *testing.T) {
+	accessibleDatastores := map[string][]string{
+		"vm-1": {"ds:///vmfs/volumes/ds-b/", "ds:///vmfs/volumes/ds-a/"},
+		"vm-2": {"ds:///vmfs/volumes/ds-b/", "ds:///vmfs/volumes/ds-a/"},
+		"vm-3": {"ds:///vmfs/volumes/ds-c/", "ds:///vmfs/volumes/ds-a/"},
+	}
+	nodeZones := map[string]string{"node1": "zone-a", "node2": "zone-a", "node3": "zone-b"}
+	var instances []csinodetopologyv1alpha1.CSINodeTopology
+	nodeVMs := make(map[string]*cnsvsphere.VirtualMachine)
+	for i, nodeName := range []string{"node1", "node2", "node3"} {
+		nodeVMs[nodeName] = &cnsvsphere.VirtualMachine{UUID: fmt.Sprintf("vm-%d", i+1)}
+		instances = append(instances, newCSINodeTopology(nodeName, csinodetopologyv1alpha1.CSINodeTopologySuccess,
+			map[string]string{"topology.csi.vmware.com/k8s-zone": nodeZones[nodeName]}))
+	}
+	getSharedDatastoresForVMs = func(ctx context.Context,
+		nodeVMs []*cnsvsphere.VirtualMachine) ([]*cnsvsphere.DatastoreInfo, error) {
+		var sharedDatastores []*cnsvsphere.DatastoreInfo
+		for _, url := range accessibleDatastores[nodeVMs[0].UUID] {
+			shared := true
+			for _, nodeVM := range nodeVMs[1:] {
+				shared = shared && common.Contains(accessibleDatastores[nodeVM.UUID], url)
+			}
+			if shared {
+				sharedDatastores = append(sharedDatastores,
+					&cnsvsphere.DatastoreInfo{Info: &vimtypes.DatastoreInfo{Url: url}})
+			}
+		}
+		return sharedDatastores, nil
+	}
+	invalidateSharedDatastoresCache(ctx)
+	defer func() {
+		getSharedDatastoresForVMs = cnsvsphere.GetSharedDatastoresForVMs
+	}()
+	volTopology := &controllerVolumeTopology{
+		csiNodeTopologyInformer: newFakeCSINodeTopologyInformer(t, instances...),
+	}
+	cacheNodeVMs(volTopology, nodeVMs)
+
+	datastores, err := volTopology.getSharedDatastoresInTopology(ctx, []*csi.Topology{
+		{Segments: map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}},
+		{Segments: map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-b"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	var urls []string
+	for _, datastore := range datastores {
+		urls = append(urls, datastore.Info.Url)
+	}
+	expected := []string{"ds:///vmfs/volumes/ds-a/", "ds:///vmfs/volumes/ds-b/", "ds:///vmfs/volumes/ds-c/"}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("expected shared datastores %v but got %v", expected, urls)
+	}
+
+	// In the intersection mode, only the datastores shared by the nodes of
+	// every requisite topology segment are used.
+	volTopology.requisiteTopologyMode = requisiteTopologyModeIntersection
+	datastores, err = volTopology.GetSharedDatastoresInTopology(ctx, commoncotypes.VanillaTopologyFetchDSParams{
+		TopologyRequirement: &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{
+				{Segments: map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}},
+				{Segments: map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-b"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	urls = nil
+	for _, datastore := range datastores {
+		urls = append(urls, datastore.Info.Url)
+	}
+	expected = []string{"ds:///vmfs/volumes/ds-a/"}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("expected datastores shared across all zones %v but got %v", expected, urls)
+	}
+
+	// In the intersection mode, the requisite topology segments are not
+	// truncated to the maximum number of segments.
+	volTopology.maxTopologySegments = 1
+	_, err = volTopology.GetSharedDatastoresInTopology(ctx, commoncotypes.VanillaTopologyFetchDSParams{
+		TopologyRequirement: &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{
+				{Segments: map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}},
+				{Segments: map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-b"}},
+			},
+		},
+	})
+	if !errors.Is(err, common.ErrTooManyTopologySegments) {
+		t.Errorf("expected ErrTooManyTopologySegments for too many requisite topology segments but got %+v", err)
+	}
+}
+
+// TestGetSharedDatastoresInTopologyRecordsTopologyPath verifies that the
+// topology requirement which yielded the shared datastores is recorded.
+func TestGetSharedDatastoresInTopologyRecordsTopologyPath(t *testing.T) {
+	volTopology, _, cleanup := newSharedDatastoresTestTopology(t, 0)
+	defer cleanup()
+
+	tests := []struct {
+		preferredZone string
+		expectedPath  string
+	}{
+		{preferredZone: "zone-a", expectedPath: common.TopologyPathPreferred},
+		{preferredZone: "zone-b", expectedPath: common.TopologyPathRequisiteFallback},
+	}
+	for _, test := range tests {
+		var topologyPath string
+		_, err := volTopology.GetSharedDatastoresInTopology(ctx, commoncotypes.VanillaTopologyFetchDSParams{
+			TopologyRequirement: &csi.TopologyRequirement{
+				Preferred: []*csi.Topology{
+					{Segments: map[string]string{"topology.csi.vmware.com/k8s-zone": test.preferredZone}}},
+				Requisite: []*csi.Topology{
+					{Segments: map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}}},
+			},
+			TopologyPath: &topologyPath,
+		})
+		if err != nil {
+			t.Fatalf("preferred zone %q: unexpected error: %+v", test.preferredZone, err)
+		}
+		if topologyPath != test.expectedPath {
+			t.Errorf("preferred zone %q: expected topology path %q but got %q", test.preferredZone,
+				test.expectedPath, topologyPath)
+		}
+	}
+}
+
+// TestGetSharedDatastoresCacheKey verifies that the cache key of a topology
+// segment does not depend on the order of its keys.
+func TestGetSharedDatastoresCacheKey(t *testing.T) {
+	key1 := getSharedDatastoresCacheKey(map[string]string{
+		"topology.csi.vmware.com/k8s-region": "region-1",
+		"topology.csi.vmware.com/k8s-zone":   "zone-a",
+	})
+	key2 := getSharedDatastoresCacheKey(map[string]string{
+		"topology.csi.vmware.com/k8s-zone":   "zone-a",
+		"topology.csi.vmware.com/k8s-region": "region-1",
+	})
+	if key1 != key2 {
+		t.Errorf("expected cache keys %q and %q to be equal", key1, key2)
+	}
+}
+
+// TestDedupTopologySegments verifies that identical topology segments are
+// processed once and that the number of segments is capped in order.
+func TestDedupTopologySegments(t *testing.T) {
+	zoneKey := "topology.csi.vmware.com/k8s-zone"
+	regionKey := "topology.csi.vmware.com/k8s-region"
+	var topologyArr []*csi.Topology
+	for i := 0; i < 3; i++ {
+		topologyArr = append(topologyArr,
+			&csi.Topology{Segments: map[string]string{regionKey: "region-1", zoneKey: "zone-a"}},
+			&csi.Topology{Segments: map[string]string{zoneKey: "zone-b", regionKey: "region-1"}},
+			&csi.Topology{Segments: map[string]string{regionKey: "region-1", zoneKey: "zone-c"}})
+	}
+
+	deduped := dedupTopologySegments(ctx, topologyArr, 0)
+	if len(deduped) != 3 {
+		t.Fatalf("expected 3 distinct topology segments, got %+v", deduped)
+	}
+	for i, zone := range []string{"zone-a", "zone-b", "zone-c"} {
+		if deduped[i].GetSegments()[zoneKey] != zone {
+			t.Errorf("expected segment %d to be in zone %q, got %+v", i, zone, deduped[i])
+		}
+	}
+
+	capped := dedupTopologySegments(ctx, topologyArr, 2)
+	if len(capped) != 2 || capped[0].GetSegments()[zoneKey] != "zone-a" ||
+		capped[1].GetSegments()[zoneKey] != "zone-b" {
+		t.Errorf("expected the first 2 distinct topology segments, got %+v", capped)
+	}
+}
+
+func benchmarkGetSharedDatastoresInTopology(b *testing.B, cacheTTL time.Duration) {
+	volTopology, _, cleanup := newSharedDatastoresTestTopology(b, cacheTTL)
+	defer cleanup()
+	topology := []*csi.Topology{{Segments: map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := volTopology.getSharedDatastoresInTopology(ctx, topology); err != nil {
+			b.Fatalf("unexpected error: %+v", err)
+		}
+	}
+}
+
+func BenchmarkGetSharedDatastoresInTopologyCached(b *testing.B) {
+	benchmarkGetSharedDatastoresInTopology(b, time.Minute)
+}
+
+func BenchmarkGetSharedDatastoresInTopologyUncached(b *testing.B) {
+	benchmarkGetSharedDatastoresInTopology(b, 0)
+}
+
+// TestTopologySnapshotHandler verifies that the topology caches and the status
+// of the CSINodeTopology instances are returned in the response body.
+func TestTopologySnapshotHandler(t *testing.T) {
+	saveDomainNodeMap(t)
+	saveAZClusterMap(t)
+	informer := newFakeCSINodeTopologyInformer(t,
+		newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+			map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}),
+		newCSINodeTopology("node2", csinodetopologyv1alpha1.CSINodeTopologyError, nil))
+	domainNodeMapInstanceLock.Lock()
+	domainNodeMap = map[string]map[string]struct{}{
+		"topology.csi.vmware.com/k8s-zone:zone-a": {"node1": {}, "node0": {}},
+	}
+	domainNodeMapInstanceLock.Unlock()
+	azClusterMapInstanceLock.Lock()
+	azClusterMap = map[string]string{"zone-a": "domain-c1"}
+	azClusterMapInstanceLock.Unlock()
+	controllerVolumeTopologyInstanceLock.Lock()
+	savedInstance := controllerVolumeTopologyInstance
+	controllerVolumeTopologyInstance = &controllerVolumeTopology{csiNodeTopologyInformer: informer}
+	controllerVolumeTopologyInstanceLock.Unlock()
+	defer func() {
+		controllerVolumeTopologyInstanceLock.Lock()
+		controllerVolumeTopologyInstance = savedInstance
+		controllerVolumeTopologyInstanceLock.Unlock()
+	}()
+
+	recorder := httptest.NewRecorder()
+	topologySnapshotHandler(recorder, httptest.NewRequest(http.MethodGet, "/debug/topology-snapshot", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	var snapshot topologySnapshot
+	if err := json.Unmarshal(recorder.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("failed to decode topology snapshot. Error: %+v", err)
+	}
+	expectedDomainNodeMap := map[string][]string{
+		"topology.csi.vmware.com/k8s-zone:zone-a": {"node0", "node1"},
+	}
+	if !reflect.DeepEqual(snapshot.DomainNodeMap, expectedDomainNodeMap) {
+		t.Errorf("expected domainNodeMap %+v but got %+v", expectedDomainNodeMap, snapshot.DomainNodeMap)
+	}
+	if !reflect.DeepEqual(snapshot.AZClusterMap, map[string]string{"zone-a": "domain-c1"}) {
+		t.Errorf("unexpected azClusterMap %+v", snapshot.AZClusterMap)
+	}
+	if len(snapshot.CSINodeTopologies) != 2 ||
+		snapshot.CSINodeTopologies["node1"].Status != csinodetopologyv1alpha1.CSINodeTopologySuccess ||
+		snapshot.CSINodeTopologies["node2"].Status != csinodetopologyv1alpha1.CSINodeTopologyError {
+		t.Errorf("unexpected CSINodeTopology statuses %+v", snapshot.CSINodeTopologies)
+	}
+
+	// POST writes the snapshot to the configured directory only.
+	dir := t.TempDir()
+	t.Setenv(common.EnvDebugServerToken, "secret")
+	post := func(token string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/debug/topology-snapshot?path=/tmp/other.json", nil)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		topologySnapshotHandler(recorder, request)
+		return recorder
+	}
+	t.Setenv("TOPOLOGY_SNAPSHOT_DIR", "")
+	if recorder = post("secret"); recorder.Code != http.StatusForbidden {
+		t.Errorf("expected status %d without a snapshot directory but got %d", http.StatusForbidden, recorder.Code)
+	}
+	t.Setenv("TOPOLOGY_SNAPSHOT_DIR", "relative/dir")
+	if recorder = post("secret"); recorder.Code != http.StatusForbidden {
+		t.Errorf("expected status %d with a relative snapshot directory but got %d", http.StatusForbidden, recorder.Code)
+	}
+	t.Setenv("TOPOLOGY_SNAPSHOT_DIR", dir)
+	if recorder = post("wrong"); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d with a wrong token but got %d", http.StatusUnauthorized, recorder.Code)
+	}
+	if recorder = post("secret"); recorder.Code != http.StatusCreated {
+		t.Fatalf("expected status %d but got %d: %s", http.StatusCreated, recorder.Code, recorder.Body.String())
+	}
+	var response map[string]string
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response. Error: %+v", err)
+	}
+	if filepath.Dir(response["path"]) != dir {
+		t.Fatalf("expected snapshot to be written to %q but got %q", dir, response["path"])
+	}
+	info, err := os.Stat(response["path"])
+	if err != nil {
+		t.Fatalf("failed to stat topology snapshot file. Error: %+v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected topology snapshot file mode 0600 but got %v", info.Mode().Perm())
+	}
+	data, err := os.ReadFile(response["path"])
+	if err != nil {
+		t.Fatalf("failed to read topology snapshot file. Error: %+v", err)
+	}
+	var written topologySnapshot
+	if err = json.Unmarshal(data, &written); err != nil {
+		t.Fatalf("failed to decode written topology snapshot. Error: %+v", err)
+	}
+	if !reflect.DeepEqual(written.DomainNodeMap, expectedDomainNodeMap) {
+		t.Errorf("expected written domainNodeMap %+v but got %+v", expectedDomainNodeMap, written.DomainNodeMap)
+	}
+
+	recorder = httptest.NewRecorder()
+	topologySnapshotHandler(recorder, httptest.NewRequest(http.MethodDelete, "/debug/topology-snapshot", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for DELETE but got %d", http.StatusMethodNotAllowed, recorder.Code)
+	}
+}
+
+// TestResetTopologyServiceInControllerStopsInformer verifies that resetting
+// the WCP topology service stops its AvailabilityZone informer goroutine, and
+// that the topology service can be initialized again afterwards.
+func TestResetTopologyServiceInControllerStopsInformer(t *testing.T) {
+	// Serve an empty list of AvailabilityZone instances and keep watches open
+	// until the informer closes them.
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/topology.tanzu.vmware.com/v1alpha1/availabilityzones" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("watch") == "true" {
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, `{"apiVersion":"topology.tanzu.vmware.com/v1alpha1","kind":"AvailabilityZoneList",`+
+			`"metadata":{"resourceVersion":"1"},"items":[]}`)
+	}))
+	defer apiServer.Close()
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	err := os.WriteFile(kubeconfig, []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: %s
+contexts:
+- name: test
+  context:
+    cluster: test
+current-context: test
+`, apiServer.URL)), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(clientcmd.RecommendedConfigPathEnvVar, kubeconfig)
+	if kubeconfigFlag := flag.Lookup("kubeconfig"); kubeconfigFlag != nil {
+		savedKubeconfig := kubeconfigFlag.Value.String()
+		defer func() {
+			_ = kubeconfigFlag.Value.Set(savedKubeconfig)
+		}()
+		if err = kubeconfigFlag.Value.Set(kubeconfig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	controllerVolumeTopologyInstanceLock.Lock()
+	savedInstance := wcpControllerVolumeTopologyInstance
+	wcpControllerVolumeTopologyInstance = nil
+	controllerVolumeTopologyInstanceLock.Unlock()
+	defer func() {
+		controllerVolumeTopologyInstanceLock.Lock()
+		wcpControllerVolumeTopologyInstance = savedInstance
+		controllerVolumeTopologyInstanceLock.Unlock()
+	}()
+
+	// The informers of the topology service run until its context is done, so
+	// it must outlive the test.
+	controllerCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	orchestrator := &K8sOrchestrator{clusterFlavor: cnstypes.CnsClusterFlavorWorkload}
+	for i := 0; i < 2; i++ {
+		topologyService, err := orchestrator.InitTopologyServiceInController(controllerCtx)
+		if err != nil {
+			t.Fatalf("failed to initialize the topology service. Error: %+v", err)
+		}
+		if topologyService == nil || !topologyService.WaitForSync(controllerCtx) {
+			t.Fatalf("expected the topology service to be initialized and synced")
+		}
+		informerDone := wcpControllerVolumeTopologyInstance.informerDone
+
+		orchestrator.ResetTopologyServiceInController(controllerCtx)
+		select {
+		case <-informerDone:
+		case <-time.After(10 * time.Second):
+			t.Fatal("informer goroutine did not exit after the topology service was reset")
+		}
+		controllerVolumeTopologyInstanceLock.RLock()
+		if wcpControllerVolumeTopologyInstance != nil {
+			t.Errorf("expected wcpControllerVolumeTopologyInstance to be cleared")
+		}
+		controllerVolumeTopologyInstanceLock.RUnlock()
+	}
+}
+
+// TestGetCSINodeTopologyWatchTimeoutInMin verifies that the watch timeout can
+// be raised up to the configured maximum, and that the default is used for
+// values beyond it.
+func TestGetCSINodeTopologyWatchTimeoutInMin(t *testing.T) {
+	tests := []struct {
+		timeout         string
+		maxTimeout      string
+		expectedTimeout int
+	}{
+		{timeout: "", maxTimeout: "", expectedTimeout: defaultTimeoutInMin},
+		{timeout: "2", maxTimeout: "", expectedTimeout: 2},
+		{timeout: "5", maxTimeout: "", expectedTimeout: defaultTimeoutInMin},
+		{timeout: "5", maxTimeout: "10", expectedTimeout: 5},
+		{timeout: "10", maxTimeout: "10", expectedTimeout: 10},
+		{timeout: "11", maxTimeout: "10", expectedTimeout: defaultTimeoutInMin},
+		{timeout: "5", maxTimeout: "11", expectedTimeout: defaultTimeoutInMin},
+		{timeout: "5", maxTimeout: "invalid", expectedTimeout: defaultTimeoutInMin},
+		{timeout: "0", maxTimeout: "10", expectedTimeout: defaultTimeoutInMin},
+		{timeout: "invalid", maxTimeout: "10", expectedTimeout: defaultTimeoutInMin},
+	}
+	for _, test := range tests {
+		t.Run(test.timeout+"/"+test.maxTimeout, func(t *testing.T) {
+			t.Setenv("NODEGETINFO_WATCH_TIMEOUT_MINUTES", test.timeout)
+			t.Setenv("NODEGETINFO_WATCH_MAX_TIMEOUT_MINUTES", test.maxTimeout)
+			if timeout := getCSINodeTopologyWatchTimeoutInMin(ctx); timeout != test.expectedTimeout {
+				t.Errorf("timeout %q, max timeout %q: expected %d but got %d", test.timeout, test.maxTimeout,
+					test.expectedTimeout, timeout)
+			}
+		})
+	}
+}
+
+// TestRefreshAllNodeTopologyLabels verifies that RefreshAllNodeTopologyLabels
+// requests a refresh of every CSINodeTopology instance and reports the labels
+// of the refreshed nodes along with an error for the nodes that failed.
+func TestRefreshAllNodeTopologyLabels(t *testing.T) {
+	instances := []csinodetopologyv1alpha1.CSINodeTopology{
+		newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+			map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"}),
+		newCSINodeTopology("node2", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+			map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-b"}),
+		newCSINodeTopology("node3", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+			map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-c"}),
+	}
+	// Instances as they are expected to be after being reconciled again.
+	reconciled := map[string]csinodetopologyv1alpha1.CSINodeTopology{
+		"node1": newCSINodeTopology("node1", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+			map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-d"}),
+		"node2": newCSINodeTopology("node2", csinodetopologyv1alpha1.CSINodeTopologySuccess,
+			map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-b"}),
+		"node3": newCSINodeTopology("node3", csinodetopologyv1alpha1.CSINodeTopologyError, nil),
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(csinodetopologyv1alpha1.SchemeGroupVersion, &csinodetopologyv1alpha1.CSINodeTopology{},
+		&csinodetopologyv1alpha1.CSINodeTopologyList{})
+	objs := make([]runtime.Object, 0, len(instances))
+	for i := range instances {
+		objs = append(objs, &instances[i])
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(objs...).Build()
+	volTopology := &nodeVolumeTopology{
+		csiNodeTopologyK8sClient: fakeClient,
+		csiNodeTopologyWatcher: &cache.ListWatch{
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				selector, err := fields.ParseSelector(options.FieldSelector)
+				if err != nil {
+					return nil, err
+				}
+				nodeName, _ := selector.RequiresExactMatch("metadata.name")
+				instance, ok := reconciled[nodeName]
+				if !ok {
+					return nil, fmt.Errorf("unexpected watch on %q", nodeName)
+				}
+				watcher := watch.NewFakeWithChanSize(1, false)
+				watcher.Modify(&instance)
+				return watcher, nil
+			},
+		},
+	}
+
+	nodeTopologyLabels, err := volTopology.RefreshAllNodeTopologyLabels(ctx)
+	if err == nil {
+		t.Errorf("expected an error for node3 but got none")
+	}
+	expected := map[string]map[string]string{
+		"node1": {"topology.csi.vmware.com/k8s-zone": "zone-d"},
+		"node2": {"topology.csi.vmware.com/k8s-zone": "zone-b"},
+	}
+	if !reflect.DeepEqual(nodeTopologyLabels, expected) {
+		t.Errorf("expected topology labels %+v but got %+v", expected, nodeTopologyLabels)
+	}
+	for _, instance := range instances {
+		refreshed := &csinodetopologyv1alpha1.CSINodeTopology{}
+		if err := fakeClient.Get(ctx, types.NamespacedName{Name: instance.Name}, refreshed); err != nil {
+			t.Fatalf("failed to get CSINodeTopology instance %q. Error: %+v", instance.Name, err)
+		}
+		if refreshed.Annotations[csinodetopologyv1alpha1.RefreshTopologyLabelsAnnotation] == "" {
+			t.Errorf("expected refresh annotation to be set on %q", instance.Name)
+		}
+		if refreshed.Status.Status != "" {
+			t.Errorf("expected status of %q to be reset but got %q", instance.Name, refreshed.Status.Status)
+		}
+	}
+}
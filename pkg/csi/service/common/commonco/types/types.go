@@ -39,6 +39,9 @@ type VanillaTopologyFetchDSParams struct {
 	// TopologyRequirement represents the topology conditions
 	// which need to be satisfied during volume provisioning.
 	TopologyRequirement *csi.TopologyRequirement
+	// TopologyPath, if not nil, is set to the path which yielded
+	// the shared datastores i.e preferred or requisite-fallback.
+	TopologyPath *string
 }
 
 // WCPTopologyFetchDSParams represents the params required to call
@@ -50,6 +53,9 @@ type WCPTopologyFetchDSParams struct {
 	// Vc is the vcenter instance using which the potential
 	// datastores will be calculated.
 	Vc *cnsvsphere.VirtualCenter
+	// VolumeSizeMB is the size of the volume to be provisioned. It is
+	// used to skip preferred topology segments which cannot host it.
+	VolumeSizeMB int64
 }
 
 // VanillaRetrieveTopologyInfoParams represents the params
@@ -79,6 +85,9 @@ type WCPRetrieveTopologyInfoParams struct {
 	// Vc is the vcenter instance using which the potential
 	// datastores will be calculated.
 	Vc *cnsvsphere.VirtualCenter
+	// TopologyPath, if not nil, is set to the path which yielded
+	// the topology i.e zonal-single or zonal-preferred.
+	TopologyPath *string
 }
 
 // ControllerTopologyService is an interface which exposes functionality
@@ -91,6 +100,18 @@ type ControllerTopologyService interface {
 	// GetTopologyInfoFromNodes retrieves the topology information of the nodes after the datastore has been
 	// selected for volume provisioning.
 	GetTopologyInfoFromNodes(ctx context.Context, retrieveTopologyInfoParams interface{}) ([]map[string]string, error)
+	// GetZonesForCluster returns the zones the given cluster belongs to.
+	GetZonesForCluster(ctx context.Context, clusterMoref string) []string
+	// HasSynced returns true if the informers backing the topology service have
+	// completed their initial sync.
+	HasSynced() bool
+	// WaitForSync waits for a bounded duration for the informers backing the
+	// topology service to complete their initial sync, and returns whether they
+	// did.
+	WaitForSync(ctx context.Context) bool
+	// SetDrainingTopologyValues replaces the topology values, i.e. tags or
+	// zones, excluded from new volume placements.
+	SetDrainingTopologyValues(ctx context.Context, values []string)
 }
 
 // NodeTopologyService is an interface which exposes functionality related to
@@ -98,4 +119,7 @@ type ControllerTopologyService interface {
 type NodeTopologyService interface {
 	// GetNodeTopologyLabels fetches the topology labels of a NodeVM given the NodeInfo.
 	GetNodeTopologyLabels(ctx context.Context, info *NodeInfo) (map[string]string, error)
+	// RefreshAllNodeTopologyLabels re-computes the topology labels of all the nodes
+	// and returns them keyed by node name.
+	RefreshAllNodeTopologyLabels(ctx context.Context) (map[string]map[string]string, error)
 }
@@ -18,11 +18,15 @@ package commonco
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
 	"strings"
+	"sync"
 
 	cnstypes "github.com/vmware/govmomi/cns/types"
 
 	csiconfig "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common/commonco/k8sorchestrator"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/logger"
 )
@@ -101,3 +105,67 @@ func SetInitParams(ctx context.Context, clusterFlavor cnstypes.CnsClusterFlavor,
 	}
 	log.Debugf("Container orchestrator init params: %+v", *initParams)
 }
+
+// registerFeatureStatesHandlerOnce ensures the feature states debug endpoint is
+// registered only once.
+var registerFeatureStatesHandlerOnce sync.Once
+
+// featureStateSwitches are the feature state switches whose evaluation is
+// reported by the /debug/feature-states endpoint.
+var featureStateSwitches = []string{
+	common.VolumeHealth,
+	common.VolumeExtend,
+	common.OnlineVolumeExtend,
+	common.CSIMigration,
+	common.CSIAuthCheck,
+	common.AsyncQueryVolume,
+	common.CSISVFeatureStateReplication,
+	common.VSANDirectDiskDecommission,
+	common.FileVolume,
+	common.FakeAttach,
+	common.TriggerCsiFullSync,
+	common.CSIVolumeManagerIdempotency,
+	common.ImprovedVolumeTopology,
+	common.BlockVolumeSnapshot,
+	common.SiblingReplicaBoundPvcCheck,
+	common.CSIWindowsSupport,
+	common.UseCSINodeId,
+	common.TKGsHA,
+	common.ListVolumes,
+	common.PVtoBackingDiskObjectIdMapping,
+	common.CnsMgrSuspendCreateVolume,
+	common.StrictPreferredTopology,
+	common.CapacityTracking,
+}
+
+// GetFeatureStates returns the current evaluation of the feature state
+// switches by the container orchestrator, keyed by feature name.
+func GetFeatureStates(ctx context.Context) map[string]bool {
+	featureStates := make(map[string]bool, len(featureStateSwitches))
+	for _, featureName := range featureStateSwitches {
+		featureStates[featureName] = ContainerOrchestratorUtility.IsFSSEnabled(ctx, featureName)
+	}
+	return featureStates
+}
+
+// RegisterFeatureStatesHandler registers the endpoint used to report the
+// feature state switches on the debug server of the controller.
+func RegisterFeatureStatesHandler(ctx context.Context) {
+	registerFeatureStatesHandlerOnce.Do(func() {
+		common.RegisterDebugHandler(ctx, "/debug/feature-states", FeatureStatesHandler)
+	})
+}
+
+// FeatureStatesHandler serves the /debug/feature-states endpoint. GET returns
+// the current evaluation of the feature state switches as JSON.
+func FeatureStatesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, log := logger.GetNewContextWithLogger()
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(GetFeatureStates(ctx)); err != nil {
+		log.Errorf("failed to write feature states. Error: %+v", err)
+	}
+}
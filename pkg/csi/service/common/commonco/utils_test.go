@@ -0,0 +1,82 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commonco
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common"
+)
+
+// fakeFSSOrchestrator is a COCommonInterface which only implements the
+// evaluation of the feature state switches.
+type fakeFSSOrchestrator struct {
+	COCommonInterface
+	featureStates map[string]bool
+}
+
+func (c *fakeFSSOrchestrator) IsFSSEnabled(ctx context.Context, featureName string) bool {
+	return c.featureStates[featureName]
+}
+
+// TestFeatureStatesHandler verifies that the feature states endpoint reports
+// the feature state switches as evaluated by the container orchestrator.
+func TestFeatureStatesHandler(t *testing.T) {
+	origCO := ContainerOrchestratorUtility
+	defer func() {
+		ContainerOrchestratorUtility = origCO
+	}()
+	ContainerOrchestratorUtility = &fakeFSSOrchestrator{
+		featureStates: map[string]bool{common.TKGsHA: true, common.FakeAttach: false},
+	}
+
+	recorder := httptest.NewRecorder()
+	FeatureStatesHandler(recorder, httptest.NewRequest(http.MethodGet, "/debug/feature-states", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d with body %q", http.StatusOK, recorder.Code,
+			recorder.Body.String())
+	}
+	var featureStates map[string]bool
+	if err := json.Unmarshal(recorder.Body.Bytes(), &featureStates); err != nil {
+		t.Fatalf("failed to decode feature states %q. err: %v", recorder.Body.String(), err)
+	}
+	expectedFeatureStates := map[string]bool{common.TKGsHA: true, common.FakeAttach: false}
+	for featureName, expected := range expectedFeatureStates {
+		if enabled, ok := featureStates[featureName]; !ok || enabled != expected {
+			t.Errorf("expected feature %q to be reported as %t but got %+v", featureName, expected,
+				featureStates)
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	FeatureStatesHandler(recorder, httptest.NewRequest(http.MethodPost, "/debug/feature-states", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for POST but got %d", http.StatusMethodNotAllowed, recorder.Code)
+	}
+}
+
+// TestRegisterFeatureStatesHandler verifies that the feature states endpoint
+// can be registered more than once without panicking.
+func TestRegisterFeatureStatesHandler(t *testing.T) {
+	ctx := context.Background()
+	RegisterFeatureStatesHandler(ctx)
+	RegisterFeatureStatesHandler(ctx)
+}
@@ -60,6 +60,92 @@ const (
 	// For example: StorageTopologyType: "zonal"
 	AttributeStorageTopologyType = "storagetopologytype"
 
+	// TopologyTypeZonal is the storageTopologyType value to provision a volume
+	// accessible from a single zone.
+	TopologyTypeZonal = "zonal"
+
+	// TopologyTypeCrossZonal is the storageTopologyType value to provision a
+	// volume accessible from multiple zones.
+	TopologyTypeCrossZonal = "crosszonal"
+
+	// AttributeTopology represents the StorageClass parameter to provision
+	// volumes without zone affinity on a TKGsHA enabled supervisor cluster
+	// when set to TopologyDisabled. For Example: Topology: "disabled".
+	AttributeTopology = "topology"
+
+	// TopologyDisabled is the AttributeTopology value which provisions the
+	// volume on cluster-wide candidate datastores without any zone affinity.
+	TopologyDisabled = "disabled"
+
+	// AttributeTopologyPath is the volume context attribute recording the path
+	// which produced the accessible topology of the volume. Its value is one of
+	// the TopologyPath* values.
+	AttributeTopologyPath = "topologypath"
+
+	// TopologyPathPreferred indicates that the volume was placed using the
+	// preferred topology requirement.
+	TopologyPathPreferred = "preferred"
+
+	// TopologyPathRequisiteFallback indicates that the volume was placed using
+	// the requisite topology requirement as the preferred topology requirement
+	// did not yield any datastore.
+	TopologyPathRequisiteFallback = "requisite-fallback"
+
+	// TopologyPathZonalSingle indicates that the zone of a zonal volume was the
+	// only zone requested or the only requested zone of the selected datastore.
+	TopologyPathZonalSingle = "zonal-single"
+
+	// TopologyPathZonalPreferred indicates that the zone of a zonal volume was
+	// the most preferred among the requested zones of the selected datastore.
+	TopologyPathZonalPreferred = "zonal-preferred"
+
+	// TopologyPathHostname indicates that the accessible topology of the volume
+	// was derived from the hostname of the nodes it is accessible from.
+	TopologyPathHostname = "hostname"
+
+	// DatastoreFilterTopology indicates that a datastore was excluded from
+	// volume placement as it is not accessible from the requested topology.
+	DatastoreFilterTopology = "topology"
+
+	// DatastoreFilterSuspended indicates that a candidate datastore was
+	// excluded from volume placement as volume creation is suspended on it.
+	DatastoreFilterSuspended = "suspended"
+
+	// DatastoreFilterAuthCheck indicates that a candidate datastore was
+	// excluded from volume placement as the CSI user lacks privileges on it.
+	DatastoreFilterAuthCheck = "auth-check"
+
+	// DatastoreFilterCapacityThreshold indicates that a candidate datastore was
+	// excluded from volume placement as its free space is below the reserved
+	// capacity.
+	DatastoreFilterCapacityThreshold = "capacity-threshold"
+
+	// DatastoreFilterDatastoreCluster indicates that a candidate datastore was
+	// excluded from volume placement as it is not a member of the requested
+	// datastore cluster.
+	DatastoreFilterDatastoreCluster = "datastore-cluster"
+
+	// DatastoreFilterAllowList indicates that a candidate datastore was
+	// excluded from volume placement as it is not in the datastore allow list.
+	DatastoreFilterAllowList = "allow-list"
+
+	// DatastoreFilterDenyList indicates that a candidate datastore was
+	// excluded from volume placement as it is in the datastore deny list.
+	DatastoreFilterDenyList = "deny-list"
+
+	// AttributeSelectedDatastoreURL is the volume context attribute recording
+	// the URL of the datastore selected by CNS for a topology aware volume.
+	AttributeSelectedDatastoreURL = "selectedDatastoreURL"
+
+	// AttributeSelectedDatastoreEstimated is the volume context attribute set
+	// to "true" when the selected datastore is an estimate of the datastore CNS
+	// would choose, e.g. for a dry-run CreateVolume call.
+	AttributeSelectedDatastoreEstimated = "selectedDatastoreEstimated"
+
+	// AttributeSelectedZones is the volume context attribute recording the
+	// comma separated zones the selected datastore of a volume resolved to.
+	AttributeSelectedZones = "selectedZones"
+
 	// AttributeFsType represents filesystem type in the Storage Classs.
 	// For Example: FsType: "ext4".
 	AttributeFsType = "fstype"
@@ -68,10 +154,54 @@ const (
 	// the PVC. For example: StoragePool: "storagepool-vsandatastore".
 	AttributeStoragePool = "storagepool"
 
+	// AttributeDatastoreClusterMoid represents the moid of the Storage DRS
+	// datastore cluster on which to place the PVC.
+	AttributeDatastoreClusterMoid = "datastoreclustermoid"
+
+	// AttributeIgnoreSuspendedDatastores represents the StorageClass parameter
+	// to place the PVC on datastores flagged as suspended for volume creation.
+	// It is meant for emergency provisioning only.
+	AttributeIgnoreSuspendedDatastores = "ignoresuspendeddatastores"
+
+	// AttributeDatastoreAllowList represents the StorageClass parameter with
+	// the comma separated URLs of the only datastores to place the PVC on.
+	AttributeDatastoreAllowList = "datastoreallowlist"
+
+	// AttributeDatastoreDenyList represents the StorageClass parameter with
+	// the comma separated URLs of the datastores to never place the PVC on.
+	AttributeDatastoreDenyList = "datastoredenylist"
+
+	// AttributeDatastoreAffinity represents the StorageClass parameter to bias
+	// datastore selection for PVCs of the same StatefulSet. Supported values
+	// are DatastoreAffinitySpread and DatastoreAffinityColocate.
+	AttributeDatastoreAffinity = "datastoreaffinity"
+
+	// DatastoreAffinitySpread makes PVCs of the same StatefulSet prefer
+	// different candidate datastores.
+	DatastoreAffinitySpread = "spread"
+
+	// DatastoreAffinityColocate makes PVCs of the same StatefulSet prefer the
+	// same candidate datastore.
+	DatastoreAffinityColocate = "colocate"
+
+	// AttributePVCName is the parameter holding the PVC name, passed by the
+	// external-provisioner when run with --extra-create-metadata.
+	AttributePVCName = "csi.storage.k8s.io/pvc/name"
+
+	// AttributePVCNamespace is the parameter holding the PVC namespace, passed by
+	// the external-provisioner when run with --extra-create-metadata.
+	AttributePVCNamespace = "csi.storage.k8s.io/pvc/namespace"
+
 	// AttributeHostLocal represents the presence of HostLocal functionality in
 	// the given storage policy. For Example: HostLocal: "True".
 	AttributeHostLocal = "hostlocal"
 
+	// AttributeDryRun is the parameter which, when set to "true", resolves the
+	// placement of a block volume without creating it. The response has an
+	// empty volume ID, the resolved accessible topology and the selected
+	// datastore in the volume context, which also carries this attribute.
+	AttributeDryRun = "csi.vsphere.volume/dry-run"
+
 	// HostMoidAnnotationKey represents the Node annotation key that has the value
 	// of VC's ESX host moid of this node.
 	HostMoidAnnotationKey = "vmware-system-esxi-node-moid"
@@ -92,6 +222,10 @@ const (
 	// Example: vsphere://4201794a-f26b-8914-d95a-edeb7ecc4a8f
 	ProviderPrefix = "vsphere://"
 
+	// AttributeCnsTaskID is the volume context attribute holding the moid of the
+	// CNS task which created the volume.
+	AttributeCnsTaskID = "cnstaskid"
+
 	// AttributeFirstClassDiskUUID is the SCSI Disk Identifier.
 	AttributeFirstClassDiskUUID = "diskUUID"
 
@@ -286,6 +420,20 @@ const (
 	// PVtoBackingDiskObjectIdSupportedVCenterPatch is the minimum patch version of vCenter
 	// on which PV to BackingDiskObjectId mapping feature is supported.
 	PVtoBackingDiskObjectIdSupportedVCenterPatch int = 2
+
+	// RetryAfterMetadataKey is the gRPC trailer metadata key used to suggest the
+	// number of seconds to wait before retrying a failed request.
+	RetryAfterMetadataKey = "retry-after"
+
+	// DefaultRetryAfterIntervalInSec is the number of seconds suggested in the
+	// retry-after hint on retryable errors.
+	DefaultRetryAfterIntervalInSec = 10
+
+	// MaxAllowedBlockVolumesPerNode is the default and the highest limit which
+	// can be set using the MAX_VOLUMES_PER_NODE env variable. ESXi allows 4
+	// PVSCSI controllers with 15 disks each on a VM and one of those slots is
+	// taken by the boot disk.
+	MaxAllowedBlockVolumesPerNode = 59
 )
 
 // Supported container orchestrators.
@@ -351,4 +499,10 @@ const (
 	PVtoBackingDiskObjectIdMapping = "pv-to-backingdiskobjectid-mapping"
 	// Block Create Volume for datastores that are in suspended mode
 	CnsMgrSuspendCreateVolume = "cnsmgr-suspend-create-volume"
+	// StrictPreferredTopology is the feature to disable the fallback to requisite
+	// topology when no shared datastores are found for the preferred topology.
+	StrictPreferredTopology = "strict-preferred-topology"
+	// CapacityTracking is the feature to report the available capacity of the
+	// datastores to the container orchestrator through GetCapacity.
+	CapacityTracking = "capacity-tracking"
 )
@@ -0,0 +1,96 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/logger"
+)
+
+const (
+	// EnvDebugServerAddress is the environment variable holding the address,
+	// e.g. "127.0.0.1:2115", of the debug server. The debug server is only
+	// started if this variable is set.
+	EnvDebugServerAddress = "CSI_DEBUG_SERVER_ADDRESS"
+	// EnvDebugServerToken is the environment variable holding the bearer token
+	// required by the debug endpoints which change the state of the driver.
+	// Such requests are refused if this variable is not set.
+	EnvDebugServerToken = "CSI_DEBUG_SERVER_TOKEN"
+	// debugServerRestartInterval is the time to wait before restarting the
+	// debug server after it exits.
+	debugServerRestartInterval = 10 * time.Second
+)
+
+var (
+	// debugServerMux serves the /debug endpoints of the controller. It is
+	// separate from the mux serving the Prometheus metrics, so that the debug
+	// endpoints are not exposed on the metrics port.
+	debugServerMux = http.NewServeMux()
+	// startDebugServerOnce ensures the debug server is started only once.
+	startDebugServerOnce sync.Once
+)
+
+// RegisterDebugHandler registers the handler for the given debug endpoint on
+// the debug server. Like http.HandleFunc, it panics if the endpoint is already
+// registered, so callers register their endpoints only once.
+func RegisterDebugHandler(ctx context.Context, pattern string, handler http.HandlerFunc) {
+	log := logger.GetLogger(ctx)
+	debugServerMux.HandleFunc(pattern, handler)
+	log.Infof("Registered the %s debug endpoint", pattern)
+}
+
+// IsAuthorizedDebugRequest checks whether the given request to a debug
+// endpoint carries the bearer token set in the CSI_DEBUG_SERVER_TOKEN
+// environment variable. Debug endpoints which change the state of the driver
+// serve only authorized requests.
+func IsAuthorizedDebugRequest(r *http.Request) bool {
+	token := os.Getenv(EnvDebugServerToken)
+	if token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) == 1
+}
+
+// StartDebugServer starts serving the registered debug endpoints on the
+// address set in the CSI_DEBUG_SERVER_ADDRESS environment variable. The debug
+// server is opt-in and is not started if the variable is not set. It is
+// started at most once.
+func StartDebugServer(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	address := os.Getenv(EnvDebugServerAddress)
+	if address == "" {
+		log.Infof("Debug server is disabled as %s is not set", EnvDebugServerAddress)
+		return
+	}
+	startDebugServerOnce.Do(func() {
+		go func() {
+			for {
+				log.Infof("Starting the debug server on %q", address)
+				err := http.ListenAndServe(address, debugServerMux)
+				log.Warnf("Debug server exited with err: %+v. Restarting it in %v.", err,
+					debugServerRestartInterval)
+				time.Sleep(debugServerRestartInterval)
+			}
+		}()
+	})
+}
@@ -52,6 +52,10 @@ var (
 
 	// ErrNotFound represents not found error
 	ErrNotFound = errors.New("not found")
+
+	// ErrVolumeShrinkNotSupported represents the error returned when the
+	// requested size of a volume is smaller than its current size.
+	ErrVolumeShrinkNotSupported = errors.New("volume shrink is not supported")
 )
 
 // Manager type comprises VirtualCenterConfig, CnsConfig, VolumeManager and VirtualCenterManager
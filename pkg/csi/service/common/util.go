@@ -20,8 +20,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	cnstypes "github.com/vmware/govmomi/cns/types"
@@ -43,10 +45,31 @@ import (
 
 const (
 	defaultK8sCloudOperatorServicePort = 10000
+	// vcConnectRetryInterval is the interval between attempts to connect to
+	// vCenter at startup.
+	vcConnectRetryInterval = 5 * time.Second
 )
 
 var ErrAvailabilityZoneCRNotRegistered = errors.New("AvailabilityZone custom resource not registered")
 
+// ErrZoneNotMapped is returned by the topology service when a zone in a
+// topology requirement cannot be resolved to a cluster.
+var ErrZoneNotMapped = errors.New("zone is not mapped to a cluster")
+
+// ErrNoMatchingNodes is returned by the topology service when no node matches
+// a topology segment of a topology requirement.
+var ErrNoMatchingNodes = errors.New("no nodes match the topology segment")
+
+// ErrTopologyNotSynced is returned by the topology service when a topology
+// requirement is resolved before its informers have completed their initial
+// sync.
+var ErrTopologyNotSynced = errors.New("topology informers have not synced")
+
+// ErrTooManyTopologySegments is returned by the topology service when a
+// topology requirement has more distinct topology segments than can be
+// processed and they cannot be truncated.
+var ErrTooManyTopologySegments = errors.New("too many topology segments")
+
 // GetVCenter returns VirtualCenter object from specified Manager object.
 // Before returning VirtualCenter object, vcenter connection is established if
 // session doesn't exist.
@@ -66,6 +89,161 @@ func GetVCenter(ctx context.Context, manager *Manager) (*cnsvsphere.VirtualCente
 	return vcenter, nil
 }
 
+// GetVCenterWithTimeout connects to the vCenter in the given manager, bounding
+// each attempt by timeout and retrying up to maxAttempts times. This is used
+// at startup so that an unreachable vCenter results in a clear error instead
+// of blocking the driver indefinitely.
+func GetVCenterWithTimeout(ctx context.Context, manager *Manager, timeout time.Duration,
+	maxAttempts int) (*cnsvsphere.VirtualCenter, error) {
+	log := logger.GetLogger(ctx)
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var vcenter *cnsvsphere.VirtualCenter
+		connectCtx, cancel := context.WithTimeout(ctx, timeout)
+		vcenter, err = GetVCenter(connectCtx, manager)
+		cancel()
+		if err == nil {
+			return vcenter, nil
+		}
+		log.Warnf("attempt %d/%d to connect to VirtualCenter host: %q within %v failed. err=%v",
+			attempt, maxAttempts, manager.VcenterConfig.Host, timeout, err)
+		if attempt < maxAttempts {
+			time.Sleep(vcConnectRetryInterval)
+		}
+	}
+	return nil, logger.LogNewErrorf(log, "failed to connect to VirtualCenter host: %q after %d attempts "+
+		"of %v each. err=%v", manager.VcenterConfig.Host, maxAttempts, timeout, err)
+}
+
+// RetryBackoff holds the parameters of the exponential backoff between
+// attempts of an operation retried by RetryWithBackoff.
+type RetryBackoff struct {
+	// InitialInterval is the wait after the first failed attempt.
+	InitialInterval time.Duration
+	// Multiplier is the factor by which the wait grows after each failed attempt.
+	Multiplier int
+	// MaxInterval caps the wait between attempts.
+	MaxInterval time.Duration
+}
+
+// GetReloadConfigBackoff returns the backoff between attempts to reload the
+// configuration as per the given config. The defaults of unset values are set
+// when the config is validated on load.
+func GetReloadConfigBackoff(cfg *cnsconfig.Config) RetryBackoff {
+	return RetryBackoff{
+		InitialInterval: time.Duration(cfg.Global.ReloadConfigRetryInitialIntervalInSec) * time.Second,
+		Multiplier:      cfg.Global.ReloadConfigRetryMultiplier,
+		MaxInterval:     time.Duration(cfg.Global.ReloadConfigRetryMaxIntervalInSec) * time.Second,
+	}
+}
+
+// retrySleep waits between the attempts of RetryWithBackoff. Tests replace it
+// to record the waits instead of sleeping.
+var retrySleep = time.Sleep
+
+// RetryWithBackoff calls fn until it succeeds, waiting between attempts as per
+// the given backoff. onFailure, if not nil, is called with the error of every
+// failed attempt and the wait before the next attempt.
+func RetryWithBackoff(backoff RetryBackoff, fn func() error, onFailure func(err error, wait time.Duration)) {
+	wait := backoff.InitialInterval
+	for {
+		err := fn()
+		if err == nil {
+			return
+		}
+		if onFailure != nil {
+			onFailure(err, wait)
+		}
+		retrySleep(wait)
+		wait *= time.Duration(backoff.Multiplier)
+		if wait > backoff.MaxInterval {
+			wait = backoff.MaxInterval
+		}
+	}
+}
+
+// GetDefaultFileVolumeSizeInBytes returns the size in bytes of file volumes
+// created without a requested capacity, as per the given config.
+func GetDefaultFileVolumeSizeInBytes(cfg *cnsconfig.Config) int64 {
+	if cfg == nil || cfg.Global.DefaultFileVolumeSizeInGB <= 0 {
+		return DefaultGbDiskSize * GbInBytes
+	}
+	return int64(cfg.Global.DefaultFileVolumeSizeInGB) * GbInBytes
+}
+
+// GetPrometheusMetricsAddress returns the address on which the Prometheus
+// metrics http server listens. The port is read from environment variable
+// CSI_METRICS_PORT or else from the given config. The default port is used
+// when neither has a value in the range [1, 65535].
+func GetPrometheusMetricsAddress(ctx context.Context, cfg *cnsconfig.Config) string {
+	log := logger.GetLogger(ctx)
+	port := cnsconfig.DefaultPrometheusMetricsPort
+	if v := os.Getenv("CSI_METRICS_PORT"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value >= 1 && value <= 65535 {
+			port = value
+		} else {
+			log.Warnf("Port set in env variable CSI_METRICS_PORT %q is invalid, using the default port %d",
+				v, port)
+		}
+	} else if cfg != nil && cfg.Global.PrometheusMetricsPort != 0 {
+		if cfg.Global.PrometheusMetricsPort >= 1 && cfg.Global.PrometheusMetricsPort <= 65535 {
+			port = cfg.Global.PrometheusMetricsPort
+		} else {
+			log.Warnf("Port set in config prometheus-metrics-port %d is invalid, using the default port %d",
+				cfg.Global.PrometheusMetricsPort, port)
+		}
+	}
+	log.Infof("Prometheus metrics will be exposed on port %d", port)
+	return fmt.Sprintf(":%d", port)
+}
+
+// GetMaxVolumesPerNode returns the maximum number of volumes that can be
+// attached to a node, reported to the CO in NodeGetInfo.
+// If environment variable MAX_VOLUMES_PER_NODE is set to a positive integer
+// not more than MaxAllowedBlockVolumesPerNode, return the value read from
+// environment variable. Otherwise, return MaxAllowedBlockVolumesPerNode, the
+// limit derived from the number of disks ESXi allows on a VM.
+func GetMaxVolumesPerNode(ctx context.Context) int64 {
+	log := logger.GetLogger(ctx)
+	maxVolumesPerNode := int64(MaxAllowedBlockVolumesPerNode)
+	if v := os.Getenv("MAX_VOLUMES_PER_NODE"); v != "" {
+		if value, err := strconv.ParseInt(v, 10, 64); err == nil {
+			if value < 1 || value > MaxAllowedBlockVolumesPerNode {
+				log.Warnf("Limit set in env variable MAX_VOLUMES_PER_NODE %q is not in the range [1, %d], "+
+					"using the default limit %d", v, MaxAllowedBlockVolumesPerNode, maxVolumesPerNode)
+			} else {
+				maxVolumesPerNode = value
+			}
+		} else {
+			log.Warnf("Limit set in env variable MAX_VOLUMES_PER_NODE %q is not a positive integer, "+
+				"using the default limit %d", v, maxVolumesPerNode)
+		}
+	}
+	log.Infof("Max volumes per node is set to %d", maxVolumesPerNode)
+	return maxVolumesPerNode
+}
+
+// SortAccessibleTopology sorts the given accessible topologies in place by
+// their segments, so that the topologies of a volume are reported in the same
+// order irrespective of the order in which they were computed.
+func SortAccessibleTopology(topologies []*csi.Topology) {
+	keys := make(map[*csi.Topology]string, len(topologies))
+	for _, topology := range topologies {
+		pairs := make([]string, 0, len(topology.GetSegments()))
+		for key, value := range topology.GetSegments() {
+			pairs = append(pairs, key+"="+value)
+		}
+		sort.Strings(pairs)
+		keys[topology] = strings.Join(pairs, ",")
+	}
+	sort.SliceStable(topologies, func(i, j int) bool {
+		return keys[topologies[i]] < keys[topologies[j]]
+	})
+}
+
 // GetUUIDFromProviderID Returns VM UUID from Node's providerID.
 func GetUUIDFromProviderID(providerID string) string {
 	return strings.TrimPrefix(providerID, ProviderPrefix)
@@ -243,6 +421,77 @@ func ParseStorageClassParams(ctx context.Context, params map[string]string,
 	return scParams, nil
 }
 
+// IsSuspendedDatastoreFilterOverridden returns true if the given
+// CreateVolume parameters request to bypass filtering of datastores flagged as
+// suspended for volume creation. A warning is logged when the filter is
+// bypassed.
+func IsSuspendedDatastoreFilterOverridden(ctx context.Context, params map[string]string) bool {
+	log := logger.GetLogger(ctx)
+	for paramName, value := range params {
+		if strings.ToLower(paramName) != AttributeIgnoreSuspendedDatastores {
+			continue
+		}
+		ignore, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Warnf("Ignoring invalid value %q for parameter %q", value, AttributeIgnoreSuspendedDatastores)
+			return false
+		}
+		if ignore {
+			log.Warnf("Parameter %q is set. Datastores flagged as suspended for volume creation will NOT "+
+				"be filtered out and may be selected to place the volume. This should only be used for "+
+				"emergency provisioning.", AttributeIgnoreSuspendedDatastores)
+		}
+		return ignore
+	}
+	return false
+}
+
+// GetDrainingTopologyValues returns the topology values being drained as per
+// the draining-topology-values entry of the Labels section in the config.
+func GetDrainingTopologyValues(cfg *cnsconfig.Config) []string {
+	var values []string
+	for _, value := range strings.Split(cfg.Labels.DrainingTopologyValues, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// ValidateStorageClassTopologyParams validates the topology related parameters
+// of a StorageClass without making any calls to vCenter. It returns an error if
+// storageTopologyType has an unsupported value or if conflicting parameters are
+// specified together. Parameter names are matched case insensitively.
+func ValidateStorageClassTopologyParams(params map[string]string) error {
+	lowerParams := make(map[string]string)
+	for paramName, value := range params {
+		lowerParams[strings.ToLower(paramName)] = value
+	}
+	if topologyType, exists := lowerParams[AttributeStorageTopologyType]; exists {
+		switch strings.ToLower(topologyType) {
+		case TopologyTypeZonal, TopologyTypeCrossZonal:
+		default:
+			return fmt.Errorf("invalid value %q for parameter %q. Supported values are %q and %q",
+				topologyType, AttributeStorageTopologyType, TopologyTypeZonal, TopologyTypeCrossZonal)
+		}
+	}
+	if _, exists := lowerParams[AttributeStoragePool]; exists {
+		for _, conflictingParam := range []string{AttributeDatastoreURL, AttributeDatastoreClusterMoid} {
+			if _, conflicts := lowerParams[conflictingParam]; conflicts {
+				return fmt.Errorf("parameters %q and %q cannot be specified together",
+					AttributeStoragePool, conflictingParam)
+			}
+		}
+	}
+	if _, exists := lowerParams[AttributeDatastoreURL]; exists {
+		if _, conflicts := lowerParams[AttributeDatastoreClusterMoid]; conflicts {
+			return fmt.Errorf("parameters %q and %q cannot be specified together",
+				AttributeDatastoreURL, AttributeDatastoreClusterMoid)
+		}
+	}
+	return nil
+}
+
 // GetConfigPath returns ConfigPath depending on the environment variable
 // specified and the cluster flavor set.
 func GetConfigPath(ctx context.Context) string {
@@ -350,6 +599,28 @@ func ConvertVolumeHealthStatus(ctx context.Context, volID string, volHealthStatu
 	}
 }
 
+// GetVolumeCondition returns the CSI VolumeCondition of a volume given its
+// health status on CNS. Volumes which are inaccessible are reported abnormal.
+func GetVolumeCondition(ctx context.Context, volumeID string, healthStatus string) *csi.VolumeCondition {
+	volHealthStatus, err := ConvertVolumeHealthStatus(ctx, volumeID, healthStatus)
+	if err != nil || volHealthStatus == string(pbmtypes.PbmHealthStatusForEntityUnknown) {
+		return &csi.VolumeCondition{
+			Abnormal: false,
+			Message:  "volume health status is unknown",
+		}
+	}
+	if volHealthStatus == VolHealthStatusInaccessible {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("volume is inaccessible. CNS health status: %q", healthStatus),
+		}
+	}
+	return &csi.VolumeCondition{
+		Abnormal: false,
+		Message:  "volume is accessible",
+	}
+}
+
 // ParseCSISnapshotID parses the SnapshotID from CSI RPC such as DeleteSnapshot, CreateVolume from snapshot
 // into a pair of CNS VolumeID and CNS SnapshotID.
 func ParseCSISnapshotID(csiSnapshotID string) (string, string, error) {
@@ -429,3 +700,43 @@ func GetClusterComputeResourceMoIds(ctx context.Context) ([]string, error) {
 	}
 	return clusterComputeResourceMoIds, nil
 }
+
+// GetDatastoresCapacity returns the total free space of the given datastores
+// and the free space of the largest one, which is the maximum size of a volume
+// that can be provisioned on them. If datastoreURL is not empty, only the
+// datastore with that URL is considered.
+func GetDatastoresCapacity(datastores []*cnsvsphere.DatastoreInfo, datastoreURL string) (int64, int64) {
+	var availableCapacity, maximumVolumeSize int64
+	for _, ds := range datastores {
+		if ds.Info == nil || (datastoreURL != "" && ds.Info.Url != datastoreURL) {
+			continue
+		}
+		availableCapacity += ds.Info.FreeSpace
+		if ds.Info.FreeSpace > maximumVolumeSize {
+			maximumVolumeSize = ds.Info.FreeSpace
+		}
+	}
+	return availableCapacity, maximumVolumeSize
+}
+
+// GetTopologyComputationContext returns a context which is done once the
+// remainder of the given topology computation timeout, after the elapsed
+// duration, runs out. The topology computation is not time limited if
+// timeout is not positive.
+func GetTopologyComputationContext(ctx context.Context, timeout time.Duration,
+	elapsed time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	remaining := timeout - elapsed
+	if remaining < 0 {
+		remaining = 0
+	}
+	return context.WithTimeout(ctx, remaining)
+}
+
+// IsTopologyComputationDeadlineExceeded returns true if the deadline of the
+// given topology computation context has been exceeded.
+func IsTopologyComputationDeadlineExceeded(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
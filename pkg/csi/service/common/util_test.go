@@ -20,12 +20,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/wait"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/vmware/govmomi/vim25/types"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/vsphere"
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/config"
 )
 
 var (
@@ -444,3 +454,217 @@ func TestParseCSISnapshotID(t *testing.T) {
 		})
 	}
 }
+
+func TestGetDrainingTopologyValues(t *testing.T) {
+	cfg := &cnsconfig.Config{}
+	assert.Empty(t, GetDrainingTopologyValues(cfg))
+	cfg.Labels.DrainingTopologyValues = " zone-a,,zone-b "
+	assert.Equal(t, []string{"zone-a", "zone-b"}, GetDrainingTopologyValues(cfg))
+}
+
+func TestValidateStorageClassTopologyParams(t *testing.T) {
+	validParams := []map[string]string{
+		{},
+		{"storageTopologyType": "Zonal"},
+		{AttributeStorageTopologyType: TopologyTypeCrossZonal, AttributeStoragePolicyID: "policy"},
+		{AttributeStoragePool: "sp1"},
+		{AttributeStoragePool: "sp1", "storageTopologyType": TopologyTypeZonal},
+	}
+	for _, params := range validParams {
+		assert.NoError(t, ValidateStorageClassTopologyParams(params), "params: %v", params)
+	}
+	invalidParams := []map[string]string{
+		{AttributeStorageTopologyType: "regional"},
+		{AttributeStoragePool: "sp1", AttributeDatastoreURL: "ds:///vmfs/volumes/vsan:1/"},
+		{AttributeDatastoreURL: "ds:///vmfs/volumes/vsan:1/", AttributeDatastoreClusterMoid: "group-p1"},
+	}
+	for _, params := range invalidParams {
+		assert.Error(t, ValidateStorageClassTopologyParams(params), "params: %v", params)
+	}
+}
+
+func TestGetPrometheusMetricsAddress(t *testing.T) {
+	cfg := &cnsconfig.Config{}
+	cfg.Global.PrometheusMetricsPort = 9090
+	tests := []struct {
+		envPort         string
+		expectedAddress string
+	}{
+		{envPort: "", expectedAddress: ":9090"},
+		{envPort: "9100", expectedAddress: ":9100"},
+		{envPort: "0", expectedAddress: ":2112"},
+		{envPort: "65536", expectedAddress: ":2112"},
+		{envPort: "invalid", expectedAddress: ":2112"},
+	}
+	for _, test := range tests {
+		t.Setenv("CSI_METRICS_PORT", test.envPort)
+		assert.Equal(t, test.expectedAddress, GetPrometheusMetricsAddress(ctx, cfg),
+			"unexpected address for CSI_METRICS_PORT %q", test.envPort)
+	}
+	t.Setenv("CSI_METRICS_PORT", "")
+	assert.Equal(t, ":2112", GetPrometheusMetricsAddress(ctx, &cnsconfig.Config{}))
+}
+
+// TestPrometheusMetricsServedOnConfiguredPort verifies that the Prometheus
+// metrics are served on the port set in CSI_METRICS_PORT.
+func TestPrometheusMetricsServedOnConfiguredPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	if err = listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CSI_METRICS_PORT", strconv.Itoa(port))
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Addr: GetPrometheusMetricsAddress(ctx, &cnsconfig.Config{}), Handler: mux}
+	go func() {
+		_ = server.ListenAndServe()
+	}()
+	defer server.Close()
+
+	var resp *http.Response
+	err = wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", port))
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("metrics are not served on port %d", port)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestGetMaxVolumesPerNode(t *testing.T) {
+	tests := []struct {
+		envLimit      string
+		expectedLimit int64
+	}{
+		{envLimit: "", expectedLimit: MaxAllowedBlockVolumesPerNode},
+		{envLimit: "1", expectedLimit: 1},
+		{envLimit: "30", expectedLimit: 30},
+		{envLimit: "59", expectedLimit: 59},
+		{envLimit: "0", expectedLimit: MaxAllowedBlockVolumesPerNode},
+		{envLimit: "-5", expectedLimit: MaxAllowedBlockVolumesPerNode},
+		{envLimit: "60", expectedLimit: MaxAllowedBlockVolumesPerNode},
+		{envLimit: "1.5", expectedLimit: MaxAllowedBlockVolumesPerNode},
+		{envLimit: "invalid", expectedLimit: MaxAllowedBlockVolumesPerNode},
+	}
+	for _, test := range tests {
+		t.Run(test.envLimit, func(t *testing.T) {
+			t.Setenv("MAX_VOLUMES_PER_NODE", test.envLimit)
+			assert.Equal(t, test.expectedLimit, GetMaxVolumesPerNode(ctx),
+				"unexpected limit for MAX_VOLUMES_PER_NODE %q", test.envLimit)
+		})
+	}
+}
+
+func TestSortAccessibleTopology(t *testing.T) {
+	zoneKey := "topology.kubernetes.io/zone"
+	regionKey := "topology.kubernetes.io/region"
+	topologies := []*csi.Topology{
+		{Segments: map[string]string{zoneKey: "zone-c"}},
+		{Segments: map[string]string{regionKey: "region-1", zoneKey: "zone-b"}},
+		{Segments: map[string]string{zoneKey: "zone-a"}},
+		{Segments: map[string]string{zoneKey: "zone-b"}},
+	}
+	SortAccessibleTopology(topologies)
+	expected := []map[string]string{
+		{regionKey: "region-1", zoneKey: "zone-b"},
+		{zoneKey: "zone-a"},
+		{zoneKey: "zone-b"},
+		{zoneKey: "zone-c"},
+	}
+	for i, topology := range topologies {
+		assert.Equal(t, expected[i], topology.GetSegments(), "unexpected segments at index %d", i)
+	}
+}
+
+// TestRetryWithBackoff verifies that the wait between attempts grows by the
+// multiplier and is capped at the maximum interval.
+func TestRetryWithBackoff(t *testing.T) {
+	var waits []time.Duration
+	retrySleep = func(wait time.Duration) { waits = append(waits, wait) }
+	defer func() { retrySleep = time.Sleep }()
+
+	attempts := 0
+	failures := 0
+	backoff := RetryBackoff{InitialInterval: time.Second, Multiplier: 2, MaxInterval: 5 * time.Second}
+	RetryWithBackoff(backoff, func() error {
+		attempts++
+		if attempts <= 5 {
+			return errors.New("vc unreachable")
+		}
+		return nil
+	}, func(err error, wait time.Duration) {
+		failures++
+	})
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	assert.Equal(t, 6, attempts)
+	assert.Equal(t, 5, failures)
+	assert.Equal(t, expected, waits)
+}
+
+// TestGetReloadConfigBackoff verifies that the reload backoff is read from
+// the config.
+func TestGetReloadConfigBackoff(t *testing.T) {
+	cfg := &cnsconfig.Config{}
+	cfg.Global.ReloadConfigRetryInitialIntervalInSec = 10
+	cfg.Global.ReloadConfigRetryMultiplier = 3
+	cfg.Global.ReloadConfigRetryMaxIntervalInSec = 120
+	backoff := GetReloadConfigBackoff(cfg)
+	assert.Equal(t, RetryBackoff{InitialInterval: 10 * time.Second, Multiplier: 3,
+		MaxInterval: 120 * time.Second}, backoff)
+}
+
+func TestGetDatastoresCapacity(t *testing.T) {
+	datastores := []*cnsvsphere.DatastoreInfo{
+		{Info: &types.DatastoreInfo{Url: "ds:///vmfs/volumes/ds1/", FreeSpace: 5 * GbInBytes}},
+		{Info: &types.DatastoreInfo{Url: "ds:///vmfs/volumes/ds2/", FreeSpace: 10 * GbInBytes}},
+		{},
+	}
+	tests := []struct {
+		datastoreURL              string
+		expectedAvailableCapacity int64
+		expectedMaximumVolumeSize int64
+	}{
+		{datastoreURL: "", expectedAvailableCapacity: 15 * GbInBytes, expectedMaximumVolumeSize: 10 * GbInBytes},
+		{datastoreURL: "ds:///vmfs/volumes/ds1/", expectedAvailableCapacity: 5 * GbInBytes,
+			expectedMaximumVolumeSize: 5 * GbInBytes},
+		{datastoreURL: "ds:///vmfs/volumes/ds3/", expectedAvailableCapacity: 0, expectedMaximumVolumeSize: 0},
+	}
+	for _, test := range tests {
+		availableCapacity, maximumVolumeSize := GetDatastoresCapacity(datastores, test.datastoreURL)
+		if availableCapacity != test.expectedAvailableCapacity || maximumVolumeSize != test.expectedMaximumVolumeSize {
+			t.Errorf("datastore URL %q: expected capacity %d and maximum volume size %d but got %d and %d",
+				test.datastoreURL, test.expectedAvailableCapacity, test.expectedMaximumVolumeSize,
+				availableCapacity, maximumVolumeSize)
+		}
+	}
+}
+
+// TestGetTopologyComputationContext verifies that the topology computation
+// context is bounded only when a timeout is configured, and that the time
+// already spent is counted against the timeout.
+func TestGetTopologyComputationContext(t *testing.T) {
+	ctx := context.Background()
+	unboundedCtx, cancel := GetTopologyComputationContext(ctx, 0, time.Hour)
+	defer cancel()
+	if _, ok := unboundedCtx.Deadline(); ok {
+		t.Errorf("expected no deadline when the timeout is not configured")
+	}
+	if IsTopologyComputationDeadlineExceeded(unboundedCtx) {
+		t.Errorf("expected deadline to not be exceeded when the timeout is not configured")
+	}
+
+	exceededCtx, cancel := GetTopologyComputationContext(ctx, time.Second, 2*time.Second)
+	defer cancel()
+	<-exceededCtx.Done()
+	if !IsTopologyComputationDeadlineExceeded(exceededCtx) {
+		t.Errorf("expected deadline to be exceeded when the elapsed time is more than the timeout")
+	}
+}
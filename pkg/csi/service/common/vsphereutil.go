@@ -17,9 +17,11 @@ limitations under the License.
 package common
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -29,6 +31,7 @@ import (
 	"github.com/vmware/govmomi/vim25/mo"
 	vim25types "github.com/vmware/govmomi/vim25/types"
 	vsanfstypes "github.com/vmware/govmomi/vsan/vsanfs/types"
+	"go.uber.org/zap/zapcore"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -36,10 +39,123 @@ import (
 	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/volume"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/vsphere"
 	csifault "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/fault"
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/prometheus"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/utils"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/logger"
 )
 
+// GetCreateVolumeErrorCode returns the gRPC code for an error returned while
+// creating a CNS volume. codes.Unavailable is returned when the volume
+// operation store cannot be reached, codes.Internal otherwise.
+func GetCreateVolumeErrorCode(err error) codes.Code {
+	if errors.Is(err, cnsvolume.ErrOperationStoreUnavailable) {
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
+
+// GetTopologyErrorCode returns the gRPC code for an error returned by the
+// topology service while resolving a topology requirement.
+// codes.FailedPrecondition is returned when the requirement cannot be satisfied
+// until the zones or nodes of the cluster change, codes.Unavailable when the
+// topology service has not synced yet, codes.InvalidArgument when the
+// requirement has too many topology segments, codes.Internal otherwise.
+func GetTopologyErrorCode(err error) codes.Code {
+	if errors.Is(err, ErrZoneNotMapped) || errors.Is(err, ErrNoMatchingNodes) {
+		return codes.FailedPrecondition
+	}
+	if errors.Is(err, ErrTopologyNotSynced) {
+		return codes.Unavailable
+	}
+	if errors.Is(err, ErrTooManyTopologySegments) {
+		return codes.InvalidArgument
+	}
+	return codes.Internal
+}
+
+// LogCandidateDatastores logs, at debug level, the datastores considered for
+// placing a volume with the given topology requirement. Together with the logs
+// of LogExcludedDatastores, this explains why no datastore was suitable.
+func LogCandidateDatastores(ctx context.Context, topologyRequirement *csi.TopologyRequirement,
+	datastores []*vsphere.DatastoreInfo) {
+	log := logger.GetLogger(ctx)
+	datastoreURLs := make([]string, 0, len(datastores))
+	for _, ds := range datastores {
+		if ds.Info != nil {
+			datastoreURLs = append(datastoreURLs, ds.Info.Url)
+		}
+	}
+	log.Debugw("Candidate datastores for volume placement",
+		"topologyRequirement", topologyRequirement,
+		"datastoreURLs", datastoreURLs)
+}
+
+// LogExcludedDatastores logs, at debug level, each of the candidate datastores
+// which was excluded from volume placement by the given filter, i.e. which is
+// not among the remaining datastores.
+func LogExcludedDatastores(ctx context.Context, filter string, candidates,
+	remaining []*vsphere.DatastoreInfo) {
+	log := logger.GetLogger(ctx)
+	for _, ds := range getExcludedDatastores(candidates, remaining) {
+		log.Debugw("Datastore excluded from volume placement",
+			"datastoreName", ds.Info.Name,
+			"datastoreURL", ds.Info.Url,
+			"filter", filter)
+	}
+}
+
+// LogTopologyExcludedDatastores logs, at debug level, each of the datastores
+// returned by getDatastores which was excluded from volume placement by the
+// topology requirement, i.e. which is not among the datastores in topology.
+// getDatastores may query vCenter, so it is only called if debug logging is
+// enabled.
+func LogTopologyExcludedDatastores(ctx context.Context,
+	getDatastores func(ctx context.Context) ([]*vsphere.DatastoreInfo, error),
+	datastoresInTopology []*vsphere.DatastoreInfo) {
+	log := logger.GetLogger(ctx)
+	if !log.Desugar().Core().Enabled(zapcore.DebugLevel) {
+		return
+	}
+	datastores, err := getDatastores(ctx)
+	if err != nil {
+		log.Debugf("Skipped logging the datastores excluded by topology. Error: %+v", err)
+		return
+	}
+	LogExcludedDatastores(ctx, DatastoreFilterTopology, datastores, datastoresInTopology)
+}
+
+// getExcludedDatastores returns the candidate datastores whose URL is not
+// among the remaining datastores.
+func getExcludedDatastores(candidates, remaining []*vsphere.DatastoreInfo) []*vsphere.DatastoreInfo {
+	remainingURLs := make(map[string]struct{}, len(remaining))
+	for _, ds := range remaining {
+		if ds.Info != nil {
+			remainingURLs[ds.Info.Url] = struct{}{}
+		}
+	}
+	var excluded []*vsphere.DatastoreInfo
+	for _, ds := range candidates {
+		if ds.Info == nil {
+			continue
+		}
+		if _, exists := remainingURLs[ds.Info.Url]; !exists {
+			excluded = append(excluded, ds)
+		}
+	}
+	return excluded
+}
+
+// ObserveCnsUtilOpLatency observes the time taken by a CNS util call made by
+// a CSI operation since start in the CsiCnsUtilOpsHistVec metric.
+func ObserveCnsUtilOpLatency(volumeType, opType string, start time.Time, err error) {
+	status := prometheus.PrometheusPassStatus
+	if err != nil {
+		status = prometheus.PrometheusFailStatus
+	}
+	prometheus.CsiCnsUtilOpsHistVec.WithLabelValues(volumeType, opType, status).Observe(
+		time.Since(start).Seconds())
+}
+
 // CreateBlockVolumeUtil is the helper function to create CNS block volume.
 func CreateBlockVolumeUtil(ctx context.Context, clusterFlavor cnstypes.CnsClusterFlavor, manager *Manager,
 	spec *CreateVolumeSpec, sharedDatastores []*vsphere.DatastoreInfo,
@@ -65,7 +181,9 @@ func CreateBlockVolumeUtil(ctx context.Context, clusterFlavor cnstypes.CnsCluste
 	}
 
 	if filterSuspendedDatastores {
-		sharedDatastores = vsphere.FilterSuspendedDatastores(ctx, sharedDatastores)
+		filteredDatastores := vsphere.FilterSuspendedDatastores(ctx, sharedDatastores)
+		LogExcludedDatastores(ctx, DatastoreFilterSuspended, sharedDatastores, filteredDatastores)
+		sharedDatastores = filteredDatastores
 	}
 
 	var datastores []vim25types.ManagedObjectReference
@@ -581,6 +699,58 @@ func getHostVsanUUID(ctx context.Context, hostMoID string, vc *vsphere.VirtualCe
 	return nodeUUID, nil
 }
 
+// failedAttachDetachOpTTL is the duration after which a failed attach or
+// detach attempt is forgotten, so that failedAttachDetachOps stays bounded.
+const failedAttachDetachOpTTL = 1 * time.Hour
+
+// failedAttachDetachOpKey identifies an attach or detach operation.
+type failedAttachDetachOpKey struct {
+	opType   string
+	volumeID string
+	vmUUID   string
+}
+
+// failedAttachDetachOps tracks attach and detach operations whose last attempt
+// has failed, along with the time of the failure. Entries are removed when the
+// operation succeeds, when the volume is deleted or when they expire.
+var failedAttachDetachOps sync.Map
+
+// recordAttachDetachAttempt records the outcome of an attach or detach attempt.
+// If the previous attempt for the same volume and VM has failed within
+// failedAttachDetachOpTTL, the attempt is counted as a retry in the
+// AttachDetachRetryCounterVec metric.
+func recordAttachDetachAttempt(ctx context.Context, opType string, volumeID string,
+	vm *vsphere.VirtualMachine, err error) {
+	log := logger.GetLogger(ctx)
+	key := failedAttachDetachOpKey{opType: opType, volumeID: volumeID, vmUUID: vm.UUID}
+	now := time.Now()
+	isRetry := false
+	if failedAt, ok := failedAttachDetachOps.Load(key); ok {
+		isRetry = now.Sub(failedAt.(time.Time)) < failedAttachDetachOpTTL
+	}
+	if err != nil {
+		failedAttachDetachOps.Store(key, now)
+		// Evict the expired entries of operations which were never retried.
+		failedAttachDetachOps.Range(func(k, failedAt interface{}) bool {
+			if now.Sub(failedAt.(time.Time)) >= failedAttachDetachOpTTL {
+				failedAttachDetachOps.Delete(k)
+			}
+			return true
+		})
+	} else {
+		failedAttachDetachOps.Delete(key)
+	}
+	if !isRetry {
+		return
+	}
+	status := prometheus.PrometheusPassStatus
+	if err != nil {
+		status = prometheus.PrometheusFailStatus
+	}
+	log.Debugf("Observed %s retry for volume: %q on vm: %q with status: %q", opType, volumeID, vm.UUID, status)
+	prometheus.AttachDetachRetryCounterVec.WithLabelValues(opType, status).Inc()
+}
+
 // AttachVolumeUtil is the helper function to attach CNS volume to specified vm.
 func AttachVolumeUtil(ctx context.Context, manager *Manager,
 	vm *vsphere.VirtualMachine,
@@ -588,6 +758,7 @@ func AttachVolumeUtil(ctx context.Context, manager *Manager,
 	log := logger.GetLogger(ctx)
 	log.Debugf("vSphere CSI driver is attaching volume: %q to vm: %q", volumeID, vm.String())
 	diskUUID, faultType, err := manager.VolumeManager.AttachVolume(ctx, vm, volumeID, checkNVMeController)
+	recordAttachDetachAttempt(ctx, prometheus.PrometheusAttachVolumeOpType, volumeID, vm, err)
 	if err != nil {
 		log.Errorf("failed to attach disk %q with VM: %q. err: %+v faultType %q", volumeID, vm.String(), err, faultType)
 		return "", faultType, err
@@ -596,6 +767,28 @@ func AttachVolumeUtil(ctx context.Context, manager *Manager,
 	return diskUUID, "", err
 }
 
+// BatchAttachVolumesUtil is the helper function to attach multiple CNS volumes
+// to specified vm using a single CNS AttachVolume task.
+func BatchAttachVolumesUtil(ctx context.Context, manager *Manager,
+	vm *vsphere.VirtualMachine, volumeIDs []string,
+	checkNVMeController bool) (map[string]*cnsvolume.CnsAttachResult, string, error) {
+	log := logger.GetLogger(ctx)
+	log.Debugf("vSphere CSI driver is attaching volumes: %v to vm: %q", volumeIDs, vm.String())
+	results, faultType, err := manager.VolumeManager.BatchAttachVolumes(ctx, vm, volumeIDs, checkNVMeController)
+	if err != nil {
+		for _, volumeID := range volumeIDs {
+			recordAttachDetachAttempt(ctx, prometheus.PrometheusAttachVolumeOpType, volumeID, vm, err)
+		}
+		log.Errorf("failed to attach disks %v with VM: %q. err: %+v faultType %q", volumeIDs, vm.String(),
+			err, faultType)
+		return nil, faultType, err
+	}
+	for volumeID, result := range results {
+		recordAttachDetachAttempt(ctx, prometheus.PrometheusAttachVolumeOpType, volumeID, vm, result.Err)
+	}
+	return results, "", nil
+}
+
 // DetachVolumeUtil is the helper function to detach CNS volume from specified
 // vm.
 func DetachVolumeUtil(ctx context.Context, manager *Manager,
@@ -604,6 +797,7 @@ func DetachVolumeUtil(ctx context.Context, manager *Manager,
 	log := logger.GetLogger(ctx)
 	log.Debugf("vSphere CSI driver is detaching volume: %s from node vm: %s", volumeID, vm.InventoryPath)
 	faultType, err := manager.VolumeManager.DetachVolume(ctx, vm, volumeID)
+	recordAttachDetachAttempt(ctx, prometheus.PrometheusDetachVolumeOpType, volumeID, vm, err)
 	if err != nil {
 		log.Errorf("failed to detach disk %s with err %+v", volumeID, err)
 		return faultType, err
@@ -626,9 +820,21 @@ func DeleteVolumeUtil(ctx context.Context, volManager cnsvolume.Manager, volumeI
 		return faultType, err
 	}
 	log.Debugf("Successfully deleted disk for volumeid: %s, deleteDisk flag: %t", volumeID, deleteDisk)
+	forgetAttachDetachAttempts(volumeID)
 	return "", nil
 }
 
+// forgetAttachDetachAttempts removes the failed attach and detach attempts of
+// the given volume from failedAttachDetachOps.
+func forgetAttachDetachAttempts(volumeID string) {
+	failedAttachDetachOps.Range(func(k, _ interface{}) bool {
+		if k.(failedAttachDetachOpKey).volumeID == volumeID {
+			failedAttachDetachOps.Delete(k)
+		}
+		return true
+	})
+}
+
 // ExpandVolumeUtil is the helper function to extend CNS volume for given
 // volumeId.
 func ExpandVolumeUtil(ctx context.Context, manager *Manager, volumeID string, capacityInMb int64,
@@ -652,14 +858,18 @@ func ExpandVolumeUtil(ctx context.Context, manager *Manager, volumeID string, ca
 			vc.Client.ServiceContent.About.ApiVersion, err)
 	}
 
-	if !isvSphere8AndAbove {
-		// Query Volume to check Volume Size for vSphere version below 8.0
-		expansionRequired, err = isExpansionRequired(ctx, volumeID, capacityInMb, manager, useAsyncQueryVolume)
-		if err != nil {
-			return csifault.CSIInternalFault, err
+	// Query Volume to check Volume Size, so that shrink requests are rejected
+	// instead of being passed on to CNS.
+	expansionRequired, err = isExpansionRequired(ctx, volumeID, capacityInMb, manager, useAsyncQueryVolume)
+	if err != nil {
+		if errors.Is(err, ErrVolumeShrinkNotSupported) {
+			return csifault.CSIInvalidArgumentFault, err
 		}
-	} else {
-		// Skip Query Volume to check Volume Size if vSphere version is 8.0 and above
+		return csifault.CSIInternalFault, err
+	}
+	if isvSphere8AndAbove {
+		// CNS ExpandVolume handles volumes already at the requested size
+		// for vSphere version 8.0 and above.
 		expansionRequired = true
 	}
 	if expansionRequired {
@@ -676,6 +886,43 @@ func ExpandVolumeUtil(ctx context.Context, manager *Manager, volumeID string, ca
 	return "", nil
 }
 
+// UpdateVolumeStoragePolicyUtil is the helper function to reconfigure the
+// storage policy of the CNS volume with the given volumeID.
+func UpdateVolumeStoragePolicyUtil(ctx context.Context, manager *Manager, volumeID string,
+	storagePolicyID string) (string, error) {
+	log := logger.GetLogger(ctx)
+	log.Debugf("vSphere CSI driver updating storage policy of volume %q to %q.", volumeID, storagePolicyID)
+	vc, err := GetVCenter(ctx, manager)
+	if err != nil {
+		log.Errorf("failed to get vcenter. err=%v", err)
+		return csifault.CSIInternalFault, err
+	}
+	volume, err := QueryVolumeByID(ctx, manager.VolumeManager, volumeID)
+	if err != nil {
+		if err == ErrNotFound {
+			return csifault.CSINotFoundFault, err
+		}
+		return csifault.CSIInternalFault, err
+	}
+	if volume.StoragePolicyId == storagePolicyID {
+		log.Infof("Volume %q is already associated with storage policy %q. Update not required.",
+			volumeID, storagePolicyID)
+		return "", nil
+	}
+	datastore, err := getDatastoreInfoObj(ctx, vc, volume.DatastoreUrl)
+	if err != nil {
+		return csifault.CSIInternalFault, err
+	}
+	faultType, err := manager.VolumeManager.UpdateVolumeStoragePolicy(ctx, volumeID, datastore.Reference(),
+		storagePolicyID)
+	if err != nil {
+		log.Errorf("failed to update storage policy of volume %q with error %+v", volumeID, err)
+		return faultType, err
+	}
+	log.Infof("Successfully updated storage policy of volume %q to %q.", volumeID, storagePolicyID)
+	return "", nil
+}
+
 func ListSnapshotsUtil(ctx context.Context, volManager cnsvolume.Manager, volumeID string, snapshotID string,
 	token string, maxEntries int64) ([]*csi.Snapshot, string, error) {
 	log := logger.GetLogger(ctx)
@@ -715,7 +962,7 @@ func ListSnapshotsUtil(ctx context.Context, volManager cnsvolume.Manager, volume
 			return nil, "", logger.LogNewErrorCodef(log, codes.Unimplemented,
 				"ListSnapshot for file volume: %q not supported", volumeID)
 		}
-		return QueryVolumeSnapshotsByVolumeID(ctx, volManager, volumeID, maxEntries)
+		return QueryVolumeSnapshotsByVolumeID(ctx, volManager, volumeID, token, maxEntries)
 	} else {
 		// Retrieve all snapshots in the inventory
 		return QueryAllVolumeSnapshots(ctx, volManager, token, maxEntries)
@@ -855,13 +1102,22 @@ func QueryAllVolumeSnapshots(ctx context.Context, volManager cnsvolume.Manager,
 }
 
 func QueryVolumeSnapshotsByVolumeID(ctx context.Context, volManager cnsvolume.Manager, volumeID string,
-	maxEntries int64) ([]*csi.Snapshot, string, error) {
+	token string, maxEntries int64) ([]*csi.Snapshot, string, error) {
 	log := logger.GetLogger(ctx)
 	var csiSnapshots []*csi.Snapshot
+	var offset int64
+	var err error
 	limit := QuerySnapshotLimit
 	if maxEntries <= QuerySnapshotLimit {
 		limit = maxEntries
 	}
+	if token != "" {
+		offset, err = strconv.ParseInt(token, 10, 64)
+		if err != nil {
+			log.Errorf("failed to parse the token: %s err: %v", token, err)
+			return nil, "", err
+		}
+	}
 	querySpec := cnstypes.CnsSnapshotQuerySpec{
 		VolumeId: cnstypes.CnsVolumeId{
 			Id: volumeID,
@@ -870,7 +1126,7 @@ func QueryVolumeSnapshotsByVolumeID(ctx context.Context, volManager cnsvolume.Ma
 	queryFilter := cnstypes.CnsSnapshotQueryFilter{
 		SnapshotQuerySpecs: []cnstypes.CnsSnapshotQuerySpec{querySpec},
 		Cursor: &cnstypes.CnsCursor{
-			Offset: 0,
+			Offset: offset,
 			Limit:  limit,
 		},
 	}
@@ -976,7 +1232,8 @@ func getDatastoreInfoObj(ctx context.Context, vc *vsphere.VirtualCenter,
 }
 
 // isExpansionRequired verifies if the requested size to expand a volume is
-// greater than the current size.
+// greater than the current size. ErrVolumeShrinkNotSupported is returned if
+// the requested size is smaller than the current size.
 func isExpansionRequired(ctx context.Context, volumeID string, requestedSize int64,
 	manager *Manager, useAsyncQueryVolume bool) (bool, error) {
 	log := logger.GetLogger(ctx)
@@ -1008,6 +1265,12 @@ func isExpansionRequired(ctx context.Context, volumeID string, requestedSize int
 
 	log.Infof("isExpansionRequired: Found current size of volumeID %q to be %d Mb. "+
 		"Requested size is %d Mb", volumeID, currentSize, requestedSize)
+	if requestedSize < currentSize {
+		err = fmt.Errorf("%w: current size of volume %q is %d Mb, requested size is %d Mb",
+			ErrVolumeShrinkNotSupported, volumeID, currentSize, requestedSize)
+		log.Error(err)
+		return false, err
+	}
 	return currentSize < requestedSize, nil
 }
 
@@ -1143,3 +1406,63 @@ func GetNodeVMsWithAccessToDatastore(ctx context.Context, vc *vsphere.VirtualCen
 	log.Infof("Nodes that have access to datastore %q are %+v", dsURL, accessibleNodes)
 	return accessibleNodes, nil
 }
+
+// GetStoragePolicyCompatibleDatastores returns the datastores among the given
+// datastores which are compatible with the given storage policy.
+func GetStoragePolicyCompatibleDatastores(ctx context.Context, vc *vsphere.VirtualCenter,
+	storagePolicyID string, datastores []*vsphere.DatastoreInfo) ([]*vsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	if len(datastores) == 0 {
+		return nil, nil
+	}
+	err := vc.ConnectPbm(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PBM service. Error: %+v", err)
+	}
+	datastoreMorList := make([]vim25types.ManagedObjectReference, 0, len(datastores))
+	for _, ds := range datastores {
+		datastoreMorList = append(datastoreMorList, ds.Datastore.Reference())
+	}
+	compat, err := vc.PbmCheckCompatibility(ctx, datastoreMorList, storagePolicyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check compatibility of storage policy %q. Error: %+v",
+			storagePolicyID, err)
+	}
+	compatibleHubIDs := make(map[string]struct{})
+	for _, hub := range compat.CompatibleDatastores() {
+		compatibleHubIDs[hub.HubId] = struct{}{}
+	}
+	var compatibleDatastores []*vsphere.DatastoreInfo
+	for _, ds := range datastores {
+		if _, exists := compatibleHubIDs[ds.Datastore.Reference().Value]; exists {
+			compatibleDatastores = append(compatibleDatastores, ds)
+		}
+	}
+	log.Debugf("Storage policy %q is compatible with datastores %+v", storagePolicyID, compatibleDatastores)
+	return compatibleDatastores, nil
+}
+
+// GetStoragePolicyIDFromParams returns the ID of the storage policy given by
+// the storagepolicyid or the storagepolicyname parameter, e.g. of a
+// GetCapacity request. An empty ID is returned if neither parameter is set.
+func GetStoragePolicyIDFromParams(ctx context.Context, vc *vsphere.VirtualCenter,
+	params map[string]string) (string, error) {
+	var storagePolicyID, storagePolicyName string
+	for paramName, value := range params {
+		switch strings.ToLower(paramName) {
+		case AttributeStoragePolicyID:
+			storagePolicyID = value
+		case AttributeStoragePolicyName:
+			storagePolicyName = value
+		}
+	}
+	if storagePolicyID != "" || storagePolicyName == "" {
+		return storagePolicyID, nil
+	}
+	storagePolicyID, err := vc.GetStoragePolicyIDByName(ctx, storagePolicyName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get storage policy ID for storage policy name %q. Error: %+v",
+			storagePolicyName, err)
+	}
+	return storagePolicyID, nil
+}
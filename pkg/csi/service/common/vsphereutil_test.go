@@ -2,13 +2,18 @@ package common
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/agiledragon/gomonkey/v2"
 	"github.com/stretchr/testify/assert"
 	cnstypes "github.com/vmware/govmomi/cns/types"
 	"github.com/vmware/govmomi/vim25/types"
+	"google.golang.org/grpc/codes"
 	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/volume"
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/vsphere"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/utils"
 )
 
@@ -36,7 +41,7 @@ func TestQueryVolumeSnapshotsByVolumeIDWithQuerySnapshotsCnsVolumeNotFoundFault(
 		map[string]*utils.CnsVolumeDetails, error) {
 		return make(map[string]*utils.CnsVolumeDetails), nil
 	})
-	results, _, err := QueryVolumeSnapshotsByVolumeID(context.TODO(), nil, volumeId, 100)
+	results, _, err := QueryVolumeSnapshotsByVolumeID(context.TODO(), nil, volumeId, "", 100)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, 0, len(results))
 }
@@ -63,7 +68,7 @@ func TestQueryVolumeSnapshotsByVolumeIDWithQuerySnapshotsUnexpectedFault(t *test
 		map[string]*utils.CnsVolumeDetails, error) {
 		return make(map[string]*utils.CnsVolumeDetails), nil
 	})
-	_, _, err := QueryVolumeSnapshotsByVolumeID(context.TODO(), nil, volumeId, 100)
+	_, _, err := QueryVolumeSnapshotsByVolumeID(context.TODO(), nil, volumeId, "", 100)
 	assert.Error(t, err)
 }
 
@@ -151,3 +156,63 @@ func TestQueryAllVolumeSnapshotsWithQuerySnapshotsUnexpectedFault(t *testing.T)
 	_, _, err := QueryAllVolumeSnapshots(context.TODO(), nil, "", 100)
 	assert.Error(t, err)
 }
+
+func TestGetTopologyErrorCode(t *testing.T) {
+	tests := []struct {
+		err          error
+		expectedCode codes.Code
+	}{
+		{err: nil, expectedCode: codes.Internal},
+		{err: errors.New("unexpected error"), expectedCode: codes.Internal},
+		{err: ErrZoneNotMapped, expectedCode: codes.FailedPrecondition},
+		{err: fmt.Errorf("zone-a: %w", ErrZoneNotMapped), expectedCode: codes.FailedPrecondition},
+		{err: fmt.Errorf("outer: %w", fmt.Errorf("inner: %w", ErrNoMatchingNodes)),
+			expectedCode: codes.FailedPrecondition},
+		{err: fmt.Errorf("AvailabilityZone informer: %w", ErrTopologyNotSynced), expectedCode: codes.Unavailable},
+		{err: fmt.Errorf("requisite topology: %w", ErrTooManyTopologySegments), expectedCode: codes.InvalidArgument},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expectedCode, GetTopologyErrorCode(test.err), "unexpected code for %v", test.err)
+	}
+}
+
+func TestGetExcludedDatastores(t *testing.T) {
+	newDatastoreInfo := func(url string) *vsphere.DatastoreInfo {
+		return &vsphere.DatastoreInfo{Info: &types.DatastoreInfo{Name: url, Url: url}}
+	}
+	ds1, ds2, ds3 := newDatastoreInfo("ds:///vmfs/volumes/ds1/"), newDatastoreInfo("ds:///vmfs/volumes/ds2/"),
+		newDatastoreInfo("ds:///vmfs/volumes/ds3/")
+	candidates := []*vsphere.DatastoreInfo{ds1, ds2, ds3}
+
+	assert.Empty(t, getExcludedDatastores(candidates, candidates))
+	assert.Equal(t, []*vsphere.DatastoreInfo{ds1, ds3},
+		getExcludedDatastores(candidates, []*vsphere.DatastoreInfo{newDatastoreInfo(ds2.Info.Url)}))
+	assert.Equal(t, candidates, getExcludedDatastores(candidates, nil))
+}
+
+func TestRecordAttachDetachAttempt(t *testing.T) {
+	ctx := context.Background()
+	vm := &vsphere.VirtualMachine{UUID: "vm-uuid"}
+	key := failedAttachDetachOpKey{opType: "attach-volume", volumeID: "vol-1", vmUUID: vm.UUID}
+	t.Cleanup(func() { forgetAttachDetachAttempts("vol-1") })
+
+	// A failed attempt is tracked and removed once the operation succeeds.
+	recordAttachDetachAttempt(ctx, key.opType, key.volumeID, vm, errors.New("attach failed"))
+	_, ok := failedAttachDetachOps.Load(key)
+	assert.True(t, ok)
+	recordAttachDetachAttempt(ctx, key.opType, key.volumeID, vm, nil)
+	_, ok = failedAttachDetachOps.Load(key)
+	assert.False(t, ok)
+
+	// Expired entries are evicted when another attempt fails.
+	expiredKey := failedAttachDetachOpKey{opType: "detach-volume", volumeID: "vol-1", vmUUID: vm.UUID}
+	failedAttachDetachOps.Store(expiredKey, time.Now().Add(-failedAttachDetachOpTTL))
+	recordAttachDetachAttempt(ctx, key.opType, key.volumeID, vm, errors.New("attach failed"))
+	_, ok = failedAttachDetachOps.Load(expiredKey)
+	assert.False(t, ok)
+
+	// Entries of a deleted volume are removed.
+	forgetAttachDetachAttempts("vol-1")
+	_, ok = failedAttachDetachOps.Load(key)
+	assert.False(t, ok)
+}
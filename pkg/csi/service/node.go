@@ -18,7 +18,6 @@ package service
 
 import (
 	"os"
-	"strconv"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	cnstypes "github.com/vmware/govmomi/cns/types"
@@ -36,10 +35,6 @@ import (
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/osutils"
 )
 
-const (
-	maxAllowedBlockVolumesPerNode = 59
-)
-
 var topologyService commoncotypes.NodeTopologyService
 
 func (driver *vsphereCSIDriver) NodeStageVolume(
@@ -356,25 +351,7 @@ func (driver *vsphereCSIDriver) NodeGetInfo(
 		nodeID = nodeName
 	}
 
-	var maxVolumesPerNode int64
-	if v := os.Getenv("MAX_VOLUMES_PER_NODE"); v != "" {
-		if value, err := strconv.ParseInt(v, 10, 64); err == nil {
-			if value < 0 {
-				return nil, logger.LogNewErrorCodef(log, codes.Internal,
-					"NodeGetInfo: MAX_VOLUMES_PER_NODE set in env variable %v is less than 0", v)
-			} else if value > maxAllowedBlockVolumesPerNode {
-				return nil, logger.LogNewErrorCodef(log, codes.Internal,
-					"NodeGetInfo: MAX_VOLUMES_PER_NODE set in env variable %v is more than %v",
-					v, maxAllowedBlockVolumesPerNode)
-			} else {
-				maxVolumesPerNode = value
-				log.Infof("NodeGetInfo: MAX_VOLUMES_PER_NODE is set to %v", maxVolumesPerNode)
-			}
-		} else {
-			return nil, logger.LogNewErrorCodef(log, codes.Internal,
-				"NodeGetInfo: MAX_VOLUMES_PER_NODE set in env variable %v is invalid", v)
-		}
-	}
+	maxVolumesPerNode := common.GetMaxVolumesPerNode(ctx)
 
 	var (
 		accessibleTopology map[string]string
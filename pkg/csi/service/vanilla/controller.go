@@ -21,10 +21,11 @@ import (
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/fsnotify/fsnotify"
@@ -32,7 +33,6 @@ import (
 	cnstypes "github.com/vmware/govmomi/cns/types"
 	"github.com/vmware/govmomi/units"
 	"github.com/vmware/govmomi/vapi/tags"
-	"github.com/vmware/govmomi/vim25/types"
 	"google.golang.org/grpc/codes"
 
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/apis/migration"
@@ -69,11 +69,18 @@ type controller struct {
 	nodeMgr     NodeManagerInterface
 	authMgr     common.AuthorizationService
 	topologyMgr commoncotypes.ControllerTopologyService
+	// operationStore persists the details of CreateVolume calls. It is nil if
+	// idempotency handling is disabled.
+	operationStore cnsvolumeoperationrequest.VolumeOperationRequest
 }
 
 // volumeMigrationService holds the pointer to VolumeMigration instance.
 var volumeMigrationService migration.VolumeMigrationService
 
+// getStoragePolicyCompatibleDatastores returns the datastores compatible with
+// a storage policy. It is a variable so that tests can replace it.
+var getStoragePolicyCompatibleDatastores = common.GetStoragePolicyCompatibleDatastores
+
 // New creates a CNS controller.
 func New() csitypes.CnsController {
 	return &controller{}
@@ -111,14 +118,19 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 			return err
 		}
 	}
+	c.operationStore = operationStore
 	c.manager = &common.Manager{
-		VcenterConfig:  vcenterconfig,
-		CnsConfig:      config,
-		VolumeManager:  cnsvolume.GetManager(ctx, vcenter, operationStore, idempotencyHandlingEnabled),
+		VcenterConfig: vcenterconfig,
+		CnsConfig:     config,
+		VolumeManager: cnsvolume.GetManagerWithOptions(ctx, vcenter, operationStore, idempotencyHandlingEnabled,
+			cnsvolume.ManagerOptions{
+				FailOnOperationStoreUnavailable: config.Global.FailCreateVolumeOnOperationStoreUnavailable,
+			}),
 		VcenterManager: vcManager,
 	}
 
-	vc, err := common.GetVCenter(ctx, c.manager)
+	vc, err := common.GetVCenterWithTimeout(ctx, c.manager,
+		time.Duration(config.Global.VCConnectTimeoutInSec)*time.Second, config.Global.VCConnectMaxAttempts)
 	if err != nil {
 		log.Errorf("failed to get vcenter. err=%v", err)
 		return err
@@ -209,15 +221,18 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 				}
 				log.Debugf("fsnotify event: %q", event.String())
 				if event.Op&fsnotify.Remove == fsnotify.Remove {
-					for {
-						reloadConfigErr := c.ReloadConfiguration()
-						if reloadConfigErr == nil {
-							log.Infof("Successfully reloaded configuration from: %q", cfgPath)
-							break
-						}
-						log.Errorf("failed to reload configuration. will retry again in 5 seconds. err: %+v", reloadConfigErr)
-						time.Sleep(5 * time.Second)
-					}
+					common.RetryWithBackoff(common.GetReloadConfigBackoff(c.manager.CnsConfig), c.ReloadConfiguration,
+						func(reloadConfigErr error, wait time.Duration) {
+							prometheus.ReloadConfigOpsCounterVec.WithLabelValues(
+								prometheus.PrometheusReloadConfigTriggerConfigChange, prometheus.PrometheusFailStatus).Inc()
+							log.Errorf("failed to reload configuration. will retry again in %v. err: %+v", wait,
+								reloadConfigErr)
+						})
+					log.Infof("Successfully reloaded configuration from: %q", cfgPath)
+					prometheus.ReloadConfigOpsCounterVec.WithLabelValues(
+						prometheus.PrometheusReloadConfigTriggerConfigChange, prometheus.PrometheusPassStatus).Inc()
+					prometheus.ReloadConfigLastSuccessGaugeVec.WithLabelValues(
+						prometheus.PrometheusReloadConfigTriggerConfigChange).SetToCurrentTime()
 				}
 			case err, ok := <-watcher.Errors:
 				if !ok {
@@ -251,14 +266,22 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 			log.Errorf("failed to initialize topology service. Error: %+v", err)
 			return err
 		}
+		c.topologyMgr.SetDrainingTopologyValues(ctx, common.GetDrainingTopologyValues(config))
+		c.topologyMgr.WaitForSync(ctx)
 	}
+	// Expose the datastores accessible to a node to help debug volume placement.
+	common.RegisterDebugHandler(ctx, "/debug/node-datastores", c.nodeDatastoresHandler)
+	// Expose the feature state switches seen by the controller to help debug.
+	commonco.RegisterFeatureStatesHandler(ctx)
+	common.StartDebugServer(ctx)
 	// Go module to keep the metrics http server running all the time.
+	metricsAddress := common.GetPrometheusMetricsAddress(ctx, config)
 	go func() {
 		prometheus.CsiInfo.WithLabelValues(version).Set(1)
 		for {
 			log.Info("Starting the http server to expose Prometheus metrics..")
 			http.Handle("/metrics", promhttp.Handler())
-			err = http.ListenAndServe(":2112", nil)
+			err = http.ListenAndServe(metricsAddress, nil)
 			if err != nil {
 				log.Warnf("Http server that exposes the Prometheus exited with err: %+v", err)
 			}
@@ -284,6 +307,7 @@ func (c *controller) ReloadConfiguration() error {
 	}
 	if newVCConfig != nil {
 		var vcenter *cnsvsphere.VirtualCenter
+		vcenterReconnected := false
 		if c.manager.VcenterConfig.Host != newVCConfig.Host ||
 			c.manager.VcenterConfig.Username != newVCConfig.Username ||
 			c.manager.VcenterConfig.Password != newVCConfig.Password {
@@ -302,6 +326,7 @@ func (c *controller) ReloadConfiguration() error {
 			if err != nil {
 				return logger.LogNewErrorf(log, "failed to get VirtualCenter. err=%v", err)
 			}
+			vcenterReconnected = true
 		} else {
 			// If it's not a VC host or VC credentials update, same singleton
 			// instance can be used and it's Config field can be updated.
@@ -328,7 +353,11 @@ func (c *controller) ReloadConfiguration() error {
 		}
 		c.manager.VolumeManager.ResetManager(ctx, vcenter)
 		c.manager.VcenterConfig = newVCConfig
-		c.manager.VolumeManager = cnsvolume.GetManager(ctx, vcenter, operationStore, idempotencyHandlingEnabled)
+		c.operationStore = operationStore
+		c.manager.VolumeManager = cnsvolume.GetManagerWithOptions(ctx, vcenter, operationStore,
+			idempotencyHandlingEnabled, cnsvolume.ManagerOptions{
+				FailOnOperationStoreUnavailable: c.manager.CnsConfig.Global.FailCreateVolumeOnOperationStoreUnavailable,
+			})
 		// Re-Initialize Node Manager to cache latest vCenter config.
 		useNodeUuid := false
 		if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.UseCSINodeId) {
@@ -340,6 +369,17 @@ func (c *controller) ReloadConfiguration() error {
 			log.Errorf("failed to re-initialize nodeMgr. err=%v", err)
 			return err
 		}
+		if vcenterReconnected && c.topologyMgr != nil {
+			// Rebuild the topology service so that the informers of the previous
+			// one are stopped instead of running alongside the new ones.
+			commonco.ContainerOrchestratorUtility.ResetTopologyServiceInController(ctx)
+			c.topologyMgr, err = commonco.ContainerOrchestratorUtility.InitTopologyServiceInController(ctx)
+			if err != nil {
+				log.Errorf("failed to reinitialize topology service. Error: %+v", err)
+				return err
+			}
+			c.topologyMgr.WaitForSync(ctx)
+		}
 		if c.authMgr != nil {
 			c.authMgr.ResetvCenterInstance(ctx, vcenter)
 			log.Debugf("Updated vCenter in auth manager")
@@ -348,6 +388,9 @@ func (c *controller) ReloadConfiguration() error {
 	if cfg != nil {
 		c.manager.CnsConfig = cfg
 		log.Debugf("Updated manager.CnsConfig")
+		if c.topologyMgr != nil {
+			c.topologyMgr.SetDrainingTopologyValues(ctx, common.GetDrainingTopologyValues(cfg))
+		}
 	}
 	return nil
 }
@@ -361,10 +404,9 @@ func (c *controller) filterDatastores(ctx context.Context,
 	for _, sharedDatastore := range sharedDatastores {
 		if _, existsInDsMap := dsMap[sharedDatastore.Info.Url]; existsInDsMap {
 			filteredDatastores = append(filteredDatastores, sharedDatastore)
-		} else {
-			log.Debugf("filter out datastore %v from create volume spec", sharedDatastore)
 		}
 	}
+	common.LogExcludedDatastores(ctx, common.DatastoreFilterAuthCheck, sharedDatastores, filteredDatastores)
 	log.Debugf("filterDatastores: filteredDatastores %v", filteredDatastores)
 	return filteredDatastores
 }
@@ -379,6 +421,12 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 		volSizeBytes = int64(req.GetCapacityRange().GetRequiredBytes())
 	}
 	volSizeMB := int64(common.RoundUpSize(volSizeBytes, common.MbInBytes))
+	// A retry of CreateVolume with the same name must not be served with the
+	// volume created earlier if its capacity does not match the request.
+	if err := common.CheckExistingVolumeCapacity(ctx, c.manager, c.operationStore, req.Name,
+		req.GetCapacityRange()); err != nil {
+		return nil, csifault.CSIAlreadyExistsFault, err
+	}
 
 	// Check if the feature state of block-volume-snapshot is enabled
 	isBlockVolumeSnapshotEnabled := commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot)
@@ -493,6 +541,15 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 
 	var sharedDatastores []*cnsvsphere.DatastoreInfo
 	var datastoreTopologyMap map[string][]map[string]string
+	// topologyPath records which topology requirement yielded the shared datastores.
+	var topologyPath string
+
+	// Bound the time spent in computing the topology of the volume so that the
+	// provisioner retries the request instead of blocking on slow topology.
+	topologyTimeout := time.Duration(c.manager.CnsConfig.Global.TopologyComputationTimeoutInSec) * time.Second
+	topologyStart := time.Now()
+	topologyCtx, cancelTopology := common.GetTopologyComputationContext(ctx, topologyTimeout, 0)
+	defer cancelTopology()
 
 	// Get accessibility.
 	topologyRequirement := req.GetAccessibilityRequirements()
@@ -507,10 +564,18 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 			}
 
 			// Get shared accessible datastores for matching topology requirement.
-			sharedDatastores, err = c.topologyMgr.GetSharedDatastoresInTopology(ctx,
-				commoncotypes.VanillaTopologyFetchDSParams{TopologyRequirement: topologyRequirement})
+			sharedDatastores, err = c.topologyMgr.GetSharedDatastoresInTopology(topologyCtx,
+				commoncotypes.VanillaTopologyFetchDSParams{
+					TopologyRequirement: topologyRequirement,
+					TopologyPath:        &topologyPath,
+				})
+			if common.IsTopologyComputationDeadlineExceeded(topologyCtx) {
+				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.DeadlineExceeded,
+					"timed out after %v while getting shared datastores for topology requirement: %+v",
+					topologyTimeout, topologyRequirement)
+			}
 			if err != nil || len(sharedDatastores) == 0 {
-				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, common.GetTopologyErrorCode(err),
 					"failed to get shared datastores for topology requirement: %+v. Error: %+v",
 					topologyRequirement, err)
 			}
@@ -539,8 +604,13 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 					log.Errorf("failed to logout tagManager. err: %v", err)
 				}
 			}()
-			sharedDatastores, datastoreTopologyMap, err = c.nodeMgr.GetSharedDatastoresInTopology(ctx,
+			sharedDatastores, datastoreTopologyMap, err = c.nodeMgr.GetSharedDatastoresInTopology(topologyCtx,
 				topologyRequirement, tagManager, c.manager.CnsConfig.Labels.Zone, c.manager.CnsConfig.Labels.Region)
+			if common.IsTopologyComputationDeadlineExceeded(topologyCtx) {
+				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.DeadlineExceeded,
+					"timed out after %v while getting shared datastores in topology: %+v",
+					topologyTimeout, topologyRequirement)
+			}
 			if err != nil || len(sharedDatastores) == 0 {
 				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
 					"failed to get shared datastores in topology: %+v. Error: %+v", topologyRequirement, err)
@@ -549,28 +619,54 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 				"datastoreTopologyMap [+%v]", sharedDatastores, topologyRequirement, datastoreTopologyMap)
 		}
 	} else {
-		sharedDatastores, err = c.nodeMgr.GetSharedDatastoresInK8SCluster(ctx)
+		sharedDatastores, err = c.nodeMgr.GetSharedDatastoresInK8SCluster(topologyCtx)
+		if common.IsTopologyComputationDeadlineExceeded(topologyCtx) {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.DeadlineExceeded,
+				"timed out after %v while getting shared datastores in kubernetes cluster", topologyTimeout)
+		}
 		if err != nil || len(sharedDatastores) == 0 {
 			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
 				"failed to get shared datastores in kubernetes cluster. Error: %+v", err)
 		}
 	}
+	// Time spent in creating the volume is not counted against the topology
+	// computation deadline.
+	topologyElapsed := time.Since(topologyStart)
 
+	if topologyRequirement != nil {
+		common.LogTopologyExcludedDatastores(ctx, c.nodeMgr.GetSharedDatastoresInK8SCluster, sharedDatastores)
+	}
+	common.LogCandidateDatastores(ctx, topologyRequirement, sharedDatastores)
 	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIAuthCheck) {
 		// Filter datastores which in datastoreMap from sharedDatastores.
 		sharedDatastores = c.filterDatastores(ctx, sharedDatastores)
 	}
 
 	filterSuspendedDatastores := commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CnsMgrSuspendCreateVolume)
+	// Do not create the volume if the deadline was exceeded while filtering the
+	// candidate datastores.
+	if common.IsTopologyComputationDeadlineExceeded(topologyCtx) {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.DeadlineExceeded,
+			"timed out after %v while computing the candidate datastores of volume %q", topologyTimeout, req.Name)
+	}
+	cnsOpStart := time.Now()
 	volumeInfo, faultType, err := common.CreateBlockVolumeUtil(ctx, cnstypes.CnsClusterFlavorVanilla,
 		c.manager, &createVolumeSpec, sharedDatastores, filterSuspendedDatastores)
+	common.ObserveCnsUtilOpLatency(prometheus.PrometheusBlockVolumeType, prometheus.PrometheusCreateVolumeOpType,
+		cnsOpStart, err)
 	if err != nil {
-		return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
+		return nil, faultType, logger.LogNewErrorCodef(log, common.GetCreateVolumeErrorCode(err),
 			"failed to create volume. Error: %+v", err)
 	}
 
 	attributes := make(map[string]string)
 	attributes[common.AttributeDiskType] = common.DiskTypeBlockVolume
+	if volumeInfo.TaskID != "" {
+		attributes[common.AttributeCnsTaskID] = volumeInfo.TaskID
+	}
+	if topologyPath != "" {
+		attributes[common.AttributeTopologyPath] = topologyPath
+	}
 	if csiMigrationFeatureState && scParams.CSIMigration == "true" {
 		// In case if feature state switch is enabled after controller is
 		// deployed, we need to initialize the volumeMigrationService.
@@ -603,6 +699,9 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 			vcenter                     *cnsvsphere.VirtualCenter
 			allNodeVMs                  []*cnsvsphere.VirtualMachine
 		)
+		accessibleTopologyCtx, cancelAccessibleTopology := common.GetTopologyComputationContext(ctx, topologyTimeout,
+			topologyElapsed)
+		defer cancelAccessibleTopology()
 
 		if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.ImprovedVolumeTopology) {
 			// Get VC instance
@@ -646,8 +745,13 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 			// If improved topology FSS is enabled, retrieve datastore topology information
 			// from CSINodeTopology CRs.
 			if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.ImprovedVolumeTopology) {
-				datastoreAccessibleTopology, err = c.getAccessibleTopologiesForDatastore(ctx, vcenter, allNodeVMs,
-					datastoreURL)
+				datastoreAccessibleTopology, err = c.getAccessibleTopologiesForDatastore(accessibleTopologyCtx,
+					vcenter, allNodeVMs, datastoreURL)
+				if common.IsTopologyComputationDeadlineExceeded(accessibleTopologyCtx) {
+					return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.DeadlineExceeded,
+						"timed out after %v while calculating accessible topologies for the datastore %q",
+						topologyTimeout, datastoreURL)
+				}
 				if err != nil {
 					return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
 						"failed to calculate accessible topologies for the datastore %q", datastoreURL)
@@ -660,8 +764,13 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 		} else {
 			// Retrieve datastoreURL from placementResults.
 			if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.ImprovedVolumeTopology) {
-				datastoreAccessibleTopology, err = c.getAccessibleTopologiesForDatastore(ctx, vcenter, allNodeVMs,
-					volumeInfo.DatastoreURL)
+				datastoreAccessibleTopology, err = c.getAccessibleTopologiesForDatastore(accessibleTopologyCtx,
+					vcenter, allNodeVMs, volumeInfo.DatastoreURL)
+				if common.IsTopologyComputationDeadlineExceeded(accessibleTopologyCtx) {
+					return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.DeadlineExceeded,
+						"timed out after %v while calculating accessible topologies for the datastore %q",
+						topologyTimeout, volumeInfo.DatastoreURL)
+				}
 				if err != nil {
 					return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
 						"failed to calculate accessible topologies for the datastore %q",
@@ -680,6 +789,7 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 			}
 			resp.Volume.AccessibleTopology = append(resp.Volume.AccessibleTopology, volumeTopology)
 		}
+		common.SortAccessibleTopology(resp.Volume.AccessibleTopology)
 	}
 
 	// Set the Snapshot VolumeContentSource in the CreateVolumeResponse
@@ -751,8 +861,8 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 			"volume topology feature for file volumes is not supported.")
 	}
 
-	// Volume Size - Default is 10 GiB.
-	volSizeBytes := int64(common.DefaultGbDiskSize * common.GbInBytes)
+	// Volume Size - Default is 10 GiB unless overridden in the config.
+	volSizeBytes := common.GetDefaultFileVolumeSizeInBytes(c.manager.CnsConfig)
 	if req.GetCapacityRange() != nil && req.GetCapacityRange().RequiredBytes != 0 {
 		volSizeBytes = int64(req.GetCapacityRange().GetRequiredBytes())
 	}
@@ -790,17 +900,20 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 			return nil, csifault.CSIInternalFault, logger.LogNewErrorCode(log, codes.Internal,
 				"no datastores found to create file volume")
 		}
+		cnsOpStart := time.Now()
 		volumeID, faultType, err = common.CreateFileVolumeUtil(ctx, cnstypes.CnsClusterFlavorVanilla,
 			c.manager, &createVolumeSpec, filteredDatastores, filterSuspendedDatastores)
+		common.ObserveCnsUtilOpLatency(prometheus.PrometheusFileVolumeType, prometheus.PrometheusCreateVolumeOpType,
+			cnsOpStart, err)
 		if err != nil {
-			return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
+			return nil, faultType, logger.LogNewErrorCodef(log, common.GetCreateVolumeErrorCode(err),
 				"failed to create volume. Error: %+v", err)
 		}
 	} else {
 		volumeID, faultType, err = common.CreateFileVolumeUtilOld(ctx, cnstypes.CnsClusterFlavorVanilla,
 			c.manager, &createVolumeSpec, filterSuspendedDatastores)
 		if err != nil {
-			return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
+			return nil, faultType, logger.LogNewErrorCodef(log, common.GetCreateVolumeErrorCode(err),
 				"failed to create volume. Error: %+v", err)
 		}
 	}
@@ -843,6 +956,10 @@ func (c *controller) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequ
 		}
 		if common.IsFileVolumeRequest(ctx, volumeCapabilities) {
 			volumeType = prometheus.PrometheusFileVolumeType
+			if c.manager.CnsConfig.Global.DisableFileVolume {
+				return nil, csifault.CSIUnimplementedFault, logger.LogNewErrorCode(log, codes.Unimplemented,
+					"file volume support is disabled in the vSphere CSI driver configuration")
+			}
 			isvSANFileServicesSupported, err := c.manager.VcenterManager.IsvSANFileServicesSupported(ctx,
 				c.manager.VcenterConfig.Host)
 			if err != nil {
@@ -861,6 +978,7 @@ func (c *controller) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequ
 	resp, faultType, err := createVolumeInternal()
 	log.Debugf("createVolumeInternal: returns fault %q", faultType)
 	if err != nil {
+		common.SetRetryAfterTrailer(ctx, err)
 		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusCreateVolumeOpType,
 			prometheus.PrometheusFailStatus, namespace, faultType).Observe(time.Since(start).Seconds())
 	} else {
@@ -943,7 +1061,7 @@ func (c *controller) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequ
 			}
 			if isCnsSnapshotSupported {
 				snapshots, _, err := common.QueryVolumeSnapshotsByVolumeID(ctx, c.manager.VolumeManager, req.VolumeId,
-					common.QuerySnapshotLimit)
+					"", common.QuerySnapshotLimit)
 				if err != nil {
 					return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
 						"failed to retrieve snapshots for volume: %s. Error: %+v", req.VolumeId, err)
@@ -958,7 +1076,9 @@ func (c *controller) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequ
 				}
 			}
 		}
+		cnsOpStart := time.Now()
 		faultType, err = common.DeleteVolumeUtil(ctx, c.manager.VolumeManager, req.VolumeId, true)
+		common.ObserveCnsUtilOpLatency(volumeType, prometheus.PrometheusDeleteVolumeOpType, cnsOpStart, err)
 		if err != nil {
 			return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
 				"failed to delete volume: %q. Error: %+v", req.VolumeId, err)
@@ -1089,7 +1209,9 @@ func (c *controller) ControllerPublishVolume(ctx context.Context, req *csi.Contr
 			}
 			log.Debugf("Found VirtualMachine for node:%q.", req.NodeId)
 			// faultType is returned from manager.AttachVolume.
+			cnsOpStart := time.Now()
 			diskUUID, faultType, err := common.AttachVolumeUtil(ctx, c.manager, node, req.VolumeId, false)
+			common.ObserveCnsUtilOpLatency(volumeType, prometheus.PrometheusAttachVolumeOpType, cnsOpStart, err)
 			if err != nil {
 				return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
 					"failed to attach disk: %+q with node: %q err %+v", req.VolumeId, req.NodeId, err)
@@ -1211,7 +1333,9 @@ func (c *controller) ControllerUnpublishVolume(ctx context.Context, req *csi.Con
 			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
 				"failed to find VirtualMachine for node:%q. Error: %v", req.NodeId, err)
 		}
+		cnsOpStart := time.Now()
 		faultType, err = common.DetachVolumeUtil(ctx, c.manager, node, req.VolumeId)
+		common.ObserveCnsUtilOpLatency(volumeType, prometheus.PrometheusDetachVolumeOpType, cnsOpStart, err)
 		if err != nil {
 			return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
 				"failed to detach disk: %+q from node: %q err %+v", req.VolumeId, req.NodeId, err)
@@ -1285,7 +1409,7 @@ func (c *controller) ControllerExpandVolume(ctx context.Context, req *csi.Contro
 			}
 			if isCnsSnapshotSupported {
 				snapshots, _, err := common.QueryVolumeSnapshotsByVolumeID(ctx, c.manager.VolumeManager, volumeID,
-					common.QuerySnapshotLimit)
+					"", common.QuerySnapshotLimit)
 				if err != nil {
 					return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
 						"failed to retrieve snapshots for volume: %s. Error: %+v", volumeID, err)
@@ -1301,10 +1425,12 @@ func (c *controller) ControllerExpandVolume(ctx context.Context, req *csi.Contro
 			}
 		}
 
+		cnsOpStart := time.Now()
 		faultType, err = common.ExpandVolumeUtil(ctx, c.manager, volumeID, volSizeMB,
 			commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.AsyncQueryVolume))
+		common.ObserveCnsUtilOpLatency(volumeType, prometheus.PrometheusExpandVolumeOpType, cnsOpStart, err)
 		if err != nil {
-			return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
+			return nil, faultType, logger.LogNewErrorCodef(log, common.GetExpandVolumeErrorCode(faultType),
 				"failed to expand volume: %q to size: %d with error: %+v", volumeID, volSizeMB, err)
 		}
 
@@ -1359,7 +1485,82 @@ func (c *controller) ListVolumes(ctx context.Context, req *csi.ListVolumesReques
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
 	log.Infof("ListVolumes: called with args %+v", *req)
-	return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "listVolumes")
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.ListVolumes) {
+		return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "listVolumes")
+	}
+	err := validateVanillaListVolumesRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var offset int64
+	if req.StartingToken != "" {
+		offset, _ = strconv.ParseInt(req.StartingToken, 10, 64)
+	}
+	limit := int64(c.manager.CnsConfig.Global.QueryLimit)
+	if limit <= 0 {
+		limit = cnsconfig.DefaultQueryLimit
+	}
+	if req.MaxEntries != 0 {
+		limit = int64(req.MaxEntries)
+	}
+	queryFilter := cnstypes.CnsQueryFilter{
+		ContainerClusterIds: []string{c.manager.CnsConfig.Global.ClusterID},
+		Cursor: &cnstypes.CnsCursor{
+			Offset: offset,
+			Limit:  limit,
+		},
+	}
+	querySelection := &cnstypes.CnsQuerySelection{
+		Names: []string{
+			string(cnstypes.QuerySelectionNameTypeBackingObjectDetails),
+			string(cnstypes.QuerySelectionNameTypeHealthStatus),
+		},
+	}
+	queryResult, err := utils.QueryVolumeUtil(ctx, c.manager.VolumeManager, queryFilter, querySelection,
+		commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.AsyncQueryVolume))
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to query volumes with offset: %d and limit: %d. Error: %+v", offset, limit, err)
+	}
+	if queryResult == nil {
+		return &csi.ListVolumesResponse{}, nil
+	}
+	if offset > queryResult.Cursor.TotalRecords {
+		return nil, logger.LogNewErrorCodef(log, codes.Aborted,
+			"ListVolumes StartingToken: %s is greater than the total number of volumes: %d",
+			req.StartingToken, queryResult.Cursor.TotalRecords)
+	}
+	var volumeIDs []string
+	for _, volume := range queryResult.Volumes {
+		volumeIDs = append(volumeIDs, volume.VolumeId.Id)
+	}
+	volumeIDToNodeIDs := c.getPublishedNodeIDsForVolumes(ctx, volumeIDs)
+	var entries []*csi.ListVolumesResponse_Entry
+	for _, volume := range queryResult.Volumes {
+		var capacityBytes int64
+		if volume.BackingObjectDetails != nil {
+			capacityBytes = volume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb * common.MbInBytes
+		}
+		entries = append(entries, &csi.ListVolumesResponse_Entry{
+			Volume: &csi.Volume{
+				VolumeId:      volume.VolumeId.Id,
+				CapacityBytes: capacityBytes,
+			},
+			Status: &csi.ListVolumesResponse_VolumeStatus{
+				PublishedNodeIds: volumeIDToNodeIDs[volume.VolumeId.Id],
+				VolumeCondition:  common.GetVolumeCondition(ctx, volume.VolumeId.Id, volume.HealthStatus),
+			},
+		})
+	}
+	var nextToken string
+	if queryResult.Cursor.Offset < queryResult.Cursor.TotalRecords {
+		nextToken = strconv.FormatInt(queryResult.Cursor.Offset, 10)
+	}
+	log.Infof("ListVolumes served %d results, token for next set: %s", len(entries), nextToken)
+	return &csi.ListVolumesResponse{
+		Entries:   entries,
+		NextToken: nextToken,
+	}, nil
 }
 
 func (c *controller) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (
@@ -1367,7 +1568,64 @@ func (c *controller) GetCapacity(ctx context.Context, req *csi.GetCapacityReques
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
 	log.Infof("GetCapacity: called with args %+v", *req)
-	return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "getCapacity")
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CapacityTracking) {
+		return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "getCapacity")
+	}
+	var (
+		sharedDatastores []*cnsvsphere.DatastoreInfo
+		err              error
+	)
+	if req.GetAccessibleTopology() != nil &&
+		commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.ImprovedVolumeTopology) {
+		topologyRequirement := &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{req.GetAccessibleTopology()},
+		}
+		sharedDatastores, err = c.topologyMgr.GetSharedDatastoresInTopology(ctx,
+			commoncotypes.VanillaTopologyFetchDSParams{TopologyRequirement: topologyRequirement})
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, common.GetTopologyErrorCode(err),
+				"failed to get shared datastores for topology: %+v. Error: %+v",
+				req.GetAccessibleTopology(), err)
+		}
+	} else {
+		sharedDatastores, err = c.nodeMgr.GetSharedDatastoresInK8SCluster(ctx)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get shared datastores in kubernetes cluster. Error: %+v", err)
+		}
+	}
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIAuthCheck) {
+		sharedDatastores = c.filterDatastores(ctx, sharedDatastores)
+	}
+	var datastoreURL string
+	for paramName, value := range req.GetParameters() {
+		if strings.ToLower(paramName) == common.AttributeDatastoreURL {
+			datastoreURL = value
+		}
+	}
+	vc, err := common.GetVCenter(ctx, c.manager)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get vCenter from Manager. Error: %v", err)
+	}
+	storagePolicyID, err := common.GetStoragePolicyIDFromParams(ctx, vc, req.GetParameters())
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument, "%v", err)
+	}
+	if storagePolicyID != "" {
+		sharedDatastores, err = getStoragePolicyCompatibleDatastores(ctx, vc, storagePolicyID, sharedDatastores)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get datastores compatible with storage policy %q. Error: %+v", storagePolicyID, err)
+		}
+	}
+	availableCapacity, maximumVolumeSize := common.GetDatastoresCapacity(sharedDatastores, datastoreURL)
+	log.Infof("GetCapacity: available capacity %d bytes and maximum volume size %d bytes for topology %+v",
+		availableCapacity, maximumVolumeSize, req.GetAccessibleTopology())
+	return &csi.GetCapacityResponse{
+		AvailableCapacity: availableCapacity,
+		MaximumVolumeSize: wrapperspb.Int64(maximumVolumeSize),
+	}, nil
 }
 
 // initVolumeMigrationService is a helper method to initialize
@@ -1402,6 +1660,16 @@ func (c *controller) ControllerGetCapabilities(ctx context.Context, req *csi.Con
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
 		csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+	}
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.ListVolumes) {
+		controllerCaps = append(controllerCaps, csi.ControllerServiceCapability_RPC_LIST_VOLUMES)
+	}
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.VolumeHealth) {
+		controllerCaps = append(controllerCaps, csi.ControllerServiceCapability_RPC_GET_VOLUME)
+	}
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CapacityTracking) {
+		controllerCaps = append(controllerCaps, csi.ControllerServiceCapability_RPC_GET_CAPACITY)
 	}
 
 	var caps []*csi.ControllerServiceCapability
@@ -1422,250 +1690,76 @@ func (c *controller) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshot
 	*csi.CreateSnapshotResponse, error) {
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
-	log.Infof("CreateSnapshot: called with args %+v", *req)
-
-	isBlockVolumeSnapshotEnabled := commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot)
-	if !isBlockVolumeSnapshotEnabled {
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot) {
 		return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "createSnapshot")
 	}
-	isCnsSnapshotSupported, err := c.manager.VcenterManager.IsCnsSnapshotSupported(ctx,
-		c.manager.VcenterConfig.Host)
-	if err != nil {
-		return nil, logger.LogNewErrorCodef(log, codes.Internal,
-			"failed to check if cns snapshot is supported on VC due to error: %v", err)
-	}
-	if !isCnsSnapshotSupported {
-		return nil, logger.LogNewErrorCode(log, codes.Unimplemented,
-			"VC version does not support snapshot operations")
-	}
-	volumeType := prometheus.PrometheusUnknownVolumeType
-	namespace := prometheus.PrometheusUnknownNamespace
-	createSnapshotInternal := func() (*csi.CreateSnapshotResponse, error) {
-		// Validate CreateSnapshotRequest
-		if err := validateVanillaCreateSnapshotRequestRequest(ctx, req); err != nil {
-			return nil, logger.LogNewErrorCodef(log, codes.Internal,
-				"validation for CreateSnapshot Request: %+v has failed. Error: %v", *req, err)
-		}
-		volumeID := req.GetSourceVolumeId()
-
-		// Check if the source volume is migrated vSphere volume
-		if strings.Contains(volumeID, ".vmdk") {
-			return nil, logger.LogNewErrorCodef(log, codes.Unimplemented,
-				"cannot snapshot migrated vSphere volume. :%q", volumeID)
-		}
-		volumeType = prometheus.PrometheusBlockVolumeType
-		// Query capacity in MB and datastore url for block volume snapshot
-		volumeIds := []cnstypes.CnsVolumeId{{Id: volumeID}}
-		cnsVolumeDetailsMap, err := utils.QueryVolumeDetailsUtil(ctx, c.manager.VolumeManager, volumeIds)
-		if err != nil {
-			return nil, err
-		}
-		if _, ok := cnsVolumeDetailsMap[volumeID]; !ok {
-			return nil, logger.LogNewErrorCodef(log, codes.Internal,
-				"cns query volume did not return the volume: %s", volumeID)
-		}
-		snapshotSizeInMB := cnsVolumeDetailsMap[volumeID].SizeInMB
-		datastoreUrl := cnsVolumeDetailsMap[volumeID].DatastoreUrl
-		if cnsVolumeDetailsMap[volumeID].VolumeType != common.BlockVolumeType {
-			return nil, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
-				"queried volume doesn't have the expected volume type. Expected VolumeType: %v. "+
-					"Queried VolumeType: %v", volumeType, cnsVolumeDetailsMap[volumeID].VolumeType)
-		}
-		// Check if snapshots number of this volume reaches the granular limit on VSAN/VVOL
-		maxSnapshotsPerBlockVolume := c.manager.CnsConfig.Snapshot.GlobalMaxSnapshotsPerBlockVolume
-		log.Infof("The limit of the maximum number of snapshots per block volume is "+
-			"set to the global maximum (%v) by default.", maxSnapshotsPerBlockVolume)
-		if c.manager.CnsConfig.Snapshot.GranularMaxSnapshotsPerBlockVolumeInVSAN > 0 ||
-			c.manager.CnsConfig.Snapshot.GranularMaxSnapshotsPerBlockVolumeInVVOL > 0 {
-
-			var isGranularMaxEnabled bool
-			if strings.Contains(datastoreUrl, strings.ToLower(string(types.HostFileSystemVolumeFileSystemTypeVsan))) {
-				if c.manager.CnsConfig.Snapshot.GranularMaxSnapshotsPerBlockVolumeInVSAN > 0 {
-					maxSnapshotsPerBlockVolume = c.manager.CnsConfig.Snapshot.GranularMaxSnapshotsPerBlockVolumeInVSAN
-					isGranularMaxEnabled = true
-
-				}
-			} else if strings.Contains(datastoreUrl, strings.ToLower(string(types.HostFileSystemVolumeFileSystemTypeVVOL))) {
-				if c.manager.CnsConfig.Snapshot.GranularMaxSnapshotsPerBlockVolumeInVVOL > 0 {
-					maxSnapshotsPerBlockVolume = c.manager.CnsConfig.Snapshot.GranularMaxSnapshotsPerBlockVolumeInVVOL
-					isGranularMaxEnabled = true
-				}
-			}
-
-			if isGranularMaxEnabled {
-				log.Infof("The limit of the maximum number of snapshots per block volume on datastore %q is "+
-					"overridden by the granular maximum (%v).", datastoreUrl, maxSnapshotsPerBlockVolume)
-			}
-		}
-
-		// Check if snapshots number of this volume reaches the limit
-		snapshotList, _, err := common.QueryVolumeSnapshotsByVolumeID(ctx, c.manager.VolumeManager, volumeID,
-			common.QuerySnapshotLimit)
-		if err != nil {
-			return nil, logger.LogNewErrorCodef(log, codes.Internal,
-				"failed to query snapshots of volume %s for the limit check. Error: %v", volumeID, err)
-		}
-
-		if len(snapshotList) >= maxSnapshotsPerBlockVolume {
-			return nil, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
-				"the number of snapshots on the source volume %s reaches the configured maximum (%v)",
-				volumeID, c.manager.CnsConfig.Snapshot.GlobalMaxSnapshotsPerBlockVolume)
-		}
-
-		// the returned snapshotID below is a combination of CNS VolumeID and CNS SnapshotID concatenated by the "+"
-		// sign. That is, a string of "<UUID>+<UUID>". Because, all other CNS snapshot APIs still require both
-		// VolumeID and SnapshotID as the input, while corresponding snapshot APIs in upstream CSI require SnapshotID.
-		// So, we need to bridge the gap in vSphere CSI driver and return a combined SnapshotID to CSI Snapshotter.
-		snapshotID, snapshotCreateTimePtr, err := common.CreateSnapshotUtil(ctx, c.manager, volumeID, req.Name)
-		if err != nil {
-			return nil, logger.LogNewErrorCodef(log, codes.Internal,
-				"failed to create snapshot on volume %q: %v", volumeID, err)
-		}
-		snapshotCreateTimeInProto := timestamppb.New(*snapshotCreateTimePtr)
-
-		createSnapshotResponse := &csi.CreateSnapshotResponse{
-			Snapshot: &csi.Snapshot{
-				SizeBytes:      snapshotSizeInMB * common.MbInBytes,
-				SnapshotId:     snapshotID,
-				SourceVolumeId: volumeID,
-				CreationTime:   snapshotCreateTimeInProto,
-				ReadyToUse:     true,
-			},
-		}
-
-		log.Infof("CreateSnapshot succeeded for snapshot %s "+
-			"on volume %s size %d Time proto %+v Timestamp %+v Response: %+v",
-			snapshotID, volumeID, snapshotSizeInMB*common.MbInBytes, snapshotCreateTimeInProto,
-			*snapshotCreateTimePtr, createSnapshotResponse)
-		return createSnapshotResponse, nil
-	}
-
-	start := time.Now()
-	resp, err := createSnapshotInternal()
-	if err != nil {
-		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusCreateSnapshotOpType,
-			prometheus.PrometheusFailStatus, namespace, "NotComputed").Observe(time.Since(start).Seconds())
-	} else {
-		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusCreateSnapshotOpType,
-			prometheus.PrometheusPassStatus, namespace, "").Observe(time.Since(start).Seconds())
-	}
-	return resp, err
+	return common.CreateSnapshot(ctx, c.manager, req)
 }
 
 func (c *controller) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (
 	*csi.DeleteSnapshotResponse, error) {
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
-	log.Infof("DeleteSnapshot: called with args %+v", *req)
-
-	isBlockVolumeSnapshotEnabled :=
-		commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot)
-	if !isBlockVolumeSnapshotEnabled {
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot) {
 		return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "deleteSnapshot")
 	}
-
-	isCnsSnapshotSupported, err := c.manager.VcenterManager.IsCnsSnapshotSupported(ctx,
-		c.manager.VcenterConfig.Host)
-	if err != nil {
-		return nil, logger.LogNewErrorCodef(log, codes.Internal,
-			"failed to check if cns snapshot is supported on VC due to error: %v", err)
-	}
-	if !isCnsSnapshotSupported {
-		return nil, logger.LogNewErrorCode(log, codes.Unimplemented,
-			"VC version does not support snapshot operations")
-	}
-
-	deleteSnapshotInternal := func() (*csi.DeleteSnapshotResponse, error) {
-		csiSnapshotID := req.GetSnapshotId()
-		err := common.DeleteSnapshotUtil(ctx, c.manager, csiSnapshotID)
-		if err != nil {
-			return nil, logger.LogNewErrorCodef(log, codes.Internal,
-				"Failed to delete snapshot %q. Error: %+v",
-				csiSnapshotID, err)
-		}
-
-		log.Infof("DeleteSnapshot: successfully deleted snapshot %q", csiSnapshotID)
-		return &csi.DeleteSnapshotResponse{}, nil
-	}
-
-	volumeType := prometheus.PrometheusBlockVolumeType
-	namespace := prometheus.PrometheusUnknownNamespace
-	start := time.Now()
-	resp, err := deleteSnapshotInternal()
-	if err != nil {
-		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusDeleteSnapshotOpType,
-			prometheus.PrometheusFailStatus, namespace, "NotComputed").Observe(time.Since(start).Seconds())
-	} else {
-		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusDeleteSnapshotOpType,
-			prometheus.PrometheusPassStatus, namespace, "").Observe(time.Since(start).Seconds())
-	}
-	return resp, err
-
+	return common.DeleteSnapshot(ctx, c.manager, req)
 }
 
 func (c *controller) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (
 	*csi.ListSnapshotsResponse, error) {
-	start := time.Now()
 	ctx = logger.NewContextWithLogger(ctx)
-	log := logger.GetLogger(ctx)
-	volumeType := prometheus.PrometheusBlockVolumeType
-	namespace := prometheus.PrometheusUnknownNamespace
+	return common.ListSnapshots(ctx, c.manager, req)
+}
 
-	isCnsSnapshotSupported, err := c.manager.VcenterManager.IsCnsSnapshotSupported(ctx,
-		c.manager.VcenterConfig.Host)
-	if err != nil {
-		return nil, logger.LogNewErrorCodef(log, codes.Internal,
-			"failed to check if cns snapshot is supported on VC due to error: %v", err)
+func (c *controller) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (
+	*csi.ControllerGetVolumeResponse, error) {
+	ctx = logger.NewContextWithLogger(ctx)
+	log := logger.GetLogger(ctx)
+	log.Infof("ControllerGetVolume: called with args %+v", *req)
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.VolumeHealth) {
+		return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "controllerGetVolume")
 	}
-	if !isCnsSnapshotSupported {
-		return nil, logger.LogNewErrorCode(log, codes.Unimplemented,
-			"VC version does not support snapshot operations")
+	volumeID := req.GetVolumeId()
+	if volumeID == "" {
+		return nil, logger.LogNewErrorCode(log, codes.InvalidArgument, "volume ID is a required parameter")
 	}
-
-	listSnapshotsInternal := func() (*csi.ListSnapshotsResponse, error) {
-		log.Infof("ListSnapshots: called with args %+v", *req)
-		err := validateVanillaListSnapshotRequest(ctx, req)
-		if err != nil {
-			return nil, err
-		}
-		maxEntries := common.QuerySnapshotLimit
-		if req.MaxEntries != 0 {
-			maxEntries = int64(req.MaxEntries)
-		}
-		snapshots, nextToken, err := common.ListSnapshotsUtil(ctx, c.manager.VolumeManager, req.SourceVolumeId,
-			req.SnapshotId, req.StartingToken, maxEntries)
-		if err != nil {
-			return nil, logger.LogNewErrorCodef(log, codes.Internal, " failed to retrieve the snapshots, err: %+v", err)
-		}
-		var entries []*csi.ListSnapshotsResponse_Entry
-		for _, snapshot := range snapshots {
-			entry := &csi.ListSnapshotsResponse_Entry{
-				Snapshot: snapshot,
-			}
-			entries = append(entries, entry)
-		}
-		resp := &csi.ListSnapshotsResponse{
-			Entries:   entries,
-			NextToken: nextToken,
-		}
-		log.Infof("ListSnapshot served %d results, token for next set: %s", len(entries), nextToken)
-		return resp, nil
+	queryFilter := cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeID}},
 	}
-	resp, err := listSnapshotsInternal()
+	querySelection := &cnstypes.CnsQuerySelection{
+		Names: []string{
+			string(cnstypes.QuerySelectionNameTypeVolumeType),
+			string(cnstypes.QuerySelectionNameTypeBackingObjectDetails),
+			string(cnstypes.QuerySelectionNameTypeHealthStatus),
+		},
+	}
+	queryResult, err := utils.QueryVolumeUtil(ctx, c.manager.VolumeManager, queryFilter, querySelection,
+		commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.AsyncQueryVolume))
 	if err != nil {
-		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusListSnapshotsOpType,
-			prometheus.PrometheusFailStatus, namespace, "NotComputed").Observe(time.Since(start).Seconds())
-	} else {
-		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusListSnapshotsOpType,
-			prometheus.PrometheusPassStatus, namespace, "").Observe(time.Since(start).Seconds())
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to query volume %q. Error: %+v", volumeID, err)
 	}
-	return resp, err
+	if queryResult == nil || len(queryResult.Volumes) == 0 {
+		return nil, logger.LogNewErrorCodef(log, codes.NotFound, "volume %q not found", volumeID)
+	}
+	volume := queryResult.Volumes[0]
+	var publishedNodeIDs []string
+	if volume.VolumeType == common.BlockVolumeType {
+		publishedNodeIDs = c.getPublishedNodeIDsForVolumes(ctx, []string{volumeID})[volumeID]
+	}
+	resp := getControllerGetVolumeResponse(ctx, volume, publishedNodeIDs)
+	log.Infof("ControllerGetVolume: volume %q has condition %+v and is published to nodes %v", volumeID,
+		resp.Status.VolumeCondition, publishedNodeIDs)
+	return resp, nil
 }
 
-func (c *controller) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (
-	*csi.ControllerGetVolumeResponse, error) {
+// ControllerModifyVolume is not supported, as volumes are not advertised as
+// modifiable in the controller capabilities.
+func (c *controller) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (
+	*csi.ControllerModifyVolumeResponse, error) {
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
-	log.Infof("ControllerGetVolume: called with args %+v", *req)
-	return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "controllerGetVolume")
+	log.Infof("ControllerModifyVolume: called with args %+v", req)
+	return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "controllerModifyVolume")
 }
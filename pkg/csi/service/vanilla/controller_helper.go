@@ -18,17 +18,21 @@ package vanilla
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	cnstypes "github.com/vmware/govmomi/cns/types"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/node"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/vsphere"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/prometheus"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common/commonco"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/logger"
 )
 
@@ -82,47 +86,18 @@ func validateVanillaControllerExpandVolumeRequest(ctx context.Context,
 	return common.IsOnlineExpansion(ctx, req.GetVolumeId(), nodes)
 }
 
-// validateVanillaCreateSnapshotRequestRequest is the helper function to
-// validate CreateSnapshotRequest for Vanilla CSI driver.
-// Function returns error if validation fails otherwise returns nil.
-func validateVanillaCreateSnapshotRequestRequest(ctx context.Context, req *csi.CreateSnapshotRequest) error {
+func validateVanillaListVolumesRequest(ctx context.Context, req *csi.ListVolumesRequest) error {
 	log := logger.GetLogger(ctx)
-	volumeID := req.GetSourceVolumeId()
-	if len(volumeID) == 0 {
-		return logger.LogNewErrorCode(log, codes.InvalidArgument,
-			"CreateSnapshot Source Volume ID must be provided")
-	}
-
-	if len(req.Name) == 0 {
-		return logger.LogNewErrorCode(log, codes.InvalidArgument,
-			"Snapshot name must be provided")
-	}
-	return nil
-}
-
-func validateVanillaListSnapshotRequest(ctx context.Context, req *csi.ListSnapshotsRequest) error {
-	log := logger.GetLogger(ctx)
-	maxEntries := req.MaxEntries
-	if maxEntries < 0 {
+	if req.MaxEntries < 0 {
 		return logger.LogNewErrorCodef(log, codes.InvalidArgument,
-			"ListSnapshots MaxEntries: %d cannot be negative", maxEntries)
+			"ListVolumes MaxEntries: %d cannot be negative", req.MaxEntries)
 	}
 	// validate the starting token by verifying that it can be converted to a int
 	if req.StartingToken != "" {
-		_, err := strconv.Atoi(req.StartingToken)
-		if err != nil {
-			return logger.LogNewErrorCodef(log, codes.InvalidArgument,
-				"ListSnapshots StartingToken: %s cannot be parsed", req.StartingToken)
-		}
-	}
-	// validate snapshot-id conforms to vSphere CSI driver format if specified.
-	if req.SnapshotId != "" {
-		// check for the delimiter "+" in the snapshot-id.
-		check := strings.Contains(req.SnapshotId, common.VSphereCSISnapshotIdDelimiter)
-		if !check {
-			return logger.LogNewErrorCodef(log, codes.InvalidArgument,
-				"ListSnapshots SnapshotId: %s is incorrectly formatted for vSphere CSI driver",
-				req.StartingToken)
+		offset, err := strconv.Atoi(req.StartingToken)
+		if err != nil || offset < 0 {
+			return logger.LogNewErrorCodef(log, codes.Aborted,
+				"ListVolumes StartingToken: %s cannot be parsed", req.StartingToken)
 		}
 	}
 	return nil
@@ -137,3 +112,98 @@ func convertCnsVolumeType(ctx context.Context, cnsVolumeType string) string {
 	}
 	return volumeType
 }
+
+// nodeDatastoreInfo is the debug representation of a datastore accessible
+// to a node.
+type nodeDatastoreInfo struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// getAccessibleDatastoresForNode resolves the node VM for the given node name
+// and returns the datastores accessible to it.
+func (c *controller) getAccessibleDatastoresForNode(ctx context.Context,
+	nodeName string) ([]*cnsvsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	nodeVM, err := c.nodeMgr.GetNodeByName(ctx, nodeName)
+	if err != nil {
+		return nil, logger.LogNewErrorf(log, "failed to find VirtualMachine for node: %q. Error: %+v",
+			nodeName, err)
+	}
+	datastores, err := cnsvsphere.GetSharedDatastoresForVMs(ctx, []*cnsvsphere.VirtualMachine{nodeVM})
+	if err != nil {
+		return nil, logger.LogNewErrorf(log, "failed to get accessible datastores for node: %q. Error: %+v",
+			nodeName, err)
+	}
+	log.Debugf("Accessible datastores for node %q: %+v", nodeName, datastores)
+	return datastores, nil
+}
+
+// nodeDatastoresHandler serves the datastores accessible to the node given in
+// the "node" query parameter. It is meant to help debug volume placement.
+func (c *controller) nodeDatastoresHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, log := logger.GetNewContextWithLogger()
+	nodeName := r.URL.Query().Get("node")
+	if nodeName == "" {
+		http.Error(w, "query parameter \"node\" is required", http.StatusBadRequest)
+		return
+	}
+	datastores, err := c.getAccessibleDatastoresForNode(ctx, nodeName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := make([]nodeDatastoreInfo, 0, len(datastores))
+	for _, ds := range datastores {
+		resp = append(resp, nodeDatastoreInfo{Name: ds.Info.Name, URL: ds.Info.Url})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(resp); err != nil {
+		log.Errorf("failed to write accessible datastores for node %q. Error: %+v", nodeName, err)
+	}
+}
+
+// getPublishedNodeIDsForVolumes returns the IDs of the nodes each of the given
+// volumes is attached to, as recorded in the VolumeAttachments of the cluster.
+func (c *controller) getPublishedNodeIDsForVolumes(ctx context.Context,
+	volumeIDs []string) map[string][]string {
+	log := logger.GetLogger(ctx)
+	useNodeUUID := commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.UseCSINodeId)
+	volumeIDToNodeIDs := make(map[string][]string)
+	for volumeID, nodeNames := range commonco.ContainerOrchestratorUtility.GetNodesForVolumes(ctx, volumeIDs) {
+		for _, nodeName := range nodeNames {
+			if !useNodeUUID {
+				volumeIDToNodeIDs[volumeID] = append(volumeIDToNodeIDs[volumeID], nodeName)
+				continue
+			}
+			nodeVM, err := c.nodeMgr.GetNodeByName(ctx, nodeName)
+			if err != nil {
+				log.Warnf("failed to get VM of node %q which volume %q is attached to. Error: %+v",
+					nodeName, volumeID, err)
+				continue
+			}
+			volumeIDToNodeIDs[volumeID] = append(volumeIDToNodeIDs[volumeID], nodeVM.UUID)
+		}
+	}
+	return volumeIDToNodeIDs
+}
+
+// getControllerGetVolumeResponse builds the ControllerGetVolumeResponse of the
+// given CNS volume published to the given nodes.
+func getControllerGetVolumeResponse(ctx context.Context, volume cnstypes.CnsVolume,
+	publishedNodeIDs []string) *csi.ControllerGetVolumeResponse {
+	var capacityBytes int64
+	if volume.BackingObjectDetails != nil {
+		capacityBytes = volume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb * common.MbInBytes
+	}
+	return &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      volume.VolumeId.Id,
+			CapacityBytes: capacityBytes,
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			PublishedNodeIds: publishedNodeIDs,
+			VolumeCondition:  common.GetVolumeCondition(ctx, volume.VolumeId.Id, volume.HealthStatus),
+		},
+	}
+}
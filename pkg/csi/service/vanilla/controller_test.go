@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"reflect"
 	"sync"
 	"testing"
 
@@ -55,6 +56,7 @@ import (
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/unittestcommon"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common/commonco"
+	commoncotypes "sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common/commonco/types"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/internalapis/cnsvolumeoperationrequest"
 	k8s "sigs.k8s.io/vsphere-csi-driver/v2/pkg/kubernetes"
 )
@@ -305,6 +307,8 @@ func (f *FakeAuthManager) ResetvCenterInstance(ctx context.Context, vCenter *cns
 	f.vcenter = vCenter
 }
 
+func (f *FakeAuthManager) RefreshFsEnabledClusterToDsMap(ctx context.Context) {}
+
 func getControllerTest(t *testing.T) *controllerTest {
 	onceForControllerTest.Do(func() {
 		// Create context.
@@ -367,6 +371,7 @@ func getControllerTest(t *testing.T) *controllerTest {
 			authMgr: &FakeAuthManager{
 				vcenter: vcenter,
 			},
+			operationStore: fakeOpStore,
 		}
 		commonco.ContainerOrchestratorUtility, err =
 			unittestcommon.GetFakeContainerOrchestratorInterface(common.Kubernetes)
@@ -493,6 +498,51 @@ func TestCreateVolumeWithStoragePolicy(t *testing.T) {
 // to deploy CSI does not have Datastore.FileManagement privilege on all shared
 // datastores, the create volume should succeed. This test is to simulate CSI
 // on VMC.
+// TestCreateVolumeWithIncompatibleExistingCapacity verifies that a retry of
+// CreateVolume is rejected with AlreadyExists if the volume created earlier
+// for the same name is smaller than the requested capacity.
+func TestCreateVolumeWithIncompatibleExistingCapacity(t *testing.T) {
+	ct := getControllerTest(t)
+	params := make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		params[common.AttributeDatastoreURL] = v
+	}
+	reqCreate := &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		Parameters: params,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, reqCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		_, err := ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if _, err = ct.controller.CreateVolume(ctx, reqCreate); err != nil {
+		t.Fatalf("expected a retry with the same capacity to succeed but got %v", err)
+	}
+	reqCreate.CapacityRange.RequiredBytes = 2 * common.GbInBytes
+	_, err = ct.controller.CreateVolume(ctx, reqCreate)
+	if status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("expected AlreadyExists for a retry with a larger capacity but got %v", err)
+	}
+}
+
 func TestCreateVolumeWithMultipleDatastores(t *testing.T) {
 	// Create context.
 	ct := getControllerTest(t)
@@ -645,6 +695,19 @@ func TestExtendVolume(t *testing.T) {
 	}
 	t.Log(fmt.Sprintf("ControllerExpandVolume succeeded: volume is expanded to requested size %d", newSize))
 
+	// Shrink Volume.
+	reqShrink := &csi.ControllerExpandVolumeRequest{
+		VolumeId: volID,
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		VolumeCapability: capabilities[0],
+	}
+	_, err = ct.controller.ControllerExpandVolume(ctx, reqShrink)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument when shrinking volume with ID: %s but got %v", volID, err)
+	}
+
 	// Query volume after expand volume.
 	queryFilter = cnstypes.CnsQueryFilter{
 		VolumeIds: []cnstypes.CnsVolumeId{
@@ -2151,3 +2214,281 @@ func TestDeleteBlockVolumeSnapshotWithManagedObjectNotFound(t *testing.T) {
 		t.Fatalf("Unexpected error is thrown in DeleteSnapshot with error: %v", err)
 	}
 }
+
+func TestGetControllerGetVolumeResponse(t *testing.T) {
+	tests := []struct {
+		name             string
+		healthStatus     string
+		expectedAbnormal bool
+	}{
+		{name: "healthy", healthStatus: "green", expectedAbnormal: false},
+		{name: "abnormal", healthStatus: "red", expectedAbnormal: true},
+	}
+	for _, test := range tests {
+		volume := cnstypes.CnsVolume{
+			VolumeId:     cnstypes.CnsVolumeId{Id: uuid.New().String()},
+			HealthStatus: test.healthStatus,
+		}
+		resp := getControllerGetVolumeResponse(ctx, volume, []string{"node1"})
+		if resp.Volume.VolumeId != volume.VolumeId.Id {
+			t.Errorf("%s: expected volume ID %q but got %q", test.name, volume.VolumeId.Id, resp.Volume.VolumeId)
+		}
+		if resp.Status.VolumeCondition.Abnormal != test.expectedAbnormal {
+			t.Errorf("%s: expected abnormal %t but got %t with message %q", test.name, test.expectedAbnormal,
+				resp.Status.VolumeCondition.Abnormal, resp.Status.VolumeCondition.Message)
+		}
+		if len(resp.Status.PublishedNodeIds) != 1 || resp.Status.PublishedNodeIds[0] != "node1" {
+			t.Errorf("%s: unexpected published node IDs %v", test.name, resp.Status.PublishedNodeIds)
+		}
+	}
+}
+
+func TestControllerGetVolumeNotFound(t *testing.T) {
+	ct := getControllerTest(t)
+	_, err := ct.controller.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{
+		VolumeId: uuid.New().String(),
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound error but got: %v", err)
+	}
+}
+
+func TestControllerGetVolume(t *testing.T) {
+	ct := getControllerTest(t)
+	params := make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		params[common.AttributeDatastoreURL] = v
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		Parameters: params,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		if _, err := ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	fakeCO := commonco.ContainerOrchestratorUtility.(*unittestcommon.FakeK8SOrchestrator)
+	fakeCO.SetNodesForVolume(volID, []string{"node1", "node2"})
+	defer fakeCO.SetNodesForVolume(volID, nil)
+
+	resp, err := ct.controller.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{VolumeId: volID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resp.Status.PublishedNodeIds, []string{"node1", "node2"}) {
+		t.Errorf("unexpected published node IDs %v", resp.Status.PublishedNodeIds)
+	}
+}
+
+func TestControllerGetVolumeDisabled(t *testing.T) {
+	ct := getControllerTest(t)
+	fakeCO := commonco.ContainerOrchestratorUtility.(*unittestcommon.FakeK8SOrchestrator)
+	fakeCO.SetFSS(common.VolumeHealth, false)
+	defer fakeCO.SetFSS(common.VolumeHealth, true)
+
+	_, err := ct.controller.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{VolumeId: uuid.New().String()})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected Unimplemented error but got: %v", err)
+	}
+	resp, err := ct.controller.ControllerGetCapabilities(ctx, &csi.ControllerGetCapabilitiesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, capability := range resp.Capabilities {
+		if capability.GetRpc().GetType() == csi.ControllerServiceCapability_RPC_GET_VOLUME {
+			t.Fatalf("GET_VOLUME capability is advertised while %s is disabled", common.VolumeHealth)
+		}
+	}
+}
+
+func TestListVolumes(t *testing.T) {
+	ct := getControllerTest(t)
+	params := make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		params[common.AttributeDatastoreURL] = v
+	}
+	reqCreate := &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		Parameters: params,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, reqCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		if _, err := ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	fakeCO := commonco.ContainerOrchestratorUtility.(*unittestcommon.FakeK8SOrchestrator)
+	fakeCO.SetNodesForVolume(volID, []string{"node1"})
+	defer fakeCO.SetNodesForVolume(volID, nil)
+
+	var entry *csi.ListVolumesResponse_Entry
+	req := &csi.ListVolumesRequest{}
+	for {
+		resp, err := ct.controller.ListVolumes(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range resp.Entries {
+			if e.Volume.VolumeId == volID {
+				entry = e
+			}
+		}
+		if entry != nil || resp.NextToken == "" || resp.NextToken == req.StartingToken {
+			break
+		}
+		req.StartingToken = resp.NextToken
+	}
+	if entry == nil {
+		t.Fatalf("volume %q is not listed by ListVolumes", volID)
+	}
+	if entry.Volume.CapacityBytes != 1*common.GbInBytes {
+		t.Errorf("expected capacity %d bytes but got %d", 1*common.GbInBytes, entry.Volume.CapacityBytes)
+	}
+	if len(entry.Status.PublishedNodeIds) != 1 || entry.Status.PublishedNodeIds[0] != "node1" {
+		t.Errorf("unexpected published node IDs %v", entry.Status.PublishedNodeIds)
+	}
+}
+
+func TestListVolumesDisabled(t *testing.T) {
+	ct := getControllerTest(t)
+	fakeCO := commonco.ContainerOrchestratorUtility.(*unittestcommon.FakeK8SOrchestrator)
+	fakeCO.SetFSS(common.ListVolumes, false)
+	defer fakeCO.SetFSS(common.ListVolumes, true)
+
+	_, err := ct.controller.ListVolumes(ctx, &csi.ListVolumesRequest{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected Unimplemented error but got: %v", err)
+	}
+	resp, err := ct.controller.ControllerGetCapabilities(ctx, &csi.ControllerGetCapabilitiesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, capability := range resp.Capabilities {
+		if capability.GetRpc().GetType() == csi.ControllerServiceCapability_RPC_LIST_VOLUMES {
+			t.Fatalf("LIST_VOLUMES capability is advertised while %s is disabled", common.ListVolumes)
+		}
+	}
+}
+
+func TestGetCapacity(t *testing.T) {
+	ct := getControllerTest(t)
+	resp, err := ct.controller.GetCapacity(ctx, &csi.GetCapacityRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.AvailableCapacity <= 0 {
+		t.Fatalf("expected a positive available capacity but got %d", resp.AvailableCapacity)
+	}
+
+	// The simulator does not implement PbmCheckCompatibility, so no datastore
+	// is reported as compatible with the storage policy.
+	var checkedStoragePolicyID string
+	defer func(f func(context.Context, *cnsvsphere.VirtualCenter, string,
+		[]*cnsvsphere.DatastoreInfo) ([]*cnsvsphere.DatastoreInfo, error)) {
+		getStoragePolicyCompatibleDatastores = f
+	}(getStoragePolicyCompatibleDatastores)
+	getStoragePolicyCompatibleDatastores = func(ctx context.Context, vc *cnsvsphere.VirtualCenter,
+		storagePolicyID string, datastores []*cnsvsphere.DatastoreInfo) ([]*cnsvsphere.DatastoreInfo, error) {
+		checkedStoragePolicyID = storagePolicyID
+		return nil, nil
+	}
+	policyResp, err := ct.controller.GetCapacity(ctx, &csi.GetCapacityRequest{
+		Parameters: map[string]string{common.AttributeStoragePolicyName: "vSAN Default Storage Policy"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkedStoragePolicyID == "" {
+		t.Fatal("expected the storage policy name to be resolved to its ID")
+	}
+	if policyResp.AvailableCapacity != 0 {
+		t.Fatalf("expected no available capacity for the storage policy but got %d", policyResp.AvailableCapacity)
+	}
+	_, err = ct.controller.GetCapacity(ctx, &csi.GetCapacityRequest{
+		Parameters: map[string]string{common.AttributeStoragePolicyName: "non-existent-policy"},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument error for an unknown storage policy but got: %v", err)
+	}
+}
+
+// unsyncedTopologyMgr is a ControllerTopologyService whose informers have not
+// synced yet.
+type unsyncedTopologyMgr struct {
+	commoncotypes.ControllerTopologyService
+}
+
+func (m *unsyncedTopologyMgr) GetSharedDatastoresInTopology(ctx context.Context,
+	topologyFetchDSParams interface{}) ([]*cnsvsphere.DatastoreInfo, error) {
+	return nil, fmt.Errorf("CSINodeTopology informer has not synced: %w", common.ErrTopologyNotSynced)
+}
+
+// TestGetCapacityTopologyNotSynced verifies that GetCapacity for a topology
+// fails with Unavailable while the topology service has not synced.
+func TestGetCapacityTopologyNotSynced(t *testing.T) {
+	ct := getControllerTest(t)
+	fakeCO := commonco.ContainerOrchestratorUtility.(*unittestcommon.FakeK8SOrchestrator)
+	defer fakeCO.SetFSS(common.ImprovedVolumeTopology,
+		fakeCO.IsFSSEnabled(ctx, common.ImprovedVolumeTopology))
+	fakeCO.SetFSS(common.ImprovedVolumeTopology, true)
+
+	c := &controller{manager: ct.controller.manager, topologyMgr: &unsyncedTopologyMgr{}}
+	_, err := c.GetCapacity(ctx, &csi.GetCapacityRequest{
+		AccessibleTopology: &csi.Topology{
+			Segments: map[string]string{"topology.csi.vmware.com/k8s-zone": "zone-a"},
+		},
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable error but got: %v", err)
+	}
+}
+
+func TestGetCapacityDisabled(t *testing.T) {
+	ct := getControllerTest(t)
+	fakeCO := commonco.ContainerOrchestratorUtility.(*unittestcommon.FakeK8SOrchestrator)
+	fakeCO.SetFSS(common.CapacityTracking, false)
+	defer fakeCO.SetFSS(common.CapacityTracking, true)
+
+	_, err := ct.controller.GetCapacity(ctx, &csi.GetCapacityRequest{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected Unimplemented error but got: %v", err)
+	}
+	resp, err := ct.controller.ControllerGetCapabilities(ctx, &csi.ControllerGetCapabilitiesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, capability := range resp.Capabilities {
+		if capability.GetRpc().GetType() == csi.ControllerServiceCapability_RPC_GET_CAPACITY {
+			t.Fatalf("GET_CAPACITY capability is advertised while %s is disabled", common.CapacityTracking)
+		}
+	}
+}
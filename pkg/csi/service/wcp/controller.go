@@ -17,10 +17,12 @@ limitations under the License.
 package wcp
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -31,7 +33,7 @@ import (
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-	v1 "k8s.io/api/core/v1"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 
 	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/volume"
 	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/vsphere"
@@ -57,11 +59,16 @@ var (
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
 		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+		csi.ControllerServiceCapability_RPC_MODIFY_VOLUME,
 	}
 )
 
 var getCandidateDatastores = cnsvsphere.GetCandidateDatastoresInCluster
 
+// getStoragePolicyCompatibleDatastores returns the datastores compatible with
+// a storage policy. It is a variable so that tests can replace it.
+var getStoragePolicyCompatibleDatastores = common.GetStoragePolicyCompatibleDatastores
+
 // Contains list of clusterComputeResourceMoIds on which supervisor cluster is deployed.
 var clusterComputeResourceMoIds = make([]string, 0)
 
@@ -69,6 +76,11 @@ type controller struct {
 	manager     *common.Manager
 	authMgr     common.AuthorizationService
 	topologyMgr commoncotypes.ControllerTopologyService
+	// topologyMgrLock serializes the lazy initialization of topologyMgr.
+	topologyMgrLock sync.Mutex
+	// operationStore persists the reason of CreateVolume failures which occur
+	// before CNS is invoked. It is nil if idempotency handling is disabled.
+	operationStore cnsvolumeoperationrequest.VolumeOperationRequest
 }
 
 // New creates a CNS controller.
@@ -89,12 +101,9 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 			return err
 		}
 		if len(clusterComputeResourceMoIds) > 0 {
-			if config.Global.SupervisorID != "" {
-				// Use new SupervisorID for Volume Metadata when AvailabilityZone CR is present and
-				// config.Global.SupervisorID is not empty string
-				config.Global.ClusterID = config.Global.SupervisorID
-			} else {
-				return logger.LogNewError(log, "supervisor-id is not set in the vsphere-config-secret")
+			// Use new SupervisorID for Volume Metadata when AvailabilityZone CR is present.
+			if err = useSupervisorIDAsClusterID(ctx, config, ""); err != nil {
+				return err
 			}
 		}
 	}
@@ -126,14 +135,19 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 			return err
 		}
 	}
+	c.operationStore = operationStore
 	c.manager = &common.Manager{
-		VcenterConfig:  vcenterconfig,
-		CnsConfig:      config,
-		VolumeManager:  cnsvolume.GetManager(ctx, vcenter, operationStore, idempotencyHandlingEnabled),
+		VcenterConfig: vcenterconfig,
+		CnsConfig:     config,
+		VolumeManager: cnsvolume.GetManagerWithOptions(ctx, vcenter, operationStore, idempotencyHandlingEnabled,
+			cnsvolume.ManagerOptions{
+				FailOnOperationStoreUnavailable: config.Global.FailCreateVolumeOnOperationStoreUnavailable,
+			}),
 		VcenterManager: cnsvsphere.GetVirtualCenterManager(ctx),
 	}
 
-	vc, err := common.GetVCenter(ctx, c.manager)
+	vc, err := common.GetVCenterWithTimeout(ctx, c.manager,
+		time.Duration(config.Global.VCConnectTimeoutInSec)*time.Second, config.Global.VCConnectMaxAttempts)
 	if err != nil {
 		log.Errorf("failed to get vcenter. err=%v", err)
 		return err
@@ -173,6 +187,19 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 			log.Errorf("failed to initialize topology service. Error: %+v", err)
 			return err
 		}
+		if c.topologyMgr != nil {
+			c.topologyMgr.SetDrainingTopologyValues(ctx, common.GetDrainingTopologyValues(config))
+			// Wait for the initial sync here rather than on the request path. If
+			// the topology service is initialized lazily, requests fail with
+			// common.ErrTopologyNotSynced until the informer syncs.
+			c.topologyMgr.WaitForSync(ctx)
+		}
+	}
+	// Invalidate cached host moids of nodes which get deleted.
+	err = initHostMoidCacheInvalidation(ctx)
+	if err != nil {
+		log.Errorf("failed to initialize host moid cache invalidation. Error: %+v", err)
+		return err
 	}
 
 	cfgDirPath := filepath.Dir(cfgPath)
@@ -182,12 +209,23 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 		log.Errorf("failed to watch on path: %q. err=%v", cfgDirPath, err)
 		return err
 	}
-	caFileDirPath := filepath.Dir(cnsconfig.SupervisorCAFilePath)
-	log.Infof("Adding watch on path: %q", caFileDirPath)
-	err = watcher.Add(caFileDirPath)
-	if err != nil {
-		log.Errorf("failed to watch on path: %q. err=%v", caFileDirPath, err)
-		return err
+	// Watch the directory of each configured CA file. A rotation of any of
+	// these files re-establishes the connection with VC.
+	caFilePaths := make(map[string]struct{})
+	caFileDirPaths := make(map[string]struct{})
+	for _, caFilePath := range cnsconfig.GetSupervisorCAFilePaths(config) {
+		caFilePaths[caFilePath] = struct{}{}
+		caFileDirPath := filepath.Dir(caFilePath)
+		if _, exists := caFileDirPaths[caFileDirPath]; exists {
+			continue
+		}
+		log.Infof("Adding watch on path: %q", caFileDirPath)
+		err = watcher.Add(caFileDirPath)
+		if err != nil {
+			log.Errorf("failed to watch on path: %q. err=%v", caFileDirPath, err)
+			return err
+		}
+		caFileDirPaths[caFileDirPath] = struct{}{}
 	}
 
 	go func() {
@@ -199,19 +237,28 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 					return
 				}
 				log.Debugf("fsnotify event: %q", event.String())
-				expectedEvent :=
-					strings.Contains(event.Name, cfgDirPath) && !strings.Contains(event.Name, caFileDirPath)
-				if event.Op&fsnotify.Remove == fsnotify.Remove && expectedEvent {
-					for {
-						reloadConfigErr := c.ReloadConfiguration(false)
-						if reloadConfigErr == nil {
-							log.Infof("Successfully reloaded configuration from: %q", cfgPath)
-							break
-						}
-						log.Errorf("failed to reload configuration. will retry again in 5 seconds. err: %+v", reloadConfigErr)
-						time.Sleep(5 * time.Second)
+				expectedEvent := strings.Contains(event.Name, cfgDirPath)
+				for caFileDirPath := range caFileDirPaths {
+					if strings.Contains(event.Name, caFileDirPath) {
+						expectedEvent = false
+						break
 					}
 				}
+				if event.Op&fsnotify.Remove == fsnotify.Remove && expectedEvent {
+					common.RetryWithBackoff(common.GetReloadConfigBackoff(c.manager.CnsConfig), func() error {
+						return c.ReloadConfiguration(false)
+					}, func(reloadConfigErr error, wait time.Duration) {
+						prometheus.ReloadConfigOpsCounterVec.WithLabelValues(
+							prometheus.PrometheusReloadConfigTriggerConfigChange, prometheus.PrometheusFailStatus).Inc()
+						log.Errorf("failed to reload configuration. will retry again in %v. err: %+v", wait,
+							reloadConfigErr)
+					})
+					log.Infof("Successfully reloaded configuration from: %q", cfgPath)
+					prometheus.ReloadConfigOpsCounterVec.WithLabelValues(
+						prometheus.PrometheusReloadConfigTriggerConfigChange, prometheus.PrometheusPassStatus).Inc()
+					prometheus.ReloadConfigLastSuccessGaugeVec.WithLabelValues(
+						prometheus.PrometheusReloadConfigTriggerConfigChange).SetToCurrentTime()
+				}
 				// Handling create event for reconnecting to VC when ca file is
 				// rotated. In Supervisor cluster, ca file gets rotated at the path
 				// /etc/vmware/wcp/tls/vmca.pem. WCP is handling ca file rotation by
@@ -219,20 +266,23 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 				// contents, and then renaming the file back to
 				// /etc/vmware/wcp/tls/vmca.pem. For such operations, fsnotify
 				// handles the event as a CREATE event. The condition below also
-				// ensures that the event is for the expected ca file path.
-				if event.Op&fsnotify.Create == fsnotify.Create && event.Name == cnsconfig.SupervisorCAFilePath {
-					log.Infof("Observed ca file rotation at: %q", cnsconfig.SupervisorCAFilePath)
-					for {
-						reconnectVCErr := c.ReloadConfiguration(true)
-						if reconnectVCErr == nil {
-							log.Infof("Successfully re-established connection with VC from: %q",
-								cnsconfig.SupervisorCAFilePath)
-							break
-						}
-						log.Errorf("failed to re-establish VC connection. Will retry again in 60 seconds. err: %+v",
+				// ensures that the event is for one of the expected ca file paths.
+				_, isCAFileEvent := caFilePaths[event.Name]
+				if event.Op&fsnotify.Create == fsnotify.Create && isCAFileEvent {
+					log.Infof("Observed ca file rotation at: %q", event.Name)
+					common.RetryWithBackoff(common.GetReloadConfigBackoff(c.manager.CnsConfig), func() error {
+						return c.ReloadConfiguration(true)
+					}, func(reconnectVCErr error, wait time.Duration) {
+						prometheus.ReloadConfigOpsCounterVec.WithLabelValues(
+							prometheus.PrometheusReloadConfigTriggerCARotation, prometheus.PrometheusFailStatus).Inc()
+						log.Errorf("failed to re-establish VC connection. Will retry again in %v. err: %+v", wait,
 							reconnectVCErr)
-						time.Sleep(60 * time.Second)
-					}
+					})
+					log.Infof("Successfully re-established connection with VC from: %q", event.Name)
+					prometheus.ReloadConfigOpsCounterVec.WithLabelValues(
+						prometheus.PrometheusReloadConfigTriggerCARotation, prometheus.PrometheusPassStatus).Inc()
+					prometheus.ReloadConfigLastSuccessGaugeVec.WithLabelValues(
+						prometheus.PrometheusReloadConfigTriggerCARotation).SetToCurrentTime()
 				}
 			case err, ok := <-watcher.Errors:
 				if !ok {
@@ -245,12 +295,19 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 	}()
 
 	// Go module to keep the metrics http server running all the time.
+	metricsAddress := common.GetPrometheusMetricsAddress(ctx, config)
+	// The health probe endpoints are served by the same http server.
+	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/healthz", newHealthHandler(c.checkControllerLiveness))
+	http.Handle("/readyz", newHealthHandler(c.checkControllerReadiness))
+	// Expose the feature state switches seen by the controller to help debug.
+	commonco.RegisterFeatureStatesHandler(ctx)
+	common.StartDebugServer(ctx)
 	go func() {
 		prometheus.CsiInfo.WithLabelValues(version).Set(1)
 		for {
 			log.Info("Starting the http server to expose Prometheus metrics..")
-			http.Handle("/metrics", promhttp.Handler())
-			err = http.ListenAndServe(":2112", nil)
+			err = http.ListenAndServe(metricsAddress, nil)
 			if err != nil {
 				log.Warnf("Http server that exposes the Prometheus exited with err: %+v", err)
 			}
@@ -282,6 +339,7 @@ func (c *controller) ReloadConfiguration(reconnectToVCFromNewConfig bool) error
 	}
 	if newVCConfig != nil {
 		var vcenter *cnsvsphere.VirtualCenter
+		vcenterReconnected := false
 		if c.manager.VcenterConfig.Host != newVCConfig.Host ||
 			c.manager.VcenterConfig.Username != newVCConfig.Username ||
 			c.manager.VcenterConfig.Password != newVCConfig.Password || reconnectToVCFromNewConfig {
@@ -293,6 +351,12 @@ func (c *controller) ReloadConfiguration(reconnectToVCFromNewConfig bool) error
 				return logger.LogNewErrorf(log, "failed to connect to VirtualCenter host: %q, Err: %+v",
 					newVCConfig.Host, err)
 			}
+			// A successful connect doesn't guarantee a usable session. Issue a
+			// lightweight query before declaring the reconnection successful.
+			if err = newVC.ValidateConnection(ctx); err != nil {
+				return logger.LogNewErrorf(log, "failed to validate connection to VirtualCenter host: %q, Err: %+v",
+					newVCConfig.Host, err)
+			}
 
 			// Reset virtual center singleton instance by passing reload flag as
 			// true.
@@ -301,6 +365,7 @@ func (c *controller) ReloadConfiguration(reconnectToVCFromNewConfig bool) error
 			if err != nil {
 				return logger.LogNewErrorf(log, "failed to get VirtualCenter. err=%v", err)
 			}
+			vcenterReconnected = true
 		} else {
 			// If it's not a VC host or VC credentials update, same singleton
 			// instance can be used and it's Config field can be updated.
@@ -325,29 +390,52 @@ func (c *controller) ReloadConfiguration(reconnectToVCFromNewConfig bool) error
 				return err
 			}
 		}
+		fileShareClustersChanged := isTargetvSANFileShareClustersChanged(
+			c.manager.VcenterConfig.TargetvSANFileShareClusters, newVCConfig.TargetvSANFileShareClusters)
 		c.manager.VolumeManager.ResetManager(ctx, vcenter)
 		c.manager.VcenterConfig = newVCConfig
-		c.manager.VolumeManager = cnsvolume.GetManager(ctx, vcenter, operationStore,
-			commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIVolumeManagerIdempotency))
+		c.operationStore = operationStore
+		c.manager.VolumeManager = cnsvolume.GetManagerWithOptions(ctx, vcenter, operationStore,
+			commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIVolumeManagerIdempotency),
+			cnsvolume.ManagerOptions{
+				FailOnOperationStoreUnavailable: c.manager.CnsConfig.Global.FailCreateVolumeOnOperationStoreUnavailable,
+			})
 		if c.authMgr != nil {
 			c.authMgr.ResetvCenterInstance(ctx, vcenter)
 			log.Debugf("Updated vCenter in auth manager")
+			if fileShareClustersChanged {
+				// Refresh the file services enabled clusters right away so that
+				// file volume provisioning picks up the new target clusters
+				// without waiting for the next periodic auth check.
+				log.Infof("TargetvSANFileShareClusters changed to %v. Refreshing file share clusters.",
+					newVCConfig.TargetvSANFileShareClusters)
+				c.authMgr.RefreshFsEnabledClusterToDsMap(ctx)
+				validateTargetvSANFileShareClusters(ctx, newVCConfig.TargetvSANFileShareClusters,
+					c.authMgr.GetFsEnabledClusterToDsMap(ctx))
+			}
+		}
+		if vcenterReconnected {
+			// Rebuild the topology service so that the informers of the previous
+			// one are stopped instead of running alongside the new ones.
+			if err = c.resetTopologyMgr(ctx); err != nil {
+				return logger.LogNewErrorf(log, "failed to reinitialize topology service. Error: %+v", err)
+			}
 		}
 	}
 	if cfg != nil {
 		if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.TKGsHA) {
 			if len(clusterComputeResourceMoIds) > 0 {
-				if cfg.Global.SupervisorID != "" {
-					// Use new SupervisorID for Volume Metadata when AvailabilityZone CR is present and
-					// config.Global.SupervisorID is not empty string
-					cfg.Global.ClusterID = cfg.Global.SupervisorID
-				} else {
-					return logger.LogNewError(log, "supervisor-id is not set in the vsphere-config-secret")
+				// Use new SupervisorID for Volume Metadata when AvailabilityZone CR is present.
+				if err = useSupervisorIDAsClusterID(ctx, cfg, c.manager.CnsConfig.Global.ClusterID); err != nil {
+					return err
 				}
 			}
 		}
 		c.manager.CnsConfig = cfg
 		log.Debugf("Updated manager.CnsConfig")
+		if topologyMgr := c.getTopologyMgr(); topologyMgr != nil {
+			topologyMgr.SetDrainingTopologyValues(ctx, common.GetDrainingTopologyValues(cfg))
+		}
 	}
 	log.Info("Successfully reloaded configuration")
 	return nil
@@ -362,6 +450,14 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 		storagePolicyID      string
 		affineToHost         string
 		storagePool          string
+		datastoreClusterMoid string
+		datastoreAffinity    string
+		datastoreAllowList   []string
+		datastoreDenyList    []string
+		pvcName              string
+		pvcNamespace         string
+		hostLocal            bool
+		dryRun               bool
 		selectedDatastoreURL string
 		storageTopologyType  string
 		topologyRequirement  *csi.TopologyRequirement
@@ -371,7 +467,11 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 		vsanDirectDatastores []*cnsvsphere.DatastoreInfo
 		hostnameLabelPresent bool
 		zoneLabelPresent     bool
-		err                  error
+		isVsanDirectVolume   bool
+		// topologyMgr is the topology manager used to place a volume requested
+		// in zones.
+		topologyMgr commoncotypes.ControllerTopologyService
+		err         error
 	)
 
 	// Support case insensitive parameters.
@@ -382,9 +482,27 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 			storagePolicyID = req.Parameters[paramName]
 		case common.AttributeStoragePool:
 			storagePool = req.Parameters[paramName]
+		case common.AttributeDatastoreClusterMoid:
+			datastoreClusterMoid = req.Parameters[paramName]
+		case common.AttributeDatastoreAffinity:
+			datastoreAffinity = req.Parameters[paramName]
+		case common.AttributeDatastoreAllowList:
+			// Validated in validateWCPCreateVolumeRequest.
+			datastoreAllowList, _ = parseDatastoreURLList(req.Parameters[paramName])
+		case common.AttributeDatastoreDenyList:
+			// Validated in validateWCPCreateVolumeRequest.
+			datastoreDenyList, _ = parseDatastoreURLList(req.Parameters[paramName])
+		case common.AttributePVCName:
+			pvcName = req.Parameters[paramName]
+		case common.AttributePVCNamespace:
+			pvcNamespace = req.Parameters[paramName]
+		case common.AttributeHostLocal:
+			hostLocal = strings.EqualFold(req.Parameters[paramName], "true")
+		case common.AttributeDryRun:
+			dryRun = strings.EqualFold(req.Parameters[paramName], "true")
 		case common.AttributeStorageTopologyType:
-			// TODO: TKGS-HA : Add validation
-			storageTopologyType = req.Parameters[paramName]
+			// Validated in validateWCPCreateVolumeRequest.
+			storageTopologyType = strings.ToLower(req.Parameters[paramName])
 		}
 	}
 
@@ -396,48 +514,118 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
 			"failed to get vCenter from Manager. Error: %v", err)
 	}
+	// Reuse the context of a previous failed attempt to create this volume.
+	if failureReason := c.getPreviousCreateVolumeFailureReason(ctx, req.Name); failureReason != "" {
+		log.Infof("Previous attempt to create volume %q failed with reason %q. Retrying.", req.Name,
+			failureReason)
+	}
+	// Volume Size - Default is 10 GiB.
+	volSizeBytes := int64(common.DefaultGbDiskSize * common.GbInBytes)
+	if req.GetCapacityRange() != nil && req.GetCapacityRange().RequiredBytes != 0 {
+		volSizeBytes = int64(req.GetCapacityRange().GetRequiredBytes())
+	}
+	volSizeMB := int64(common.RoundUpSize(volSizeBytes, common.MbInBytes))
+	// A retry of CreateVolume with the same name must not be served with the
+	// volume created earlier if its capacity does not match the request.
+	if err := common.CheckExistingVolumeCapacity(ctx, c.manager, c.operationStore, req.Name,
+		req.GetCapacityRange()); err != nil {
+		return nil, csifault.CSIAlreadyExistsFault, err
+	}
 	// Fetch the accessibility requirements from the request.
 	topologyRequirement = req.GetAccessibilityRequirements()
-	filterSuspendedDatastores := commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CnsMgrSuspendCreateVolume)
-	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.TKGsHA) {
+	filterSuspendedDatastores := commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx,
+		common.CnsMgrSuspendCreateVolume) && !common.IsSuspendedDatastoreFilterOverridden(ctx, req.Parameters)
+	// StorageClasses with topology disabled provision cluster-wide volumes
+	// without consulting the topology manager.
+	topologyDisabled := isTopologyDisabled(req.Parameters)
+	if topologyDisabled {
+		if storageTopologyType != "" {
+			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"parameter %q cannot be set along with %q: %q", common.AttributeStorageTopologyType,
+				common.AttributeTopology, common.TopologyDisabled)
+		}
+		log.Infof("Topology is disabled for volume %q. Using cluster-wide candidate datastores", req.Name)
+	} else if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.TKGsHA) {
+		err = checkZonalTopologyRequirementWithoutTKGsHA(ctx, topologyRequirement,
+			c.manager.CnsConfig.Global.FailCreateVolumeOnZonesWithoutTKGsHA)
+		if err != nil {
+			return nil, csifault.CSIFailedPreconditionFault, err
+		}
+	}
+	// Bound the time spent in computing the topology of the volume so that the
+	// provisioner retries the request instead of blocking on slow topology.
+	topologyTimeout := time.Duration(c.manager.CnsConfig.Global.TopologyComputationTimeoutInSec) * time.Second
+	topologyStart := time.Now()
+	topologyCtx, cancelTopology := common.GetTopologyComputationContext(ctx, topologyTimeout, 0)
+	defer cancelTopology()
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.TKGsHA) && !topologyDisabled {
 		// Identify the topology keys in Accessibility requirements.
+		// Requirements with both zone and hostname labels are rejected in
+		// validateWCPCreateVolumeRequest.
 		hostnameLabelPresent, zoneLabelPresent = checkTopologyKeysFromAccessibilityReqs(topologyRequirement)
-		// TODO: TKGS-HA: This case will only arise when spherelet will add zone and hostname labels to CSINodes.
-		// Currently spherelet only accepts hostname. We will handle this case later.
-		if zoneLabelPresent && hostnameLabelPresent {
-			return nil, csifault.CSIUnimplementedFault, logger.LogNewErrorCodef(log, codes.Unimplemented,
-				"support for topology requirement with both zone and hostname labels is not yet implemented.")
-		} else if zoneLabelPresent {
+		if zoneLabelPresent {
 			// topologyMgr can be nil if the AZ CR was not been registered
 			// at the time of controller init. Handling that case in CreateVolume calls.
-			if c.topologyMgr == nil {
-				return nil, csifault.CSIInternalFault, logger.LogNewErrorCode(log, codes.Internal,
-					"topology manager not initialized.")
+			var faultType string
+			topologyMgr, faultType, err = c.getOrInitTopologyMgr(ctx)
+			if err != nil {
+				c.recordCreateVolumeFailure(ctx, req.Name, cnsvolumeoperationrequest.FailureReasonZoneUnregistered,
+					err)
+				return nil, faultType, err
 			}
 			// Initiate TKGs HA workflow when the topology requirement contains zone labels only.
 			log.Infof("Topology aware environment detected with requirement: %+v", topologyRequirement)
-			sharedDatastores, err = c.topologyMgr.GetSharedDatastoresInTopology(ctx,
+			sharedDatastores, err = topologyMgr.GetSharedDatastoresInTopology(topologyCtx,
 				commoncotypes.WCPTopologyFetchDSParams{
 					TopologyRequirement: topologyRequirement,
-					Vc:                  vc})
+					Vc:                  vc,
+					VolumeSizeMB:        volSizeMB})
+			if common.IsTopologyComputationDeadlineExceeded(topologyCtx) {
+				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.DeadlineExceeded,
+					"timed out after %v while getting shared datastores for topology requirement: %+v",
+					topologyTimeout, topologyRequirement)
+			}
 			if err != nil {
-				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				err = logger.LogNewErrorCodef(log, common.GetTopologyErrorCode(err),
 					"failed to find shared datastores for given topology requirement. Error: %v", err)
+				c.recordCreateVolumeFailure(ctx, req.Name, cnsvolumeoperationrequest.FailureReasonNoDatastores, err)
+				return nil, csifault.CSIInternalFault, err
+			}
+			// Fail early if the storage policy doesn't resolve to any datastore
+			// in the requested zones.
+			if storagePolicyID != "" {
+				compatible, err := isStoragePolicyCompatibleWithDatastores(ctx, vc, storagePolicyID,
+					sharedDatastores)
+				if err != nil {
+					log.Warnf("Skipping storage policy compatibility check for the requested zones. Error: %+v",
+						err)
+				} else if !compatible {
+					err = logger.LogNewErrorCodef(log, codes.InvalidArgument,
+						"storage policy %q is not compatible with any datastore in zone(s) %v",
+						storagePolicyID, getZonesFromAccessibilityReqs(topologyRequirement))
+					c.recordCreateVolumeFailure(ctx, req.Name, cnsvolumeoperationrequest.FailureReasonPolicyInvalid,
+						err)
+					return nil, csifault.CSIInvalidArgumentFault, err
+				}
 			}
 		} else {
 			sharedDatastores, vsanDirectDatastores, err = getCandidateDatastores(ctx, vc,
 				c.manager.CnsConfig.Global.ClusterID)
 			if err != nil {
-				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				err = logger.LogNewErrorCodef(log, codes.Internal,
 					"failed finding candidate datastores to place volume. Error: %v", err)
+				c.recordCreateVolumeFailure(ctx, req.Name, cnsvolumeoperationrequest.FailureReasonNoDatastores, err)
+				return nil, csifault.CSIInternalFault, err
 			}
 		}
 	} else {
 		sharedDatastores, vsanDirectDatastores, err = getCandidateDatastores(ctx, vc,
 			c.manager.CnsConfig.Global.ClusterID)
 		if err != nil {
-			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			err = logger.LogNewErrorCodef(log, codes.Internal,
 				"failed finding candidate datastores to place volume. Error: %v", err)
+			c.recordCreateVolumeFailure(ctx, req.Name, cnsvolumeoperationrequest.FailureReasonNoDatastores, err)
+			return nil, csifault.CSIInternalFault, err
 		}
 	}
 
@@ -460,34 +648,62 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 		log.Infof("Storage pool Accessible nodes for volume topology: %+v", accessibleNodes)
 
 		if storagePoolType == vsanDirect {
+			isVsanDirectVolume = true
+			err = validateVsanDirectOverlappingNodes(storagePool, overlappingNodes, topologyRequirement)
+			if err != nil {
+				return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+					"ambiguous accessibility requirements. Error: %+v", err)
+			}
 			selectedDatastoreURL, err = getDatastoreURLFromStoragePool(ctx, storagePool)
 			if err != nil {
 				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
 					"error in specified StoragePool %s. Error: %+v", storagePool, err)
 			}
 			log.Infof("Will select datastore %s as per the provided storage pool %s", selectedDatastoreURL, storagePool)
+			if len(overlappingNodes) > 1 {
+				log.Infof("Datastore %s of vSAN-direct storage pool %s is accessible from the most preferred node "+
+					"and will be accessible from all overlapping nodes %v", selectedDatastoreURL, storagePool,
+					overlappingNodes)
+			}
 		} else if storagePoolType == vsanSna {
 			// Query API server to get ESX Host Moid from the hostLocalNodeName.
 			if len(accessibleNodes) != 1 {
 				return nil, csifault.CSIInternalFault, logger.LogNewErrorCode(log, codes.Internal,
 					"too many accessible nodes")
 			}
-			hostMoid, err := getHostMOIDFromK8sCloudOperatorService(ctx, accessibleNodes[0])
+			hostMoid, err := c.getCachedHostMOIDFromK8sCloudOperatorService(ctx, accessibleNodes[0])
 			if err != nil {
 				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
 					"failed to get ESX Host Moid from API server. Error: %+v", err)
 			}
+			if !isValidHostMoid(hostMoid) {
+				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+					"invalid ESX Host Moid %q received for node %q. Expected a HostSystem moref of the "+
+						"form host-<number>", hostMoid, accessibleNodes[0])
+			}
 			affineToHost = hostMoid
 			log.Debugf("Setting the affineToHost value as %s", affineToHost)
 		}
+	} else if hostLocalNode := getHostnameFromAccessibilityReqs(topologyRequirement); hostLocal &&
+		!zoneLabelPresent && hostLocalNode != "" {
+		// Derive the host for host-local volumes from the hostname topology
+		// requirement when no storage pool is given.
+		hostMoid, err := c.getCachedHostMOIDFromK8sCloudOperatorService(ctx, hostLocalNode)
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get ESX Host Moid of node %q from API server. Error: %+v", hostLocalNode, err)
+		}
+		if !isValidHostMoid(hostMoid) {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"invalid ESX Host Moid %q received for node %q. Expected a HostSystem moref of the "+
+					"form host-<number>", hostMoid, hostLocalNode)
+		}
+		affineToHost = hostMoid
+		accessibleNodes = append(accessibleNodes, hostLocalNode)
+		log.Infof("Will place host-local volume on host %q of node %q as per the topology requirement",
+			affineToHost, hostLocalNode)
 	}
 
-	// Volume Size - Default is 10 GiB.
-	volSizeBytes := int64(common.DefaultGbDiskSize * common.GbInBytes)
-	if req.GetCapacityRange() != nil && req.GetCapacityRange().RequiredBytes != 0 {
-		volSizeBytes = int64(req.GetCapacityRange().GetRequiredBytes())
-	}
-	volSizeMB := int64(common.RoundUpSize(volSizeBytes, common.MbInBytes))
 	// Create CreateVolumeSpec and populate values.
 	var createVolumeSpec = common.CreateVolumeSpec{
 		CapacityMB:             volSizeMB,
@@ -499,16 +715,140 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 		VsanDirectDatastoreURL: selectedDatastoreURL,
 	}
 	candidateDatastores := append(sharedDatastores, vsanDirectDatastores...)
-	volumeInfo, faultType, err := common.CreateBlockVolumeUtil(ctx, cnstypes.CnsClusterFlavorWorkload,
-		c.manager, &createVolumeSpec, candidateDatastores, filterSuspendedDatastores)
-	if err != nil {
-		return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
-			"failed to create volume. Error: %+v", err)
+	if zoneLabelPresent {
+		common.LogTopologyExcludedDatastores(ctx, func(ctx context.Context) ([]*cnsvsphere.DatastoreInfo, error) {
+			datastores, vsanDirectDatastores, err := getCandidateDatastores(ctx, vc,
+				c.manager.CnsConfig.Global.ClusterID)
+			return append(datastores, vsanDirectDatastores...), err
+		}, candidateDatastores)
+	}
+	common.LogCandidateDatastores(ctx, topologyRequirement, candidateDatastores)
+	// Skip datastores which are above the configured capacity threshold, unless
+	// the datastore is already selected as per the provided storage pool.
+	reservedCapacityPercent := c.manager.CnsConfig.Global.DatastoreReservedCapacityPercent
+	if reservedCapacityPercent > 0 && selectedDatastoreURL == "" {
+		filteredDatastores := cnsvsphere.FilterDatastoresAboveCapacityThreshold(ctx, candidateDatastores,
+			reservedCapacityPercent)
+		common.LogExcludedDatastores(ctx, common.DatastoreFilterCapacityThreshold, candidateDatastores,
+			filteredDatastores)
+		candidateDatastores = filteredDatastores
+		if len(candidateDatastores) == 0 {
+			err = logger.LogNewErrorCodef(log, codes.ResourceExhausted,
+				"all candidate datastores have less than %d%% free capacity", reservedCapacityPercent)
+			c.recordCreateVolumeFailure(ctx, req.Name, cnsvolumeoperationrequest.FailureReasonNoDatastores, err)
+			return nil, csifault.CSIResourceExhaustedFault, err
+		}
+	}
+	// Skip datastores which are not allowed by the datastore allow and deny
+	// lists. If the datastore is already selected as per the provided storage
+	// pool, reject the request if that datastore is not allowed.
+	// Note that the lists are applied after the topology manager picked the
+	// datastores of the first preferred zone which can host the volume. A zone
+	// whose datastores are all denied is not skipped in favour of the next
+	// preferred zone, and the request fails with ResourceExhausted instead.
+	if len(datastoreAllowList) > 0 || len(datastoreDenyList) > 0 {
+		if selectedDatastoreURL != "" {
+			if !isDatastoreURLAllowed(selectedDatastoreURL, datastoreAllowList, datastoreDenyList) {
+				err = logger.LogNewErrorCodef(log, codes.InvalidArgument,
+					"datastore %q of storage pool %q is not allowed by the datastore allow list %v "+
+						"and deny list %v", selectedDatastoreURL, storagePool, datastoreAllowList, datastoreDenyList)
+				c.recordCreateVolumeFailure(ctx, req.Name, cnsvolumeoperationrequest.FailureReasonNoDatastores, err)
+				return nil, csifault.CSIInvalidArgumentFault, err
+			}
+		} else {
+			filteredDatastores := filterDatastoresByURL(candidateDatastores, datastoreAllowList, nil)
+			common.LogExcludedDatastores(ctx, common.DatastoreFilterAllowList, candidateDatastores,
+				filteredDatastores)
+			candidateDatastores = filteredDatastores
+			filteredDatastores = filterDatastoresByURL(candidateDatastores, nil, datastoreDenyList)
+			common.LogExcludedDatastores(ctx, common.DatastoreFilterDenyList, candidateDatastores,
+				filteredDatastores)
+			candidateDatastores = filteredDatastores
+			if len(candidateDatastores) == 0 {
+				err = logger.LogNewErrorCodef(log, codes.ResourceExhausted,
+					"no candidate datastores left after applying the datastore allow list %v and deny list %v",
+					datastoreAllowList, datastoreDenyList)
+				c.recordCreateVolumeFailure(ctx, req.Name, cnsvolumeoperationrequest.FailureReasonNoDatastores,
+					err)
+				return nil, csifault.CSIResourceExhaustedFault, err
+			}
+		}
+	}
+	if datastoreClusterMoid != "" {
+		// The storagePool parameter is rejected along with datastoreClusterMoid
+		// in validateWCPCreateVolumeRequest.
+		// Restrict the candidate datastores to the members of the requested
+		// Storage DRS datastore cluster.
+		filteredDatastores, err := filterDatastoresInStoragePod(ctx, vc, datastoreClusterMoid, candidateDatastores)
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get datastores in datastore cluster %q. Error: %+v", datastoreClusterMoid, err)
+		}
+		common.LogExcludedDatastores(ctx, common.DatastoreFilterDatastoreCluster, candidateDatastores,
+			filteredDatastores)
+		candidateDatastores = filteredDatastores
+		if len(candidateDatastores) == 0 {
+			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"none of the datastores in datastore cluster %q are accessible to the supervisor cluster",
+				datastoreClusterMoid)
+		}
+		log.Infof("Will select datastore from datastore cluster %q with candidates: %+v",
+			datastoreClusterMoid, candidateDatastores)
+	}
+	if datastoreAffinity != "" && selectedDatastoreURL == "" && len(candidateDatastores) > 1 {
+		// Bias the datastore selection for PVCs of the same StatefulSet as per
+		// the requested affinity.
+		if ownerKey, ordinal, ok := getStatefulSetPVCOwner(pvcNamespace, pvcName); ok {
+			candidateDatastores = orderDatastoresByAffinity(datastoreAffinity, ownerKey, ordinal,
+				candidateDatastores)
+			log.Infof("Will prefer datastore %q for PVC %s/%s as per the %q datastore affinity of %q",
+				candidateDatastores[0].Info.Url, pvcNamespace, pvcName, datastoreAffinity, ownerKey)
+		} else {
+			log.Infof("Ignoring datastore affinity %q as PVC %q is not owned by a StatefulSet",
+				datastoreAffinity, pvcName)
+		}
+	}
+	// Do not create the volume if the deadline was exceeded while computing the
+	// candidate datastores. Time spent in creating the volume is not counted
+	// against the topology computation deadline.
+	if common.IsTopologyComputationDeadlineExceeded(topologyCtx) {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.DeadlineExceeded,
+			"timed out after %v while computing the candidate datastores of volume %q", topologyTimeout, req.Name)
+	}
+	topologyElapsed := time.Since(topologyStart)
+	var volumeInfo *cnsvolume.CnsVolumeInfo
+	if dryRun {
+		// Resolve the placement of the volume without creating it.
+		var faultType string
+		volumeInfo, faultType, err = getDryRunVolumeInfo(ctx, vc, &createVolumeSpec, candidateDatastores,
+			filterSuspendedDatastores)
+		if err != nil {
+			return nil, faultType, err
+		}
+	} else {
+		var faultType string
+		cnsOpStart := time.Now()
+		volumeInfo, faultType, err = common.CreateBlockVolumeUtil(ctx, cnstypes.CnsClusterFlavorWorkload,
+			c.manager, &createVolumeSpec, candidateDatastores, filterSuspendedDatastores)
+		common.ObserveCnsUtilOpLatency(prometheus.PrometheusBlockVolumeType,
+			prometheus.PrometheusCreateVolumeOpType, cnsOpStart, err)
+		if err != nil {
+			return nil, faultType, logger.LogNewErrorCodef(log, common.GetCreateVolumeErrorCode(err),
+				"failed to create volume. Error: %+v", err)
+		}
 	}
 
 	// CreateVolume response.
 	attributes := make(map[string]string)
 	attributes[common.AttributeDiskType] = common.DiskTypeBlockVolume
+	if volumeInfo.TaskID != "" {
+		attributes[common.AttributeCnsTaskID] = volumeInfo.TaskID
+	}
+	if dryRun {
+		attributes[common.AttributeDryRun] = "true"
+		attributes[common.AttributeSelectedDatastoreURL] = volumeInfo.DatastoreURL
+		attributes[common.AttributeSelectedDatastoreEstimated] = "true"
+	}
 	resp := &csi.CreateVolumeResponse{
 		Volume: &csi.Volume{
 			VolumeId:      volumeInfo.VolumeID.Id,
@@ -518,18 +858,32 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 	}
 
 	// Calculate accessible topology for the provisioned volume in case of topology aware environment.
-	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.TKGsHA) {
+	// Volumes provisioned with topology disabled carry no accessible topology.
+	if topologyDisabled {
+		log.Debugf("Skipping accessible topology calculation for volume %q as topology is disabled",
+			resp.Volume.VolumeId)
+	} else if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.TKGsHA) {
 		if zoneLabelPresent && !hostnameLabelPresent {
 			// Calculate accessible topology for the provisioned volume.
 			selectedDatastore := volumeInfo.DatastoreURL
-			datastoreAccessibleTopology, err := c.topologyMgr.GetTopologyInfoFromNodes(ctx,
+			var topologyPath string
+			accessibleTopologyCtx, cancelAccessibleTopology := common.GetTopologyComputationContext(ctx,
+				topologyTimeout, topologyElapsed)
+			defer cancelAccessibleTopology()
+			datastoreAccessibleTopology, err := topologyMgr.GetTopologyInfoFromNodes(accessibleTopologyCtx,
 				commoncotypes.WCPRetrieveTopologyInfoParams{
 					DatastoreURL:        selectedDatastore,
 					StorageTopologyType: storageTopologyType,
 					TopologyRequirement: topologyRequirement,
-					Vc:                  vc})
+					Vc:                  vc,
+					TopologyPath:        &topologyPath})
+			if common.IsTopologyComputationDeadlineExceeded(accessibleTopologyCtx) {
+				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.DeadlineExceeded,
+					"timed out after %v while calculating accessible topologies for the datastore %q",
+					topologyTimeout, selectedDatastore)
+			}
 			if err != nil {
-				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, common.GetTopologyErrorCode(err),
 					"failed to find accessible topologies for the selected datastore %q. Error: %+v",
 					selectedDatastore, err)
 			}
@@ -540,35 +894,54 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 				}
 				resp.Volume.AccessibleTopology = append(resp.Volume.AccessibleTopology, volumeTopology)
 			}
+			if topologyPath != "" {
+				attributes[common.AttributeTopologyPath] = topologyPath
+			}
+			// Record the placement of the volume for debugging.
+			attributes[common.AttributeSelectedDatastoreURL] = selectedDatastore
+			attributes[common.AttributeSelectedZones] = strings.Join(
+				getZonesFromAccessibleTopology(datastoreAccessibleTopology), ",")
+		} else if hostnameLabelPresent && isVsanDirectVolume && c.getTopologyMgr() != nil {
+			// vSAN-direct volumes also carry the zone of the host they are
+			// accessible from, so that the PV has zone affinity.
+			resp.Volume.AccessibleTopology = c.getVsanDirectAccessibleTopology(ctx, vc, accessibleNodes,
+				topologyRequirement)
+			attributes[common.AttributeTopologyPath] = common.TopologyPathHostname
+			log.Debugf("Volume Accessible Topology: %+v", resp.Volume.AccessibleTopology)
 		} else if hostnameLabelPresent {
 			// Configure the volumeTopology in the response so that the external
 			// provisioner will properly sets up the nodeAffinity for this volume.
-			for _, hostName := range accessibleNodes {
-				volumeTopology := &csi.Topology{
-					Segments: map[string]string{
-						v1.LabelHostname: hostName,
-					},
-				}
-				resp.Volume.AccessibleTopology = append(resp.Volume.AccessibleTopology, volumeTopology)
-			}
+			resp.Volume.AccessibleTopology = getHostnameAccessibleTopology(ctx, accessibleNodes,
+				topologyRequirement)
+			attributes[common.AttributeTopologyPath] = common.TopologyPathHostname
 			log.Debugf("Volume Accessible Topology: %+v", resp.Volume.AccessibleTopology)
 		}
 	} else {
 		// Configure the volumeTopology in the response so that the external
 		// provisioner will properly sets up the nodeAffinity for this volume.
 		if isValidAccessibilityRequirement(topologyRequirement) {
-			for _, hostName := range accessibleNodes {
-				volumeTopology := &csi.Topology{
-					Segments: map[string]string{
-						v1.LabelHostname: hostName,
-					},
-				}
-				resp.Volume.AccessibleTopology = append(resp.Volume.AccessibleTopology, volumeTopology)
-			}
+			resp.Volume.AccessibleTopology = getHostnameAccessibleTopology(ctx, accessibleNodes,
+				topologyRequirement)
+			attributes[common.AttributeTopologyPath] = common.TopologyPathHostname
 			log.Debugf("Volume Accessible Topology: %+v", resp.Volume.AccessibleTopology)
 		}
 	}
 
+	common.SortAccessibleTopology(resp.Volume.AccessibleTopology)
+	// Summarize the placement decision in a single line for auditing.
+	log.Infow("CreateVolume placement decision",
+		"volumeID", resp.Volume.VolumeId,
+		"requestedTopology", topologyRequirement,
+		"candidateDatastoreCount", len(candidateDatastores),
+		"selectedDatastoreURL", volumeInfo.DatastoreURL,
+		"accessibleTopology", resp.Volume.AccessibleTopology,
+		"topologyPath", attributes[common.AttributeTopologyPath],
+		"storagePolicyID", storagePolicyID,
+		"cnsTaskID", volumeInfo.TaskID)
+	if dryRun {
+		log.Infof("Dry-run: volume %q was not created. It would be placed on datastore %q (estimated) "+
+			"with accessible topology %+v", req.Name, volumeInfo.DatastoreURL, resp.Volume.AccessibleTopology)
+	}
 	return resp, "", nil
 }
 
@@ -581,8 +954,8 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 		log.Info("Ignoring TopologyRequirement for file volume")
 	}
 
-	// Volume Size - Default is 10 GiB.
-	volSizeBytes := int64(common.DefaultGbDiskSize * common.GbInBytes)
+	// Volume Size - Default is 10 GiB unless overridden in the config.
+	volSizeBytes := common.GetDefaultFileVolumeSizeInBytes(c.manager.CnsConfig)
 	if req.GetCapacityRange() != nil && req.GetCapacityRange().RequiredBytes != 0 {
 		volSizeBytes = int64(req.GetCapacityRange().GetRequiredBytes())
 	}
@@ -628,11 +1001,15 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 		return nil, csifault.CSIInternalFault, logger.LogNewErrorCode(log, codes.Internal,
 			"no datastores found to create file volume")
 	}
-	filterSuspendedDatastores := commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CnsMgrSuspendCreateVolume)
+	filterSuspendedDatastores := commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx,
+		common.CnsMgrSuspendCreateVolume) && !common.IsSuspendedDatastoreFilterOverridden(ctx, req.Parameters)
+	cnsOpStart := time.Now()
 	volumeID, faultType, err = common.CreateFileVolumeUtil(ctx, cnstypes.CnsClusterFlavorWorkload,
 		c.manager, &createVolumeSpec, filteredDatastores, filterSuspendedDatastores)
+	common.ObserveCnsUtilOpLatency(prometheus.PrometheusFileVolumeType, prometheus.PrometheusCreateVolumeOpType,
+		cnsOpStart, err)
 	if err != nil {
-		return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
+		return nil, faultType, logger.LogNewErrorCodef(log, common.GetCreateVolumeErrorCode(err),
 			"failed to create volume. Error: %+v", err)
 	}
 
@@ -669,16 +1046,29 @@ func (c *controller) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequ
 		// Later we may need to define different csi faults.
 
 		isBlockRequest := !common.IsFileVolumeRequest(ctx, req.GetVolumeCapabilities())
-		if isBlockRequest {
+		if len(req.GetVolumeCapabilities()) == 0 {
+			// The volume type cannot be determined without volume capabilities.
+			// The request is rejected by the validation below.
+			volumeType = prometheus.PrometheusUnknownVolumeType
+		} else if isBlockRequest {
 			volumeType = prometheus.PrometheusBlockVolumeType
 		} else {
 			volumeType = prometheus.PrometheusFileVolumeType
+			if c.manager.CnsConfig.Global.DisableFileVolume {
+				return nil, csifault.CSIUnimplementedFault, logger.LogNewErrorCode(log, codes.Unimplemented,
+					"file volume support is disabled in the vSphere CSI driver configuration")
+			}
 		}
 		// Validate create request.
 		err := validateWCPCreateVolumeRequest(ctx, req, isBlockRequest)
 		if err != nil {
 			msg := fmt.Sprintf("Validation for CreateVolume Request: %+v has failed. Error: %+v", *req, err)
 			log.Error(msg)
+			var validationErr *createVolumeValidationError
+			if errors.As(err, &validationErr) {
+				return nil, csifault.CSIInvalidArgumentFault, status.Errorf(codes.InvalidArgument,
+					"CreateVolume request field %q is invalid: %s", validationErr.field, validationErr.reason)
+			}
 			return nil, csifault.CSIInvalidArgumentFault, err
 		}
 
@@ -709,11 +1099,16 @@ func (c *controller) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequ
 	}
 
 	if err != nil {
+		common.SetRetryAfterTrailer(ctx, err)
 		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusCreateVolumeOpType,
 			prometheus.PrometheusFailStatus, namespace, faultType).Observe(time.Since(start).Seconds())
 	} else {
 		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusCreateVolumeOpType,
 			prometheus.PrometheusPassStatus, namespace, faultType).Observe(time.Since(start).Seconds())
+		if resp != nil && resp.Volume != nil {
+			prometheus.VolumeCreateSizeHistVec.WithLabelValues(volumeType).Observe(
+				float64(resp.Volume.CapacityBytes) / float64(common.GbInBytes))
+		}
 	}
 	return resp, err
 }
@@ -726,6 +1121,9 @@ func (c *controller) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequ
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
 	volumeType := prometheus.PrometheusUnknownVolumeType
+	// Look up the zones of the volume before deleting it, as the PV carrying
+	// the zone information may be removed once the volume is deleted.
+	volumeZones := commonco.ContainerOrchestratorUtility.GetZonesForVolume(ctx, req.VolumeId)
 
 	deleteVolumeInternal := func() (
 		*csi.DeleteVolumeResponse, string, error) {
@@ -744,7 +1142,10 @@ func (c *controller) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequ
 		}
 		// TODO: Add code to determine the volume type and set volumeType for
 		// Prometheus metric accordingly.
+		log.Debugf("DeleteVolume: volume %q is in zones %v", req.VolumeId, volumeZones)
+		cnsOpStart := time.Now()
 		faultType, err = common.DeleteVolumeUtil(ctx, c.manager.VolumeManager, req.VolumeId, true)
+		common.ObserveCnsUtilOpLatency(volumeType, prometheus.PrometheusDeleteVolumeOpType, cnsOpStart, err)
 		if err != nil {
 			log.Debugf("DeleteVolumeUtil returns fault %s:", faultType)
 			return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
@@ -769,6 +1170,16 @@ func (c *controller) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequ
 		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusDeleteVolumeOpType,
 			prometheus.PrometheusPassStatus, namespace, faultType).Observe(time.Since(start).Seconds())
 	}
+	status := prometheus.PrometheusPassStatus
+	if err != nil {
+		status = prometheus.PrometheusFailStatus
+	}
+	if len(volumeZones) == 0 {
+		volumeZones = []string{prometheus.PrometheusUnknownZone}
+	}
+	for _, zone := range volumeZones {
+		prometheus.VolumeDeleteZoneCounterVec.WithLabelValues(zone, status).Inc()
+	}
 	return resp, err
 }
 
@@ -841,14 +1252,40 @@ func (c *controller) ControllerPublishVolume(ctx context.Context, req *csi.Contr
 
 		podVM, err := getVMByInstanceUUIDInDatacenter(ctx, vc, dcMorefValue, vmuuid)
 		if err != nil {
-			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			faultType, code := getVMLookupFault(err)
+			return nil, faultType, logger.LogNewErrorCodef(log, code,
 				"failed to the PodVM Moref from the PodVM UUID: %s in datacenter: %s with err: %+v",
 				vmuuid, dcMorefValue, err)
 		}
 
-		// Attach the volume to the node.
-		// faultType is returned from manager.AttachVolume.
-		diskUUID, faultType, err := common.AttachVolumeUtil(ctx, c.manager, podVM, req.VolumeId, true)
+		// Attaching a volume to a powered off PodVM is not expected. Fail early
+		// with a clear error instead of surfacing a generic attach failure.
+		isActive, err := podVM.IsActive(ctx)
+		if err != nil {
+			log.Warnf("failed to get power state of PodVM: %s. Proceeding with attach of volume: %s. Error: %+v",
+				vmuuid, req.VolumeId, err)
+		} else if !isActive {
+			return nil, csifault.CSIVmPoweredOffFault, logger.LogNewErrorCodef(log, codes.FailedPrecondition,
+				"PodVM: %s on node: %s is powered off. Cannot attach volume: %s", vmuuid, req.NodeId, req.VolumeId)
+		}
+
+		// Skip the CNS attach task if the volume is already attached to the
+		// PodVM, e.g. when the attach is replayed after a controller restart.
+		if publishInfo := getPublishContextIfAttached(ctx, podVM, req.VolumeId); publishInfo != nil {
+			return &csi.ControllerPublishVolumeResponse{PublishContext: publishInfo}, "", nil
+		}
+
+		// Attach the volume to the node. If enabled, requests for the same
+		// PodVM arriving while an attach is in progress are coalesced into a
+		// single CNS attach task.
+		// faultType is returned from manager.AttachVolume or
+		// manager.BatchAttachVolumes.
+		var diskUUID, faultType string
+		if c.manager.CnsConfig.Global.BatchAttachVolumes {
+			diskUUID, faultType, err = batchAttachVolume(ctx, c.manager, podVM, req.VolumeId)
+		} else {
+			diskUUID, faultType, err = common.AttachVolumeUtil(ctx, c.manager, podVM, req.VolumeId, true)
+		}
 		if err != nil {
 			if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.FakeAttach) {
 				log.Infof("Volume attachment failed. Checking if it can be fake attached")
@@ -886,14 +1323,13 @@ func (c *controller) ControllerPublishVolume(ctx context.Context, req *csi.Contr
 			}
 			log.Debugf("AttachVolumeUtil returns fault %s:", faultType)
 			return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
-				"failed to attach volume with volumeID: %s. Error: %+v", req.VolumeId, err)
+				"failed to attach volume with volumeID: %s to PodVM: %s (UUID: %s) of node: %s in datacenter: %s "+
+					"on vCenter: %s. Error: %+v", req.VolumeId, podVM.Reference().Value, vmuuid, req.NodeId,
+				dcMorefValue, vc.Config.Host, err)
 		}
 
-		publishInfo := make(map[string]string)
-		publishInfo[common.AttributeDiskType] = common.DiskTypeBlockVolume
-		publishInfo[common.AttributeFirstClassDiskUUID] = common.FormatDiskUUID(diskUUID)
 		resp := &csi.ControllerPublishVolumeResponse{
-			PublishContext: publishInfo,
+			PublishContext: getBlockVolumePublishContext(diskUUID),
 		}
 
 		return resp, "", nil
@@ -1003,7 +1439,37 @@ func (c *controller) GetCapacity(ctx context.Context, req *csi.GetCapacityReques
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
 	log.Infof("GetCapacity: called with args %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "")
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CapacityTracking) {
+		return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "getCapacity")
+	}
+	vc, err := common.GetVCenter(ctx, c.manager)
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get vCenter from Manager. Error: %v", err)
+	}
+	storagePolicyID, err := common.GetStoragePolicyIDFromParams(ctx, vc, req.GetParameters())
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument, "%v", err)
+	}
+	datastores, err := c.getCapacityDatastores(ctx, vc, req.GetAccessibleTopology())
+	if err != nil {
+		return nil, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to get datastores for topology: %+v. Error: %+v", req.GetAccessibleTopology(), err)
+	}
+	if storagePolicyID != "" {
+		datastores, err = common.GetStoragePolicyCompatibleDatastores(ctx, vc, storagePolicyID, datastores)
+		if err != nil {
+			return nil, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get datastores compatible with storage policy %q. Error: %+v", storagePolicyID, err)
+		}
+	}
+	availableCapacity, maximumVolumeSize := common.GetDatastoresCapacity(datastores, "")
+	log.Infof("GetCapacity: available capacity %d bytes and maximum volume size %d bytes for topology %+v",
+		availableCapacity, maximumVolumeSize, req.GetAccessibleTopology())
+	return &csi.GetCapacityResponse{
+		AvailableCapacity: availableCapacity,
+		MaximumVolumeSize: wrapperspb.Int64(maximumVolumeSize),
+	}, nil
 }
 
 func (c *controller) ControllerGetCapabilities(ctx context.Context, req *csi.ControllerGetCapabilitiesRequest) (
@@ -1012,8 +1478,16 @@ func (c *controller) ControllerGetCapabilities(ctx context.Context, req *csi.Con
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
 	log.Infof("ControllerGetCapabilities: called with args %+v", *req)
+	rpcTypes := append([]csi.ControllerServiceCapability_RPC_Type{}, controllerCaps...)
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CapacityTracking) {
+		rpcTypes = append(rpcTypes, csi.ControllerServiceCapability_RPC_GET_CAPACITY)
+	}
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot) {
+		rpcTypes = append(rpcTypes, csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+			csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS)
+	}
 	var caps []*csi.ControllerServiceCapability
-	for _, cap := range controllerCaps {
+	for _, cap := range rpcTypes {
 		c := &csi.ControllerServiceCapability{
 			Type: &csi.ControllerServiceCapability_Rpc{
 				Rpc: &csi.ControllerServiceCapability_RPC{
@@ -1026,31 +1500,40 @@ func (c *controller) ControllerGetCapabilities(ctx context.Context, req *csi.Con
 	return &csi.ControllerGetCapabilitiesResponse{Capabilities: caps}, nil
 }
 
+// CreateSnapshot creates a CNS snapshot of a block volume.
 func (c *controller) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (
 	*csi.CreateSnapshotResponse, error) {
-
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
-	log.Infof("CreateSnapshot: called with args %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "")
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot) {
+		return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "createSnapshot")
+	}
+	return common.CreateSnapshot(ctx, c.manager, req)
 }
 
+// DeleteSnapshot deletes a CNS snapshot of a block volume. Deleting a snapshot
+// which does not exist succeeds.
 func (c *controller) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (
 	*csi.DeleteSnapshotResponse, error) {
-
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
-	log.Infof("DeleteSnapshot: called with args %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "")
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot) {
+		return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "deleteSnapshot")
+	}
+	return common.DeleteSnapshot(ctx, c.manager, req)
 }
 
+// ListSnapshots lists the CNS snapshots of block volumes. The snapshots can be
+// filtered by source volume or snapshot ID and are paginated using the
+// starting token and max entries of the request.
 func (c *controller) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (
 	*csi.ListSnapshotsResponse, error) {
-
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
-	log.Infof("ListSnapshots: called with args %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "")
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot) {
+		return nil, logger.LogNewErrorCode(log, codes.Unimplemented, "listSnapshots")
+	}
+	return common.ListSnapshots(ctx, c.manager, req)
 }
 
 // ControllerExpandVolume expands a volume.
@@ -1085,10 +1568,12 @@ func (c *controller) ControllerExpandVolume(ctx context.Context, req *csi.Contro
 		volSizeBytes := int64(req.GetCapacityRange().GetRequiredBytes())
 		volSizeMB := int64(common.RoundUpSize(volSizeBytes, common.MbInBytes))
 		var faultType string
+		cnsOpStart := time.Now()
 		faultType, err = common.ExpandVolumeUtil(ctx, c.manager, volumeID, volSizeMB,
 			commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.AsyncQueryVolume))
+		common.ObserveCnsUtilOpLatency(volumeType, prometheus.PrometheusExpandVolumeOpType, cnsOpStart, err)
 		if err != nil {
-			return nil, faultType, logger.LogNewErrorCodef(log, codes.Internal,
+			return nil, faultType, logger.LogNewErrorCodef(log, common.GetExpandVolumeErrorCode(faultType),
 				"failed to expand volume: %+q to size: %d err %+v", volumeID, volSizeMB, err)
 		}
 
@@ -1129,6 +1614,90 @@ func (c *controller) ControllerExpandVolume(ctx context.Context, req *csi.Contro
 	return resp, err
 }
 
+// ControllerModifyVolume modifies the mutable parameters of a volume. Only the
+// storage policy of a block volume can be modified, by setting the
+// "storagepolicyid" mutable parameter.
+func (c *controller) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (
+	*csi.ControllerModifyVolumeResponse, error) {
+	ctx = logger.NewContextWithLogger(ctx)
+	log := logger.GetLogger(ctx)
+	log.Infof("ControllerModifyVolume: called with args %+v", req)
+	var storagePolicyID string
+	for paramName, value := range req.GetMutableParameters() {
+		if strings.ToLower(paramName) != common.AttributeStoragePolicyID {
+			return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"mutable parameter %q is not supported", paramName)
+		}
+		storagePolicyID = value
+	}
+	if storagePolicyID == "" {
+		return nil, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+			"mutable parameter %q must be provided", common.AttributeStoragePolicyID)
+	}
+	if err := c.ModifyVolumeStoragePolicy(ctx, req.GetVolumeId(), storagePolicyID); err != nil {
+		return nil, err
+	}
+	return &csi.ControllerModifyVolumeResponse{}, nil
+}
+
+// ModifyVolumeStoragePolicy moves an existing block volume to the given storage
+// policy without recreating it.
+func (c *controller) ModifyVolumeStoragePolicy(ctx context.Context, volumeID string,
+	storagePolicyID string) error {
+	start := time.Now()
+	log := logger.GetLogger(ctx)
+	volumeType := prometheus.PrometheusBlockVolumeType
+	modifyVolumeStoragePolicyInternal := func() (string, error) {
+		log.Infof("ModifyVolumeStoragePolicy: called for volume %q with storage policy %q",
+			volumeID, storagePolicyID)
+		if volumeID == "" || storagePolicyID == "" {
+			return csifault.CSIInvalidArgumentFault, logger.LogNewErrorCode(log, codes.InvalidArgument,
+				"volume ID and storage policy ID must be provided")
+		}
+		vc, err := common.GetVCenter(ctx, c.manager)
+		if err != nil {
+			return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to get vCenter from Manager. Error: %v", err)
+		}
+		// Validate the target storage policy exists before reconfiguring the volume.
+		if err = vc.ConnectPbm(ctx); err != nil {
+			return csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to connect to PBM. Error: %v", err)
+		}
+		policies, err := vc.PbmRetrieveContent(ctx, []string{storagePolicyID})
+		if err != nil || len(policies) == 0 {
+			return csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"storage policy %q not found. Error: %v", storagePolicyID, err)
+		}
+		cnsOpStart := time.Now()
+		faultType, err := common.UpdateVolumeStoragePolicyUtil(ctx, c.manager, volumeID, storagePolicyID)
+		common.ObserveCnsUtilOpLatency(volumeType, prometheus.PrometheusModifyVolumeStoragePolicyOpType,
+			cnsOpStart, err)
+		if err != nil {
+			if faultType == csifault.CSINotFoundFault {
+				return faultType, logger.LogNewErrorCodef(log, codes.NotFound,
+					"volume %q not found. Error: %v", volumeID, err)
+			}
+			return faultType, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to update storage policy of volume %q to %q. Error: %v", volumeID, storagePolicyID, err)
+		}
+		return "", nil
+	}
+	faultType, err := modifyVolumeStoragePolicyInternal()
+	log.Debugf("modifyVolumeStoragePolicyInternal: returns fault %q for volume %q", faultType, volumeID)
+	namespace := common.GetNamespaceFromContext(ctx)
+	if err != nil {
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType,
+			prometheus.PrometheusModifyVolumeStoragePolicyOpType, prometheus.PrometheusFailStatus, namespace,
+			faultType).Observe(time.Since(start).Seconds())
+	} else {
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType,
+			prometheus.PrometheusModifyVolumeStoragePolicyOpType, prometheus.PrometheusPassStatus, namespace,
+			faultType).Observe(time.Since(start).Seconds())
+	}
+	return err
+}
+
 func (c *controller) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (
 	*csi.ControllerGetVolumeResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "")
@@ -20,8 +20,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	vmoperatorv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
@@ -29,21 +36,67 @@ import (
 	vimtypes "github.com/vmware/govmomi/vim25/types"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/dynamic"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	spv1alpha1 "sigs.k8s.io/vsphere-csi-driver/v2/pkg/apis/storagepool/cns/v1alpha1"
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/volume"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/vsphere"
 	cnsconfig "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/config"
+	csifault "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/fault"
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/prometheus"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common/commonco"
+	commoncotypes "sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common/commonco/types"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/logger"
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/internalapis/cnsvolumeoperationrequest"
 	k8s "sigs.k8s.io/vsphere-csi-driver/v2/pkg/kubernetes"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/syncer/k8scloudoperator"
 )
 
+var (
+	// hostMoidRegex matches a well-formed HostSystem managed object id.
+	hostMoidRegex = regexp.MustCompile(`^host-[0-9]+$`)
+	// hostMoidCache maintains a cache of node names to the host-moid of the ESX
+	// host backing the node.
+	hostMoidCache = make(map[string]hostMoidCacheEntry)
+	// hostMoidCacheInstanceLock guards the hostMoidCache instance from concurrent writes.
+	hostMoidCacheInstanceLock = &sync.RWMutex{}
+	// pendingAttachBatches maintains the attach requests waiting to be issued
+	// to CNS, keyed by the moref of the PodVM they are to be attached to.
+	pendingAttachBatches = make(map[string]*attachBatch)
+	// attachesInProgress holds the morefs of the PodVMs for which a CNS attach
+	// task is in progress.
+	attachesInProgress = make(map[string]struct{})
+	// pendingAttachBatchesLock guards the pendingAttachBatches and
+	// attachesInProgress instances from concurrent writes.
+	pendingAttachBatchesLock = &sync.Mutex{}
+	// nodeLister is used to look up the hostname label of the nodes a volume
+	// is accessible from.
+	nodeLister corelisters.NodeLister
+)
+
+// attachBatch is a set of volumes waiting to be attached to a PodVM in a
+// single CNS attach task.
+type attachBatch struct {
+	// podVM is the PodVM the volumes are to be attached to.
+	podVM *vsphere.VirtualMachine
+	// waiters holds the channels on which the result of each volume in the
+	// batch is sent back to the callers waiting on it.
+	waiters map[string][]chan *cnsvolume.CnsAttachResult
+}
+
+// hostMoidCacheEntry is a cached host-moid in the hostMoidCache.
+type hostMoidCacheEntry struct {
+	// hostMoid is the moid of the ESX host backing the node.
+	hostMoid string
+	// expiresAt is the time after which the entry is considered stale.
+	expiresAt time.Time
+}
+
 // validateCreateBlockReqParam is a helper function used to validate the parameter
 // name received in the CreateVolume request for block volumes on WCP CSI driver.
 // Returns true if the parameter name is valid, false otherwise.
@@ -52,7 +105,17 @@ func validateCreateBlockReqParam(paramName, value string) bool {
 		paramName == common.AttributeFsType ||
 		paramName == common.AttributeStorageTopologyType ||
 		paramName == common.AttributeStoragePool ||
-		(paramName == common.AttributeHostLocal && strings.EqualFold(value, "true"))
+		paramName == common.AttributeDatastoreClusterMoid ||
+		paramName == common.AttributeIgnoreSuspendedDatastores ||
+		paramName == common.AttributeDatastoreAllowList ||
+		paramName == common.AttributeDatastoreDenyList ||
+		paramName == common.AttributePVCName ||
+		paramName == common.AttributePVCNamespace ||
+		(paramName == common.AttributeTopology && strings.EqualFold(value, common.TopologyDisabled)) ||
+		(paramName == common.AttributeDatastoreAffinity && (strings.EqualFold(value, common.DatastoreAffinitySpread) ||
+			strings.EqualFold(value, common.DatastoreAffinityColocate))) ||
+		(paramName == common.AttributeHostLocal && strings.EqualFold(value, "true")) ||
+		(paramName == common.AttributeDryRun && strings.EqualFold(value, "true"))
 }
 
 const (
@@ -66,28 +129,118 @@ const (
 func validateCreateFileReqParam(paramName, value string) bool {
 	return paramName == common.AttributeStoragePolicyID ||
 		paramName == common.AttributeStorageTopologyType ||
+		paramName == common.AttributeIgnoreSuspendedDatastores ||
 		paramName == common.AttributeFsType
 }
 
+// createVolumeValidationError is returned by validateWCPCreateVolumeRequest
+// and identifies the CreateVolumeRequest field which failed validation.
+type createVolumeValidationError struct {
+	// field is the name of the CreateVolumeRequest field which is invalid.
+	field string
+	// reason describes why the field is invalid.
+	reason string
+}
+
+func (e *createVolumeValidationError) Error() string {
+	return fmt.Sprintf("invalid field %q: %s", e.field, e.reason)
+}
+
 // ValidateCreateVolumeRequest is the helper function to validate
 // CreateVolumeRequest for WCP CSI driver.
-// Function returns error if validation fails otherwise returns nil.
+// Function returns a *createVolumeValidationError identifying the invalid
+// field if validation fails otherwise returns nil.
 // TODO: Need to remove AttributeHostLocal after external provisioner stops
 // sending this parameter.
 func validateWCPCreateVolumeRequest(ctx context.Context, req *csi.CreateVolumeRequest, isBlockRequest bool) error {
-	// Get create params.
-	params := req.GetParameters()
-	for paramName, value := range params {
+	log := logger.GetLogger(ctx)
+	invalidField := func(field, reason string) error {
+		validationErr := &createVolumeValidationError{field: field, reason: reason}
+		log.Error(validationErr)
+		return validationErr
+	}
+	// Volume Name.
+	if len(req.GetName()) == 0 {
+		return invalidField("name", "volume name is a required parameter")
+	}
+	// Validate Volume Capabilities.
+	volCaps := req.GetVolumeCapabilities()
+	if len(volCaps) == 0 {
+		return invalidField("volume_capabilities", "volume capabilities not provided. At least one volume "+
+			"capability with an access mode and an access type of either block or mount is required")
+	}
+	if err := common.IsValidVolumeCapabilities(ctx, volCaps); err != nil {
+		return invalidField("volume_capabilities", fmt.Sprintf("volume capability not supported. Err: %+v", err))
+	}
+	// Validate Capacity Range.
+	if req.GetCapacityRange() != nil {
+		requiredBytes := req.GetCapacityRange().GetRequiredBytes()
+		limitBytes := req.GetCapacityRange().GetLimitBytes()
+		if requiredBytes < 0 || limitBytes < 0 {
+			return invalidField("capacity_range", fmt.Sprintf("required bytes %d and limit bytes %d must not "+
+				"be negative", requiredBytes, limitBytes))
+		}
+		if limitBytes > 0 && requiredBytes > limitBytes {
+			return invalidField("capacity_range", fmt.Sprintf("required bytes %d exceeds limit bytes %d",
+				requiredBytes, limitBytes))
+		}
+	}
+	// Validate create params.
+	var storagePool, datastoreClusterMoid string
+	for paramName, value := range req.GetParameters() {
 		paramName = strings.ToLower(paramName)
+		switch paramName {
+		case common.AttributeStoragePool:
+			storagePool = value
+		case common.AttributeDatastoreClusterMoid:
+			datastoreClusterMoid = value
+		}
 		if isBlockRequest && !validateCreateBlockReqParam(paramName, value) {
-			msg := fmt.Sprintf("Volume parameter %s is not a valid WCP CSI parameter for block volume.", paramName)
-			return status.Error(codes.InvalidArgument, msg)
+			return invalidField("parameters."+paramName, "not a valid WCP CSI parameter for block volume")
+		} else if !isBlockRequest && paramName == common.AttributeDryRun {
+			return invalidField("parameters."+paramName, "dry-run is only supported for block volumes")
 		} else if !isBlockRequest && !validateCreateFileReqParam(paramName, value) {
-			msg := fmt.Sprintf("Volume parameter %s is not a valid WCP CSI parameter for file volumes.", paramName)
-			return status.Error(codes.InvalidArgument, msg)
+			return invalidField("parameters."+paramName, "not a valid WCP CSI parameter for file volumes")
 		}
+		// Validate the storageTopologyType parameter, which is only honored
+		// when the TKGsHA feature is enabled.
+		if paramName == common.AttributeStorageTopologyType && value != "" {
+			if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.TKGsHA) {
+				return invalidField("parameters."+paramName, fmt.Sprintf("parameter is not supported when "+
+					"the %q feature state switch is disabled", common.TKGsHA))
+			}
+			if !strings.EqualFold(value, common.TopologyTypeZonal) &&
+				!strings.EqualFold(value, common.TopologyTypeCrossZonal) {
+				return invalidField("parameters."+paramName, fmt.Sprintf("value %q is not one of %q or %q",
+					value, common.TopologyTypeZonal, common.TopologyTypeCrossZonal))
+			}
+		}
+		// Validate the datastore allow and deny lists.
+		if isBlockRequest && (paramName == common.AttributeDatastoreAllowList ||
+			paramName == common.AttributeDatastoreDenyList) {
+			if _, err := parseDatastoreURLList(value); err != nil {
+				return invalidField("parameters."+paramName, err.Error())
+			}
+		}
+	}
+	if isBlockRequest && storagePool != "" && datastoreClusterMoid != "" {
+		return invalidField("parameters."+common.AttributeDatastoreClusterMoid, fmt.Sprintf("parameter cannot "+
+			"be specified together with %q", common.AttributeStoragePool))
 	}
-	return common.ValidateCreateVolumeRequest(ctx, req)
+	// Validate topology keys in the accessibility requirements. Reject the
+	// request before any calls to VC are made.
+	if isBlockRequest && !isTopologyDisabled(req.GetParameters()) &&
+		commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.TKGsHA) {
+		// TODO: TKGS-HA: This case will only arise when spherelet will add zone and hostname labels to CSINodes.
+		// Currently spherelet only accepts hostname. We will handle this case later.
+		hostnameLabelPresent, zoneLabelPresent := checkTopologyKeysFromAccessibilityReqs(
+			req.GetAccessibilityRequirements())
+		if hostnameLabelPresent && zoneLabelPresent {
+			return invalidField("accessibility_requirements", fmt.Sprintf("support for topology requirement "+
+				"with both %q and %q keys is not yet implemented", v1.LabelTopologyZone, v1.LabelHostname))
+		}
+	}
+	return nil
 }
 
 // validateWCPDeleteVolumeRequest is the helper function to validate
@@ -282,6 +435,83 @@ func getHostMOIDFromK8sCloudOperatorService(ctx context.Context, nodeName string
 	return res.AnnotationValue, nil
 }
 
+// getCachedHostMOIDFromK8sCloudOperatorService returns the host-moid for the
+// given node from the hostMoidCache, falling back to the K8sCloudOperator gRPC
+// service when the entry is missing or has expired. Entries are cached for the
+// host-moid-cache-ttl-insec duration set in the config.
+func (c *controller) getCachedHostMOIDFromK8sCloudOperatorService(ctx context.Context,
+	nodeName string) (string, error) {
+	log := logger.GetLogger(ctx)
+	hostMoidCacheTTL := time.Duration(c.manager.CnsConfig.Global.HostMoidCacheTTLInSec) * time.Second
+	if hostMoidCacheTTL == 0 {
+		hostMoidCacheTTL = time.Duration(cnsconfig.DefaultHostMoidCacheTTLInSec) * time.Second
+	}
+	hostMoidCacheInstanceLock.RLock()
+	entry, exists := hostMoidCache[nodeName]
+	hostMoidCacheInstanceLock.RUnlock()
+	if exists && time.Now().Before(entry.expiresAt) {
+		log.Debugf("Using cached host-moid: %s for node %q", entry.hostMoid, nodeName)
+		return entry.hostMoid, nil
+	}
+	hostMoid, err := getHostMOIDFromK8sCloudOperatorService(ctx, nodeName)
+	if err != nil {
+		return "", err
+	}
+	hostMoidCacheInstanceLock.Lock()
+	defer hostMoidCacheInstanceLock.Unlock()
+	// Prune expired entries so that the cache stays bounded by the number of
+	// nodes recently used for provisioning.
+	now := time.Now()
+	for cachedNodeName, cachedEntry := range hostMoidCache {
+		if now.After(cachedEntry.expiresAt) {
+			delete(hostMoidCache, cachedNodeName)
+		}
+	}
+	hostMoidCache[nodeName] = hostMoidCacheEntry{
+		hostMoid:  hostMoid,
+		expiresAt: now.Add(hostMoidCacheTTL),
+	}
+	return hostMoid, nil
+}
+
+// isValidHostMoid returns true if the given value looks like the moid of a
+// HostSystem, e.g. "host-1001".
+func isValidHostMoid(hostMoid string) bool {
+	return hostMoidRegex.MatchString(hostMoid)
+}
+
+// initHostMoidCacheInvalidation sets up a node listener which removes the
+// cached host-moid of a node from the hostMoidCache when the node is deleted.
+func initHostMoidCacheInvalidation(ctx context.Context) error {
+	log := logger.GetLogger(ctx)
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		log.Errorf("failed to create kubernetes client. Error: %+v", err)
+		return err
+	}
+	informerManager := k8s.NewInformer(k8sClient)
+	informerManager.AddNodeListener(nil, nil, hostMoidCacheNodeDeleted)
+	nodeLister = informerManager.GetNodeLister()
+	informerManager.Listen()
+	return nil
+}
+
+// hostMoidCacheNodeDeleted removes the deleted node from the hostMoidCache.
+func hostMoidCacheNodeDeleted(obj interface{}) {
+	_, log := logger.GetNewContextWithLogger()
+	node, ok := obj.(*v1.Node)
+	if node == nil || !ok {
+		log.Warnf("hostMoidCacheNodeDeleted: unrecognized object %+v", obj)
+		return
+	}
+	hostMoidCacheInstanceLock.Lock()
+	defer hostMoidCacheInstanceLock.Unlock()
+	if _, exists := hostMoidCache[node.Name]; exists {
+		delete(hostMoidCache, node.Name)
+		log.Infof("Removed node %q from hostMoidCache", node.Name)
+	}
+}
+
 // getDatacenterFromConfig gets the vcenter-datacenter where WCP PodVM cluster
 // is deployed.
 func getDatacenterFromConfig(cfg *cnsconfig.Config) (map[string]string, error) {
@@ -342,12 +572,113 @@ func getVMByInstanceUUIDInDatacenter(ctx context.Context,
 	// Get VM by UUID from datacenter.
 	vm, err := dc.GetVirtualMachineByUUID(ctx, vmInstanceUUID, true)
 	if err != nil {
-		return nil, fmt.Errorf("failed to the VM from the VM Instance UUID: %s in datacenter: %+v with err: %+v",
+		return nil, fmt.Errorf("failed to the VM from the VM Instance UUID: %s in datacenter: %+v with err: %w",
 			vmInstanceUUID, dc, err)
 	}
 	return vm, nil
 }
 
+// parseDatastoreURLList parses the given comma separated list of datastore
+// URLs. Returns an error if an entry is not a URL.
+func parseDatastoreURLList(value string) ([]string, error) {
+	var datastoreURLs []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if parsedURL, err := url.Parse(entry); err != nil || parsedURL.Scheme == "" {
+			return nil, fmt.Errorf("%q is not a valid datastore URL", entry)
+		}
+		datastoreURLs = append(datastoreURLs, entry)
+	}
+	return datastoreURLs, nil
+}
+
+// filterDatastoresByURL returns the datastores whose URL is allowed by the
+// given allow and deny lists, see isDatastoreURLAllowed.
+func filterDatastoresByURL(datastores []*vsphere.DatastoreInfo, allowList []string,
+	denyList []string) []*vsphere.DatastoreInfo {
+	var filteredDatastores []*vsphere.DatastoreInfo
+	for _, ds := range datastores {
+		if isDatastoreURLAllowed(ds.Info.Url, allowList, denyList) {
+			filteredDatastores = append(filteredDatastores, ds)
+		}
+	}
+	return filteredDatastores
+}
+
+// isDatastoreURLAllowed checks whether the given datastore URL is in the given
+// allow list, unless it is empty, and not in the given deny list. URLs are
+// compared regardless of a trailing slash.
+func isDatastoreURLAllowed(datastoreURL string, allowList []string, denyList []string) bool {
+	contains := func(datastoreURLs []string) bool {
+		for _, entry := range datastoreURLs {
+			if strings.TrimSuffix(entry, "/") == strings.TrimSuffix(datastoreURL, "/") {
+				return true
+			}
+		}
+		return false
+	}
+	return (len(allowList) == 0 || contains(allowList)) && !contains(denyList)
+}
+
+// getDryRunVolumeInfo returns the volume info of a dry-run CreateVolume call
+// without creating the volume, along with the fault type if it fails. The
+// volume has no ID and is placed on the datastore selected by the storage
+// pool, if any, or else on the candidate datastore compatible with the storage
+// policy with the most free space. The latter is an estimate, as CNS may
+// choose another compatible datastore.
+func getDryRunVolumeInfo(ctx context.Context, vc *vsphere.VirtualCenter, spec *common.CreateVolumeSpec,
+	candidateDatastores []*vsphere.DatastoreInfo, filterSuspendedDatastores bool) (
+	*cnsvolume.CnsVolumeInfo, string, error) {
+	log := logger.GetLogger(ctx)
+	if spec.VsanDirectDatastoreURL != "" {
+		return &cnsvolume.CnsVolumeInfo{DatastoreURL: spec.VsanDirectDatastoreURL}, "", nil
+	}
+	if filterSuspendedDatastores {
+		candidateDatastores = vsphere.FilterSuspendedDatastores(ctx, candidateDatastores)
+	}
+	if spec.StoragePolicyID != "" && len(candidateDatastores) > 0 {
+		compatibleDatastores, err := getStoragePolicyCompatibleDatastores(ctx, vc, spec.StoragePolicyID,
+			candidateDatastores)
+		if err != nil {
+			return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+				"failed to check the compatibility of storage policy %q for volume %q. Error: %+v",
+				spec.StoragePolicyID, spec.Name, err)
+		}
+		if len(compatibleDatastores) == 0 {
+			return nil, csifault.CSIInvalidArgumentFault, logger.LogNewErrorCodef(log, codes.InvalidArgument,
+				"storage policy %q is not compatible with any candidate datastore of volume %q",
+				spec.StoragePolicyID, spec.Name)
+		}
+		candidateDatastores = compatibleDatastores
+	}
+	var selectedDatastore *vsphere.DatastoreInfo
+	for _, ds := range candidateDatastores {
+		if selectedDatastore == nil || ds.Info.FreeSpace > selectedDatastore.Info.FreeSpace {
+			selectedDatastore = ds
+		}
+	}
+	if selectedDatastore == nil {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"no candidate datastores found to place volume %q", spec.Name)
+	}
+	log.Infof("Dry-run: volume %q would be placed on datastore %q", spec.Name, selectedDatastore.Info.Url)
+	return &cnsvolume.CnsVolumeInfo{DatastoreURL: selectedDatastore.Info.Url}, "", nil
+}
+
+// getVMLookupFault returns the fault type and the gRPC code for an error
+// returned by getVMByInstanceUUIDInDatacenter. A VM which is not found, e.g.
+// a PodVM deleted while its volume is being attached, is reported as NotFound
+// so that it is not treated like a failure to reach vCenter.
+func getVMLookupFault(err error) (string, codes.Code) {
+	if errors.Is(err, vsphere.ErrVMNotFound) {
+		return csifault.CSIVmNotFoundFault, codes.NotFound
+	}
+	return csifault.CSIInternalFault, codes.Internal
+}
+
 // getDatastoreURLFromStoragePool returns the datastoreUrl that the given
 // StoragePool represents.
 func getDatastoreURLFromStoragePool(ctx context.Context, spName string) (string, error) {
@@ -449,6 +780,280 @@ func getOverlappingNodes(accessibleNodes []string, topologyRequirement *csi.Topo
 	return overlappingNodes, nil
 }
 
+// validateVsanDirectOverlappingNodes validates the overlapping nodes computed
+// for a vSAN-direct StoragePool. The datastore of a vSAN-direct StoragePool is
+// selected only if it is accessible from the most preferred node in the
+// accessibility requirements, which is the node selected by the scheduler.
+// When multiple overlapping nodes exist, the choice is ambiguous unless the
+// most preferred node is one of them.
+func validateVsanDirectOverlappingNodes(storagePool string, overlappingNodes []string,
+	topologyRequirement *csi.TopologyRequirement) error {
+	if len(overlappingNodes) <= 1 || len(topologyRequirement.GetPreferred()) == 0 {
+		return nil
+	}
+	preferredNode := topologyRequirement.GetPreferred()[0].Segments[v1.LabelHostname]
+	for _, node := range overlappingNodes {
+		if node == preferredNode {
+			return nil
+		}
+	}
+	return fmt.Errorf("vSAN-direct StoragePool %s is accessible from multiple requested nodes %v but not from "+
+		"the most preferred node %q. The datastore of a vSAN-direct StoragePool is only selected when it is "+
+		"accessible from the most preferred node", storagePool, overlappingNodes, preferredNode)
+}
+
+// getStatefulSetPVCOwner returns a key identifying the StatefulSet owning the
+// given PVC and the ordinal of the PVC within it. StatefulSet PVCs are named
+// <claim-template>-<statefulset>-<ordinal>, so PVCs of the same StatefulSet
+// share the name without the ordinal. Returns false if the PVC name doesn't
+// follow this pattern.
+func getStatefulSetPVCOwner(pvcNamespace, pvcName string) (string, int, bool) {
+	idx := strings.LastIndex(pvcName, "-")
+	if idx <= 0 || idx == len(pvcName)-1 {
+		return "", 0, false
+	}
+	ordinal, err := strconv.Atoi(pvcName[idx+1:])
+	if err != nil || ordinal < 0 {
+		return "", 0, false
+	}
+	return pvcNamespace + "/" + pvcName[:idx], ordinal, true
+}
+
+// orderDatastoresByAffinity orders the given candidate datastores by
+// preference for a PVC of a StatefulSet, identified by ownerKey and ordinal.
+// The owner key is consistently hashed over the candidates sorted by URL to
+// pick the most preferred datastore, so that with the colocate affinity all
+// PVCs of the StatefulSet prefer the same datastore, and with the spread
+// affinity consecutive ordinals prefer different datastores in a round-robin
+// manner. The remaining candidates follow in URL order, so that CNS can still
+// place the volume when the most preferred datastore cannot host it.
+func orderDatastoresByAffinity(affinity, ownerKey string, ordinal int,
+	datastores []*vsphere.DatastoreInfo) []*vsphere.DatastoreInfo {
+	if len(datastores) == 0 {
+		return datastores
+	}
+	sortedDatastores := make([]*vsphere.DatastoreInfo, len(datastores))
+	copy(sortedDatastores, datastores)
+	sort.Slice(sortedDatastores, func(i, j int) bool {
+		return sortedDatastores[i].Info.Url < sortedDatastores[j].Info.Url
+	})
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(ownerKey))
+	index := uint64(hash.Sum32())
+	if strings.EqualFold(affinity, common.DatastoreAffinitySpread) {
+		index += uint64(ordinal)
+	}
+	first := int(index % uint64(len(sortedDatastores)))
+	return append(sortedDatastores[first:], sortedDatastores[:first]...)
+}
+
+// getZonesFromAccessibilityReqs returns the distinct zones requested in the
+// given topology requirement.
+func getZonesFromAccessibilityReqs(topologyRequirement *csi.TopologyRequirement) []string {
+	var zones []string
+	seen := make(map[string]struct{})
+	var topologies []*csi.Topology
+	topologies = append(topologies, topologyRequirement.GetPreferred()...)
+	topologies = append(topologies, topologyRequirement.GetRequisite()...)
+	for _, topology := range topologies {
+		zone, exists := topology.GetSegments()[v1.LabelTopologyZone]
+		if !exists {
+			continue
+		}
+		if _, found := seen[zone]; !found {
+			seen[zone] = struct{}{}
+			zones = append(zones, zone)
+		}
+	}
+	return zones
+}
+
+// getZonesFromAccessibleTopology returns the distinct zones in the given
+// accessible topology segments.
+func getZonesFromAccessibleTopology(accessibleTopology []map[string]string) []string {
+	var zones []string
+	seen := make(map[string]struct{})
+	for _, segments := range accessibleTopology {
+		zone, exists := segments[v1.LabelTopologyZone]
+		if !exists {
+			continue
+		}
+		if _, found := seen[zone]; !found {
+			seen[zone] = struct{}{}
+			zones = append(zones, zone)
+		}
+	}
+	return zones
+}
+
+// isStoragePolicyCompatibleWithDatastores returns true if the given storage
+// policy is compatible with at least one of the given datastores.
+func isStoragePolicyCompatibleWithDatastores(ctx context.Context, vc *vsphere.VirtualCenter,
+	storagePolicyID string, datastores []*vsphere.DatastoreInfo) (bool, error) {
+	compatibleDatastores, err := getStoragePolicyCompatibleDatastores(ctx, vc, storagePolicyID, datastores)
+	if err != nil {
+		return false, err
+	}
+	return len(compatibleDatastores) > 0, nil
+}
+
+// getCapacityDatastores returns the candidate datastores whose capacity is
+// reported in GetCapacity. If the accessible topology contains a zone, only
+// the datastores of the clusters which belong to that zone are returned.
+func (c *controller) getCapacityDatastores(ctx context.Context, vc *vsphere.VirtualCenter,
+	accessibleTopology *csi.Topology) ([]*vsphere.DatastoreInfo, error) {
+	zone, zonePresent := accessibleTopology.GetSegments()[v1.LabelTopologyZone]
+	if !zonePresent || !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.TKGsHA) {
+		sharedDatastores, _, err := getCandidateDatastores(ctx, vc, c.manager.CnsConfig.Global.ClusterID)
+		if err != nil {
+			return nil, fmt.Errorf("failed finding candidate datastores. Error: %+v", err)
+		}
+		return sharedDatastores, nil
+	}
+	topologyMgr, _, err := c.getOrInitTopologyMgr(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var datastores []*vsphere.DatastoreInfo
+	datastoreURLs := make(map[string]struct{})
+	for _, clusterID := range clusterComputeResourceMoIds {
+		inZone := false
+		for _, clusterZone := range topologyMgr.GetZonesForCluster(ctx, clusterID) {
+			if clusterZone == zone {
+				inZone = true
+				break
+			}
+		}
+		if !inZone {
+			continue
+		}
+		sharedDatastores, _, err := getCandidateDatastores(ctx, vc, clusterID)
+		if err != nil {
+			return nil, fmt.Errorf("failed finding candidate datastores in cluster %q. Error: %+v",
+				clusterID, err)
+		}
+		// Datastores shared across the clusters of a zone are counted once.
+		for _, ds := range sharedDatastores {
+			if ds.Info == nil {
+				continue
+			}
+			if _, exists := datastoreURLs[ds.Info.Url]; exists {
+				continue
+			}
+			datastoreURLs[ds.Info.Url] = struct{}{}
+			datastores = append(datastores, ds)
+		}
+	}
+	return datastores, nil
+}
+
+// recordCreateVolumeFailure persists the given failure reason of a CreateVolume
+// call for the given volume in the operation store, so that retries and
+// operators can inspect why the volume fails to be provisioned.
+func (c *controller) recordCreateVolumeFailure(ctx context.Context, volumeName string, failureReason string,
+	createErr error) {
+	log := logger.GetLogger(ctx)
+	if c.operationStore == nil || createErr == nil {
+		return
+	}
+	volumeOperationDetails := cnsvolumeoperationrequest.CreateVolumeOperationRequestDetails(volumeName, "", "", 0,
+		metav1.Now(), "", "", cnsvolumeoperationrequest.TaskInvocationStatusError, createErr.Error())
+	volumeOperationDetails.OperationDetails.FailureReason = failureReason
+	if err := c.operationStore.StoreRequestDetails(ctx, volumeOperationDetails); err != nil {
+		log.Warnf("failed to store CreateVolume failure reason %q for volume %q with error: %v",
+			failureReason, volumeName, err)
+	}
+}
+
+// getPreviousCreateVolumeFailureReason returns the failure reason of the
+// previous failed CreateVolume call for the given volume, if any.
+func (c *controller) getPreviousCreateVolumeFailureReason(ctx context.Context, volumeName string) string {
+	if c.operationStore == nil {
+		return ""
+	}
+	volumeOperationDetails, err := c.operationStore.GetRequestDetails(ctx, volumeName)
+	if err != nil || volumeOperationDetails.OperationDetails == nil ||
+		volumeOperationDetails.OperationDetails.TaskStatus != cnsvolumeoperationrequest.TaskInvocationStatusError {
+		return ""
+	}
+	return volumeOperationDetails.OperationDetails.FailureReason
+}
+
+// getTopologyMgr returns the topology manager of the controller, which is nil
+// if it is not initialized yet.
+func (c *controller) getTopologyMgr() commoncotypes.ControllerTopologyService {
+	c.topologyMgrLock.Lock()
+	defer c.topologyMgrLock.Unlock()
+	return c.topologyMgr
+}
+
+// getOrInitTopologyMgr returns the topology manager of the controller. The
+// topology manager is nil if the AvailabilityZone CR was not registered at the
+// time of controller init, in which case one attempt is made to initialize it
+// so that an AvailabilityZone CR registered after controller init is picked up
+// without restarting the controller. The fault type is returned along with the
+// error if the topology manager is still unavailable.
+func (c *controller) getOrInitTopologyMgr(ctx context.Context) (
+	commoncotypes.ControllerTopologyService, string, error) {
+	log := logger.GetLogger(ctx)
+	c.topologyMgrLock.Lock()
+	defer c.topologyMgrLock.Unlock()
+	if c.topologyMgr != nil {
+		return c.topologyMgr, "", nil
+	}
+	log.Info("Topology manager not initialized. Attempting to initialize the topology service " +
+		"as the AvailabilityZone CR may have been registered after controller init.")
+	// The informers of the topology service outlive the request which
+	// initializes it, so they must not be stopped along with its context.
+	topologyCtx, _ := logger.GetNewContextWithLogger()
+	topologyMgr, err := commonco.ContainerOrchestratorUtility.InitTopologyServiceInController(topologyCtx)
+	if err != nil {
+		return nil, csifault.CSIInternalFault, logger.LogNewErrorCodef(log, codes.Internal,
+			"failed to initialize topology service. Error: %+v", err)
+	}
+	if topologyMgr == nil {
+		return nil, csifault.CSITopologyServiceNotInitializedFault, logger.LogNewErrorCodef(log,
+			codes.FailedPrecondition, "volume requested in zones but the topology service is not "+
+				"initialized. Verify that the AvailabilityZone CR is registered in the supervisor cluster "+
+				"and that the %q feature state switch is enabled, then retry the request.", common.TKGsHA)
+	}
+	topologyMgr.SetDrainingTopologyValues(ctx, common.GetDrainingTopologyValues(c.manager.CnsConfig))
+	c.topologyMgr = topologyMgr
+	log.Info("Topology service initialized successfully")
+	return c.topologyMgr, "", nil
+}
+
+// resetTopologyMgr rebuilds the topology manager of the controller, if any.
+// The informers of the previous topology manager are stopped first so that
+// duplicate informers are not left running.
+func (c *controller) resetTopologyMgr(ctx context.Context) error {
+	c.topologyMgrLock.Lock()
+	if c.topologyMgr == nil {
+		c.topologyMgrLock.Unlock()
+		return nil
+	}
+	commonco.ContainerOrchestratorUtility.ResetTopologyServiceInController(ctx)
+	c.topologyMgr = nil
+	c.topologyMgrLock.Unlock()
+	topologyMgr, _, err := c.getOrInitTopologyMgr(ctx)
+	if err != nil {
+		return err
+	}
+	topologyMgr.WaitForSync(ctx)
+	return nil
+}
+
+// isTopologyDisabled returns true if the given StorageClass parameters request
+// volumes without any zone affinity.
+func isTopologyDisabled(params map[string]string) bool {
+	for paramName, value := range params {
+		if strings.ToLower(paramName) == common.AttributeTopology && strings.EqualFold(value, common.TopologyDisabled) {
+			return true
+		}
+	}
+	return false
+}
+
 // checkTopologyKeysFromAccessibilityReqs checks if the topology requirement contains zone or hostname labels.
 func checkTopologyKeysFromAccessibilityReqs(topologyRequirement *csi.TopologyRequirement) (bool, bool) {
 	var hostnameLabelPresent, zoneLabelPresent bool
@@ -471,3 +1076,393 @@ func checkTopologyKeysFromAccessibilityReqs(topologyRequirement *csi.TopologyReq
 	}
 	return hostnameLabelPresent, zoneLabelPresent
 }
+
+// checkZonalTopologyRequirementWithoutTKGsHA checks the given topology
+// requirement of a volume created while the TKGsHA feature is disabled, in
+// which case zones in the requirement are not honored. If zones are requested,
+// a FailedPrecondition error is returned when failOnZones is set, otherwise a
+// warning is logged.
+func checkZonalTopologyRequirementWithoutTKGsHA(ctx context.Context,
+	topologyRequirement *csi.TopologyRequirement, failOnZones bool) error {
+	log := logger.GetLogger(ctx)
+	if _, zoneLabelPresent := checkTopologyKeysFromAccessibilityReqs(topologyRequirement); !zoneLabelPresent {
+		return nil
+	}
+	if failOnZones {
+		return logger.LogNewErrorCodef(log, codes.FailedPrecondition,
+			"volume requested in zones with topology requirement %+v but the %q feature state switch is "+
+				"disabled", topologyRequirement, common.TKGsHA)
+	}
+	log.Warnf("Volume requested in zones with topology requirement %+v but the %q feature state switch is "+
+		"disabled. The zones are ignored and the volume is placed on cluster-wide datastores.",
+		topologyRequirement, common.TKGsHA)
+	return nil
+}
+
+// useSupervisorIDAsClusterID sets the ClusterID in the given config to its
+// SupervisorID, which is used for volume metadata in TKGs HA enabled
+// environments. effectiveClusterID is the ClusterID currently in use, if any,
+// and is used to log the transition from ClusterID to SupervisorID only once.
+func useSupervisorIDAsClusterID(ctx context.Context, cfg *cnsconfig.Config, effectiveClusterID string) error {
+	log := logger.GetLogger(ctx)
+	if cfg.Global.SupervisorID == "" {
+		return logger.LogNewError(log, "supervisor-id is not set in the vsphere-config-secret")
+	}
+	if cfg.Global.ClusterID == cfg.Global.SupervisorID {
+		log.Debugf("cluster-id is already the same as supervisor-id %q", cfg.Global.SupervisorID)
+		return nil
+	}
+	if effectiveClusterID != cfg.Global.SupervisorID {
+		log.Infof("Using supervisor-id %q in place of cluster-id %q for volume metadata",
+			cfg.Global.SupervisorID, cfg.Global.ClusterID)
+	}
+	cfg.Global.ClusterID = cfg.Global.SupervisorID
+	return nil
+}
+
+// getHostnameFromAccessibilityReqs returns the hostname from the most preferred
+// topology segment, falling back to the first requisite topology segment.
+// Returns an empty string if no segment has a hostname label.
+func getHostnameFromAccessibilityReqs(topologyRequirement *csi.TopologyRequirement) string {
+	if topologyRequirement == nil {
+		return ""
+	}
+	for _, topologies := range [][]*csi.Topology{topologyRequirement.GetPreferred(),
+		topologyRequirement.GetRequisite()} {
+		for _, topology := range topologies {
+			if hostname := topology.GetSegments()[v1.LabelHostname]; hostname != "" {
+				return hostname
+			}
+		}
+	}
+	return ""
+}
+
+// getVsanDirectAccessibleTopology returns the hostname-only accessible
+// topology for the given nodes, augmented with the zone of each node's host
+// when its cluster belongs to one or more zones. A node whose zone cannot be
+// resolved keeps its hostname-only segment.
+func (c *controller) getVsanDirectAccessibleTopology(ctx context.Context, vc *vsphere.VirtualCenter,
+	accessibleNodes []string, topologyRequirement *csi.TopologyRequirement) []*csi.Topology {
+	log := logger.GetLogger(ctx)
+	var accessibleTopology []*csi.Topology
+	for _, hostName := range accessibleNodes {
+		var zones []string
+		hostnameValues := getHostnameTopologyValues(ctx, hostName, topologyRequirement)
+		hostMoid, err := c.getCachedHostMOIDFromK8sCloudOperatorService(ctx, hostName)
+		if err != nil || !isValidHostMoid(hostMoid) {
+			log.Warnf("failed to get host moid for node %q. Err: %v. Skipping zone lookup.", hostName, err)
+		} else {
+			host := &vsphere.HostSystem{
+				HostSystem: object.NewHostSystem(vc.Client.Client,
+					vimtypes.ManagedObjectReference{Type: "HostSystem", Value: hostMoid}),
+			}
+			clusterMoref, err := host.GetClusterComputeResourceMoId(ctx)
+			if err != nil {
+				log.Warnf("failed to get cluster of host %q for node %q. Err: %v. Skipping zone lookup.",
+					hostMoid, hostName, err)
+			} else if topologyMgr := c.getTopologyMgr(); clusterMoref != "" && topologyMgr != nil {
+				zones = topologyMgr.GetZonesForCluster(ctx, clusterMoref)
+			}
+		}
+		for _, hostnameValue := range hostnameValues {
+			if len(zones) == 0 {
+				accessibleTopology = append(accessibleTopology, &csi.Topology{
+					Segments: map[string]string{v1.LabelHostname: hostnameValue},
+				})
+				continue
+			}
+			for _, zone := range zones {
+				accessibleTopology = append(accessibleTopology, &csi.Topology{
+					Segments: map[string]string{
+						v1.LabelHostname:     hostnameValue,
+						v1.LabelTopologyZone: zone,
+					},
+				})
+			}
+		}
+	}
+	return accessibleTopology
+}
+
+// getHostnameAccessibleTopology returns the hostname based accessible topology
+// of a volume accessible from the given nodes.
+func getHostnameAccessibleTopology(ctx context.Context, accessibleNodes []string,
+	topologyRequirement *csi.TopologyRequirement) []*csi.Topology {
+	var accessibleTopology []*csi.Topology
+	for _, nodeName := range accessibleNodes {
+		for _, hostnameValue := range getHostnameTopologyValues(ctx, nodeName, topologyRequirement) {
+			accessibleTopology = append(accessibleTopology, &csi.Topology{
+				Segments: map[string]string{v1.LabelHostname: hostnameValue},
+			})
+		}
+	}
+	return accessibleTopology
+}
+
+// getHostnameTopologyValues returns the values of the hostname topology label
+// under which the given node is known. The node name may not match the value
+// of the hostname label, e.g. when one is the short name and the other is the
+// FQDN of the host. The values are taken from the hostname label of the node
+// and from the hostname values in the topology requirement which are aliases
+// of the node name. The node name is returned if no such value is found.
+func getHostnameTopologyValues(ctx context.Context, nodeName string,
+	topologyRequirement *csi.TopologyRequirement) []string {
+	log := logger.GetLogger(ctx)
+	var hostnameValues []string
+	addHostnameValue := func(value string) {
+		for _, existingValue := range hostnameValues {
+			if existingValue == value {
+				return
+			}
+		}
+		hostnameValues = append(hostnameValues, value)
+	}
+	if nodeLister != nil {
+		node, err := nodeLister.Get(nodeName)
+		if err != nil {
+			log.Debugf("failed to get node %q from the node lister. Error: %v", nodeName, err)
+		} else if value, exists := node.Labels[v1.LabelHostname]; exists && value != "" {
+			addHostnameValue(value)
+		}
+	}
+	var requestedTopologies []*csi.Topology
+	requestedTopologies = append(requestedTopologies, topologyRequirement.GetRequisite()...)
+	requestedTopologies = append(requestedTopologies, topologyRequirement.GetPreferred()...)
+	for _, topology := range requestedTopologies {
+		if value, exists := topology.GetSegments()[v1.LabelHostname]; exists && isHostnameAlias(value, nodeName) {
+			addHostnameValue(value)
+		}
+	}
+	if len(hostnameValues) == 0 {
+		return []string{nodeName}
+	}
+	if len(hostnameValues) > 1 || hostnameValues[0] != nodeName {
+		log.Debugf("Node %q is known by hostname values %v", nodeName, hostnameValues)
+	}
+	return hostnameValues
+}
+
+// isHostnameAlias returns true if the given hostnames refer to the same host,
+// i.e. they are equal or one is the short name of the other.
+func isHostnameAlias(hostname1, hostname2 string) bool {
+	shortName1 := strings.SplitN(strings.ToLower(hostname1), ".", 2)[0]
+	shortName2 := strings.SplitN(strings.ToLower(hostname2), ".", 2)[0]
+	if shortName1 != shortName2 {
+		return false
+	}
+	// Different FQDNs with the same short name do not refer to the same host.
+	return !strings.Contains(hostname1, ".") || !strings.Contains(hostname2, ".") ||
+		strings.EqualFold(hostname1, hostname2)
+}
+
+// filterDatastoresInStoragePod returns the datastores from the given list
+// which are members of the given datastore cluster (StoragePod).
+func filterDatastoresInStoragePod(ctx context.Context, vc *vsphere.VirtualCenter, storagePodMoid string,
+	datastores []*vsphere.DatastoreInfo) ([]*vsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	dsMorefs, err := vc.GetDatastoreMorefsInStoragePod(ctx, storagePodMoid)
+	if err != nil {
+		return nil, err
+	}
+	if len(dsMorefs) == 0 {
+		return nil, logger.LogNewErrorf(log, "no datastores found in datastore cluster %q", storagePodMoid)
+	}
+	memberDatastores := make(map[string]struct{})
+	for _, dsMoref := range dsMorefs {
+		memberDatastores[dsMoref.Value] = struct{}{}
+	}
+	var filteredDatastores []*vsphere.DatastoreInfo
+	for _, ds := range datastores {
+		if _, exists := memberDatastores[ds.Datastore.Reference().Value]; exists {
+			filteredDatastores = append(filteredDatastores, ds)
+		}
+	}
+	log.Debugf("Datastores %+v in datastore cluster %q are accessible: %+v", dsMorefs, storagePodMoid,
+		filteredDatastores)
+	return filteredDatastores, nil
+}
+
+// isTargetvSANFileShareClustersChanged returns true if the given lists of
+// target vSAN file share clusters differ, irrespective of their order.
+func isTargetvSANFileShareClustersChanged(oldClusters, newClusters []string) bool {
+	if len(oldClusters) != len(newClusters) {
+		return true
+	}
+	oldClusterSet := make(map[string]struct{}, len(oldClusters))
+	for _, cluster := range oldClusters {
+		oldClusterSet[cluster] = struct{}{}
+	}
+	for _, cluster := range newClusters {
+		if _, exists := oldClusterSet[cluster]; !exists {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTargetvSANFileShareClusters logs a warning for each target vSAN file
+// share cluster which is not present in the given map of file services enabled
+// clusters, as file volumes cannot be created on such clusters.
+func validateTargetvSANFileShareClusters(ctx context.Context, targetClusters []string,
+	fsEnabledClusterToDsMap map[string][]*vsphere.DatastoreInfo) {
+	log := logger.GetLogger(ctx)
+	for _, cluster := range targetClusters {
+		if _, exists := fsEnabledClusterToDsMap[cluster]; !exists {
+			log.Warnf("Target vSAN file share cluster %q either does not have file services enabled "+
+				"or the CSI user lacks the required privileges on it. File volumes will not be created on it.",
+				cluster)
+		}
+	}
+}
+
+// batchAttachVolume queues the given volume to be attached to the PodVM and
+// waits for the result. If no attach to the PodVM is in progress, the volume
+// is attached right away. Otherwise, the requests for the PodVM arriving while
+// the attach is in progress are attached together using a single CNS attach
+// task once it completes.
+func batchAttachVolume(ctx context.Context, manager *common.Manager, podVM *vsphere.VirtualMachine,
+	volumeID string) (string, string, error) {
+	log := logger.GetLogger(ctx)
+	resultCh := make(chan *cnsvolume.CnsAttachResult, 1)
+	key := podVM.Reference().Value
+
+	pendingAttachBatchesLock.Lock()
+	batch, exists := pendingAttachBatches[key]
+	if !exists {
+		batch = &attachBatch{
+			podVM:   podVM,
+			waiters: make(map[string][]chan *cnsvolume.CnsAttachResult),
+		}
+		pendingAttachBatches[key] = batch
+	}
+	batch.waiters[volumeID] = append(batch.waiters[volumeID], resultCh)
+	if _, inProgress := attachesInProgress[key]; !inProgress {
+		attachesInProgress[key] = struct{}{}
+		go flushAttachBatches(manager, key)
+	}
+	pendingAttachBatchesLock.Unlock()
+	log.Debugf("Queued volume: %q for attach to PodVM: %q", volumeID, podVM.String())
+
+	select {
+	case result := <-resultCh:
+		return result.DiskUUID, result.FaultType, result.Err
+	case <-ctx.Done():
+		return "", csifault.CSIInternalFault, logger.LogNewErrorf(log,
+			"timed out waiting for volume: %q to be attached to PodVM: %q. Error: %+v",
+			volumeID, podVM.String(), ctx.Err())
+	}
+}
+
+// getPublishContextIfAttached returns the PublishContext of the given block
+// volume if it is already attached to the PodVM, else nil. Failure to check
+// the devices of the PodVM is logged and treated as the volume not being
+// attached, so that the attach is attempted.
+func getPublishContextIfAttached(ctx context.Context, podVM *vsphere.VirtualMachine,
+	volumeID string) map[string]string {
+	log := logger.GetLogger(ctx)
+	diskUUID, err := cnsvolume.IsDiskAttached(ctx, podVM, volumeID, true)
+	if err != nil {
+		log.Warnf("failed to check if volume: %q is attached to PodVM: %q. Proceeding with attach. Error: %+v",
+			volumeID, podVM.String(), err)
+		return nil
+	}
+	if diskUUID == "" {
+		return nil
+	}
+	log.Infof("Volume: %q is already attached to PodVM: %q with diskUUID: %q. Skipping attach.",
+		volumeID, podVM.String(), diskUUID)
+	return getBlockVolumePublishContext(diskUUID)
+}
+
+// getBlockVolumePublishContext returns the PublishContext of a block volume
+// attached to a PodVM with the given diskUUID.
+func getBlockVolumePublishContext(diskUUID string) map[string]string {
+	return map[string]string{
+		common.AttributeDiskType:           common.DiskTypeBlockVolume,
+		common.AttributeFirstClassDiskUUID: common.FormatDiskUUID(diskUUID),
+	}
+}
+
+// flushAttachBatches issues a CNS attach task for the volumes queued for the
+// PodVM identified by key and sends the results back to the callers. It
+// repeats until no more volumes are queued for the PodVM.
+func flushAttachBatches(manager *common.Manager, key string) {
+	ctx, log := logger.GetNewContextWithLogger()
+	for {
+		pendingAttachBatchesLock.Lock()
+		batch, exists := pendingAttachBatches[key]
+		delete(pendingAttachBatches, key)
+		if !exists {
+			delete(attachesInProgress, key)
+			pendingAttachBatchesLock.Unlock()
+			return
+		}
+		pendingAttachBatchesLock.Unlock()
+
+		volumeIDs := make([]string, 0, len(batch.waiters))
+		for volumeID := range batch.waiters {
+			volumeIDs = append(volumeIDs, volumeID)
+		}
+		sort.Strings(volumeIDs)
+		log.Infof("Attaching volumes: %v to PodVM: %q in a single CNS task", volumeIDs, batch.podVM.String())
+		cnsOpStart := time.Now()
+		results, faultType, err := common.BatchAttachVolumesUtil(ctx, manager, batch.podVM, volumeIDs, true)
+		common.ObserveCnsUtilOpLatency(prometheus.PrometheusBlockVolumeType,
+			prometheus.PrometheusAttachVolumeOpType, cnsOpStart, err)
+		for volumeID, waiters := range batch.waiters {
+			result := &cnsvolume.CnsAttachResult{FaultType: faultType, Err: err}
+			if err == nil {
+				result = results[volumeID]
+			}
+			for _, waiter := range waiters {
+				waiter <- result
+			}
+		}
+	}
+}
+
+// checkControllerLiveness reports the controller as live as long as it serves
+// the health probe. Dependencies like vCenter are not checked, so that their
+// outages do not restart the controller.
+func (c *controller) checkControllerLiveness(ctx context.Context) error {
+	return nil
+}
+
+// checkControllerReadiness returns an error describing why the controller is
+// not ready to serve requests. The controller is ready when its connection to
+// vCenter is usable and, if TKGsHA is enabled and the topology service is
+// initialized, the AvailabilityZone informer has completed its initial sync.
+// The topology service is initialized lazily, so the controller is ready
+// before it is initialized.
+func (c *controller) checkControllerReadiness(ctx context.Context) error {
+	vc, err := c.manager.VcenterManager.GetVirtualCenter(ctx, c.manager.VcenterConfig.Host)
+	if err != nil {
+		return fmt.Errorf("failed to get vCenter %q. err: %v", c.manager.VcenterConfig.Host, err)
+	}
+	if err = vc.ValidateConnection(ctx); err != nil {
+		return fmt.Errorf("vCenter %q is not connected. err: %v", c.manager.VcenterConfig.Host, err)
+	}
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.TKGsHA) {
+		topologyMgr := c.getTopologyMgr()
+		if topologyMgr != nil && !topologyMgr.HasSynced() {
+			return errors.New("AvailabilityZone informer has not synced")
+		}
+	}
+	return nil
+}
+
+// newHealthHandler returns an HTTP handler which responds with 200 if check
+// succeeds, else with 503 along with the reason returned by check.
+func newHealthHandler(check func(ctx context.Context) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, log := logger.GetNewContextWithLogger()
+		if err := check(ctx); err != nil {
+			log.Warnf("Health check for %q failed. Reason: %v", r.URL.Path, err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}
+}
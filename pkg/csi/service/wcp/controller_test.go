@@ -19,13 +19,20 @@ package wcp
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/agiledragon/gomonkey/v2"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/google/uuid"
 	cnssim "github.com/vmware/govmomi/cns/simulator"
@@ -38,12 +45,18 @@ import (
 	"github.com/vmware/govmomi/simulator"
 	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	cnsvolume "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/volume"
 	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/cns-lib/vsphere"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/config"
+	csifault "sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/fault"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/common/unittestcommon"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common"
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/common/commonco"
+	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/internalapis/cnsvolumeoperationrequest"
 )
 
 const (
@@ -118,6 +131,12 @@ func configFromSimWithTLS(tlsConfig *tls.Config, insecureAllowed bool) (*config.
 		InsecureFlag: cfg.Global.InsecureFlag,
 		Datacenters:  cfg.Global.Datacenters,
 	}
+
+	// set up the default global maximum of number of snapshots if unset
+	if cfg.Snapshot.GlobalMaxSnapshotsPerBlockVolume == 0 {
+		cfg.Snapshot.GlobalMaxSnapshotsPerBlockVolume = config.DefaultGlobalMaxSnapshotsPerBlockVolume
+	}
+
 	return cfg, func() {
 		s.Close()
 		model.Remove()
@@ -373,3 +392,1288 @@ func TestWCPCreateVolumeWithStoragePolicy(t *testing.T) {
 		t.Fatalf("Volume should not exist after deletion with ID: %s", volID)
 	}
 }
+
+// TestGetHostnameTopologyValues verifies that the hostname topology values of
+// a node resolve aliases of the node name found in the topology requirement.
+func TestGetHostnameTopologyValues(t *testing.T) {
+	topologyRequirement := &csi.TopologyRequirement{
+		Preferred: []*csi.Topology{
+			{Segments: map[string]string{v1.LabelHostname: "node1.example.com"}},
+			{Segments: map[string]string{v1.LabelHostname: "node2"}},
+			{Segments: map[string]string{v1.LabelHostname: "node3.other.com"}},
+		},
+	}
+	tests := []struct {
+		nodeName       string
+		expectedValues []string
+	}{
+		{nodeName: "node1", expectedValues: []string{"node1.example.com"}},
+		{nodeName: "node2.example.com", expectedValues: []string{"node2"}},
+		{nodeName: "node3.example.com", expectedValues: []string{"node3.example.com"}},
+		{nodeName: "node4", expectedValues: []string{"node4"}},
+	}
+	for _, test := range tests {
+		values := getHostnameTopologyValues(context.Background(), test.nodeName, topologyRequirement)
+		if !reflect.DeepEqual(values, test.expectedValues) {
+			t.Errorf("node %q: expected hostname values %v but got %v", test.nodeName, test.expectedValues, values)
+		}
+	}
+}
+
+// TestGetOrInitTopologyMgr verifies that the topology manager is lazily
+// initialized when it was not available at controller init.
+func TestGetOrInitTopologyMgr(t *testing.T) {
+	var err error
+	commonco.ContainerOrchestratorUtility, err =
+		unittestcommon.GetFakeContainerOrchestratorInterface(common.Kubernetes)
+	if err != nil {
+		t.Fatalf("Failed to create co agnostic interface. err=%v", err)
+	}
+	c := &controller{manager: &common.Manager{CnsConfig: &config.Config{}}}
+	topologyMgr, faultType, err := c.getOrInitTopologyMgr(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %+v, fault: %q", err, faultType)
+	}
+	if topologyMgr == nil || c.topologyMgr != topologyMgr {
+		t.Errorf("expected topology manager to be initialized and cached on the controller")
+	}
+}
+
+// fakeZonalTopologyMgr is a ControllerTopologyService which maps clusters to
+// zones.
+type fakeZonalTopologyMgr struct {
+	clusterZones map[string][]string
+	unsynced     bool
+}
+
+func (f *fakeZonalTopologyMgr) GetSharedDatastoresInTopology(ctx context.Context,
+	topologyFetchDSParams interface{}) ([]*cnsvsphere.DatastoreInfo, error) {
+	return nil, nil
+}
+
+func (f *fakeZonalTopologyMgr) GetTopologyInfoFromNodes(ctx context.Context,
+	retrieveTopologyInfoParams interface{}) ([]map[string]string, error) {
+	return nil, nil
+}
+
+func (f *fakeZonalTopologyMgr) GetZonesForCluster(ctx context.Context, clusterMoref string) []string {
+	return f.clusterZones[clusterMoref]
+}
+
+func (f *fakeZonalTopologyMgr) HasSynced() bool {
+	return !f.unsynced
+}
+
+func (f *fakeZonalTopologyMgr) WaitForSync(ctx context.Context) bool {
+	return !f.unsynced
+}
+
+func (f *fakeZonalTopologyMgr) SetDrainingTopologyValues(ctx context.Context, values []string) {
+}
+
+// fakePlacementTopologyMgr is a ControllerTopologyService which places
+// volumes on the given datastores in the given zones.
+type fakePlacementTopologyMgr struct {
+	fakeZonalTopologyMgr
+	sharedDatastores []*cnsvsphere.DatastoreInfo
+	zones            []string
+}
+
+func (f *fakePlacementTopologyMgr) GetSharedDatastoresInTopology(ctx context.Context,
+	topologyFetchDSParams interface{}) ([]*cnsvsphere.DatastoreInfo, error) {
+	return f.sharedDatastores, nil
+}
+
+func (f *fakePlacementTopologyMgr) GetTopologyInfoFromNodes(ctx context.Context,
+	retrieveTopologyInfoParams interface{}) ([]map[string]string, error) {
+	var accessibleTopology []map[string]string
+	for _, zone := range f.zones {
+		accessibleTopology = append(accessibleTopology, map[string]string{v1.LabelTopologyZone: zone})
+	}
+	return accessibleTopology, nil
+}
+
+// TestCreateVolumeRecordsZonalPlacement verifies that the selected datastore
+// and zones of a zonal volume are recorded in its volume context.
+func TestCreateVolumeRecordsZonalPlacement(t *testing.T) {
+	ct := getControllerTest(t)
+	sharedDatastores, _, err := getFakeDatastores(ctx, ct.vcenter, testClusterName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct.controller.topologyMgr = &fakePlacementTopologyMgr{sharedDatastores: sharedDatastores,
+		zones: []string{"zone-a"}}
+	defer func() {
+		ct.controller.topologyMgr = nil
+	}()
+	reqCreate := &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+		AccessibilityRequirements: &csi.TopologyRequirement{
+			Preferred: []*csi.Topology{{Segments: map[string]string{v1.LabelTopologyZone: "zone-a"}}},
+			Requisite: []*csi.Topology{{Segments: map[string]string{v1.LabelTopologyZone: "zone-a"}}},
+		},
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, reqCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: respCreate.Volume.VolumeId})
+	}()
+	volumeContext := respCreate.Volume.VolumeContext
+	if volumeContext[common.AttributeSelectedDatastoreURL] != sharedDatastores[0].Info.Url {
+		t.Errorf("expected selected datastore URL %q but got %q", sharedDatastores[0].Info.Url,
+			volumeContext[common.AttributeSelectedDatastoreURL])
+	}
+	if volumeContext[common.AttributeSelectedZones] != "zone-a" {
+		t.Errorf("expected selected zones %q but got %q", "zone-a", volumeContext[common.AttributeSelectedZones])
+	}
+}
+
+// TestGetCapacityDatastores verifies that the capacity of the datastores in
+// the requested zone is summed and no capacity is reported for a zone without
+// datastores.
+func TestGetCapacityDatastores(t *testing.T) {
+	newDatastore := func(url string, freeSpace int64) *cnsvsphere.DatastoreInfo {
+		return &cnsvsphere.DatastoreInfo{Info: &types.DatastoreInfo{Url: url, FreeSpace: freeSpace}}
+	}
+	clusterDatastores := map[string][]*cnsvsphere.DatastoreInfo{
+		"domain-c1": {newDatastore("ds:///vmfs/volumes/ds1/", 10*common.GbInBytes),
+			newDatastore("ds:///vmfs/volumes/shared/", 5*common.GbInBytes)},
+		"domain-c2": {newDatastore("ds:///vmfs/volumes/shared/", 5*common.GbInBytes)},
+		"domain-c3": {newDatastore("ds:///vmfs/volumes/ds3/", 20*common.GbInBytes)},
+	}
+	savedGetCandidateDatastores, savedClusterComputeResourceMoIds := getCandidateDatastores,
+		clusterComputeResourceMoIds
+	defer func() {
+		getCandidateDatastores, clusterComputeResourceMoIds = savedGetCandidateDatastores,
+			savedClusterComputeResourceMoIds
+	}()
+	getCandidateDatastores = func(ctx context.Context, vc *cnsvsphere.VirtualCenter,
+		clusterID string) ([]*cnsvsphere.DatastoreInfo, []*cnsvsphere.DatastoreInfo, error) {
+		return clusterDatastores[clusterID], nil, nil
+	}
+	clusterComputeResourceMoIds = []string{"domain-c1", "domain-c2", "domain-c3"}
+	var err error
+	commonco.ContainerOrchestratorUtility, err =
+		unittestcommon.GetFakeContainerOrchestratorInterface(common.Kubernetes)
+	if err != nil {
+		t.Fatalf("Failed to create co agnostic interface. err=%v", err)
+	}
+	c := &controller{
+		manager: &common.Manager{CnsConfig: &config.Config{}},
+		topologyMgr: &fakeZonalTopologyMgr{clusterZones: map[string][]string{
+			"domain-c1": {"zone-a"},
+			"domain-c2": {"zone-a"},
+			"domain-c3": {"zone-b"},
+		}},
+	}
+
+	tests := []struct {
+		zone                      string
+		expectedAvailableCapacity int64
+		expectedMaximumVolumeSize int64
+	}{
+		{zone: "zone-a", expectedAvailableCapacity: 15 * common.GbInBytes,
+			expectedMaximumVolumeSize: 10 * common.GbInBytes},
+		{zone: "zone-b", expectedAvailableCapacity: 20 * common.GbInBytes,
+			expectedMaximumVolumeSize: 20 * common.GbInBytes},
+		{zone: "zone-c", expectedAvailableCapacity: 0, expectedMaximumVolumeSize: 0},
+	}
+	for _, test := range tests {
+		datastores, err := c.getCapacityDatastores(context.Background(), nil,
+			&csi.Topology{Segments: map[string]string{v1.LabelTopologyZone: test.zone}})
+		if err != nil {
+			t.Fatalf("zone %q: unexpected error: %+v", test.zone, err)
+		}
+		availableCapacity, maximumVolumeSize := common.GetDatastoresCapacity(datastores, "")
+		if availableCapacity != test.expectedAvailableCapacity || maximumVolumeSize != test.expectedMaximumVolumeSize {
+			t.Errorf("zone %q: expected capacity %d and maximum volume size %d but got %d and %d", test.zone,
+				test.expectedAvailableCapacity, test.expectedMaximumVolumeSize, availableCapacity, maximumVolumeSize)
+		}
+	}
+}
+
+// TestValidateWCPCreateVolumeRequestWithZoneAndHostname verifies that a
+// topology requirement with both zone and hostname segments is rejected by
+// the request validation.
+func TestValidateWCPCreateVolumeRequestWithZoneAndHostname(t *testing.T) {
+	var err error
+	commonco.ContainerOrchestratorUtility, err =
+		unittestcommon.GetFakeContainerOrchestratorInterface(common.Kubernetes)
+	if err != nil {
+		t.Fatalf("Failed to create co agnostic interface. err=%v", err)
+	}
+	req := &csi.CreateVolumeRequest{
+		Name: testVolumeName,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+		AccessibilityRequirements: &csi.TopologyRequirement{
+			Preferred: []*csi.Topology{
+				{Segments: map[string]string{v1.LabelTopologyZone: "zone-a"}},
+				{Segments: map[string]string{v1.LabelHostname: "node1"}},
+			},
+		},
+	}
+	err = validateWCPCreateVolumeRequest(context.Background(), req, true)
+	var validationErr *createVolumeValidationError
+	if !errors.As(err, &validationErr) || validationErr.field != "accessibility_requirements" {
+		t.Fatalf("expected validation error for accessibility_requirements but got %+v", err)
+	}
+	// StorageClasses with topology disabled ignore the topology requirement.
+	req.Parameters = map[string]string{"Topology": common.TopologyDisabled}
+	if err = validateWCPCreateVolumeRequest(context.Background(), req, true); err != nil {
+		t.Fatalf("expected no validation error with topology disabled but got %+v", err)
+	}
+}
+
+// TestValidateWCPCreateVolumeRequestWithDatastoreClusterAndStoragePool verifies
+// that a datastore cluster and a storage pool cannot be requested together.
+func TestValidateWCPCreateVolumeRequestWithDatastoreClusterAndStoragePool(t *testing.T) {
+	var err error
+	commonco.ContainerOrchestratorUtility, err =
+		unittestcommon.GetFakeContainerOrchestratorInterface(common.Kubernetes)
+	if err != nil {
+		t.Fatalf("Failed to create co agnostic interface. err=%v", err)
+	}
+	req := &csi.CreateVolumeRequest{
+		Name: testVolumeName,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+		Parameters: map[string]string{"DatastoreClusterMoid": "group-p1"},
+	}
+	if err = validateWCPCreateVolumeRequest(context.Background(), req, true); err != nil {
+		t.Fatalf("expected no validation error for a datastore cluster but got %+v", err)
+	}
+	req.Parameters["StoragePool"] = "storagepool-1"
+	err = validateWCPCreateVolumeRequest(context.Background(), req, true)
+	var validationErr *createVolumeValidationError
+	if !errors.As(err, &validationErr) ||
+		validationErr.field != "parameters."+common.AttributeDatastoreClusterMoid {
+		t.Fatalf("expected validation error for %s but got %+v", common.AttributeDatastoreClusterMoid, err)
+	}
+}
+
+// TestCheckZonalTopologyRequirementWithoutTKGsHA verifies that zones requested
+// while the TKGsHA feature is disabled fail the request only when configured to.
+func TestCheckZonalTopologyRequirementWithoutTKGsHA(t *testing.T) {
+	ctx := context.Background()
+	zonalRequirement := &csi.TopologyRequirement{
+		Preferred: []*csi.Topology{{Segments: map[string]string{v1.LabelTopologyZone: "zone-a"}}},
+	}
+	hostnameRequirement := &csi.TopologyRequirement{
+		Preferred: []*csi.Topology{{Segments: map[string]string{v1.LabelHostname: "node1"}}},
+	}
+	if err := checkZonalTopologyRequirementWithoutTKGsHA(ctx, zonalRequirement, false); err != nil {
+		t.Errorf("expected only a warning for zones but got %+v", err)
+	}
+	err := checkZonalTopologyRequirementWithoutTKGsHA(ctx, zonalRequirement, true)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition for zones but got %+v", err)
+	}
+	for _, requirement := range []*csi.TopologyRequirement{nil, hostnameRequirement} {
+		if err = checkZonalTopologyRequirementWithoutTKGsHA(ctx, requirement, true); err != nil {
+			t.Errorf("expected no error for topology requirement %+v but got %+v", requirement, err)
+		}
+	}
+}
+
+// TestValidateWCPCreateVolumeRequestStorageTopologyType verifies that the
+// storageTopologyType parameter is validated case insensitively and rejected
+// when the TKGsHA feature is disabled.
+func TestValidateWCPCreateVolumeRequestStorageTopologyType(t *testing.T) {
+	originalCO := commonco.ContainerOrchestratorUtility
+	defer func() {
+		commonco.ContainerOrchestratorUtility = originalCO
+	}()
+	fakeCO, err := unittestcommon.GetFakeContainerOrchestratorInterface(common.Kubernetes)
+	if err != nil {
+		t.Fatalf("Failed to create co agnostic interface. err=%v", err)
+	}
+	commonco.ContainerOrchestratorUtility = fakeCO
+	newRequest := func(storageTopologyType string) *csi.CreateVolumeRequest {
+		return &csi.CreateVolumeRequest{
+			Name: testVolumeName,
+			VolumeCapabilities: []*csi.VolumeCapability{
+				{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+			},
+			Parameters: map[string]string{"StorageTopologyType": storageTopologyType},
+		}
+	}
+
+	tests := []struct {
+		storageTopologyType string
+		tkgsHAEnabled       bool
+		expectValid         bool
+	}{
+		{storageTopologyType: "zonal", tkgsHAEnabled: true, expectValid: true},
+		{storageTopologyType: "Zonal", tkgsHAEnabled: true, expectValid: true},
+		{storageTopologyType: "CrossZonal", tkgsHAEnabled: true, expectValid: true},
+		{storageTopologyType: "regional", tkgsHAEnabled: true, expectValid: false},
+		{storageTopologyType: "zonal", tkgsHAEnabled: false, expectValid: false},
+	}
+	for _, test := range tests {
+		fakeCO.(*unittestcommon.FakeK8SOrchestrator).SetFSS(common.TKGsHA, test.tkgsHAEnabled)
+		err = validateWCPCreateVolumeRequest(context.Background(), newRequest(test.storageTopologyType), true)
+		if test.expectValid {
+			if err != nil {
+				t.Errorf("%q with tkgs-ha %t: expected no validation error but got %+v",
+					test.storageTopologyType, test.tkgsHAEnabled, err)
+			}
+			continue
+		}
+		var validationErr *createVolumeValidationError
+		if !errors.As(err, &validationErr) || validationErr.field != "parameters.storagetopologytype" {
+			t.Errorf("%q with tkgs-ha %t: expected validation error for parameters.storagetopologytype "+
+				"but got %+v", test.storageTopologyType, test.tkgsHAEnabled, err)
+		}
+	}
+}
+
+// fakeStoragePolicyVolumeManager records storage policy updates, as the CNS
+// simulator does not implement RelocateVolume.
+type fakeStoragePolicyVolumeManager struct {
+	cnsvolume.Manager
+	volumeID        string
+	datastore       types.ManagedObjectReference
+	storagePolicyID string
+}
+
+func (f *fakeStoragePolicyVolumeManager) UpdateVolumeStoragePolicy(ctx context.Context, volumeID string,
+	datastore types.ManagedObjectReference, storagePolicyID string) (string, error) {
+	f.volumeID = volumeID
+	f.datastore = datastore
+	f.storagePolicyID = storagePolicyID
+	return "", nil
+}
+
+// TestModifyVolumeStoragePolicy verifies that ControllerModifyVolume updates
+// the storage policy of a volume only for known volumes and storage policies.
+func TestModifyVolumeStoragePolicy(t *testing.T) {
+	ct := getControllerTest(t)
+	pc, err := pbm.NewClient(ctx, ct.vcenter.Client.Client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profileID, err := pc.ProfileIDByName(ctx, "vSAN Default Storage Policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqCreate := &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	}
+	getCandidateDatastores = getFakeDatastores
+	respCreate, err := ct.controller.CreateVolume(ctx, reqCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		_, _ = ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID})
+	}()
+
+	volumeManager := ct.controller.manager.VolumeManager
+	fakeVolumeManager := &fakeStoragePolicyVolumeManager{Manager: volumeManager}
+	ct.controller.manager.VolumeManager = fakeVolumeManager
+	defer func() {
+		ct.controller.manager.VolumeManager = volumeManager
+	}()
+
+	modifyVolume := func(volumeID string, mutableParameters map[string]string) error {
+		_, err := ct.controller.ControllerModifyVolume(ctx, &csi.ControllerModifyVolumeRequest{
+			VolumeId:          volumeID,
+			MutableParameters: mutableParameters,
+		})
+		return err
+	}
+
+	// Success.
+	if err = modifyVolume(volID, map[string]string{"storagePolicyID": profileID}); err != nil {
+		t.Fatalf("failed to modify storage policy of volume %q. Error: %v", volID, err)
+	}
+	if fakeVolumeManager.volumeID != volID || fakeVolumeManager.storagePolicyID != profileID ||
+		fakeVolumeManager.datastore.Value == "" {
+		t.Fatalf("unexpected storage policy update %+v", fakeVolumeManager)
+	}
+
+	// Unknown storage policy.
+	err = modifyVolume(volID, map[string]string{common.AttributeStoragePolicyID: uuid.New().String()})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for unknown storage policy but got %v", err)
+	}
+
+	// Unknown volume.
+	err = modifyVolume(uuid.New().String(), map[string]string{common.AttributeStoragePolicyID: profileID})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for unknown volume but got %v", err)
+	}
+
+	// Missing or unsupported mutable parameters.
+	for _, mutableParameters := range []map[string]string{
+		nil,
+		{common.AttributeStoragePolicyID: profileID, "storagepolicyname": "gold"},
+	} {
+		if err = modifyVolume(volID, mutableParameters); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("expected InvalidArgument for mutable parameters %+v but got %v", mutableParameters, err)
+		}
+	}
+}
+
+// TestRecordCreateVolumeFailure verifies that the failure reason of a
+// CreateVolume call is persisted in the operation store and is available to
+// its retry.
+func TestRecordCreateVolumeFailure(t *testing.T) {
+	ctx := context.Background()
+	operationStore, err := unittestcommon.InitFakeVolumeOperationRequestInterface()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &controller{operationStore: operationStore}
+	volumeName := testVolumeName + "-" + uuid.New().String()
+	if reason := c.getPreviousCreateVolumeFailureReason(ctx, volumeName); reason != "" {
+		t.Fatalf("expected no failure reason for a new volume but got %q", reason)
+	}
+	c.recordCreateVolumeFailure(ctx, volumeName, cnsvolumeoperationrequest.FailureReasonPolicyInvalid,
+		errors.New("storage policy is not compatible"))
+	details, err := operationStore.GetRequestDetails(ctx, volumeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.OperationDetails.TaskStatus != cnsvolumeoperationrequest.TaskInvocationStatusError ||
+		details.OperationDetails.Error != "storage policy is not compatible" {
+		t.Fatalf("unexpected operation details %+v", details.OperationDetails)
+	}
+	if reason := c.getPreviousCreateVolumeFailureReason(ctx, volumeName); reason !=
+		cnsvolumeoperationrequest.FailureReasonPolicyInvalid {
+		t.Fatalf("expected failure reason %q but got %q", cnsvolumeoperationrequest.FailureReasonPolicyInvalid,
+			reason)
+	}
+}
+
+// TestCheckExistingVolumeCapacity verifies that a CreateVolume retry with the
+// name of an existing volume is rejected with AlreadyExists only if the
+// requested capacity is not compatible with the existing volume.
+func TestCheckExistingVolumeCapacity(t *testing.T) {
+	ct := getControllerTest(t)
+	pc, err := pbm.NewClient(ctx, ct.vcenter.Client.Client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// PBM simulator defaults.
+	profileID, err := pc.ProfileIDByName(ctx, "vSAN Default Storage Policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqCreate := &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		Parameters: map[string]string{common.AttributeStoragePolicyID: profileID},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	}
+	getCandidateDatastores = getFakeDatastores
+	respCreate, err := ct.controller.CreateVolume(ctx, reqCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		_, err := ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	operationStore, err := unittestcommon.InitFakeVolumeOperationRequestInterface()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &controller{manager: ct.controller.manager, operationStore: operationStore}
+	// Without a previous successful CreateVolume call, no volume exists.
+	if err := common.CheckExistingVolumeCapacity(ctx, c.manager, c.operationStore, reqCreate.Name,
+		&csi.CapacityRange{RequiredBytes: 2 * common.GbInBytes}); err != nil {
+		t.Fatalf("expected no error for a volume which was not created yet but got %v", err)
+	}
+	err = operationStore.StoreRequestDetails(ctx, cnsvolumeoperationrequest.CreateVolumeOperationRequestDetails(
+		reqCreate.Name, volID, "", 0, metav1.Now(), "", "", cnsvolumeoperationrequest.TaskInvocationStatusSuccess, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		capacityRange *csi.CapacityRange
+		expectedCode  codes.Code
+	}{
+		{"same capacity", &csi.CapacityRange{RequiredBytes: 1 * common.GbInBytes}, codes.OK},
+		{"smaller capacity", &csi.CapacityRange{RequiredBytes: 512 * common.MbInBytes}, codes.OK},
+		{"larger capacity", &csi.CapacityRange{RequiredBytes: 2 * common.GbInBytes}, codes.AlreadyExists},
+		{"limit below capacity", &csi.CapacityRange{RequiredBytes: 512 * common.MbInBytes,
+			LimitBytes: 768 * common.MbInBytes}, codes.AlreadyExists},
+	}
+	for _, test := range tests {
+		err := common.CheckExistingVolumeCapacity(ctx, c.manager, c.operationStore, reqCreate.Name,
+			test.capacityRange)
+		if status.Code(err) != test.expectedCode {
+			t.Errorf("%s: expected code %v but got error %v", test.name, test.expectedCode, err)
+		}
+	}
+}
+
+// TestWCPCreateVolumeDryRun verifies that a dry-run CreateVolume call resolves
+// the placement of a block volume without creating it in CNS, and that the
+// dry-run parameter is rejected for file volumes.
+func TestWCPCreateVolumeDryRun(t *testing.T) {
+	ct := getControllerTest(t)
+	pc, err := pbm.NewClient(ctx, ct.vcenter.Client.Client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// PBM simulator defaults.
+	profileID, err := pc.ProfileIDByName(ctx, "vSAN Default Storage Policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqCreate := &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		Parameters: map[string]string{
+			common.AttributeStoragePolicyID: profileID,
+			common.AttributeDryRun:          "true",
+		},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	}
+	queryResult, err := ct.vcenter.CnsClient.QueryVolume(ctx, cnstypes.CnsQueryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	numVolumes := len(queryResult.Volumes)
+
+	getCandidateDatastores = getFakeDatastores
+	// The simulator does not implement PbmCheckCompatibility.
+	var compatibleDatastoreURL string
+	defer func(f func(context.Context, *cnsvsphere.VirtualCenter, string,
+		[]*cnsvsphere.DatastoreInfo) ([]*cnsvsphere.DatastoreInfo, error)) {
+		getStoragePolicyCompatibleDatastores = f
+	}(getStoragePolicyCompatibleDatastores)
+	getStoragePolicyCompatibleDatastores = func(ctx context.Context, vc *cnsvsphere.VirtualCenter,
+		storagePolicyID string, datastores []*cnsvsphere.DatastoreInfo) ([]*cnsvsphere.DatastoreInfo, error) {
+		var compatibleDatastores []*cnsvsphere.DatastoreInfo
+		for _, ds := range datastores {
+			if compatibleDatastoreURL == "" || ds.Info.Url == compatibleDatastoreURL {
+				compatibleDatastores = append(compatibleDatastores, ds)
+			}
+		}
+		return compatibleDatastores, nil
+	}
+	respCreate, err := ct.controller.CreateVolume(ctx, reqCreate)
+	if err != nil {
+		t.Fatalf("expected a dry-run to succeed but got %v", err)
+	}
+	if respCreate.Volume.VolumeId != "" {
+		t.Errorf("expected an empty volume ID for a dry-run but got %q", respCreate.Volume.VolumeId)
+	}
+	if respCreate.Volume.VolumeContext[common.AttributeSelectedDatastoreURL] == "" ||
+		respCreate.Volume.VolumeContext[common.AttributeSelectedDatastoreEstimated] != "true" ||
+		respCreate.Volume.VolumeContext[common.AttributeDryRun] != "true" {
+		t.Errorf("expected the estimated selected datastore in the volume context of a dry-run but got %+v",
+			respCreate.Volume.VolumeContext)
+	}
+	// The datastore is selected among the datastores compatible with the
+	// storage policy.
+	compatibleDatastoreURL = "ds:///vmfs/volumes/no-such-datastore/"
+	_, err = ct.controller.CreateVolume(ctx, reqCreate)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a dry-run with an incompatible storage policy but got %v", err)
+	}
+	queryResult, err = ct.vcenter.CnsClient.QueryVolume(ctx, cnstypes.CnsQueryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queryResult.Volumes) != numVolumes {
+		t.Fatalf("expected no volume to be created in a dry-run but found %d volumes instead of %d",
+			len(queryResult.Volumes), numVolumes)
+	}
+
+	err = validateWCPCreateVolumeRequest(ctx, reqCreate, false)
+	var validationErr *createVolumeValidationError
+	if !errors.As(err, &validationErr) || validationErr.field != "parameters."+common.AttributeDryRun {
+		t.Errorf("expected validation error for the dry-run parameter of a file volume but got %+v", err)
+	}
+}
+
+// TestFilterDatastoresByURL verifies that the candidate datastores are
+// restricted by the datastore allow and deny lists.
+func TestOrderDatastoresByAffinity(t *testing.T) {
+	datastores := []*cnsvsphere.DatastoreInfo{
+		{Info: &types.DatastoreInfo{Url: "ds:///vmfs/volumes/ds3/"}},
+		{Info: &types.DatastoreInfo{Url: "ds:///vmfs/volumes/ds1/"}},
+		{Info: &types.DatastoreInfo{Url: "ds:///vmfs/volumes/ds2/"}},
+	}
+	getURLs := func(orderedDatastores []*cnsvsphere.DatastoreInfo) []string {
+		var urls []string
+		for _, ds := range orderedDatastores {
+			urls = append(urls, ds.Info.Url)
+		}
+		return urls
+	}
+	// All candidates are kept, most preferred first.
+	ordered := getURLs(orderDatastoresByAffinity(common.DatastoreAffinityColocate, "ns/web", 0, datastores))
+	if len(ordered) != len(datastores) {
+		t.Fatalf("expected all %d candidate datastores to be kept but got %v", len(datastores), ordered)
+	}
+	// With the colocate affinity, all ordinals prefer the same datastore.
+	for ordinal := 1; ordinal < 5; ordinal++ {
+		colocated := getURLs(orderDatastoresByAffinity(common.DatastoreAffinityColocate, "ns/web", ordinal,
+			datastores))
+		if !reflect.DeepEqual(colocated, ordered) {
+			t.Errorf("expected ordinal %d to be ordered as %v but got %v", ordinal, ordered, colocated)
+		}
+	}
+	// With the spread affinity, consecutive ordinals prefer different
+	// datastores and the others follow in round-robin order.
+	for ordinal := 0; ordinal < len(datastores); ordinal++ {
+		spread := getURLs(orderDatastoresByAffinity(common.DatastoreAffinitySpread, "ns/web", ordinal,
+			datastores))
+		next := getURLs(orderDatastoresByAffinity(common.DatastoreAffinitySpread, "ns/web", ordinal+1,
+			datastores))
+		expected := append(append([]string{}, spread[1:]...), spread[0])
+		if !reflect.DeepEqual(next, expected) {
+			t.Errorf("expected ordinal %d to be ordered as %v but got %v", ordinal+1, expected, next)
+		}
+	}
+	// The given candidates are not reordered in place.
+	if datastores[0].Info.Url != "ds:///vmfs/volumes/ds3/" {
+		t.Errorf("expected the candidate datastores to be left unchanged but got %v", getURLs(datastores))
+	}
+}
+
+func TestFilterDatastoresByURL(t *testing.T) {
+	datastores := []*cnsvsphere.DatastoreInfo{
+		{Info: &types.DatastoreInfo{Url: "ds:///vmfs/volumes/ds1/"}},
+		{Info: &types.DatastoreInfo{Url: "ds:///vmfs/volumes/ds2/"}},
+		{Info: &types.DatastoreInfo{Url: "ds:///vmfs/volumes/ds3/"}},
+	}
+	tests := []struct {
+		name      string
+		allowList []string
+		denyList  []string
+		expected  []string
+	}{
+		{"allow list only", []string{"ds:///vmfs/volumes/ds1/", "ds:///vmfs/volumes/ds3"}, nil,
+			[]string{"ds:///vmfs/volumes/ds1/", "ds:///vmfs/volumes/ds3/"}},
+		{"deny list only", nil, []string{"ds:///vmfs/volumes/ds2/"},
+			[]string{"ds:///vmfs/volumes/ds1/", "ds:///vmfs/volumes/ds3/"}},
+		{"empty after filter", []string{"ds:///vmfs/volumes/ds1/"}, []string{"ds:///vmfs/volumes/ds1/"}, nil},
+	}
+	for _, test := range tests {
+		var filteredURLs []string
+		for _, ds := range filterDatastoresByURL(datastores, test.allowList, test.denyList) {
+			filteredURLs = append(filteredURLs, ds.Info.Url)
+		}
+		if !reflect.DeepEqual(filteredURLs, test.expected) {
+			t.Errorf("%s: expected datastores %v but got %v", test.name, test.expected, filteredURLs)
+		}
+	}
+
+	// The datastore preselected by a storage pool is checked on its own.
+	if isDatastoreURLAllowed("ds:///vmfs/volumes/ds2", nil, []string{"ds:///vmfs/volumes/ds2/"}) {
+		t.Errorf("expected a denied datastore to be disallowed")
+	}
+	if isDatastoreURLAllowed("ds:///vmfs/volumes/ds2/", []string{"ds:///vmfs/volumes/ds1/"}, nil) {
+		t.Errorf("expected a datastore missing from the allow list to be disallowed")
+	}
+
+	if _, err := parseDatastoreURLList("ds:///vmfs/volumes/ds1/, ds:///vmfs/volumes/ds2/"); err != nil {
+		t.Errorf("expected a valid list of datastore URLs but got %v", err)
+	}
+	if _, err := parseDatastoreURLList("ds:///vmfs/volumes/ds1/,datastore2"); err == nil {
+		t.Errorf("expected an error for a datastore which is not a URL")
+	}
+}
+
+// TestWCPCreateVolumeWithDatastoreDenyList verifies that CreateVolume fails
+// with ResourceExhausted when the deny list excludes all candidate datastores.
+func TestWCPCreateVolumeWithDatastoreDenyList(t *testing.T) {
+	ct := getControllerTest(t)
+	pc, err := pbm.NewClient(ctx, ct.vcenter.Client.Client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// PBM simulator defaults.
+	profileID, err := pc.ProfileIDByName(ctx, "vSAN Default Storage Policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The simulated datastores have URLs without a scheme, which are not
+	// valid in a datastore deny list.
+	defer func() {
+		getCandidateDatastores = getFakeDatastores
+	}()
+	getCandidateDatastores = func(ctx context.Context, vc *cnsvsphere.VirtualCenter,
+		clusterID string) ([]*cnsvsphere.DatastoreInfo, []*cnsvsphere.DatastoreInfo, error) {
+		sharedDatastores, vsanDirectDatastores, err := getFakeDatastores(ctx, vc, clusterID)
+		for _, ds := range append(sharedDatastores, vsanDirectDatastores...) {
+			ds.Info.Url = "ds:///vmfs/volumes/" + ds.Info.Name + "/"
+		}
+		return sharedDatastores, vsanDirectDatastores, err
+	}
+	sharedDatastores, vsanDirectDatastores, err := getCandidateDatastores(ctx, ct.vcenter, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var denyList []string
+	for _, ds := range append(sharedDatastores, vsanDirectDatastores...) {
+		denyList = append(denyList, ds.Info.Url)
+	}
+	reqCreate := &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		Parameters: map[string]string{
+			common.AttributeStoragePolicyID:   profileID,
+			common.AttributeDatastoreDenyList: strings.Join(denyList, ","),
+		},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	}
+	if _, err = ct.controller.CreateVolume(ctx, reqCreate); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted when all datastores are denied but got %v", err)
+	}
+}
+
+// enableSnapshotSupport reports a vCenter version which supports snapshots,
+// as the simulated vCenter has a version of 6.5.0. The returned function
+// restores the original version.
+func enableSnapshotSupport(ct *controllerTest) func() {
+	about := &ct.vcenter.Client.ServiceContent.About
+	version := about.Version
+	about.Version = "7.0.3"
+	return func() {
+		about.Version = version
+	}
+}
+
+// fakeSnapshotVolumeManager serves a fixed set of block volume snapshots and
+// honors the query cursor, which the CNS simulator ignores.
+type fakeSnapshotVolumeManager struct {
+	cnsvolume.Manager
+	snapshots []cnstypes.CnsSnapshot
+}
+
+func (f *fakeSnapshotVolumeManager) QuerySnapshots(ctx context.Context,
+	snapshotQueryFilter cnstypes.CnsSnapshotQueryFilter) (*cnstypes.CnsSnapshotQueryResult, error) {
+	var matching []cnstypes.CnsSnapshot
+	for _, snapshot := range f.snapshots {
+		if len(snapshotQueryFilter.SnapshotQuerySpecs) > 0 {
+			spec := snapshotQueryFilter.SnapshotQuerySpecs[0]
+			if spec.VolumeId.Id != snapshot.VolumeId.Id ||
+				(spec.SnapshotId != nil && spec.SnapshotId.Id != snapshot.SnapshotId.Id) {
+				continue
+			}
+		}
+		matching = append(matching, snapshot)
+	}
+	total := int64(len(matching))
+	offset := snapshotQueryFilter.Cursor.Offset
+	if offset > total {
+		offset = total
+	}
+	end := offset + snapshotQueryFilter.Cursor.Limit
+	if end > total {
+		end = total
+	}
+	result := &cnstypes.CnsSnapshotQueryResult{
+		Cursor: cnstypes.CnsCursor{
+			Offset:       end,
+			Limit:        snapshotQueryFilter.Cursor.Limit,
+			TotalRecords: total,
+		},
+	}
+	for _, snapshot := range matching[offset:end] {
+		result.Entries = append(result.Entries, cnstypes.CnsSnapshotQueryResultEntry{Snapshot: snapshot})
+	}
+	return result, nil
+}
+
+func (f *fakeSnapshotVolumeManager) QueryVolume(ctx context.Context,
+	queryFilter cnstypes.CnsQueryFilter) (*cnstypes.CnsQueryResult, error) {
+	return f.queryBlockVolumes(queryFilter.VolumeIds), nil
+}
+
+func (f *fakeSnapshotVolumeManager) QueryAllVolume(ctx context.Context, queryFilter cnstypes.CnsQueryFilter,
+	querySelection cnstypes.CnsQuerySelection) (*cnstypes.CnsQueryResult, error) {
+	return f.queryBlockVolumes(queryFilter.VolumeIds), nil
+}
+
+func (f *fakeSnapshotVolumeManager) queryBlockVolumes(volumeIds []cnstypes.CnsVolumeId) *cnstypes.CnsQueryResult {
+	result := &cnstypes.CnsQueryResult{}
+	for _, volumeID := range volumeIds {
+		result.Volumes = append(result.Volumes, cnstypes.CnsVolume{
+			VolumeId:   volumeID,
+			VolumeType: common.BlockVolumeType,
+			BackingObjectDetails: &cnstypes.CnsBlockBackingDetails{
+				CnsBackingObjectDetails: cnstypes.CnsBackingObjectDetails{CapacityInMb: 1024},
+			},
+		})
+	}
+	return result
+}
+
+// TestListSnapshots verifies that ListSnapshots filters the snapshots by
+// source volume and snapshot ID and paginates them.
+func TestListSnapshots(t *testing.T) {
+	ct := getControllerTest(t)
+	defer enableSnapshotSupport(ct)()
+
+	volumeManager := ct.controller.manager.VolumeManager
+	fakeVolumeManager := &fakeSnapshotVolumeManager{Manager: volumeManager}
+	for _, id := range []string{"vol-1+snap-1", "vol-1+snap-2", "vol-1+snap-3", "vol-2+snap-1", "vol-2+snap-2"} {
+		volumeID, snapshotID, err := common.ParseCSISnapshotID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fakeVolumeManager.snapshots = append(fakeVolumeManager.snapshots, cnstypes.CnsSnapshot{
+			VolumeId:   cnstypes.CnsVolumeId{Id: volumeID},
+			SnapshotId: cnstypes.CnsSnapshotId{Id: snapshotID},
+		})
+	}
+	ct.controller.manager.VolumeManager = fakeVolumeManager
+	defer func() {
+		ct.controller.manager.VolumeManager = volumeManager
+	}()
+
+	// listAll pages through the snapshots and returns their IDs along with
+	// the next tokens returned.
+	listAll := func(req *csi.ListSnapshotsRequest) ([]string, []string) {
+		var snapshotIDs, tokens []string
+		for {
+			resp, err := ct.controller.ListSnapshots(ctx, req)
+			if err != nil {
+				t.Fatalf("failed to list snapshots with request %+v. Error: %v", req, err)
+			}
+			if req.MaxEntries != 0 && int32(len(resp.Entries)) > req.MaxEntries {
+				t.Fatalf("expected at most %d entries but got %d", req.MaxEntries, len(resp.Entries))
+			}
+			for _, entry := range resp.Entries {
+				if entry.Snapshot.SizeBytes != 1024*common.MbInBytes || !entry.Snapshot.ReadyToUse ||
+					entry.Snapshot.CreationTime == nil {
+					t.Fatalf("unexpected snapshot %+v", entry.Snapshot)
+				}
+				snapshotIDs = append(snapshotIDs, entry.Snapshot.SnapshotId)
+			}
+			tokens = append(tokens, resp.NextToken)
+			if resp.NextToken == "" {
+				return snapshotIDs, tokens
+			}
+			req.StartingToken = resp.NextToken
+		}
+	}
+
+	tests := []struct {
+		name                string
+		req                 *csi.ListSnapshotsRequest
+		expectedSnapshotIDs []string
+		expectedTokens      []string
+	}{
+		{
+			name:                "SourceVolumeFilter",
+			req:                 &csi.ListSnapshotsRequest{SourceVolumeId: "vol-1"},
+			expectedSnapshotIDs: []string{"vol-1+snap-1", "vol-1+snap-2", "vol-1+snap-3"},
+			expectedTokens:      []string{""},
+		},
+		{
+			name:                "SnapshotIDFilter",
+			req:                 &csi.ListSnapshotsRequest{SnapshotId: "vol-2+snap-1"},
+			expectedSnapshotIDs: []string{"vol-2+snap-1"},
+			expectedTokens:      []string{""},
+		},
+		{
+			name: "PaginateAll",
+			req:  &csi.ListSnapshotsRequest{MaxEntries: 2},
+			expectedSnapshotIDs: []string{"vol-1+snap-1", "vol-1+snap-2", "vol-1+snap-3", "vol-2+snap-1",
+				"vol-2+snap-2"},
+			expectedTokens: []string{"2", "4", ""},
+		},
+		{
+			name: "MaxEntriesEqualToTotal",
+			req:  &csi.ListSnapshotsRequest{MaxEntries: 5},
+			expectedSnapshotIDs: []string{"vol-1+snap-1", "vol-1+snap-2", "vol-1+snap-3", "vol-2+snap-1",
+				"vol-2+snap-2"},
+			expectedTokens: []string{""},
+		},
+		{
+			name:                "PaginateSourceVolume",
+			req:                 &csi.ListSnapshotsRequest{SourceVolumeId: "vol-1", MaxEntries: 1},
+			expectedSnapshotIDs: []string{"vol-1+snap-1", "vol-1+snap-2", "vol-1+snap-3"},
+			expectedTokens:      []string{"1", "2", ""},
+		},
+		{
+			name:                "StartingTokenPastEnd",
+			req:                 &csi.ListSnapshotsRequest{MaxEntries: 2, StartingToken: "5"},
+			expectedSnapshotIDs: nil,
+			expectedTokens:      []string{""},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshotIDs, tokens := listAll(test.req)
+			if !reflect.DeepEqual(snapshotIDs, test.expectedSnapshotIDs) {
+				t.Errorf("expected snapshots %v but got %v", test.expectedSnapshotIDs, snapshotIDs)
+			}
+			if !reflect.DeepEqual(tokens, test.expectedTokens) {
+				t.Errorf("expected tokens %q but got %q", test.expectedTokens, tokens)
+			}
+		})
+	}
+
+	// Invalid starting token.
+	_, err := ct.controller.ListSnapshots(ctx, &csi.ListSnapshotsRequest{StartingToken: "invalid"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for invalid starting token but got %v", err)
+	}
+}
+
+// TestSnapshotsDisabled verifies that the snapshot RPCs are neither served nor
+// advertised while the block-volume-snapshot feature is disabled.
+func TestSnapshotsDisabled(t *testing.T) {
+	ct := getControllerTest(t)
+	origCO := commonco.ContainerOrchestratorUtility
+	defer func() {
+		commonco.ContainerOrchestratorUtility = origCO
+	}()
+	fakeCO, err := unittestcommon.GetFakeContainerOrchestratorInterface(common.Kubernetes)
+	if err != nil {
+		t.Fatalf("Failed to create co agnostic interface. err=%v", err)
+	}
+	fakeCO.(*unittestcommon.FakeK8SOrchestrator).SetFSS(common.BlockVolumeSnapshot, false)
+	commonco.ContainerOrchestratorUtility = fakeCO
+
+	_, err = ct.controller.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected Unimplemented error from CreateSnapshot but got: %v", err)
+	}
+	_, err = ct.controller.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected Unimplemented error from DeleteSnapshot but got: %v", err)
+	}
+	_, err = ct.controller.ListSnapshots(ctx, &csi.ListSnapshotsRequest{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected Unimplemented error from ListSnapshots but got: %v", err)
+	}
+	resp, err := ct.controller.ControllerGetCapabilities(ctx, &csi.ControllerGetCapabilitiesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, capability := range resp.Capabilities {
+		switch capability.GetRpc().GetType() {
+		case csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+			csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS:
+			t.Fatalf("%v capability is advertised while %s is disabled", capability.GetRpc().GetType(),
+				common.BlockVolumeSnapshot)
+		}
+	}
+}
+
+// TestCreateDeleteSnapshot verifies that snapshots of block volumes are created
+// idempotently and that deleting a missing snapshot succeeds.
+func TestCreateDeleteSnapshot(t *testing.T) {
+	ct := getControllerTest(t)
+	defer enableSnapshotSupport(ct)()
+	reqCreate := &csi.CreateVolumeRequest{
+		Name: testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 * common.GbInBytes,
+		},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	}
+	getCandidateDatastores = getFakeDatastores
+	respCreate, err := ct.controller.CreateVolume(ctx, reqCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	defer func() {
+		_, _ = ct.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: volID})
+	}()
+
+	// Create.
+	reqCreateSnapshot := &csi.CreateSnapshotRequest{
+		SourceVolumeId: volID,
+		Name:           "snapshot-" + uuid.New().String(),
+	}
+	respCreateSnapshot, err := ct.controller.CreateSnapshot(ctx, reqCreateSnapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := respCreateSnapshot.Snapshot
+	if snapshot.SourceVolumeId != volID || !snapshot.ReadyToUse || snapshot.SizeBytes != 1*common.GbInBytes ||
+		!strings.HasPrefix(snapshot.SnapshotId, volID+common.VSphereCSISnapshotIdDelimiter) {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	// Idempotent create with the same name.
+	respCreateSnapshot, err = ct.controller.CreateSnapshot(ctx, reqCreateSnapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if respCreateSnapshot.Snapshot.SnapshotId != snapshot.SnapshotId {
+		t.Fatalf("expected snapshot %q to be returned again but got %q", snapshot.SnapshotId,
+			respCreateSnapshot.Snapshot.SnapshotId)
+	}
+
+	// Delete.
+	reqDeleteSnapshot := &csi.DeleteSnapshotRequest{SnapshotId: snapshot.SnapshotId}
+	if _, err = ct.controller.DeleteSnapshot(ctx, reqDeleteSnapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete the snapshot which is no longer found.
+	if _, err = ct.controller.DeleteSnapshot(ctx, reqDeleteSnapshot); err != nil {
+		t.Fatalf("expected deleting a missing snapshot to succeed but got %v", err)
+	}
+}
+
+// TestHealthHandlers verifies that the liveness probe handler always reports
+// the controller as live, and that the readiness probe handler reports the
+// controller as ready unless the AvailabilityZone informer has not synced.
+func TestHealthHandlers(t *testing.T) {
+	ct := getControllerTest(t)
+	origCO := commonco.ContainerOrchestratorUtility
+	defer func() {
+		commonco.ContainerOrchestratorUtility = origCO
+	}()
+	fakeCO, err := unittestcommon.GetFakeContainerOrchestratorInterface(common.Kubernetes)
+	if err != nil {
+		t.Fatalf("Failed to create co agnostic interface. err=%v", err)
+	}
+	fakeCO.(*unittestcommon.FakeK8SOrchestrator).SetFSS(common.TKGsHA, true)
+	commonco.ContainerOrchestratorUtility = fakeCO
+
+	tests := []struct {
+		name           string
+		topologyMgr    *fakeZonalTopologyMgr
+		expectedStatus int
+	}{
+		{name: "synced", topologyMgr: &fakeZonalTopologyMgr{}, expectedStatus: http.StatusOK},
+		{name: "unsynced", topologyMgr: &fakeZonalTopologyMgr{unsynced: true},
+			expectedStatus: http.StatusServiceUnavailable},
+		{name: "uninitialized", expectedStatus: http.StatusOK},
+	}
+	for _, test := range tests {
+		c := &controller{manager: ct.controller.manager}
+		if test.topologyMgr != nil {
+			c.topologyMgr = test.topologyMgr
+		}
+		recorder := httptest.NewRecorder()
+		newHealthHandler(c.checkControllerLiveness).ServeHTTP(recorder,
+			httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if recorder.Code != http.StatusOK {
+			t.Errorf("%s: expected status %d for /healthz but got %d with body %q", test.name,
+				http.StatusOK, recorder.Code, recorder.Body.String())
+		}
+		recorder = httptest.NewRecorder()
+		newHealthHandler(c.checkControllerReadiness).ServeHTTP(recorder,
+			httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if recorder.Code != test.expectedStatus {
+			t.Errorf("%s: expected status %d for /readyz but got %d with body %q", test.name,
+				test.expectedStatus, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+// TestGetVMLookupFault verifies that a PodVM which is not found in the
+// datacenter is reported as NotFound while other lookup failures are Internal.
+func TestGetVMLookupFault(t *testing.T) {
+	ct := getControllerTest(t)
+	dc := simulator.Map.Any("Datacenter").Reference().Value
+	_, err := getVMByInstanceUUIDInDatacenter(ctx, ct.vcenter, dc, uuid.New().String())
+	if err == nil {
+		t.Fatal("expected an error for an unknown PodVM")
+	}
+	if faultType, code := getVMLookupFault(err); faultType != csifault.CSIVmNotFoundFault || code != codes.NotFound {
+		t.Errorf("expected fault %q with code %v for an unknown PodVM but got fault %q with code %v",
+			csifault.CSIVmNotFoundFault, codes.NotFound, faultType, code)
+	}
+
+	// A cancelled context fails the request to vCenter.
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = getVMByInstanceUUIDInDatacenter(cancelledCtx, ct.vcenter, dc, uuid.New().String())
+	if err == nil {
+		t.Fatal("expected an error for a failed request to vCenter")
+	}
+	if faultType, code := getVMLookupFault(err); faultType != csifault.CSIInternalFault || code != codes.Internal {
+		t.Errorf("expected fault %q with code %v for a failed request to vCenter but got fault %q with code %v",
+			csifault.CSIInternalFault, codes.Internal, faultType, code)
+	}
+}
+
+// TestGetPublishContextIfAttached verifies that the PublishContext of a volume
+// is returned only when a disk backed by it is attached to the PodVM.
+func TestGetPublishContextIfAttached(t *testing.T) {
+	ct := getControllerTest(t)
+	simVM := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	podVM := &cnsvsphere.VirtualMachine{
+		VirtualMachine: object.NewVirtualMachine(ct.vcenter.Client.Client, simVM.Reference()),
+	}
+	volumeID := uuid.New().String()
+	if publishContext := getPublishContextIfAttached(context.Background(), podVM, volumeID); publishContext != nil {
+		t.Errorf("expected no PublishContext for a volume not attached to the PodVM but got %+v", publishContext)
+	}
+
+	diskUUID := "6000C298-595d-8d19-1c6e-2b5f8d1fb2c7"
+	devices := simVM.Config.Hardware.Device
+	defer func() {
+		simVM.Config.Hardware.Device = devices
+	}()
+	simVM.Config.Hardware.Device = append(append([]types.BaseVirtualDevice{}, devices...), &types.VirtualDisk{
+		VirtualDevice: types.VirtualDevice{
+			Key:     3999,
+			Backing: &types.VirtualDiskFlatVer2BackingInfo{Uuid: diskUUID},
+		},
+		VDiskId: &types.ID{Id: volumeID},
+	})
+	expected := map[string]string{
+		common.AttributeDiskType:           common.DiskTypeBlockVolume,
+		common.AttributeFirstClassDiskUUID: common.FormatDiskUUID(diskUUID),
+	}
+	publishContext := getPublishContextIfAttached(context.Background(), podVM, volumeID)
+	if !reflect.DeepEqual(publishContext, expected) {
+		t.Errorf("expected PublishContext %+v for a volume attached to the PodVM but got %+v", expected,
+			publishContext)
+	}
+}
+
+// TestBatchAttachVolume verifies that an attach request is issued right away
+// when no attach to the PodVM is in progress, and that the requests arriving
+// while an attach is in progress are coalesced into a single CNS attach task.
+func TestBatchAttachVolume(t *testing.T) {
+	attachStarted := make(chan struct{})
+	releaseAttach := make(chan struct{})
+	var attachedBatches [][]string
+	var attachedBatchesLock sync.Mutex
+	patches := gomonkey.ApplyFunc(common.BatchAttachVolumesUtil, func(_ context.Context, _ *common.Manager,
+		_ *cnsvsphere.VirtualMachine, volumeIDs []string, _ bool) (map[string]*cnsvolume.CnsAttachResult,
+		string, error) {
+		attachedBatchesLock.Lock()
+		attachedBatches = append(attachedBatches, volumeIDs)
+		isFirstBatch := len(attachedBatches) == 1
+		attachedBatchesLock.Unlock()
+		if isFirstBatch {
+			close(attachStarted)
+			<-releaseAttach
+		}
+		results := make(map[string]*cnsvolume.CnsAttachResult)
+		for _, volumeID := range volumeIDs {
+			results[volumeID] = &cnsvolume.CnsAttachResult{DiskUUID: "disk-" + volumeID}
+		}
+		return results, "", nil
+	})
+	defer patches.Reset()
+
+	testCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	podVM := &cnsvsphere.VirtualMachine{VirtualMachine: object.NewVirtualMachine(nil,
+		types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-batch"})}
+	diskUUIDs := make(chan string, 3)
+	attach := func(volumeID string) {
+		diskUUID, _, err := batchAttachVolume(testCtx, nil, podVM, volumeID)
+		if err != nil {
+			t.Errorf("unexpected error attaching volume %q: %+v", volumeID, err)
+		}
+		diskUUIDs <- diskUUID
+	}
+
+	go attach("vol-1")
+	select {
+	case <-attachStarted:
+	case <-testCtx.Done():
+		t.Fatal("expected the first volume to be attached without waiting for other requests")
+	}
+	go attach("vol-2")
+	go attach("vol-3")
+	// Wait for both requests to be queued behind the attach in progress.
+	for queued := 0; queued < 2; {
+		time.Sleep(10 * time.Millisecond)
+		pendingAttachBatchesLock.Lock()
+		if batch, exists := pendingAttachBatches[podVM.Reference().Value]; exists {
+			queued = len(batch.waiters)
+		}
+		pendingAttachBatchesLock.Unlock()
+	}
+	close(releaseAttach)
+
+	attached := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		attached[<-diskUUIDs] = true
+	}
+	expectedDiskUUIDs := map[string]bool{"disk-vol-1": true, "disk-vol-2": true, "disk-vol-3": true}
+	if !reflect.DeepEqual(attached, expectedDiskUUIDs) {
+		t.Errorf("expected disk UUIDs %v but got %v", expectedDiskUUIDs, attached)
+	}
+	expectedBatches := [][]string{{"vol-1"}, {"vol-2", "vol-3"}}
+	if !reflect.DeepEqual(attachedBatches, expectedBatches) {
+		t.Errorf("expected attach batches %v but got %v", expectedBatches, attachedBatches)
+	}
+}
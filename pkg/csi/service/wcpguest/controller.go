@@ -134,15 +134,18 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 				}
 				log.Debugf("fsnotify event: %q", event.String())
 				if event.Op&fsnotify.Remove == fsnotify.Remove {
-					for {
-						reloadConfigErr := c.ReloadConfiguration()
-						if reloadConfigErr == nil {
-							log.Infof("Successfully reloaded configuration from: %q", pvcsiConfigPath)
-							break
-						}
-						log.Errorf("failed to reload configuration. will retry again in 5 seconds. err: %+v", reloadConfigErr)
-						time.Sleep(5 * time.Second)
-					}
+					common.RetryWithBackoff(common.GetReloadConfigBackoff(config), c.ReloadConfiguration,
+						func(reloadConfigErr error, wait time.Duration) {
+							prometheus.ReloadConfigOpsCounterVec.WithLabelValues(
+								prometheus.PrometheusReloadConfigTriggerConfigChange, prometheus.PrometheusFailStatus).Inc()
+							log.Errorf("failed to reload configuration. will retry again in %v. err: %+v", wait,
+								reloadConfigErr)
+						})
+					log.Infof("Successfully reloaded configuration from: %q", pvcsiConfigPath)
+					prometheus.ReloadConfigOpsCounterVec.WithLabelValues(
+						prometheus.PrometheusReloadConfigTriggerConfigChange, prometheus.PrometheusPassStatus).Inc()
+					prometheus.ReloadConfigLastSuccessGaugeVec.WithLabelValues(
+						prometheus.PrometheusReloadConfigTriggerConfigChange).SetToCurrentTime()
 				}
 			case err, ok := <-watcher.Errors:
 				if !ok {
@@ -166,13 +169,17 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 		log.Errorf("failed to watch on path: %q. err=%v", cnsconfig.DefaultpvCSIProviderPath, err)
 		return err
 	}
+	// Expose the feature state switches seen by the controller to help debug.
+	commonco.RegisterFeatureStatesHandler(ctx)
+	common.StartDebugServer(ctx)
 	// Go module to keep the metrics http server running all the time.
+	metricsAddress := common.GetPrometheusMetricsAddress(ctx, config)
 	go func() {
 		prometheus.CsiInfo.WithLabelValues(version).Set(1)
 		for {
 			log.Info("Starting the http server to expose Prometheus metrics..")
 			http.Handle("/metrics", promhttp.Handler())
-			err = http.ListenAndServe(":2112", nil)
+			err = http.ListenAndServe(metricsAddress, nil)
 			if err != nil {
 				log.Warnf("Http server that exposes the Prometheus exited with err: %+v", err)
 			}
@@ -371,12 +378,14 @@ func (c *controller) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequ
 				}
 				resp.Volume.AccessibleTopology = append(resp.Volume.AccessibleTopology, volumeTopology)
 			}
+			common.SortAccessibleTopology(resp.Volume.AccessibleTopology)
 		}
 		return resp, "", nil
 	}
 	resp, faultType, err := createVolumeInternal()
 	log.Debugf("createVolumeInternal: returns fault %q", faultType)
 	if err != nil {
+		common.SetRetryAfterTrailer(ctx, err)
 		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusCreateVolumeOpType,
 			prometheus.PrometheusFailStatus, namespace, faultType).Observe(time.Since(start).Seconds())
 	} else {
@@ -1313,3 +1322,10 @@ func (c *controller) ControllerGetVolume(ctx context.Context, req *csi.Controlle
 	*csi.ControllerGetVolumeResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "")
 }
+
+// ControllerModifyVolume is not supported, as volumes are not advertised as
+// modifiable in the controller capabilities.
+func (c *controller) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (
+	*csi.ControllerModifyVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
@@ -144,10 +144,12 @@ func (or *operationRequestStore) GetRequestDetails(
 	// Callers only need to know about the last operation that was invoked on a volume.
 	operationDetailsToReturn := instance.Status.LatestOperationDetails[len(instance.Status.LatestOperationDetails)-1]
 
-	return CreateVolumeOperationRequestDetails(instance.Spec.Name, instance.Status.VolumeID, instance.Status.SnapshotID,
-			instance.Status.Capacity, operationDetailsToReturn.TaskInvocationTimestamp, operationDetailsToReturn.TaskID,
-			operationDetailsToReturn.OpID, operationDetailsToReturn.TaskStatus, operationDetailsToReturn.Error),
-		nil
+	requestDetails := CreateVolumeOperationRequestDetails(instance.Spec.Name, instance.Status.VolumeID,
+		instance.Status.SnapshotID, instance.Status.Capacity, operationDetailsToReturn.TaskInvocationTimestamp,
+		operationDetailsToReturn.TaskID, operationDetailsToReturn.OpID, operationDetailsToReturn.TaskStatus,
+		operationDetailsToReturn.Error)
+	requestDetails.OperationDetails.FailureReason = operationDetailsToReturn.FailureReason
+	return requestDetails, nil
 }
 
 // StoreRequestDetails persists the details of the operation taking
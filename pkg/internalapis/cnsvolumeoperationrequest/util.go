@@ -32,6 +32,17 @@ const (
 	TaskInvocationStatusError = "Error"
 	// TaskInvocationStatusSuccess represents a task thats status is Success.
 	TaskInvocationStatusSuccess = "Success"
+	// FailureReasonNoDatastores represents a CreateVolume failure due to no
+	// candidate datastores being available for the volume.
+	FailureReasonNoDatastores = "no-datastores"
+	// FailureReasonZoneUnregistered represents a CreateVolume failure due to
+	// the requested zones not being registered with the cluster.
+	FailureReasonZoneUnregistered = "zone-unregistered"
+	// FailureReasonPolicyInvalid represents a CreateVolume failure due to the
+	// storage policy not being usable for the volume.
+	FailureReasonPolicyInvalid = "policy-invalid"
+	// FailureReasonCnsError represents a failure returned by CNS.
+	FailureReasonCnsError = "cns-error"
 )
 
 // VolumeOperationRequestDetails stores details about a single operation
@@ -53,6 +64,7 @@ type OperationDetails struct {
 	OpID                    string
 	TaskStatus              string
 	Error                   string
+	FailureReason           string
 }
 
 // CreateVolumeOperationRequestDetails returns an object of type
@@ -85,5 +97,6 @@ func convertToCnsVolumeOperationRequestDetails(
 		OpID:                    details.OpID,
 		TaskStatus:              details.TaskStatus,
 		Error:                   details.Error,
+		FailureReason:           details.FailureReason,
 	}
 }
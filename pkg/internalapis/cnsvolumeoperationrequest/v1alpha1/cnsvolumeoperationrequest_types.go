@@ -65,6 +65,10 @@ type OperationDetails struct {
 	// Error represents the error returned if the task fails on CNS.
 	// Defaults to empty string.
 	Error string `json:"error,omitempty"`
+	// FailureReason classifies why the operation failed. Valid strings are
+	// "no-datastores", "zone-unregistered", "policy-invalid" and "cns-error".
+	// Defaults to empty string.
+	FailureReason string `json:"failureReason,omitempty"`
 }
 
 //+kubebuilder:object:root=true
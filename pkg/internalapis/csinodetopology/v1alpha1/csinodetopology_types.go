@@ -39,6 +39,11 @@ const (
 	CSINodeTopologyError CRDStatus = "Error"
 )
 
+// RefreshTopologyLabelsAnnotation is set on a CSINodeTopology instance to
+// request the re-computation of its topology labels. A change in its value
+// triggers a new reconciliation of the instance.
+const RefreshTopologyLabelsAnnotation = "csinodetopology.cns.vmware.com/refresh-topology-labels"
+
 // CSINodeTopologyStatus defines the observed state of CSINodeTopology.
 type CSINodeTopologyStatus struct {
 	// Status can have the following values: "Success", "Error".
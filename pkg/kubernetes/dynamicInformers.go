@@ -25,6 +25,7 @@ import (
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 
 	"sigs.k8s.io/vsphere-csi-driver/v2/pkg/csi/service/logger"
 )
@@ -102,3 +103,20 @@ func GetDynamicInformer(ctx context.Context, crdGroup, crdVersion, crdName, name
 	gvr := schema.GroupVersionResource{Group: crdGroup, Version: crdVersion, Resource: crdName}
 	return dynamicInformerFactory.ForResource(gvr), nil
 }
+
+// NewDynamicInformer returns a new informer for specified CRD group, version,
+// name and namespace using the given configuration. Unlike the informers
+// returned by GetDynamicInformer, it is not shared, so it can be stopped and
+// created again without affecting other users of the resource.
+func NewDynamicInformer(ctx context.Context, crdGroup, crdVersion, crdName, namespace string,
+	cfg *restclient.Config) (informers.GenericInformer, error) {
+	log := logger.GetLogger(ctx)
+	dc, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		log.Errorf("could not generate dynamic client for config. Error :%v", err)
+		return nil, err
+	}
+	gvr := schema.GroupVersionResource{Group: crdGroup, Version: crdVersion, Resource: crdName}
+	return dynamicinformer.NewFilteredDynamicInformer(dc, gvr, namespace, 0,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, nil), nil
+}
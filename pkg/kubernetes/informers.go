@@ -199,6 +199,11 @@ func (im *InformerManager) GetConfigMapLister() corelisters.ConfigMapLister {
 	return im.informerFactory.Core().V1().ConfigMaps().Lister()
 }
 
+// GetNodeLister returns Node Lister for the calling informer manager.
+func (im *InformerManager) GetNodeLister() corelisters.NodeLister {
+	return im.informerFactory.Core().V1().Nodes().Lister()
+}
+
 // GetPodLister returns Pod Lister for the calling informer manager.
 func (im *InformerManager) GetPodLister() corelisters.PodLister {
 	return im.informerFactory.Core().V1().Pods().Lister()
@@ -46,17 +46,15 @@ const (
 	volumeExpansionErrorMessage = "AllowVolumeExpansion can not be set to true on the in-tree vSphere StorageClass"
 	migrationParamErrorMessage  = "Invalid StorageClass Parameters. " +
 		"Migration specific parameters should not be used in the StorageClass"
+	topologyParamErrorMessagePrefix = "Invalid StorageClass Parameters. "
 )
 
 // validateStorageClass helps validate AdmissionReview requests for StroageClass.
 func validateStorageClass(ctx context.Context, ar *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
-	if containerOrchestratorUtility != nil && !containerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIMigration) {
-		// If CSI migration is disabled and webhook is running,
-		// skip validation for StorageClass.
-		return &admissionv1.AdmissionResponse{
-			Allowed: true,
-		}
-	}
+	// If CSI migration is disabled and webhook is running, skip migration
+	// specific validation for StorageClass.
+	isMigrationEnabled := containerOrchestratorUtility == nil ||
+		containerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIMigration)
 	log := logger.GetLogger(ctx)
 	req := ar.Request
 	var result *metav1.Status
@@ -76,7 +74,7 @@ func validateStorageClass(ctx context.Context, ar *admissionv1.AdmissionReview)
 		}
 		log.Infof("Validating StorageClass: %q", sc.Name)
 		// AllowVolumeExpansion check for kubernetes.io/vsphere-volume provisioner.
-		if sc.Provisioner == "kubernetes.io/vsphere-volume" {
+		if sc.Provisioner == "kubernetes.io/vsphere-volume" && isMigrationEnabled {
 			if sc.AllowVolumeExpansion != nil && *sc.AllowVolumeExpansion {
 				allowed = false
 				result = &metav1.Status{
@@ -85,13 +83,24 @@ func validateStorageClass(ctx context.Context, ar *admissionv1.AdmissionReview)
 			}
 		} else if sc.Provisioner == "csi.vsphere.vmware.com" {
 			// Migration parameters check for csi.vsphere.vmware.com provisioner.
-			for param := range sc.Parameters {
-				if unSupportedParameters.Has(param) {
+			if isMigrationEnabled {
+				for param := range sc.Parameters {
+					if unSupportedParameters.Has(param) {
+						allowed = false
+						result = &metav1.Status{
+							Reason: migrationParamErrorMessage,
+						}
+						break
+					}
+				}
+			}
+			// Topology parameters check for csi.vsphere.vmware.com provisioner.
+			if allowed {
+				if err := common.ValidateStorageClassTopologyParams(sc.Parameters); err != nil {
 					allowed = false
 					result = &metav1.Status{
-						Reason: migrationParamErrorMessage,
+						Reason: metav1.StatusReason(topologyParamErrorMessagePrefix + err.Error()),
 					}
-					break
 				}
 			}
 		}
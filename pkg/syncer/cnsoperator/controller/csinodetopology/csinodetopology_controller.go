@@ -172,7 +172,15 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		UpdateFunc: func(e event.UpdateEvent) bool {
 			// The CO calls NodeGetInfo API just once during the node registration,
 			// therefore we do not support updates to the spec after the CR has
-			// been reconciled.
+			// been reconciled. The topology labels are only re-computed when a
+			// refresh is explicitly requested through an annotation.
+			oldValue := e.ObjectOld.GetAnnotations()[csinodetopologyv1alpha1.RefreshTopologyLabelsAnnotation]
+			newValue := e.ObjectNew.GetAnnotations()[csinodetopologyv1alpha1.RefreshTopologyLabelsAnnotation]
+			if oldValue != newValue {
+				log.Infof("Refresh of topology labels requested for CSINodeTopology instance %q",
+					e.ObjectNew.GetName())
+				return true
+			}
 			log.Debug("Ignoring CSINodeTopology reconciliation on update event")
 			return false
 		},
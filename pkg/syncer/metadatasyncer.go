@@ -262,15 +262,13 @@ func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFl
 				}
 				log.Debugf("fsnotify event: %q", event.String())
 				if event.Op&fsnotify.Remove == fsnotify.Remove {
-					for {
-						reloadConfigErr := ReloadConfiguration(metadataSyncer, false)
-						if reloadConfigErr == nil {
-							log.Infof("Successfully reloaded configuration from: %q", cfgPath)
-							break
-						}
-						log.Errorf("failed to reload configuration will retry again in 5 seconds. err: %+v", reloadConfigErr)
-						time.Sleep(5 * time.Second)
-					}
+					common.RetryWithBackoff(common.GetReloadConfigBackoff(metadataSyncer.configInfo.Cfg), func() error {
+						return ReloadConfiguration(metadataSyncer, false)
+					}, func(reloadConfigErr error, wait time.Duration) {
+						log.Errorf("failed to reload configuration will retry again in %v. err: %+v", wait,
+							reloadConfigErr)
+					})
+					log.Infof("Successfully reloaded configuration from: %q", cfgPath)
 				}
 				// Handling create event for reconnecting to VC when ca file is
 				// rotated. In Supervisor cluster, ca file gets rotated at the path
@@ -281,17 +279,14 @@ func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFl
 				// event. The conditions below also ensures that the event is for
 				// the expected ca file path.
 				if event.Op&fsnotify.Create == fsnotify.Create && event.Name == cnsconfig.SupervisorCAFilePath {
-					for {
-						reconnectVCErr := ReloadConfiguration(metadataSyncer, true)
-						if reconnectVCErr == nil {
-							log.Infof("Successfully re-established connection with VC from: %q",
-								cnsconfig.SupervisorCAFilePath)
-							break
-						}
-						log.Errorf("failed to re-establish VC connection. Will retry again in 60 seconds. err: %+v",
+					common.RetryWithBackoff(common.GetReloadConfigBackoff(metadataSyncer.configInfo.Cfg), func() error {
+						return ReloadConfiguration(metadataSyncer, true)
+					}, func(reconnectVCErr error, wait time.Duration) {
+						log.Errorf("failed to re-establish VC connection. Will retry again in %v. err: %+v", wait,
 							reconnectVCErr)
-						time.Sleep(60 * time.Second)
-					}
+					})
+					log.Infof("Successfully re-established connection with VC from: %q",
+						cnsconfig.SupervisorCAFilePath)
 				}
 			case err, ok := <-watcher.Errors:
 				if !ok {